@@ -0,0 +1,449 @@
+package bigquery
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	nurl "net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/hashicorp/go-multierror"
+	uatomic "go.uber.org/atomic"
+	bq "google.golang.org/api/bigquery/v2"
+	"google.golang.org/api/option"
+
+	"github.com/golang-migrate/migrate/v4/database"
+)
+
+func init() {
+	database.Register("bigquery", &BigQuery{})
+}
+
+// DefaultMigrationsTable is used if no custom table is specified
+const DefaultMigrationsTable = "schema_migrations"
+
+// DefaultLockTable is used if no custom lock table is specified
+const DefaultLockTable = "schema_migrations_lock"
+
+// Driver errors
+var (
+	ErrNilConfig     = errors.New("no config")
+	ErrNoProjectID   = errors.New("no project id")
+	ErrNoDatasetID   = errors.New("no dataset id")
+	ErrLockHeld      = errors.New("unable to obtain lock")
+	ErrLockNotHeld   = errors.New("unable to release already released lock")
+	errQueryNotReady = errors.New("query did not complete")
+)
+
+// Config used for a BigQuery instance
+type Config struct {
+	ProjectID       string
+	DatasetID       string
+	MigrationsTable string
+	// LockTable holds a row per migrations table, locked while migrating
+	// to guard against concurrent migrations from other processes.
+	// Defaults to DefaultLockTable.
+	LockTable string
+}
+
+// Client runs queries and manages tables of BigQuery. NewClient returns
+// one for the BigQuery API, tests can use a fake one.
+type Client interface {
+	// Query runs the GoogleSQL query or script with the named params and
+	// waits for it to complete.
+	Query(ctx context.Context, query string, params []*bq.QueryParameter) (*QueryResult, error)
+	// ListTables returns the ids of the tables in the dataset.
+	ListTables(ctx context.Context, datasetID string) ([]string, error)
+	// DeleteTable deletes a table of the dataset.
+	DeleteTable(ctx context.Context, datasetID string, tableID string) error
+}
+
+// QueryResult is the result of a completed query.
+type QueryResult struct {
+	Rows         []*bq.TableRow
+	AffectedRows int64
+}
+
+// BigQuery implements database.Driver for Google BigQuery. BigQuery has no
+// transactions for DDL, so a failed migration may be partially applied.
+type BigQuery struct {
+	client Client
+	config *Config
+
+	lock *uatomic.Bool
+}
+
+// WithInstance implements database.Driver
+func WithInstance(client Client, config *Config) (database.Driver, error) {
+	if config == nil {
+		return nil, ErrNilConfig
+	}
+
+	if len(config.ProjectID) == 0 {
+		return nil, ErrNoProjectID
+	}
+
+	if len(config.DatasetID) == 0 {
+		return nil, ErrNoDatasetID
+	}
+
+	if len(config.MigrationsTable) == 0 {
+		config.MigrationsTable = DefaultMigrationsTable
+	}
+
+	if len(config.LockTable) == 0 {
+		config.LockTable = DefaultLockTable
+	}
+
+	b := &BigQuery{
+		client: client,
+		config: config,
+		lock:   uatomic.NewBool(false),
+	}
+
+	if err := b.ensureTables(); err != nil {
+		return nil, err
+	}
+
+	return b, nil
+}
+
+// Open implements database.Driver. The URL has the form
+// bigquery://project/dataset.
+func (b *BigQuery) Open(url string) (database.Driver, error) {
+	purl, err := nurl.Parse(url)
+	if err != nil {
+		return nil, err
+	}
+
+	var opts []option.ClientOption
+	if endpoint := purl.Query().Get("x-endpoint"); endpoint != "" {
+		// e.g. an emulator, which doesn't authenticate
+		opts = append(opts, option.WithEndpoint(endpoint), option.WithoutAuthentication())
+	} else if file := purl.Query().Get("credentials-file"); file != "" {
+		opts = append(opts, option.WithCredentialsFile(file))
+	}
+
+	client, err := NewClient(context.Background(), purl.Host, opts...)
+	if err != nil {
+		return nil, err
+	}
+
+	return WithInstance(client, &Config{
+		ProjectID:       purl.Host,
+		DatasetID:       strings.Trim(purl.Path, "/"),
+		MigrationsTable: purl.Query().Get("x-migrations-table"),
+		LockTable:       purl.Query().Get("x-lock-table"),
+	})
+}
+
+// Close implements database.Driver
+func (b *BigQuery) Close() error {
+	return nil
+}
+
+// Capabilities implements database.CapabilitiesDriver.
+// Migrations may contain multiple statements, which BigQuery runs as a
+// script. DDL is not transactional, so a failed migration may be partially
+// applied and can't be rolled back.
+func (b *BigQuery) Capabilities() database.Capabilities {
+	return database.Capabilities{
+		SupportsMultiStatement: true,
+		SupportsLocking:        true,
+	}
+}
+
+// Describe implements database.Describer.
+func (b *BigQuery) Describe() (database.DriverInfo, error) {
+	return database.DriverInfo{
+		Name:         "bigquery",
+		Capabilities: b.Capabilities(),
+	}, nil
+}
+
+// Lock implements database.Driver. The lock row is set to locked in a
+// transaction, which sets nothing if another process holds the lock and
+// fails if another process locks it at the same time.
+func (b *BigQuery) Lock() error {
+	return database.CasRestoreOnErr(b.lock, false, true, ErrLockHeld, func() error {
+		query := `DECLARE acquired INT64 DEFAULT 0;
+BEGIN TRANSACTION;
+MERGE ` + b.table(b.config.LockTable) + ` T
+USING (SELECT @lock_id AS lock_id) S ON T.lock_id = S.lock_id
+WHEN NOT MATCHED THEN INSERT (lock_id, locked) VALUES (S.lock_id, true)
+WHEN MATCHED AND NOT T.locked THEN UPDATE SET locked = true;
+SET acquired = @@row_count;
+COMMIT TRANSACTION;
+SELECT acquired;`
+		res, err := b.client.Query(context.Background(), query, b.lockParams())
+		if err != nil {
+			return &database.Error{OrigErr: err, Err: "try lock failed", Query: []byte(query)}
+		}
+		if len(res.Rows) == 0 || len(res.Rows[0].F) == 0 || fmt.Sprint(res.Rows[0].F[0].V) == "0" {
+			return ErrLockHeld
+		}
+		return nil
+	})
+}
+
+// Unlock implements database.Driver
+func (b *BigQuery) Unlock() error {
+	return database.CasRestoreOnErr(b.lock, true, false, ErrLockNotHeld, func() error {
+		query := `BEGIN TRANSACTION;
+UPDATE ` + b.table(b.config.LockTable) + ` SET locked = false WHERE lock_id = @lock_id;
+COMMIT TRANSACTION;`
+		if _, err := b.client.Query(context.Background(), query, b.lockParams()); err != nil {
+			return &database.Error{OrigErr: err, Query: []byte(query)}
+		}
+		return nil
+	})
+}
+
+// lockParams identifies the lock row by the migrations table, so that
+// migrations tables sharing a lock table are locked separately.
+func (b *BigQuery) lockParams() []*bq.QueryParameter {
+	return []*bq.QueryParameter{param("lock_id", "STRING", b.config.MigrationsTable)}
+}
+
+// Run implements database.Driver. Migrations with multiple statements are
+// run as a script, which is not atomic.
+func (b *BigQuery) Run(migration io.Reader) error {
+	migr, err := io.ReadAll(migration)
+	if err != nil {
+		return err
+	}
+	if len(strings.TrimSpace(string(migr))) == 0 {
+		return nil
+	}
+
+	if _, err := b.client.Query(context.Background(), string(migr), nil); err != nil {
+		return &database.Error{OrigErr: err, Err: "migration failed", Query: migr}
+	}
+	return nil
+}
+
+// SetVersion implements database.Driver
+func (b *BigQuery) SetVersion(version int, dirty bool) error {
+	table := b.table(b.config.MigrationsTable)
+	query := `BEGIN TRANSACTION;
+DELETE FROM ` + table + ` WHERE true;
+`
+	var params []*bq.QueryParameter
+
+	// Also re-write the schema version for nil dirty versions to prevent
+	// empty schema version for failed down migration on the first migration
+	// See: https://github.com/golang-migrate/migrate/issues/330
+	if version >= 0 || (version == database.NilVersion && dirty) {
+		query += `INSERT INTO ` + table + ` (version, dirty) VALUES (@version, @dirty);
+`
+		params = []*bq.QueryParameter{
+			param("version", "INT64", strconv.Itoa(version)),
+			param("dirty", "BOOL", strconv.FormatBool(dirty)),
+		}
+	}
+	query += `COMMIT TRANSACTION;`
+
+	if _, err := b.client.Query(context.Background(), query, params); err != nil {
+		return &database.Error{OrigErr: err, Query: []byte(query)}
+	}
+	return nil
+}
+
+// Version implements database.Driver
+func (b *BigQuery) Version() (version int, dirty bool, err error) {
+	query := `SELECT version, dirty FROM ` + b.table(b.config.MigrationsTable) + ` LIMIT 1`
+	res, err := b.client.Query(context.Background(), query, nil)
+	if err != nil {
+		return 0, false, &database.Error{OrigErr: err, Query: []byte(query)}
+	}
+	if len(res.Rows) == 0 {
+		return database.NilVersion, false, nil
+	}
+
+	row := res.Rows[0]
+	if len(row.F) != 2 {
+		return 0, false, &database.Error{OrigErr: fmt.Errorf("expected 2 columns, got %d", len(row.F)), Query: []byte(query)}
+	}
+	v, err := strconv.Atoi(fmt.Sprint(row.F[0].V))
+	if err != nil {
+		return 0, false, &database.Error{OrigErr: err, Query: []byte(query)}
+	}
+	dirty, err = strconv.ParseBool(fmt.Sprint(row.F[1].V))
+	if err != nil {
+		return 0, false, &database.Error{OrigErr: err, Query: []byte(query)}
+	}
+	return v, dirty, nil
+}
+
+// Drop implements database.Driver. It deletes the tables of the dataset,
+// except for the lock table.
+func (b *BigQuery) Drop() error {
+	return b.drop(context.Background(), false)
+}
+
+// DropWithOptions implements database.DropOptionsDriver.
+func (b *BigQuery) DropWithOptions(ctx context.Context, opts database.DropOptions) error {
+	return b.drop(ctx, opts.KeepMigrationsTable)
+}
+
+// DropList implements database.DropLister.
+func (b *BigQuery) DropList(ctx context.Context, opts database.DropOptions) ([]string, error) {
+	return b.dropTables(ctx, opts.KeepMigrationsTable)
+}
+
+// dropTables returns the tables drop deletes.
+func (b *BigQuery) dropTables(ctx context.Context, keepMigrationsTable bool) ([]string, error) {
+	tables, err := b.client.ListTables(ctx, b.config.DatasetID)
+	if err != nil {
+		return nil, &database.Error{OrigErr: err, Err: "drop failed"}
+	}
+
+	var drop []string
+	for _, t := range tables {
+		if t == b.config.LockTable || (keepMigrationsTable && t == b.config.MigrationsTable) {
+			continue
+		}
+		drop = append(drop, t)
+	}
+	return drop, nil
+}
+
+func (b *BigQuery) drop(ctx context.Context, keepMigrationsTable bool) error {
+	tables, err := b.dropTables(ctx, keepMigrationsTable)
+	if err != nil {
+		return err
+	}
+
+	for _, t := range tables {
+		if err := b.client.DeleteTable(ctx, b.config.DatasetID, t); err != nil {
+			return &database.Error{OrigErr: err, Err: "drop failed on table " + t}
+		}
+	}
+	return nil
+}
+
+// ensureTables creates the migrations table and the lock table if they
+// don't exist. Note that this function locks the database, which deviates
+// from the usual convention of "caller locks" in the BigQuery type.
+func (b *BigQuery) ensureTables() (err error) {
+	// the lock table has to exist before locking
+	query := `CREATE TABLE IF NOT EXISTS ` + b.table(b.config.LockTable) + ` (lock_id STRING NOT NULL, locked BOOL NOT NULL)`
+	if _, err := b.client.Query(context.Background(), query, nil); err != nil {
+		return &database.Error{OrigErr: err, Query: []byte(query)}
+	}
+
+	if err = b.Lock(); err != nil {
+		return err
+	}
+
+	defer func() {
+		if e := b.Unlock(); e != nil {
+			if err == nil {
+				err = e
+			} else {
+				err = multierror.Append(err, e)
+			}
+		}
+	}()
+
+	query = `CREATE TABLE IF NOT EXISTS ` + b.table(b.config.MigrationsTable) + ` (version INT64 NOT NULL, dirty BOOL NOT NULL)`
+	if _, err := b.client.Query(context.Background(), query, nil); err != nil {
+		return &database.Error{OrigErr: err, Query: []byte(query)}
+	}
+	return nil
+}
+
+// table returns the quoted, fully qualified name of a table of the dataset.
+func (b *BigQuery) table(name string) string {
+	return "`" + b.config.ProjectID + "." + b.config.DatasetID + "." + name + "`"
+}
+
+// param returns a named query parameter.
+func param(name string, typ string, value string) *bq.QueryParameter {
+	return &bq.QueryParameter{
+		Name:           name,
+		ParameterType:  &bq.QueryParameterType{Type: typ},
+		ParameterValue: &bq.QueryParameterValue{Value: value},
+	}
+}
+
+// apiClient implements Client with the BigQuery API.
+type apiClient struct {
+	service   *bq.Service
+	projectID string
+}
+
+// NewClient returns a Client for the BigQuery API, running the queries in
+// the project.
+func NewClient(ctx context.Context, projectID string, opts ...option.ClientOption) (Client, error) {
+	service, err := bq.NewService(ctx, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return &apiClient{service: service, projectID: projectID}, nil
+}
+
+// queryPollInterval is how long to wait between polls of a running query.
+var queryPollInterval = time.Second
+
+func (c *apiClient) Query(ctx context.Context, query string, params []*bq.QueryParameter) (*QueryResult, error) {
+	useLegacySQL := false
+	req := &bq.QueryRequest{
+		Query:           query,
+		UseLegacySql:    &useLegacySQL,
+		QueryParameters: params,
+	}
+	if len(params) > 0 {
+		req.ParameterMode = "NAMED"
+	}
+
+	resp, err := c.service.Jobs.Query(c.projectID, req).Context(ctx).Do()
+	if err != nil {
+		return nil, err
+	}
+	if resp.JobComplete {
+		return &QueryResult{Rows: resp.Rows, AffectedRows: resp.NumDmlAffectedRows}, nil
+	}
+	if resp.JobReference == nil {
+		return nil, errQueryNotReady
+	}
+
+	// poll until the query completes
+	for {
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-time.After(queryPollInterval):
+		}
+
+		res, err := c.service.Jobs.GetQueryResults(c.projectID, resp.JobReference.JobId).
+			Location(resp.JobReference.Location).Context(ctx).Do()
+		if err != nil {
+			return nil, err
+		}
+		if res.JobComplete {
+			return &QueryResult{Rows: res.Rows, AffectedRows: res.NumDmlAffectedRows}, nil
+		}
+	}
+}
+
+func (c *apiClient) ListTables(ctx context.Context, datasetID string) ([]string, error) {
+	var tables []string
+	err := c.service.Tables.List(c.projectID, datasetID).Pages(ctx, func(page *bq.TableList) error {
+		for _, t := range page.Tables {
+			tables = append(tables, t.TableReference.TableId)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return tables, nil
+}
+
+func (c *apiClient) DeleteTable(ctx context.Context, datasetID string, tableID string) error {
+	return c.service.Tables.Delete(c.projectID, datasetID, tableID).Context(ctx).Do()
+}
@@ -0,0 +1,278 @@
+package bigquery
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	bq "google.golang.org/api/bigquery/v2"
+	"google.golang.org/api/option"
+
+	"github.com/golang-migrate/migrate/v4/database"
+)
+
+// fakeClient records the queries and answers them with results.
+type fakeClient struct {
+	queries []string
+	params  [][]*bq.QueryParameter
+	// results are returned for queries starting with the key
+	results map[string]*QueryResult
+	err     error
+	// lockHeld makes locking find the lock held by another process
+	lockHeld bool
+
+	tables  []string
+	deleted []string
+}
+
+func (c *fakeClient) Query(ctx context.Context, query string, params []*bq.QueryParameter) (*QueryResult, error) {
+	c.queries = append(c.queries, query)
+	c.params = append(c.params, params)
+	if c.err != nil {
+		return nil, c.err
+	}
+	if strings.HasPrefix(query, "DECLARE acquired") {
+		acquired := "1"
+		if c.lockHeld {
+			acquired = "0"
+		}
+		return &QueryResult{Rows: []*bq.TableRow{{F: []*bq.TableCell{{V: acquired}}}}}, nil
+	}
+	for prefix, res := range c.results {
+		if strings.HasPrefix(query, prefix) {
+			return res, nil
+		}
+	}
+	return &QueryResult{}, nil
+}
+
+func (c *fakeClient) ListTables(ctx context.Context, datasetID string) ([]string, error) {
+	return c.tables, nil
+}
+
+func (c *fakeClient) DeleteTable(ctx context.Context, datasetID string, tableID string) error {
+	c.deleted = append(c.deleted, datasetID+"."+tableID)
+	return nil
+}
+
+func newFake(t *testing.T, client *fakeClient, config *Config) *BigQuery {
+	t.Helper()
+	d, err := WithInstance(client, config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	client.queries, client.params = nil, nil
+	return d.(*BigQuery)
+}
+
+func TestWithInstance(t *testing.T) {
+	client := &fakeClient{}
+	if _, err := WithInstance(client, &Config{ProjectID: "p", DatasetID: "d"}); err != nil {
+		t.Fatal(err)
+	}
+
+	expected := []string{
+		"CREATE TABLE IF NOT EXISTS `p.d.schema_migrations_lock` (lock_id STRING NOT NULL, locked BOOL NOT NULL)",
+		"DECLARE acquired INT64 DEFAULT 0;\nBEGIN TRANSACTION;\nMERGE `p.d.schema_migrations_lock`",
+		"CREATE TABLE IF NOT EXISTS `p.d.schema_migrations` (version INT64 NOT NULL, dirty BOOL NOT NULL)",
+		"BEGIN TRANSACTION;\nUPDATE `p.d.schema_migrations_lock` SET locked = false WHERE lock_id = @lock_id;",
+	}
+	if len(client.queries) != len(expected) {
+		t.Fatalf("expected %d queries, got %q", len(expected), client.queries)
+	}
+	for i, q := range expected {
+		if !strings.HasPrefix(client.queries[i], q) {
+			t.Errorf("expected query %d to start with %q, got %q", i, q, client.queries[i])
+		}
+	}
+
+	for _, config := range []*Config{nil, {DatasetID: "d"}, {ProjectID: "p"}} {
+		if _, err := WithInstance(&fakeClient{}, config); err == nil {
+			t.Errorf("expected an error for %+v", config)
+		}
+	}
+}
+
+func TestVersion(t *testing.T) {
+	client := &fakeClient{}
+	b := newFake(t, client, &Config{ProjectID: "p", DatasetID: "d"})
+
+	if v, dirty, err := b.Version(); err != nil || v != database.NilVersion || dirty {
+		t.Errorf("expected nil version, got %v, %v, %v", v, dirty, err)
+	}
+
+	client.results = map[string]*QueryResult{"SELECT": {Rows: []*bq.TableRow{
+		{F: []*bq.TableCell{{V: "3"}, {V: "true"}}},
+	}}}
+	if v, dirty, err := b.Version(); err != nil || v != 3 || !dirty {
+		t.Errorf("expected dirty version 3, got %v, %v, %v", v, dirty, err)
+	}
+}
+
+func TestSetVersion(t *testing.T) {
+	client := &fakeClient{}
+	b := newFake(t, client, &Config{ProjectID: "p", DatasetID: "d", MigrationsTable: "versions"})
+
+	if err := b.SetVersion(2, true); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(client.queries[0], "DELETE FROM `p.d.versions` WHERE true") ||
+		!strings.Contains(client.queries[0], "INSERT INTO `p.d.versions` (version, dirty) VALUES (@version, @dirty)") {
+		t.Errorf("unexpected query %q", client.queries[0])
+	}
+	expected := []*bq.QueryParameter{param("version", "INT64", "2"), param("dirty", "BOOL", "true")}
+	if !reflect.DeepEqual(client.params[0], expected) {
+		t.Errorf("expected params %+v, got %+v", expected, client.params[0])
+	}
+
+	// a clean nil version deletes the version only
+	if err := b.SetVersion(database.NilVersion, false); err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(client.queries[1], "INSERT") || client.params[1] != nil {
+		t.Errorf("expected no insert, got %q", client.queries[1])
+	}
+}
+
+func TestRun(t *testing.T) {
+	client := &fakeClient{}
+	b := newFake(t, client, &Config{ProjectID: "p", DatasetID: "d"})
+
+	migration := "CREATE TABLE d.t (id INT64);\nINSERT INTO d.t VALUES (1);"
+	if err := b.Run(strings.NewReader(migration)); err != nil {
+		t.Fatal(err)
+	}
+	if err := b.Run(strings.NewReader(" \n")); err != nil {
+		t.Fatal(err)
+	}
+	if len(client.queries) != 1 || client.queries[0] != migration {
+		t.Errorf("expected the migration to run as one script, got %q", client.queries)
+	}
+
+	client.err = errors.New("syntax error")
+	err := b.Run(strings.NewReader("CREATE"))
+	var dbErr *database.Error
+	if !errors.As(err, &dbErr) || string(dbErr.Query) != "CREATE" {
+		t.Errorf("expected a database.Error for the migration, got %v", err)
+	}
+}
+
+func TestLock(t *testing.T) {
+	client := &fakeClient{}
+	b := newFake(t, client, &Config{ProjectID: "p", DatasetID: "d", LockTable: "locks"})
+
+	if err := b.Lock(); err != nil {
+		t.Fatal(err)
+	}
+	// the instance is locked without asking BigQuery
+	if err := b.Lock(); err != ErrLockHeld {
+		t.Errorf("expected ErrLockHeld, got %v", err)
+	}
+	if err := b.Unlock(); err != nil {
+		t.Fatal(err)
+	}
+	if err := b.Unlock(); err != ErrLockNotHeld {
+		t.Errorf("expected ErrLockNotHeld, got %v", err)
+	}
+	expected := []*bq.QueryParameter{param("lock_id", "STRING", DefaultMigrationsTable)}
+	if len(client.queries) != 2 || !reflect.DeepEqual(client.params[0], expected) || !reflect.DeepEqual(client.params[1], expected) {
+		t.Errorf("expected a lock and an unlock query, got %q", client.queries)
+	}
+	if !strings.Contains(client.queries[0], "MERGE `p.d.locks`") || !strings.Contains(client.queries[1], "UPDATE `p.d.locks`") {
+		t.Errorf("expected the queries to use the lock table, got %q", client.queries)
+	}
+
+	// another process holds the lock
+	client.lockHeld = true
+	if err := b.Lock(); err != ErrLockHeld {
+		t.Errorf("expected ErrLockHeld, got %v", err)
+	}
+	// the in process lock is restored
+	client.lockHeld = false
+	if err := b.Lock(); err != nil {
+		t.Error(err)
+	}
+	if !b.Capabilities().SupportsLocking {
+		t.Error("expected locking support")
+	}
+}
+
+func TestDrop(t *testing.T) {
+	client := &fakeClient{
+		tables: []string{"users", "schema_migrations", "locks"},
+	}
+	b := newFake(t, client, &Config{ProjectID: "p", DatasetID: "d", LockTable: "locks"})
+
+	tables, err := b.DropList(context.Background(), database.DropOptions{KeepMigrationsTable: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(tables, []string{"users"}) {
+		t.Errorf("expected users only, got %v", tables)
+	}
+
+	if err := b.Drop(); err != nil {
+		t.Fatal(err)
+	}
+	if expected := []string{"d.users", "d.schema_migrations"}; !reflect.DeepEqual(client.deleted, expected) {
+		t.Errorf("expected %v to be deleted, got %v", expected, client.deleted)
+	}
+}
+
+func TestAPIClient(t *testing.T) {
+	defer func(interval time.Duration) { queryPollInterval = interval }(queryPollInterval)
+	queryPollInterval = time.Millisecond
+
+	var req bq.QueryRequest
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case r.Method == http.MethodPost && strings.HasSuffix(r.URL.Path, "/projects/p/queries"):
+			if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+				t.Error(err)
+			}
+			// the query is still running
+			_, _ = w.Write([]byte(`{"jobComplete": false, "jobReference": {"projectId": "p", "jobId": "j", "location": "EU"}}`))
+		case r.Method == http.MethodGet && strings.HasSuffix(r.URL.Path, "/projects/p/queries/j"):
+			if loc := r.URL.Query().Get("location"); loc != "EU" {
+				t.Errorf("expected location EU, got %q", loc)
+			}
+			_, _ = w.Write([]byte(`{"jobComplete": true, "numDmlAffectedRows": "1", "rows": [{"f": [{"v": "1"}]}]}`))
+		case r.Method == http.MethodGet && strings.HasSuffix(r.URL.Path, "/projects/p/datasets/d/tables"):
+			_, _ = w.Write([]byte(`{"tables": [{"tableReference": {"tableId": "users"}}]}`))
+		default:
+			t.Errorf("unexpected request %v %v", r.Method, r.URL)
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer server.Close()
+
+	client, err := NewClient(context.Background(), "p", option.WithEndpoint(server.URL), option.WithoutAuthentication())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	res, err := client.Query(context.Background(), "SELECT @x", []*bq.QueryParameter{param("x", "INT64", "1")})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.AffectedRows != 1 || len(res.Rows) != 1 || res.Rows[0].F[0].V != "1" {
+		t.Errorf("unexpected result %+v", res)
+	}
+	if req.UseLegacySql == nil || *req.UseLegacySql || req.ParameterMode != "NAMED" {
+		t.Errorf("expected a GoogleSQL query with named parameters, got %+v", req)
+	}
+
+	tables, err := client.ListTables(context.Background(), "d")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(tables, []string{"users"}) {
+		t.Errorf("expected users, got %v", tables)
+	}
+}
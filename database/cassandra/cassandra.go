@@ -1,6 +1,8 @@
 package cassandra
 
 import (
+	"crypto/rand"
+	"encoding/hex"
 	"errors"
 	"fmt"
 	"io"
@@ -30,11 +32,20 @@ var (
 
 var DefaultMigrationsTable = "schema_migrations"
 
+var (
+	// DefaultLockTable holds the row inserted while migrating.
+	DefaultLockTable = "schema_lock"
+	// DefaultLockTTL is how long the lock is held at most, in case the
+	// process holding it dies.
+	DefaultLockTTL = 10 * time.Minute
+)
+
 var (
 	ErrNilConfig     = errors.New("no config")
 	ErrNoKeyspace    = errors.New("no keyspace provided")
 	ErrDatabaseDirty = errors.New("database is dirty")
 	ErrClosedSession = errors.New("session is closed")
+	ErrLockExpired   = errors.New("lock expired before it was released, increase the lock TTL")
 )
 
 type Config struct {
@@ -42,11 +53,19 @@ type Config struct {
 	KeyspaceName          string
 	MultiStatementEnabled bool
 	MultiStatementMaxSize int
+	// LockTable defaults to DefaultLockTable.
+	LockTable string
+	// LockTTL defaults to DefaultLockTTL.
+	LockTTL time.Duration
+	// NoLock only locks the driver instance, for clusters without
+	// lightweight transactions.
+	NoLock bool
 }
 
 type Cassandra struct {
-	session  *gocql.Session
-	isLocked atomic.Bool
+	session   *gocql.Session
+	isLocked  atomic.Bool
+	lockToken string
 
 	// Open and WithInstance need to guarantee that config is never nil
 	config *Config
@@ -71,11 +90,23 @@ func WithInstance(session *gocql.Session, config *Config) (database.Driver, erro
 		config.MultiStatementMaxSize = DefaultMultiStatementMaxSize
 	}
 
+	if len(config.LockTable) == 0 {
+		config.LockTable = DefaultLockTable
+	}
+
+	if config.LockTTL <= 0 {
+		config.LockTTL = DefaultLockTTL
+	}
+
 	c := &Cassandra{
 		session: session,
 		config:  config,
 	}
 
+	if err := c.ensureLockTable(); err != nil {
+		return nil, err
+	}
+
 	if err := c.ensureVersionTable(); err != nil {
 		return nil, err
 	}
@@ -185,11 +216,23 @@ func (c *Cassandra) Open(url string) (database.Driver, error) {
 		}
 	}
 
+	var lockTTL time.Duration
+	if s := u.Query().Get("x-lock-ttl"); len(s) > 0 {
+		ttl, err := strconv.Atoi(s)
+		if err != nil {
+			return nil, fmt.Errorf("could not parse x-lock-ttl as int: %w", err)
+		}
+		lockTTL = time.Duration(ttl) * time.Second
+	}
+
 	return WithInstance(session, &Config{
 		KeyspaceName:          strings.TrimPrefix(u.Path, "/"),
 		MigrationsTable:       u.Query().Get("x-migrations-table"),
 		MultiStatementEnabled: u.Query().Get("x-multi-statement") == "true",
 		MultiStatementMaxSize: multiStatementMaxSize,
+		LockTable:             u.Query().Get("x-lock-table"),
+		LockTTL:               lockTTL,
+		NoLock:                u.Query().Get("x-no-lock") == "true",
 	})
 }
 
@@ -198,18 +241,52 @@ func (c *Cassandra) Close() error {
 	return nil
 }
 
+// Lock inserts the lock row with a lightweight transaction, which fails if
+// another process holds the lock. The row expires after the lock TTL in case
+// the process dies while migrating.
 func (c *Cassandra) Lock() error {
-	if !c.isLocked.CAS(false, true) {
-		return database.ErrLocked
-	}
-	return nil
+	return database.CasRestoreOnErr(&c.isLocked, false, true, database.ErrLocked, func() error {
+		if c.config.NoLock {
+			return nil
+		}
+
+		token := make([]byte, 16)
+		if _, err := rand.Read(token); err != nil {
+			return err
+		}
+		c.lockToken = hex.EncodeToString(token)
+
+		query := `INSERT INTO "` + c.config.LockTable + `" (id, token) VALUES (1, ?) IF NOT EXISTS USING TTL ?`
+		ttl := int(c.config.LockTTL / time.Second)
+		applied, err := c.session.Query(query, c.lockToken, ttl).MapScanCAS(map[string]interface{}{})
+		if err != nil {
+			return &database.Error{OrigErr: err, Err: "try lock failed", Query: []byte(query)}
+		}
+		if !applied {
+			return database.ErrLocked
+		}
+		return nil
+	})
 }
 
+// Unlock deletes the lock row if it is still the one inserted by Lock.
 func (c *Cassandra) Unlock() error {
-	if !c.isLocked.CAS(true, false) {
-		return database.ErrNotLocked
-	}
-	return nil
+	return database.CasRestoreOnErr(&c.isLocked, true, false, database.ErrNotLocked, func() error {
+		if c.config.NoLock {
+			return nil
+		}
+
+		query := `DELETE FROM "` + c.config.LockTable + `" WHERE id = 1 IF token = ?`
+		applied, err := c.session.Query(query, c.lockToken).MapScanCAS(map[string]interface{}{})
+		if err != nil {
+			return &database.Error{OrigErr: err, Err: "try unlock failed", Query: []byte(query)}
+		}
+		if !applied {
+			// the lock expired and another process may hold it now
+			return ErrLockExpired
+		}
+		return nil
+	})
 }
 
 func (c *Cassandra) Run(migration io.Reader) error {
@@ -291,21 +368,45 @@ func (c *Cassandra) Version() (version int, dirty bool, err error) {
 	}
 }
 
+// Drop drops all tables of the keyspace but the lock table, which holds the
+// lock while dropping.
 func (c *Cassandra) Drop() error {
 	// select all tables in current schema
-	query := fmt.Sprintf(`SELECT table_name from system_schema.tables WHERE keyspace_name='%s'`, c.config.KeyspaceName)
-	iter := c.session.Query(query).Iter()
+	query := `SELECT table_name FROM system_schema.tables WHERE keyspace_name = ?`
+	iter := c.session.Query(query, c.config.KeyspaceName).Iter()
+	var tableNames []string
 	var tableName string
 	for iter.Scan(&tableName) {
-		err := c.session.Query(fmt.Sprintf(`DROP TABLE %s`, tableName)).Exec()
-		if err != nil {
-			return err
+		if tableName != c.config.LockTable {
+			tableNames = append(tableNames, tableName)
+		}
+	}
+	if err := iter.Close(); err != nil {
+		return &database.Error{OrigErr: err, Query: []byte(query)}
+	}
+
+	for _, tableName := range tableNames {
+		query := `DROP TABLE IF EXISTS "` + tableName + `"`
+		if err := c.session.Query(query).Exec(); err != nil {
+			return &database.Error{OrigErr: err, Query: []byte(query)}
 		}
 	}
 
 	return nil
 }
 
+// ensureLockTable creates the lock table if it doesn't exist.
+func (c *Cassandra) ensureLockTable() error {
+	if c.config.NoLock {
+		return nil
+	}
+	query := `CREATE TABLE IF NOT EXISTS "` + c.config.LockTable + `" (id int PRIMARY KEY, token text)`
+	if err := c.session.Query(query).Exec(); err != nil {
+		return &database.Error{OrigErr: err, Query: []byte(query)}
+	}
+	return nil
+}
+
 // ensureVersionTable checks if versions table exists and, if not, creates it.
 // Note that this function locks the database, which deviates from the usual
 // convention of "caller locks" in the Cassandra type.
@@ -14,6 +14,7 @@ import (
 )
 
 import (
+	"github.com/golang-migrate/migrate/v4/database"
 	dt "github.com/golang-migrate/migrate/v4/database/testing"
 	"github.com/golang-migrate/migrate/v4/dktesting"
 	_ "github.com/golang-migrate/migrate/v4/source/file"
@@ -63,6 +64,7 @@ func isReady(ctx context.Context, c dktest.ContainerInfo) bool {
 func Test(t *testing.T) {
 	t.Run("test", test)
 	t.Run("testMigrate", testMigrate)
+	t.Run("testLock", testLock)
 
 	t.Cleanup(func() {
 		for _, spec := range specs {
@@ -120,3 +122,48 @@ func testMigrate(t *testing.T) {
 		dt.TestMigrate(t, m)
 	})
 }
+
+func testLock(t *testing.T) {
+	dktesting.ParallelTest(t, specs, func(t *testing.T, c dktest.ContainerInfo) {
+		ip, port, err := c.Port(9042)
+		if err != nil {
+			t.Fatal("Unable to get mapped port:", err)
+		}
+		addr := fmt.Sprintf("cassandra://%v:%v/testks", ip, port)
+		p := &Cassandra{}
+		d1, err := p.Open(addr)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer func() {
+			if err := d1.Close(); err != nil {
+				t.Error(err)
+			}
+		}()
+		d2, err := p.Open(addr)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer func() {
+			if err := d2.Close(); err != nil {
+				t.Error(err)
+			}
+		}()
+
+		if err := d1.Lock(); err != nil {
+			t.Fatal(err)
+		}
+		if err := d2.Lock(); err != database.ErrLocked {
+			t.Fatalf("expected %v, got %v", database.ErrLocked, err)
+		}
+		if err := d1.Unlock(); err != nil {
+			t.Fatal(err)
+		}
+		if err := d2.Lock(); err != nil {
+			t.Fatal(err)
+		}
+		if err := d2.Unlock(); err != nil {
+			t.Fatal(err)
+		}
+	})
+}
@@ -1,6 +1,7 @@
 package clickhouse
 
 import (
+	"bytes"
 	"database/sql"
 	"fmt"
 	"io"
@@ -13,12 +14,13 @@ import (
 
 	"github.com/golang-migrate/migrate/v4"
 	"github.com/golang-migrate/migrate/v4/database"
-	"github.com/golang-migrate/migrate/v4/database/multistmt"
+	"github.com/golang-migrate/migrate/v4/database/sqlutil"
 	"github.com/hashicorp/go-multierror"
 )
 
 var (
-	multiStmtDelimiter = []byte(";")
+	// multiStmtSplitter splits migrations if MultiStatementEnabled is set
+	multiStmtSplitter = sqlutil.StatementSplitter{Quotes: "'\"`", BackslashEscapes: true}
 
 	DefaultMigrationsTable       = "schema_migrations"
 	DefaultMigrationsTableEngine = "TinyLog"
@@ -34,6 +36,9 @@ type Config struct {
 	MigrationsTableEngine string
 	MultiStatementEnabled bool
 	MultiStatementMaxSize int
+	// StripComments removes the comments of migrations before running them,
+	// for servers that can't handle them.
+	StripComments bool
 }
 
 func init() {
@@ -101,6 +106,7 @@ func (ch *ClickHouse) Open(dsn string) (database.Driver, error) {
 			ClusterName:           purl.Query().Get("x-cluster-name"),
 			MultiStatementEnabled: purl.Query().Get("x-multi-statement") == "true",
 			MultiStatementMaxSize: multiStatementMaxSize,
+			StripComments:         purl.Query().Get("x-strip-comments") == "true",
 		},
 	}
 
@@ -134,9 +140,16 @@ func (ch *ClickHouse) init() error {
 }
 
 func (ch *ClickHouse) Run(r io.Reader) error {
+	if ch.config.StripComments {
+		migration, err := io.ReadAll(r)
+		if err != nil {
+			return err
+		}
+		r = bytes.NewReader(multiStmtSplitter.StripComments(migration))
+	}
 	if ch.config.MultiStatementEnabled {
 		var err error
-		if e := multistmt.Parse(r, multiStmtDelimiter, ch.config.MultiStatementMaxSize, func(m []byte) bool {
+		if e := multiStmtSplitter.Split(r, ch.config.MultiStatementMaxSize, func(m []byte) bool {
 			tq := strings.TrimSpace(string(m))
 			if tq == "" {
 				return true
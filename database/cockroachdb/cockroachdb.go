@@ -3,15 +3,18 @@ package cockroachdb
 import (
 	"context"
 	"database/sql"
+	"errors"
 	"fmt"
 	"io"
 	nurl "net/url"
 	"regexp"
 	"strconv"
+	"time"
 
 	"github.com/cockroachdb/cockroach-go/v2/crdb"
 	"github.com/golang-migrate/migrate/v4"
 	"github.com/golang-migrate/migrate/v4/database"
+	"github.com/golang-migrate/migrate/v4/database/sqlutil"
 	"github.com/hashicorp/go-multierror"
 	"github.com/lib/pq"
 	"go.uber.org/atomic"
@@ -27,6 +30,11 @@ func init() {
 var DefaultMigrationsTable = "schema_migrations"
 var DefaultLockTable = "schema_lock"
 
+var (
+	DefaultMaxRetries    = 3
+	DefaultRetryInterval = 100 * time.Millisecond
+)
+
 var (
 	ErrNilConfig      = fmt.Errorf("no config")
 	ErrNoDatabaseName = fmt.Errorf("no database name")
@@ -37,6 +45,17 @@ type Config struct {
 	LockTable       string
 	ForceLock       bool
 	DatabaseName    string
+	NoLock          bool
+	// MigrationsSchema and LockSchema are the schemas of the migrations and
+	// lock tables, created if missing. Empty means the current schema.
+	MigrationsSchema string
+	LockSchema       string
+	// MaxRetries is how many times migrate.Migrate.RetryUp retries Up after
+	// a serialization failure. Defaults to DefaultMaxRetries.
+	MaxRetries int
+	// RetryInterval is the wait before the first retry, doubled for each
+	// following one. Defaults to DefaultRetryInterval.
+	RetryInterval time.Duration
 }
 
 type CockroachDb struct {
@@ -78,6 +97,14 @@ func WithInstance(instance *sql.DB, config *Config) (database.Driver, error) {
 		config.LockTable = DefaultLockTable
 	}
 
+	if config.MaxRetries == 0 {
+		config.MaxRetries = DefaultMaxRetries
+	}
+
+	if config.RetryInterval == 0 {
+		config.RetryInterval = DefaultRetryInterval
+	}
+
 	px := &CockroachDb{
 		db:     instance,
 		config: config,
@@ -96,6 +123,11 @@ func WithInstance(instance *sql.DB, config *Config) (database.Driver, error) {
 }
 
 func (c *CockroachDb) Open(url string) (database.Driver, error) {
+	return c.OpenWithLogger(url, nil)
+}
+
+// OpenWithLogger implements database.LoggingOpener.
+func (c *CockroachDb) OpenWithLogger(url string, l database.Logger) (database.Driver, error) {
 	purl, err := nurl.Parse(url)
 	if err != nil {
 		return nil, err
@@ -121,17 +153,68 @@ func (c *CockroachDb) Open(url string) (database.Driver, error) {
 		lockTable = DefaultLockTable
 	}
 
+	// x-schema places both tables in the same schema
+	migrationsSchema := purl.Query().Get("x-migrations-schema")
+	if len(migrationsSchema) == 0 {
+		migrationsSchema = purl.Query().Get("x-schema")
+	}
+	lockSchema := purl.Query().Get("x-lock-schema")
+	if len(lockSchema) == 0 {
+		lockSchema = purl.Query().Get("x-schema")
+	}
+
 	forceLockQuery := purl.Query().Get("x-force-lock")
 	forceLock, err := strconv.ParseBool(forceLockQuery)
 	if err != nil {
 		forceLock = false
 	}
 
+	noLock := false
+	if s := purl.Query().Get("x-no-lock"); len(s) > 0 {
+		noLock, err = strconv.ParseBool(s)
+		if err != nil {
+			return nil, fmt.Errorf("could not parse x-no-lock as bool: %w", err)
+		}
+	}
+
+	maxRetries := 0
+	if s := purl.Query().Get("x-max-retries"); len(s) > 0 {
+		maxRetries, err = strconv.Atoi(s)
+		if err != nil {
+			return nil, fmt.Errorf("could not parse x-max-retries as int: %w", err)
+		}
+	}
+
+	retryInterval := time.Duration(0)
+	if s := purl.Query().Get("x-retry-interval"); len(s) > 0 {
+		retryInterval, err = time.ParseDuration(s)
+		if err != nil {
+			return nil, fmt.Errorf("could not parse x-retry-interval as duration: %w", err)
+		}
+	}
+
+	connectRetry, err := sqlutil.ParseConnectRetry(purl.Query().Get("x-connect-retries"), purl.Query().Get("x-connect-retry-interval"))
+	if err != nil {
+		return nil, err
+	}
+	connectRetry.OnRetry = sqlutil.LogRetries(l)
+	if connectRetry.Retries > 0 {
+		if err := connectRetry.Ping(context.Background(), db); err != nil {
+			db.Close()
+			return nil, err
+		}
+	}
+
 	px, err := WithInstance(db, &Config{
-		DatabaseName:    purl.Path,
-		MigrationsTable: migrationsTable,
-		LockTable:       lockTable,
-		ForceLock:       forceLock,
+		DatabaseName:     purl.Path,
+		MigrationsTable:  migrationsTable,
+		LockTable:        lockTable,
+		MigrationsSchema: migrationsSchema,
+		LockSchema:       lockSchema,
+		ForceLock:        forceLock,
+		NoLock:           noLock,
+		MaxRetries:       maxRetries,
+		RetryInterval:    retryInterval,
 	})
 	if err != nil {
 		return nil, err
@@ -144,17 +227,38 @@ func (c *CockroachDb) Close() error {
 	return c.db.Close()
 }
 
+// qualifiedTable returns the quoted table, qualified with the quoted schema
+// unless schema is empty.
+func qualifiedTable(schema, table string) string {
+	if schema == "" {
+		return pq.QuoteIdentifier(table)
+	}
+	return pq.QuoteIdentifier(schema) + "." + pq.QuoteIdentifier(table)
+}
+
+func (c *CockroachDb) migrationsTable() string {
+	return qualifiedTable(c.config.MigrationsSchema, c.config.MigrationsTable)
+}
+
+func (c *CockroachDb) lockTable() string {
+	return qualifiedTable(c.config.LockSchema, c.config.LockTable)
+}
+
 // Locking is done manually with a separate lock table.  Implementing advisory locks in CRDB is being discussed
 // See: https://github.com/cockroachdb/cockroach/issues/13546
 func (c *CockroachDb) Lock() error {
 	return database.CasRestoreOnErr(&c.isLocked, false, true, database.ErrLocked, func() (err error) {
+		if c.config.NoLock {
+			return nil
+		}
+
 		return crdb.ExecuteTx(context.Background(), c.db, nil, func(tx *sql.Tx) (err error) {
 			aid, err := database.GenerateAdvisoryLockId(c.config.DatabaseName)
 			if err != nil {
 				return err
 			}
 
-			query := "SELECT * FROM " + c.config.LockTable + " WHERE lock_id = $1"
+			query := "SELECT * FROM " + c.lockTable() + " WHERE lock_id = $1"
 			rows, err := tx.Query(query, aid)
 			if err != nil {
 				return database.Error{OrigErr: err, Err: "failed to fetch migration lock", Query: []byte(query)}
@@ -171,7 +275,7 @@ func (c *CockroachDb) Lock() error {
 				return database.ErrLocked
 			}
 
-			query = "INSERT INTO " + c.config.LockTable + " (lock_id) VALUES ($1)"
+			query = "INSERT INTO " + c.lockTable() + " (lock_id) VALUES ($1)"
 			if _, err := tx.Exec(query, aid); err != nil {
 				return database.Error{OrigErr: err, Err: "failed to set migration lock", Query: []byte(query)}
 			}
@@ -185,6 +289,10 @@ func (c *CockroachDb) Lock() error {
 // See: https://github.com/cockroachdb/cockroach/issues/13546
 func (c *CockroachDb) Unlock() error {
 	return database.CasRestoreOnErr(&c.isLocked, true, false, database.ErrNotLocked, func() (err error) {
+		if c.config.NoLock {
+			return nil
+		}
+
 		aid, err := database.GenerateAdvisoryLockId(c.config.DatabaseName)
 		if err != nil {
 			return err
@@ -192,7 +300,7 @@ func (c *CockroachDb) Unlock() error {
 
 		// In the event of an implementation (non-migration) error, it is possible for the lock to not be released.  Until
 		// a better locking mechanism is added, a manual purging of the lock table may be required in such circumstances
-		query := "DELETE FROM " + c.config.LockTable + " WHERE lock_id = $1"
+		query := "DELETE FROM " + c.lockTable() + " WHERE lock_id = $1"
 		if _, err := c.db.Exec(query, aid); err != nil {
 			if e, ok := err.(*pq.Error); ok {
 				// 42P01 is "UndefinedTableError" in CockroachDB
@@ -227,15 +335,24 @@ func (c *CockroachDb) Run(migration io.Reader) error {
 
 func (c *CockroachDb) SetVersion(version int, dirty bool) error {
 	return crdb.ExecuteTx(context.Background(), c.db, nil, func(tx *sql.Tx) error {
-		if _, err := tx.Exec(`DELETE FROM "` + c.config.MigrationsTable + `"`); err != nil {
-			return err
-		}
-
 		// Also re-write the schema version for nil dirty versions to prevent
 		// empty schema version for failed down migration on the first migration
 		// See: https://github.com/golang-migrate/migrate/issues/330
-		if version >= 0 || (version == database.NilVersion && dirty) {
-			if _, err := tx.Exec(`INSERT INTO "`+c.config.MigrationsTable+`" (version, dirty) VALUES ($1, $2)`, version, dirty); err != nil {
+		write := version >= 0 || (version == database.NilVersion && dirty)
+
+		// keep the row of an unchanged version, so it is updated in place
+		query := `DELETE FROM ` + c.migrationsTable()
+		var args []interface{}
+		if write {
+			query += ` WHERE version <> $1`
+			args = append(args, version)
+		}
+		if _, err := tx.Exec(query, args...); err != nil {
+			return err
+		}
+
+		if write {
+			if _, err := tx.Exec(`INSERT INTO `+c.migrationsTable()+` (version, dirty) VALUES ($1, $2) ON CONFLICT (version) DO UPDATE SET dirty = EXCLUDED.dirty`, version, dirty); err != nil {
 				return err
 			}
 		}
@@ -244,8 +361,36 @@ func (c *CockroachDb) SetVersion(version int, dirty bool) error {
 	})
 }
 
+// IsRetryable implements database.Retryable. Serialization failures, which
+// abort transactions under contention, are retryable.
+func (c *CockroachDb) IsRetryable(err error) bool {
+	var restartErr *crdb.TxnRestartError
+	if errors.As(err, &restartErr) {
+		err = restartErr.RetryCause()
+	}
+	var dbErr *database.Error
+	if errors.As(err, &dbErr) {
+		err = dbErr.OrigErr
+	}
+	var pqErr *pq.Error
+	if !errors.As(err, &pqErr) {
+		return false
+	}
+	// CR000 is the retry error code of older CockroachDB versions
+	return pqErr.Code == "40001" || pqErr.Code == "CR000"
+}
+
+// RetryBackoff implements database.Retryable, doubling RetryInterval up to
+// MaxRetries retries.
+func (c *CockroachDb) RetryBackoff(attempt int) (time.Duration, bool) {
+	if attempt < 1 || attempt > c.config.MaxRetries {
+		return 0, false
+	}
+	return c.config.RetryInterval << (attempt - 1), true
+}
+
 func (c *CockroachDb) Version() (version int, dirty bool, err error) {
-	query := `SELECT version, dirty FROM "` + c.config.MigrationsTable + `" LIMIT 1`
+	query := `SELECT version, dirty FROM ` + c.migrationsTable() + ` LIMIT 1`
 	err = c.db.QueryRow(query).Scan(&version, &dirty)
 
 	switch {
@@ -305,6 +450,14 @@ func (c *CockroachDb) Drop() (err error) {
 		}
 	}
 
+	// the migrations and lock tables may be in other schemas
+	for _, t := range []string{c.migrationsTable(), c.lockTable()} {
+		query = `DROP TABLE IF EXISTS ` + t + ` CASCADE`
+		if _, err := c.db.Exec(query); err != nil {
+			return &database.Error{OrigErr: err, Query: []byte(query)}
+		}
+	}
+
 	return nil
 }
 
@@ -328,16 +481,20 @@ func (c *CockroachDb) ensureVersionTable() (err error) {
 
 	// check if migration table exists
 	var count int
-	query := `SELECT COUNT(1) FROM information_schema.tables WHERE table_name = $1 AND table_schema = (SELECT current_schema()) LIMIT 1`
-	if err := c.db.QueryRow(query, c.config.MigrationsTable).Scan(&count); err != nil {
+	query := `SELECT COUNT(1) FROM information_schema.tables WHERE table_name = $1 AND table_schema = COALESCE(NULLIF($2, ''), current_schema()) LIMIT 1`
+	if err := c.db.QueryRow(query, c.config.MigrationsTable, c.config.MigrationsSchema).Scan(&count); err != nil {
 		return &database.Error{OrigErr: err, Query: []byte(query)}
 	}
 	if count == 1 {
 		return nil
 	}
 
+	if err := c.ensureSchema(c.config.MigrationsSchema); err != nil {
+		return err
+	}
+
 	// if not, create the empty migration table
-	query = `CREATE TABLE "` + c.config.MigrationsTable + `" (version INT NOT NULL PRIMARY KEY, dirty BOOL NOT NULL)`
+	query = `CREATE TABLE ` + c.migrationsTable() + ` (version INT NOT NULL PRIMARY KEY, dirty BOOL NOT NULL)`
 	if _, err := c.db.Exec(query); err != nil {
 		return &database.Error{OrigErr: err, Query: []byte(query)}
 	}
@@ -347,19 +504,35 @@ func (c *CockroachDb) ensureVersionTable() (err error) {
 func (c *CockroachDb) ensureLockTable() error {
 	// check if lock table exists
 	var count int
-	query := `SELECT COUNT(1) FROM information_schema.tables WHERE table_name = $1 AND table_schema = (SELECT current_schema()) LIMIT 1`
-	if err := c.db.QueryRow(query, c.config.LockTable).Scan(&count); err != nil {
+	query := `SELECT COUNT(1) FROM information_schema.tables WHERE table_name = $1 AND table_schema = COALESCE(NULLIF($2, ''), current_schema()) LIMIT 1`
+	if err := c.db.QueryRow(query, c.config.LockTable, c.config.LockSchema).Scan(&count); err != nil {
 		return &database.Error{OrigErr: err, Query: []byte(query)}
 	}
 	if count == 1 {
 		return nil
 	}
 
+	if err := c.ensureSchema(c.config.LockSchema); err != nil {
+		return err
+	}
+
 	// if not, create the empty lock table
-	query = `CREATE TABLE "` + c.config.LockTable + `" (lock_id INT NOT NULL PRIMARY KEY)`
+	query = `CREATE TABLE ` + c.lockTable() + ` (lock_id INT NOT NULL PRIMARY KEY)`
 	if _, err := c.db.Exec(query); err != nil {
 		return &database.Error{OrigErr: err, Query: []byte(query)}
 	}
 
 	return nil
 }
+
+// ensureSchema creates schema if it is not empty and doesn't exist.
+func (c *CockroachDb) ensureSchema(schema string) error {
+	if schema == "" {
+		return nil
+	}
+	query := `CREATE SCHEMA IF NOT EXISTS ` + pq.QuoteIdentifier(schema)
+	if _, err := c.db.Exec(query); err != nil {
+		return &database.Error{OrigErr: err, Query: []byte(query)}
+	}
+	return nil
+}
@@ -5,19 +5,23 @@ package cockroachdb
 import (
 	"context"
 	"database/sql"
+	"errors"
 	"fmt"
 	"github.com/golang-migrate/migrate/v4"
 	"log"
+	"strconv"
 	"strings"
 	"testing"
+	"time"
 )
 
 import (
 	"github.com/dhui/dktest"
-	_ "github.com/lib/pq"
+	"github.com/lib/pq"
 )
 
 import (
+	"github.com/golang-migrate/migrate/v4/database"
 	dt "github.com/golang-migrate/migrate/v4/database/testing"
 	"github.com/golang-migrate/migrate/v4/dktesting"
 	_ "github.com/golang-migrate/migrate/v4/source/file"
@@ -97,6 +101,7 @@ func Test(t *testing.T) {
 		if err != nil {
 			t.Fatal(err)
 		}
+		dt.TestParallelMigrate(t, d, 10)
 		dt.Test(t, d, []byte("SELECT 1"))
 	})
 }
@@ -125,6 +130,25 @@ func TestMigrate(t *testing.T) {
 	})
 }
 
+func TestSetVersionRows(t *testing.T) {
+	dktesting.ParallelTest(t, specs, func(t *testing.T, ci dktest.ContainerInfo) {
+		createDB(t, ci)
+
+		ip, port, err := ci.Port(26257)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		addr := fmt.Sprintf("cockroach://root@%v:%v/migrate?sslmode=disable", ip, port)
+		c := &CockroachDb{}
+		d, err := c.Open(addr)
+		if err != nil {
+			t.Fatal(err)
+		}
+		dt.TestSetVersionRows(t, d, d.(*CockroachDb).db, `"schema_migrations"`)
+	})
+}
+
 func TestMultiStatement(t *testing.T) {
 	dktesting.ParallelTest(t, specs, func(t *testing.T, ci dktest.ContainerInfo) {
 		createDB(t, ci)
@@ -155,6 +179,168 @@ func TestMultiStatement(t *testing.T) {
 	})
 }
 
+func TestNoLock(t *testing.T) {
+	dktesting.ParallelTest(t, specs, func(t *testing.T, ci dktest.ContainerInfo) {
+		createDB(t, ci)
+
+		ip, port, err := ci.Port(26257)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		addr := fmt.Sprintf("cockroach://root@%v:%v/migrate?sslmode=disable", ip, port)
+
+		c := &CockroachDb{}
+		d, err := c.Open(addr)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		lock := d.(*CockroachDb)
+
+		c = &CockroachDb{}
+		d, err = c.Open(addr + "&x-no-lock=true")
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		noLock := d.(*CockroachDb)
+
+		// Should be possible to take real lock and no-lock at the same time
+		if err = lock.Lock(); err != nil {
+			t.Fatal(err)
+		}
+		if err = noLock.Lock(); err != nil {
+			t.Fatal(err)
+		}
+		if err = lock.Unlock(); err != nil {
+			t.Fatal(err)
+		}
+		if err = noLock.Unlock(); err != nil {
+			t.Fatal(err)
+		}
+	})
+}
+
+func TestSchemas(t *testing.T) {
+	dktesting.ParallelTest(t, specs, func(t *testing.T, ci dktest.ContainerInfo) {
+		createDB(t, ci)
+
+		ip, port, err := ci.Port(26257)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		addr := fmt.Sprintf("cockroach://root@%v:%v/migrate?sslmode=disable", ip, port)
+		open := func(query string) *CockroachDb {
+			d, err := (&CockroachDb{}).Open(addr + query)
+			if err != nil {
+				t.Fatal(err)
+			}
+			t.Cleanup(func() { d.Close() })
+			return d.(*CockroachDb)
+		}
+		foo := open("&x-schema=foo")
+		bar := open("&x-migrations-schema=bar&x-lock-schema=bar")
+		otherFoo := open("&x-schema=foo")
+
+		var count int
+		query := "SELECT COUNT(1) FROM information_schema.tables WHERE table_schema IN ('foo', 'bar') AND table_name IN ('schema_migrations', 'schema_lock')"
+		if err := foo.db.QueryRow(query).Scan(&count); err != nil {
+			t.Fatal(err)
+		}
+		if count != 4 {
+			t.Fatalf("expected the tables in schemas foo and bar, got %v tables", count)
+		}
+
+		// the lock of a schema doesn't lock the other
+		if err := foo.Lock(); err != nil {
+			t.Fatal(err)
+		}
+		if err := bar.Lock(); err != nil {
+			t.Fatalf("expected to lock schema bar while foo is locked, got %v", err)
+		}
+		if err := otherFoo.Lock(); !errors.Is(err, database.ErrLocked) {
+			t.Fatalf("expected %v for schema foo, got %v", database.ErrLocked, err)
+		}
+
+		if err := foo.SetVersion(2, false); err != nil {
+			t.Fatal(err)
+		}
+		if err := bar.SetVersion(5, true); err != nil {
+			t.Fatal(err)
+		}
+		if version, dirty, err := foo.Version(); err != nil || version != 2 || dirty {
+			t.Errorf("expected version 2 in schema foo, got %v %v %v", version, dirty, err)
+		}
+		if version, dirty, err := bar.Version(); err != nil || version != 5 || !dirty {
+			t.Errorf("expected dirty version 5 in schema bar, got %v %v %v", version, dirty, err)
+		}
+
+		if err := foo.Unlock(); err != nil {
+			t.Fatal(err)
+		}
+		if err := bar.Unlock(); err != nil {
+			t.Fatal(err)
+		}
+	})
+}
+
+func TestNoLockParamValidation(t *testing.T) {
+	c := &CockroachDb{}
+	_, err := c.Open("cockroach://root@127.0.0.1:26257/migrate?sslmode=disable&x-no-lock=not-a-bool")
+	if !errors.Is(err, strconv.ErrSyntax) {
+		t.Fatal("Expected syntax error when passing a non-bool as x-no-lock parameter")
+	}
+}
+
+func TestRetryParamValidation(t *testing.T) {
+	c := &CockroachDb{}
+	_, err := c.Open("cockroach://root@127.0.0.1:26257/migrate?sslmode=disable&x-max-retries=many")
+	if !errors.Is(err, strconv.ErrSyntax) {
+		t.Fatalf("expected a syntax error for x-max-retries, got %v", err)
+	}
+	_, err = c.Open("cockroach://root@127.0.0.1:26257/migrate?sslmode=disable&x-retry-interval=100")
+	if err == nil || !strings.Contains(err.Error(), "x-retry-interval") {
+		t.Fatalf("expected an error for x-retry-interval, got %v", err)
+	}
+}
+
+func TestIsRetryable(t *testing.T) {
+	c := &CockroachDb{config: &Config{}}
+	serialization := &pq.Error{Code: "40001", Message: "restart transaction"}
+	testCases := []struct {
+		err       error
+		retryable bool
+	}{
+		{serialization, true},
+		{&pq.Error{Code: "CR000"}, true},
+		{fmt.Errorf("setting version: %w", serialization), true},
+		{&database.Error{OrigErr: serialization, Query: []byte("UPDATE")}, true},
+		{&pq.Error{Code: "42P01", Message: "relation does not exist"}, false},
+		{errors.New("40001"), false},
+		{nil, false},
+	}
+	for _, tc := range testCases {
+		if retryable := c.IsRetryable(tc.err); retryable != tc.retryable {
+			t.Errorf("%v: expected retryable %v, got %v", tc.err, tc.retryable, retryable)
+		}
+	}
+}
+
+func TestRetryBackoff(t *testing.T) {
+	c := &CockroachDb{config: &Config{MaxRetries: 3, RetryInterval: 10 * time.Millisecond}}
+	expected := []time.Duration{10 * time.Millisecond, 20 * time.Millisecond, 40 * time.Millisecond}
+	for i, backoff := range expected {
+		if d, ok := c.RetryBackoff(i + 1); !ok || d != backoff {
+			t.Errorf("attempt %v: expected %v, got %v, %v", i+1, backoff, d, ok)
+		}
+	}
+	if _, ok := c.RetryBackoff(4); ok {
+		t.Error("expected no retry left after MaxRetries")
+	}
+}
+
 func TestFilterCustomQuery(t *testing.T) {
 	dktesting.ParallelTest(t, specs, func(t *testing.T, ci dktest.ContainerInfo) {
 		createDB(t, ci)
@@ -5,16 +5,19 @@
 package database
 
 import (
+	"context"
 	"fmt"
 	"io"
 	"sync"
+	"time"
 
 	iurl "github.com/golang-migrate/migrate/v4/internal/url"
 )
 
 var (
-	ErrLocked    = fmt.Errorf("can't acquire lock")
-	ErrNotLocked = fmt.Errorf("can't unlock, as not currently locked")
+	ErrLocked       = fmt.Errorf("can't acquire lock")
+	ErrNotLocked    = fmt.Errorf("can't unlock, as not currently locked")
+	ErrLockDisabled = fmt.Errorf("locking is disabled, only read-only operations are allowed")
 )
 
 const NilVersion int = -1
@@ -81,8 +84,210 @@ type Driver interface {
 	Drop() error
 }
 
+// DropOptions configures what DropWithOptions deletes.
+type DropOptions struct {
+	// KeepMigrationsTable excludes the migrations table from the drop,
+	// so that the migration history is preserved.
+	KeepMigrationsTable bool
+}
+
+// DropOptionsDriver is an optional interface a driver can implement
+// to support dropping the database with DropOptions.
+type DropOptionsDriver interface {
+	// DropWithOptions deletes everything in the database like Drop,
+	// but respects the given DropOptions.
+	DropWithOptions(ctx context.Context, opts DropOptions) error
+}
+
+// DropLister is an optional interface a driver can implement to list the
+// tables a drop would delete, without deleting them. Drivers drop tables
+// with IF EXISTS, so an interrupted drop can be run again, and the list
+// then only holds the remaining tables.
+type DropLister interface {
+	// DropList returns the names of the tables DropWithOptions would
+	// delete with opts, or Drop with the zero DropOptions.
+	DropList(ctx context.Context, opts DropOptions) ([]string, error)
+}
+
+// Capabilities describes the optional features supported by a driver.
+type Capabilities struct {
+	// SupportsTx is true if migrations can be wrapped in a transaction,
+	// including schema changes.
+	SupportsTx bool
+
+	// SupportsMultiStatement is true if a single migration may contain
+	// multiple statements.
+	SupportsMultiStatement bool
+
+	// SupportsLocking is true if Lock prevents concurrent migrations across
+	// processes, not just within a single driver instance.
+	SupportsLocking bool
+
+	// SupportsHistory is true if the driver records every applied migration,
+	// not just the current version.
+	SupportsHistory bool
+}
+
+// CapabilitiesDriver is an optional interface a driver can implement
+// to report which features it supports.
+type CapabilitiesDriver interface {
+	Capabilities() Capabilities
+}
+
+// DriverInfo describes a driver and the features it supports, for tooling
+// built on top of migrate. Drivers implementing both CapabilitiesDriver and
+// Describer embed the result of Capabilities, so that both agree.
+type DriverInfo struct {
+	// Name is the name the driver is registered with.
+	Name string
+
+	Capabilities
+
+	// SupportsAdvisoryLocks is true if Lock uses database advisory locks.
+	SupportsAdvisoryLocks bool
+
+	// SupportsSchemas is true if the migrations can be isolated in a schema
+	// of the database.
+	SupportsSchemas bool
+}
+
+// Describer is an optional interface a driver can implement to describe
+// itself and the features it supports.
+type Describer interface {
+	Describe() (DriverInfo, error)
+}
+
+// LockDisabledDriver is an optional interface a driver can implement to
+// report that locking is disabled for read-only use, e.g. by roles lacking
+// the permissions to lock. Migrate refuses to change the database then.
+type LockDisabledDriver interface {
+	LockDisabled() bool
+}
+
+// Logger receives the messages logged by drivers, see LoggingOpener.
+// migrate.Logger implements it.
+type Logger interface {
+	Printf(format string, v ...interface{})
+}
+
+// LoggingOpener is an optional interface a driver can implement to log
+// while opening a connection, like the retries of x-connect-retries.
+type LoggingOpener interface {
+	// OpenWithLogger works like Open, logging to l if not nil.
+	OpenWithLogger(url string, l Logger) (Driver, error)
+}
+
+// Pinger is an optional interface a driver can implement to verify
+// the database is reachable.
+type Pinger interface {
+	Ping(ctx context.Context) error
+}
+
+// MigrationValidator is an optional interface a driver can implement to
+// check a migration, e.g. its syntax, before it is run. Migrate doesn't mark
+// the database dirty if the migration is invalid. Passing validation doesn't
+// guarantee the migration runs successfully.
+type MigrationValidator interface {
+	Validate(ctx context.Context, migration io.Reader) error
+}
+
+// BatchDriver is an optional interface a driver can implement to run
+// several migrations atomically, like in a single transaction.
+type BatchDriver interface {
+	// RunBatch runs the migrations in order and sets version, not dirty.
+	// If any migration fails, none is applied and the version is unchanged.
+	RunBatch(ctx context.Context, migrations []io.Reader, version int) error
+}
+
+// AppVersionEnv is the environment variable holding the application
+// version recorded with migrations by drivers tracking it.
+const AppVersionEnv = "X_MIGRATE_APP_VERSION"
+
+// AppliedMigration is a migration recorded in the migrations table.
+type AppliedMigration struct {
+	Version int
+	Dirty   bool
+	// AppVersion is the version of the application that applied the
+	// migration, if tracked.
+	AppVersion string
+}
+
+// HistoryDriver is an optional interface a driver can implement to list
+// the migrations recorded in its migrations table.
+type HistoryDriver interface {
+	History() ([]AppliedMigration, error)
+}
+
+// Retryable is an optional interface a driver can implement to have
+// transient errors retried, see migrate.Migrate.RetryUp.
+type Retryable interface {
+	// IsRetryable reports whether err is transient, like a serialization
+	// failure of a transaction.
+	IsRetryable(err error) bool
+
+	// RetryBackoff returns how long to wait before the given retry attempt,
+	// starting at 1, or false if no retry is left.
+	RetryBackoff(attempt int) (time.Duration, bool)
+}
+
+// ContextRunner is an optional interface a driver can implement to run a
+// migration with a context, e.g. to stop it after a timeout, see
+// migrate.Migration.Timeout.
+type ContextRunner interface {
+	// RunContext runs the migration like Run, stopping when ctx is done.
+	// A deadline of ctx replaces any statement timeout of the driver.
+	RunContext(ctx context.Context, migration io.Reader) error
+}
+
+// ContextLocker is an optional interface a driver can implement to take
+// the lock with a context, see migrate.WithContext.
+type ContextLocker interface {
+	// LockContext locks like Lock, giving up when ctx is done.
+	LockContext(ctx context.Context) error
+}
+
+// ContextVersionSetter is an optional interface a driver can implement to
+// set the version with a context, see migrate.WithContext.
+type ContextVersionSetter interface {
+	// SetVersionContext sets the version like SetVersion, giving up when
+	// ctx is done.
+	SetVersionContext(ctx context.Context, version int, dirty bool) error
+}
+
+// ChecksumDriver is an optional interface a driver can implement to record
+// the checksums of applied migrations, see migrate.Migration.Checksum.
+type ChecksumDriver interface {
+	// SetChecksum records the checksum of the migration of version.
+	SetChecksum(version uint, checksum string) error
+	// GetChecksum returns the checksum recorded for version, or an empty
+	// string if there is none.
+	GetChecksum(version uint) (string, error)
+}
+
 // Open returns a new driver instance.
 func Open(url string) (Driver, error) {
+	d, err := registered(url)
+	if err != nil {
+		return nil, err
+	}
+	return d.Open(url)
+}
+
+// OpenWithLogger opens url like Open, but drivers implementing
+// LoggingOpener log to l while opening, e.g. the connection retries.
+func OpenWithLogger(url string, l Logger) (Driver, error) {
+	d, err := registered(url)
+	if err != nil {
+		return nil, err
+	}
+	if o, ok := d.(LoggingOpener); ok {
+		return o.OpenWithLogger(url, l)
+	}
+	return d.Open(url)
+}
+
+// registered returns the driver registered for the scheme of url.
+func registered(url string) (Driver, error) {
 	scheme, err := iurl.SchemeFromURL(url)
 	if err != nil {
 		return nil, err
@@ -94,8 +299,7 @@ func Open(url string) (Driver, error) {
 	if !ok {
 		return nil, fmt.Errorf("database driver: unknown driver %v (forgotten import?)", scheme)
 	}
-
-	return d.Open(url)
+	return d, nil
 }
 
 // Register globally registers a driver.
@@ -1,7 +1,9 @@
 package database
 
 import (
+	"fmt"
 	"io"
+	"strings"
 	"testing"
 )
 
@@ -113,3 +115,46 @@ func TestOpen(t *testing.T) {
 		})
 	}
 }
+
+type loggingMockDriver struct {
+	mockDriver
+}
+
+func (m *loggingMockDriver) OpenWithLogger(url string, l Logger) (Driver, error) {
+	l.Printf("opening %v", url)
+	return m.Open(url)
+}
+
+type stringLogger struct {
+	strings.Builder
+}
+
+func (l *stringLogger) Printf(format string, v ...interface{}) {
+	fmt.Fprintf(&l.Builder, format, v...)
+}
+
+func TestOpenWithLogger(t *testing.T) {
+	func() {
+		defer func() {
+			_ = recover()
+		}()
+		Register("mock", &mockDriver{})
+	}()
+	Register("loggingmock", &loggingMockDriver{})
+
+	var l stringLogger
+	if _, err := OpenWithLogger("loggingmock://db", &l); err != nil {
+		t.Fatal(err)
+	}
+	if expected := "opening loggingmock://db"; l.String() != expected {
+		t.Fatalf("expected %q, got %q", expected, l.String())
+	}
+
+	// drivers not implementing LoggingOpener are opened with Open
+	if _, err := OpenWithLogger("mock://db", &l); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := OpenWithLogger("unknown://db", &l); err == nil {
+		t.Fatal("expected an error for an unknown driver")
+	}
+}
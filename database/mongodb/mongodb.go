@@ -1,12 +1,16 @@
 package mongodb
 
 import (
+	"bytes"
 	"context"
+	"errors"
 	"fmt"
 	"io"
 	"net/url"
 	"os"
+	"regexp"
 	"strconv"
+	"strings"
 	"time"
 
 	"github.com/cenkalti/backoff/v4"
@@ -27,18 +31,25 @@ func init() {
 
 var DefaultMigrationsCollection = "schema_migrations"
 
+// documentSeparator matches the lines separating the command documents of
+// a migration.
+var documentSeparator = regexp.MustCompile(`(?m)^---[ \t]*\r?$`)
+
 const DefaultLockingCollection = "migrate_advisory_lock" // the collection to use for advisory locking by default.
 const lockKeyUniqueValue = 0                             // the unique value to lock on. If multiple clients try to insert the same key, it will fail (locked).
 const DefaultLockTimeout = 15                            // the default maximum time to wait for a lock to be released.
 const DefaultLockTimeoutInterval = 10                    // the default maximum intervals time for the locking timout.
 const DefaultAdvisoryLockingFlag = true                  // the default value for the advisory locking feature flag. Default is true.
 const LockIndexName = "lock_unique_key"                  // the name of the index which adds unique constraint to the locking_key field.
+const LockTTLIndexName = "lock_ttl"                      // the name of the TTL index expiring lock documents on the created_at field.
 const contextWaitTimeout = 5 * time.Second               // how long to wait for the request to mongo to block/wait for.
 
 var (
 	ErrNoDatabaseName            = fmt.Errorf("no database name")
 	ErrNilConfig                 = fmt.Errorf("no config")
 	ErrLockTimeoutConfigConflict = fmt.Errorf("both x-advisory-lock-timeout-interval and x-advisory-lock-timout-interval were specified")
+
+	errLockHeld = errors.New("lock is held by another client")
 )
 
 type Mongo struct {
@@ -53,6 +64,10 @@ type Locking struct {
 	Timeout        int
 	Enabled        bool
 	Interval       int
+	// TTL is the number of seconds after which a lock document expires, so
+	// that a migrator which died holding the lock doesn't block the others
+	// forever. Zero disables expiry.
+	TTL int
 }
 type Config struct {
 	DatabaseName         string
@@ -154,6 +169,10 @@ func (m *Mongo) Open(dsn string) (database.Driver, error) {
 
 	maxLockCheckInterval, err := parseInt(lockTimeout, DefaultLockTimeoutInterval)
 
+	if err != nil {
+		return nil, err
+	}
+	lockTTL, err := parseInt(unknown.Get("x-advisory-lock-ttl"), 0)
 	if err != nil {
 		return nil, err
 	}
@@ -174,6 +193,7 @@ func (m *Mongo) Open(dsn string) (database.Driver, error) {
 			Timeout:        lockingTimout,
 			Enabled:        advisoryLockingFlag,
 			Interval:       maxLockCheckInterval,
+			TTL:            lockTTL,
 		},
 	})
 	if err != nil {
@@ -245,10 +265,9 @@ func (m *Mongo) Run(migration io.Reader) error {
 	if err != nil {
 		return err
 	}
-	var cmds []bson.D
-	err = bson.UnmarshalExtJSON(migr, true, &cmds)
+	cmds, err := parseCommands(migr)
 	if err != nil {
-		return fmt.Errorf("unmarshaling json error: %s", err)
+		return err
 	}
 	if m.config.TransactionMode {
 		if err := m.executeCommandsWithTransaction(context.TODO(), cmds); err != nil {
@@ -262,6 +281,32 @@ func (m *Mongo) Run(migration io.Reader) error {
 	return nil
 }
 
+// parseCommands parses a migration into the commands to run. A migration is
+// either a JSON array of commands, or a sequence of JSON command documents
+// separated by lines holding only the --- YAML document separator.
+func parseCommands(migr []byte) ([]bson.D, error) {
+	if trimmed := bytes.TrimSpace(migr); len(trimmed) == 0 || trimmed[0] == '[' {
+		var cmds []bson.D
+		if err := bson.UnmarshalExtJSON(migr, true, &cmds); err != nil {
+			return nil, fmt.Errorf("unmarshaling json error: %s", err)
+		}
+		return cmds, nil
+	}
+
+	var cmds []bson.D
+	for i, doc := range documentSeparator.Split(string(migr), -1) {
+		if strings.TrimSpace(doc) == "" {
+			continue
+		}
+		var cmd bson.D
+		if err := bson.UnmarshalExtJSON([]byte(doc), true, &cmd); err != nil {
+			return nil, fmt.Errorf("unmarshaling json error in document %d: %s", i+1, err)
+		}
+		cmds = append(cmds, cmd)
+	}
+	return cmds, nil
+}
+
 func (m *Mongo) executeCommandsWithTransaction(ctx context.Context, cmds []bson.D) error {
 	err := m.db.Client().UseSession(ctx, func(sessionContext mongo.SessionContext) error {
 		if err := sessionContext.StartTransaction(); err != nil {
@@ -284,10 +329,17 @@ func (m *Mongo) executeCommandsWithTransaction(ctx context.Context, cmds []bson.
 }
 
 func (m *Mongo) executeCommands(ctx context.Context, cmds []bson.D) error {
-	for _, cmd := range cmds {
-		err := m.db.RunCommand(ctx, cmd).Err()
-		if err != nil {
-			return &database.Error{OrigErr: err, Err: fmt.Sprintf("failed to execute command:%v", cmd)}
+	return runCommands(ctx, cmds, func(ctx context.Context, cmd bson.D) error {
+		return m.db.RunCommand(ctx, cmd).Err()
+	})
+}
+
+// runCommands runs cmds in order with run, stopping at the first failing
+// command, whose 1-based index is reported in the error.
+func runCommands(ctx context.Context, cmds []bson.D, run func(ctx context.Context, cmd bson.D) error) error {
+	for i, cmd := range cmds {
+		if err := run(ctx, cmd); err != nil {
+			return &database.Error{OrigErr: err, Err: fmt.Sprintf("failed to execute command %d of %d:%v", i+1, len(cmds), cmd)}
 		}
 	}
 	return nil
@@ -312,6 +364,16 @@ func (m *Mongo) ensureLockTable() error {
 	if err != nil {
 		return err
 	}
+	if m.config.Locking.TTL > 0 {
+		// expired lock documents are removed by the server in the background
+		_, err = indexes.CreateOne(context.TODO(), mongo.IndexModel{
+			Options: options.Index().SetExpireAfterSeconds(int32(m.config.Locking.TTL)).SetName(LockTTLIndexName),
+			Keys:    bson.D{{Key: "created_at", Value: 1}},
+		})
+		if err != nil {
+			return err
+		}
+	}
 	return nil
 }
 
@@ -343,7 +405,8 @@ func (m *Mongo) ensureVersionTable() (err error) {
 }
 
 // Utilizes advisory locking on the config.LockingCollection collection
-// This uses a unique index on the `locking_key` field.
+// The lock document is claimed atomically with findOneAndUpdate, upserting
+// it with $setOnInsert. This uses a unique index on the `locking_key` field.
 func (m *Mongo) Lock() error {
 	return database.CasRestoreOnErr(&m.isLocked, false, true, database.ErrLocked, func() error {
 		if !m.config.Locking.Enabled {
@@ -357,16 +420,40 @@ func (m *Mongo) Lock() error {
 		}
 
 		newLockObj := lockObj{
-			Key:       lockKeyUniqueValue,
-			Pid:       pid,
-			Hostname:  hostname,
-			CreatedAt: time.Now(),
+			Key:      lockKeyUniqueValue,
+			Pid:      pid,
+			Hostname: hostname,
 		}
+		// the lock document is only inserted if there is none, which
+		// findOneAndUpdate reports by finding no document before the update
+		opts := options.FindOneAndUpdate().SetUpsert(true).SetReturnDocument(options.Before)
 		operation := func() error {
+			// the TTL counts from when the lock is claimed
+			newLockObj.CreatedAt = time.Now()
+			update := bson.M{"$setOnInsert": newLockObj}
 			timeout, cancelFunc := context.WithTimeout(context.Background(), contextWaitTimeout)
-			_, err := m.db.Collection(m.config.Locking.CollectionName).InsertOne(timeout, newLockObj)
 			defer cancelFunc()
-			return err
+			if m.config.Locking.TTL > 0 {
+				// take over an expired lock without waiting for the TTL index
+				expired := bson.M{
+					"locking_key": lockKeyUniqueValue,
+					"created_at":  bson.M{"$lt": time.Now().Add(-time.Duration(m.config.Locking.TTL) * time.Second)},
+				}
+				if _, err := m.db.Collection(m.config.Locking.CollectionName).DeleteOne(timeout, expired); err != nil {
+					return err
+				}
+			}
+			err := m.db.Collection(m.config.Locking.CollectionName).
+				FindOneAndUpdate(timeout, findFilter{Key: lockKeyUniqueValue}, update, opts).Err()
+			switch {
+			case errors.Is(err, mongo.ErrNoDocuments):
+				return nil
+			case err == nil:
+				return errLockHeld
+			default:
+				// concurrent upserts fail on the unique index
+				return err
+			}
 		}
 		exponentialBackOff := backoff.NewExponentialBackOff()
 		duration := time.Duration(m.config.Locking.Timeout) * time.Second
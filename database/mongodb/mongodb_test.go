@@ -3,7 +3,9 @@ package mongodb
 import (
 	"bytes"
 	"context"
+	"errors"
 	"fmt"
+	"strings"
 
 	"log"
 
@@ -23,6 +25,7 @@ import (
 )
 
 import (
+	"github.com/golang-migrate/migrate/v4/database"
 	dt "github.com/golang-migrate/migrate/v4/database/testing"
 	"github.com/golang-migrate/migrate/v4/dktesting"
 	_ "github.com/golang-migrate/migrate/v4/source/file"
@@ -428,3 +431,64 @@ func waitForReplicaInit(client *mongo.Client) error {
 	}
 
 }
+
+func TestParseCommands(t *testing.T) {
+	insert := bson.D{{Key: "insert", Value: "hello"}, {Key: "documents", Value: bson.A{bson.D{{Key: "wild", Value: "world"}}}}}
+	ping := bson.D{{Key: "ping", Value: int32(1)}}
+
+	testCases := []struct {
+		name     string
+		migr     string
+		expected []bson.D
+	}{
+		{name: "array", migr: `[{"insert":"hello","documents":[{"wild":"world"}]},{"ping":1}]`, expected: []bson.D{insert, ping}},
+		{name: "empty array", migr: " []\n", expected: []bson.D{}},
+		{name: "single document", migr: `{"ping":1}`, expected: []bson.D{ping}},
+		{name: "documents", migr: "{\"insert\":\"hello\",\n\"documents\":[{\"wild\":\"world\"}]}\n---\n{\"ping\":1}\n", expected: []bson.D{insert, ping}},
+		{name: "leading and trailing separators", migr: "---\n{\"ping\":1}\n--- \r\n", expected: []bson.D{ping}},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			cmds, err := parseCommands([]byte(tc.migr))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if fmt.Sprint(cmds) != fmt.Sprint(tc.expected) {
+				t.Fatalf("expected %v, got %v", tc.expected, cmds)
+			}
+		})
+	}
+
+	if _, err := parseCommands([]byte("{\"ping\":1}\n---\n{ping}")); err == nil {
+		t.Fatal("expected an error for an invalid document")
+	}
+}
+
+func TestRunCommands(t *testing.T) {
+	cmds, err := parseCommands([]byte(`[{"ping":1},{"insert":"hello","documents":[]},{"drop":"hello"},{"ping":1}]`))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var ran []string
+	errDrop := fmt.Errorf("drop failed")
+	err = runCommands(context.Background(), cmds, func(ctx context.Context, cmd bson.D) error {
+		ran = append(ran, cmd[0].Key)
+		if cmd[0].Key == "drop" {
+			return errDrop
+		}
+		return nil
+	})
+
+	// commands run in order until the first failure
+	if fmt.Sprint(ran) != "[ping insert drop]" {
+		t.Fatalf("expected ping, insert and drop to run, got %v", ran)
+	}
+	var dbErr *database.Error
+	if !errors.As(err, &dbErr) || !errors.Is(dbErr.OrigErr, errDrop) {
+		t.Fatalf("expected a database.Error wrapping the drop error, got %v", err)
+	}
+	if !strings.Contains(dbErr.Err, "command 3 of 4") {
+		t.Fatalf("expected the error to report command 3 of 4, got %q", dbErr.Err)
+	}
+}
@@ -8,10 +8,13 @@ import (
 	"crypto/tls"
 	"crypto/x509"
 	"database/sql"
+	sqldriver "database/sql/driver"
+	"errors"
 	"fmt"
 	"io"
 	nurl "net/url"
 	"os"
+	"regexp"
 	"strconv"
 	"strings"
 	"time"
@@ -20,6 +23,7 @@ import (
 
 	"github.com/go-sql-driver/mysql"
 	"github.com/golang-migrate/migrate/v4/database"
+	"github.com/golang-migrate/migrate/v4/database/sqlutil"
 	"github.com/hashicorp/go-multierror"
 )
 
@@ -31,19 +35,104 @@ func init() {
 
 var DefaultMigrationsTable = "schema_migrations"
 
+var (
+	DefaultMigrationsTableEngine  = "InnoDB"
+	DefaultMigrationsTableCharset = "utf8mb4"
+	DefaultVersionColumnType      = "bigint"
+	DefaultDirtyColumnType        = "boolean"
+)
+
+var (
+	// splitter splits migrations into statements like the mysql client
+	splitter = sqlutil.StatementSplitter{Quotes: "'\"`", BackslashEscapes: true, HashComments: true, DelimiterCommand: true}
+	// delimiterCommand matches migrations using the DELIMITER command of the
+	// mysql client, which the server doesn't know
+	delimiterCommand = regexp.MustCompile(`(?im)^\s*DELIMITER\s+\S`)
+	// tableOption matches the engines, charsets and collations of the
+	// migrations table, which are not quoted in CREATE TABLE
+	tableOption = regexp.MustCompile(`^[A-Za-z0-9_]+$`)
+)
+
+var (
+	DefaultLockTable   = "schema_lock"
+	DefaultLockTimeout = 10 * time.Second
+)
+
+const (
+	// LockStrategyAdvisory locks using GET_LOCK and RELEASE_LOCK.
+	LockStrategyAdvisory = "advisory"
+	// LockStrategyTable locks by inserting a row into a dedicated lock
+	// table, for environments where GET_LOCK is unreliable, e.g. behind
+	// some proxies.
+	LockStrategyTable = "table"
+)
+
 var (
 	ErrDatabaseDirty    = fmt.Errorf("database is dirty")
 	ErrNilConfig        = fmt.Errorf("no config")
 	ErrNoDatabaseName   = fmt.Errorf("no database name")
 	ErrAppendPEM        = fmt.Errorf("failed to append PEM")
 	ErrTLSCertKeyConfig = fmt.Errorf("To use TLS client authentication, both x-tls-cert and x-tls-key must not be empty")
+	ErrNoParentDB       = fmt.Errorf("cannot reconnect without a parent *sql.DB")
+	ErrLockLost         = fmt.Errorf("lock lost while reconnecting")
+	ErrLockStrategy     = fmt.Errorf("lock strategy must be either %q or %q", LockStrategyAdvisory, LockStrategyTable)
+	ErrVersionIsolation = fmt.Errorf("version isolation must be one of read-uncommitted, read-committed, repeatable-read or serializable")
+	ErrTableOption      = fmt.Errorf("migrations table engine, charset and collation must be made of letters, digits and underscores")
 )
 
+// versionIsolationLevels maps the values of x-version-isolation to the
+// isolation levels supported by MySQL.
+var versionIsolationLevels = map[string]sql.IsolationLevel{
+	"read-uncommitted": sql.LevelReadUncommitted,
+	"read-committed":   sql.LevelReadCommitted,
+	"repeatable-read":  sql.LevelRepeatableRead,
+	"serializable":     sql.LevelSerializable,
+}
+
 type Config struct {
 	MigrationsTable  string
 	DatabaseName     string
 	NoLock           bool
 	StatementTimeout time.Duration
+	// LockTimeout is how long GET_LOCK waits for the lock.
+	// Defaults to DefaultLockTimeout.
+	LockTimeout time.Duration
+	// LockStrategy is either LockStrategyAdvisory (the default) or
+	// LockStrategyTable.
+	LockStrategy string
+	// LockTable is the name of the lock table used by LockStrategyTable.
+	// Defaults to DefaultLockTable.
+	LockTable string
+	// LockID overrides the lock id generated from the database and
+	// migrations table names. It has to be a bigint.
+	LockID string
+	// MigrationsTableSchema is the database holding the migrations table,
+	// if not DatabaseName, like admin for `admin`.`schema_migrations`.
+	MigrationsTableSchema string
+	// VersionIsolation is the isolation level of the SetVersion
+	// transaction. Defaults to sql.LevelSerializable.
+	VersionIsolation sql.IsolationLevel
+	// OnlineDDL, if set, runs migrations made of a single ALTER TABLE
+	// statement with an external tool.
+	OnlineDDL *OnlineDDL
+	// StripComments removes the comments of migrations before running them,
+	// for proxies that can't handle them. Conditional comments like
+	// /*!50100 ... */ are kept.
+	StripComments bool
+	// MigrationsTableEngine is the storage engine of the migrations table.
+	// Defaults to DefaultMigrationsTableEngine.
+	MigrationsTableEngine string
+	// MigrationsTableCharset is the default character set of the migrations
+	// table. Defaults to DefaultMigrationsTableCharset.
+	MigrationsTableCharset string
+	// MigrationsTableCollation is the default collation of the migrations
+	// table, the default collation of its charset if empty.
+	MigrationsTableCollation string
+	// VersionColumnType and DirtyColumnType are the column types of a new
+	// migrations table, default to DefaultVersionColumnType and
+	// DefaultDirtyColumnType.
+	VersionColumnType string
+	DirtyColumnType   string
 }
 
 type Mysql struct {
@@ -90,6 +179,69 @@ func WithConnection(ctx context.Context, conn *sql.Conn, config *Config) (*Mysql
 		config.MigrationsTable = DefaultMigrationsTable
 	}
 
+	if config.LockTimeout == 0 {
+		config.LockTimeout = DefaultLockTimeout
+	}
+
+	switch config.LockStrategy {
+	case "":
+		config.LockStrategy = LockStrategyAdvisory
+	case LockStrategyAdvisory, LockStrategyTable:
+	default:
+		return nil, ErrLockStrategy
+	}
+
+	if len(config.LockTable) == 0 {
+		config.LockTable = DefaultLockTable
+	}
+
+	if config.LockID != "" {
+		lockID, err := database.ParseAdvisoryLockId(config.LockID)
+		if err != nil {
+			return nil, err
+		}
+		config.LockID = lockID
+	}
+
+	switch config.VersionIsolation {
+	case sql.LevelDefault:
+		config.VersionIsolation = sql.LevelSerializable
+	case sql.LevelReadUncommitted, sql.LevelReadCommitted, sql.LevelRepeatableRead, sql.LevelSerializable:
+	default:
+		return nil, ErrVersionIsolation
+	}
+
+	if len(config.MigrationsTableEngine) == 0 {
+		config.MigrationsTableEngine = DefaultMigrationsTableEngine
+	}
+	if len(config.MigrationsTableCharset) == 0 {
+		config.MigrationsTableCharset = DefaultMigrationsTableCharset
+	}
+	for _, option := range []string{config.MigrationsTableEngine, config.MigrationsTableCharset, config.MigrationsTableCollation} {
+		if option != "" && !tableOption.MatchString(option) {
+			return nil, ErrTableOption
+		}
+	}
+
+	var err error
+	if config.VersionColumnType, err = database.ParseColumnType(config.VersionColumnType, DefaultVersionColumnType); err != nil {
+		return nil, err
+	}
+	if config.DirtyColumnType, err = database.ParseColumnType(config.DirtyColumnType, DefaultDirtyColumnType); err != nil {
+		return nil, err
+	}
+
+	if config.OnlineDDL != nil {
+		if err := config.OnlineDDL.init(); err != nil {
+			return nil, err
+		}
+	}
+
+	// ensureVersionTable is a locking operation, so we need to ensureLockTable before we ensureVersionTable.
+	if err := mx.ensureLockTable(); err != nil {
+		return nil, err
+	}
+
 	if err := mx.ensureVersionTable(); err != nil {
 		return nil, err
 	}
@@ -226,6 +378,11 @@ func urlToMySQLConfig(url string) (*mysql.Config, error) {
 }
 
 func (m *Mysql) Open(url string) (database.Driver, error) {
+	return m.OpenWithLogger(url, nil)
+}
+
+// OpenWithLogger implements database.LoggingOpener.
+func (m *Mysql) OpenWithLogger(url string, l database.Logger) (database.Driver, error) {
 	config, err := urlToMySQLConfig(url)
 	if err != nil {
 		return nil, err
@@ -253,16 +410,72 @@ func (m *Mysql) Open(url string) (database.Driver, error) {
 		}
 	}
 
+	lockTimeoutParam := customParams["x-lock-timeout"]
+	lockTimeout := 0
+	if lockTimeoutParam != "" {
+		lockTimeout, err = strconv.Atoi(lockTimeoutParam)
+		if err != nil {
+			return nil, fmt.Errorf("could not parse x-lock-timeout as int: %w", err)
+		}
+	}
+
+	var versionIsolation sql.IsolationLevel
+	if s := customParams["x-version-isolation"]; s != "" {
+		level, ok := versionIsolationLevels[s]
+		if !ok {
+			return nil, fmt.Errorf("%w, got %q", ErrVersionIsolation, s)
+		}
+		versionIsolation = level
+	}
+
+	stripComments := false
+	if s := customParams["x-strip-comments"]; s != "" {
+		stripComments, err = strconv.ParseBool(s)
+		if err != nil {
+			return nil, fmt.Errorf("could not parse x-strip-comments as bool: %w", err)
+		}
+	}
+
+	var onlineDDL *OnlineDDL
+	if tool := customParams["x-online-ddl"]; tool != "" {
+		onlineDDL = newOnlineDDL(tool, config, l)
+	}
+
 	db, err := sql.Open("mysql", config.FormatDSN())
 	if err != nil {
 		return nil, err
 	}
 
+	connectRetry, err := sqlutil.ParseConnectRetry(customParams["x-connect-retries"], customParams["x-connect-retry-interval"])
+	if err != nil {
+		return nil, err
+	}
+	connectRetry.OnRetry = sqlutil.LogRetries(l)
+	if connectRetry.Retries > 0 {
+		if err := connectRetry.Ping(context.Background(), db); err != nil {
+			db.Close()
+			return nil, err
+		}
+	}
+
 	mx, err := WithInstance(db, &Config{
-		DatabaseName:     config.DBName,
-		MigrationsTable:  customParams["x-migrations-table"],
-		NoLock:           noLock,
-		StatementTimeout: time.Duration(statementTimeout) * time.Millisecond,
+		DatabaseName:             config.DBName,
+		MigrationsTable:          customParams["x-migrations-table"],
+		MigrationsTableSchema:    customParams["x-migrations-table-schema"],
+		NoLock:                   noLock,
+		StatementTimeout:         time.Duration(statementTimeout) * time.Millisecond,
+		LockTimeout:              time.Duration(lockTimeout) * time.Second,
+		LockStrategy:             customParams["x-lock-strategy"],
+		LockTable:                customParams["x-lock-table"],
+		LockID:                   customParams["x-lock-id"],
+		VersionIsolation:         versionIsolation,
+		OnlineDDL:                onlineDDL,
+		StripComments:            stripComments,
+		MigrationsTableEngine:    customParams["x-migrations-table-engine"],
+		MigrationsTableCharset:   customParams["x-migrations-table-charset"],
+		MigrationsTableCollation: customParams["x-migrations-table-collation"],
+		VersionColumnType:        customParams["x-version-column-type"],
+		DirtyColumnType:          customParams["x-dirty-column-type"],
 	})
 	if err != nil {
 		return nil, err
@@ -284,43 +497,142 @@ func (m *Mysql) Close() error {
 	return nil
 }
 
+// Capabilities implements database.CapabilitiesDriver.
+// Schema changes in MySQL cause an implicit commit, so migrations
+// can't be wrapped in a transaction.
+func (m *Mysql) Capabilities() database.Capabilities {
+	return database.Capabilities{
+		SupportsMultiStatement: true,
+		SupportsLocking:        !m.config.NoLock,
+	}
+}
+
+// Describe implements database.Describer.
+// Databases are the closest to schemas in MySQL, and a migrations table
+// always lives in the database of the connection.
+func (m *Mysql) Describe() (database.DriverInfo, error) {
+	return database.DriverInfo{
+		Name:                  "mysql",
+		Capabilities:          m.Capabilities(),
+		SupportsAdvisoryLocks: !m.config.NoLock && m.config.LockStrategy != LockStrategyTable,
+	}, nil
+}
+
+// lockID returns Config.LockID if set, or else the lock id generated from
+// the database and migrations table names.
+func (m *Mysql) lockID() (string, error) {
+	if m.config.LockID != "" {
+		return m.config.LockID, nil
+	}
+	if m.config.MigrationsTableSchema != "" {
+		return database.GenerateAdvisoryLockId(
+			fmt.Sprintf("%s:%s.%s", m.config.DatabaseName, m.config.MigrationsTableSchema, m.config.MigrationsTable))
+	}
+	return database.GenerateAdvisoryLockId(
+		fmt.Sprintf("%s:%s", m.config.DatabaseName, m.config.MigrationsTable))
+}
+
+// migrationsTable returns the quoted name of the migrations table,
+// qualified with MigrationsTableSchema if set.
+func (m *Mysql) migrationsTable() string {
+	if m.config.MigrationsTableSchema != "" {
+		return "`" + m.config.MigrationsTableSchema + "`.`" + m.config.MigrationsTable + "`"
+	}
+	return "`" + m.config.MigrationsTable + "`"
+}
+
+// createMigrationsTable returns the CREATE TABLE statement of the
+// migrations table, with its table options.
+func (m *Mysql) createMigrationsTable() string {
+	query := "CREATE TABLE " + m.migrationsTable() + " (version " + m.config.VersionColumnType + " not null primary key, dirty " + m.config.DirtyColumnType + " not null)"
+	if m.config.MigrationsTableEngine != "" {
+		query += " ENGINE=" + m.config.MigrationsTableEngine
+	}
+	if m.config.MigrationsTableCharset != "" {
+		query += " DEFAULT CHARSET=" + m.config.MigrationsTableCharset
+	}
+	if m.config.MigrationsTableCollation != "" {
+		query += " COLLATE=" + m.config.MigrationsTableCollation
+	}
+	return query
+}
+
+// migrationsTableInDatabase reports whether the migrations table is one of
+// the tables of DatabaseName.
+func (m *Mysql) migrationsTableInDatabase() bool {
+	return m.config.MigrationsTableSchema == "" || m.config.MigrationsTableSchema == m.config.DatabaseName
+}
+
 func (m *Mysql) Lock() error {
 	return database.CasRestoreOnErr(&m.isLocked, false, true, database.ErrLocked, func() error {
 		if m.config.NoLock {
 			return nil
 		}
-		aid, err := database.GenerateAdvisoryLockId(
-			fmt.Sprintf("%s:%s", m.config.DatabaseName, m.config.MigrationsTable))
+		aid, err := m.lockID()
 		if err != nil {
 			return err
 		}
 
-		query := "SELECT GET_LOCK(?, 10)"
-		var success bool
-		if err := m.conn.QueryRowContext(context.Background(), query, aid).Scan(&success); err != nil {
-			return &database.Error{OrigErr: err, Err: "try lock failed", Query: []byte(query)}
-		}
-
-		if !success {
-			return database.ErrLocked
+		if m.config.LockStrategy == LockStrategyTable {
+			return m.lockTable(aid)
 		}
 
-		return nil
+		return m.getLock(context.Background(), m.conn, aid)
 	})
 }
 
+// getLock acquires the advisory lock aid for the session of conn.
+func (m *Mysql) getLock(ctx context.Context, conn *sql.Conn, aid string) error {
+	query := "SELECT GET_LOCK(?, ?)"
+	var success bool
+	if err := conn.QueryRowContext(ctx, query, aid, int(m.config.LockTimeout.Seconds())).Scan(&success); err != nil {
+		return &database.Error{OrigErr: err, Err: "try lock failed", Query: []byte(query)}
+	}
+
+	if !success {
+		return database.ErrLocked
+	}
+
+	return nil
+}
+
+// lockTable acquires the lock by inserting a row into the lock table.
+// No row is affected if the row already exists, i.e. the lock is held.
+func (m *Mysql) lockTable(aid string) error {
+	query := "INSERT INTO `" + m.config.LockTable + "` (lock_id) VALUES (?) ON DUPLICATE KEY UPDATE lock_id = lock_id"
+	result, err := m.conn.ExecContext(context.Background(), query, aid)
+	if err != nil {
+		return &database.Error{OrigErr: err, Err: "try lock failed", Query: []byte(query)}
+	}
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return &database.Error{OrigErr: err, Err: "try lock failed", Query: []byte(query)}
+	}
+	if affected == 0 {
+		return database.ErrLocked
+	}
+	return nil
+}
+
 func (m *Mysql) Unlock() error {
 	return database.CasRestoreOnErr(&m.isLocked, true, false, database.ErrNotLocked, func() error {
 		if m.config.NoLock {
 			return nil
 		}
 
-		aid, err := database.GenerateAdvisoryLockId(
-			fmt.Sprintf("%s:%s", m.config.DatabaseName, m.config.MigrationsTable))
+		aid, err := m.lockID()
 		if err != nil {
 			return err
 		}
 
+		if m.config.LockStrategy == LockStrategyTable {
+			query := "DELETE FROM `" + m.config.LockTable + "` WHERE lock_id = ?"
+			if _, err := m.conn.ExecContext(context.Background(), query, aid); err != nil {
+				return &database.Error{OrigErr: err, Err: "failed to release migration lock", Query: []byte(query)}
+			}
+			return nil
+		}
+
 		query := `SELECT RELEASE_LOCK(?)`
 		if _, err := m.conn.ExecContext(context.Background(), query, aid); err != nil {
 			return &database.Error{OrigErr: err, Query: []byte(query)}
@@ -335,33 +647,143 @@ func (m *Mysql) Unlock() error {
 }
 
 func (m *Mysql) Run(migration io.Reader) error {
+	return m.RunContext(context.Background(), migration)
+}
+
+// RunContext implements database.ContextRunner. A deadline of ctx replaces
+// StatementTimeout for the migration.
+func (m *Mysql) RunContext(ctx context.Context, migration io.Reader) error {
 	migr, err := io.ReadAll(migration)
 	if err != nil {
 		return err
 	}
+	if m.config.StripComments {
+		migr = splitter.StripComments(migr)
+	}
 
-	ctx := context.Background()
-	if m.config.StatementTimeout != 0 {
+	_, hasDeadline := ctx.Deadline()
+	if !hasDeadline && m.config.StatementTimeout != 0 {
 		var cancel context.CancelFunc
 		ctx, cancel = context.WithTimeout(ctx, m.config.StatementTimeout)
 		defer cancel()
 	}
 
 	query := string(migr[:])
-	if _, err := m.conn.ExecContext(ctx, query); err != nil {
-		return database.Error{OrigErr: err, Err: "migration failed", Query: migr}
+	if m.config.OnlineDDL != nil {
+		if db, table, alter, ok := parseAlterTable(query); ok {
+			if db == "" {
+				db = m.config.DatabaseName
+			}
+			if err := m.config.OnlineDDL.run(ctx, db, table, alter); err != nil {
+				return database.Error{OrigErr: err, Err: "migration failed", Query: migr}
+			}
+			return nil
+		}
 	}
 
+	queries := []string{query}
+	if delimiterCommand.MatchString(query) {
+		if queries, err = splitStatements(query); err != nil {
+			return database.Error{OrigErr: err, Err: "migration failed", Query: migr}
+		}
+	}
+
+	for _, query := range queries {
+		if !hasDeadline && m.config.StatementTimeout != 0 {
+			query = withMaxExecutionTime(query, m.config.StatementTimeout)
+		}
+		_, err = m.conn.ExecContext(ctx, query)
+		if isBadConn(err) {
+			// the server may have closed the connection, e.g. after wait_timeout
+			if rerr := m.reconnect(ctx); rerr != nil {
+				return database.Error{OrigErr: multierror.Append(err, rerr), Err: "migration failed", Query: migr}
+			}
+			_, err = m.conn.ExecContext(ctx, query)
+		}
+		if err != nil {
+			return database.Error{OrigErr: err, Err: "migration failed", Query: migr}
+		}
+	}
+
+	return nil
+}
+
+// splitStatements splits query into its statements, leaving out blank ones.
+func splitStatements(query string) ([]string, error) {
+	var stmts []string
+	err := splitter.Split(strings.NewReader(query), len(query)+1, func(stmt []byte) bool {
+		if len(strings.TrimSpace(string(stmt))) > 0 {
+			stmts = append(stmts, string(stmt))
+		}
+		return true
+	})
+	return stmts, err
+}
+
+// withMaxExecutionTime prepends setting max_execution_time to query, so
+// MySQL enforces the statement timeout on the server even if the client
+// connection is lost.
+func withMaxExecutionTime(query string, timeout time.Duration) string {
+	return fmt.Sprintf("SET SESSION max_execution_time=%d;\n%s", timeout.Milliseconds(), query)
+}
+
+// Ping implements database.Pinger. It verifies the connection used by the
+// driver is still alive.
+func (m *Mysql) Ping(ctx context.Context) error {
+	return m.conn.PingContext(ctx)
+}
+
+// reconnect replaces the driver's connection with a new one from the parent
+// *sql.DB. This is not possible for drivers created with WithConnection.
+// Session state is lost along with the old connection, so the advisory lock
+// is acquired again on the new one if it was held. If another process took
+// it in the meantime, ErrLockLost is returned and the old connection is
+// kept, so that nothing runs without the lock.
+func (m *Mysql) reconnect(ctx context.Context) error {
+	if m.db == nil {
+		return ErrNoParentDB
+	}
+	conn, err := m.db.Conn(ctx)
+	if err != nil {
+		return err
+	}
+	if m.isLocked.Load() && !m.config.NoLock && m.config.LockStrategy != LockStrategyTable {
+		aid, err := m.lockID()
+		if err == nil {
+			err = m.getLock(ctx, conn, aid)
+		}
+		if err != nil {
+			_ = conn.Close()
+			return fmt.Errorf("%w: %v", ErrLockLost, err)
+		}
+	}
+	// the old connection is broken, so errors closing it don't matter
+	_ = m.conn.Close()
+	m.conn = conn
 	return nil
 }
 
+// isBadConn reports whether err means the connection was unusable before
+// the query was sent, so that it is safe to run it again on a new
+// connection. mysql.ErrInvalidConn is not retried, since the query may have
+// been run when the connection broke.
+func isBadConn(err error) bool {
+	return errors.Is(err, sqldriver.ErrBadConn)
+}
+
 func (m *Mysql) SetVersion(version int, dirty bool) error {
-	tx, err := m.conn.BeginTx(context.Background(), &sql.TxOptions{Isolation: sql.LevelSerializable})
+	tx, err := m.conn.BeginTx(context.Background(), &sql.TxOptions{Isolation: m.config.VersionIsolation})
+	if isBadConn(err) {
+		if rerr := m.reconnect(context.Background()); rerr != nil {
+			return &database.Error{OrigErr: multierror.Append(err, rerr), Err: "transaction start failed"}
+		}
+		tx, err = m.conn.BeginTx(context.Background(), &sql.TxOptions{Isolation: m.config.VersionIsolation})
+	}
 	if err != nil {
 		return &database.Error{OrigErr: err, Err: "transaction start failed"}
 	}
 
-	query := "DELETE FROM `" + m.config.MigrationsTable + "` LIMIT 1"
+	query := "DELETE FROM " + m.migrationsTable() + " LIMIT 1"
 	if _, err := tx.ExecContext(context.Background(), query); err != nil {
 		if errRollback := tx.Rollback(); errRollback != nil {
 			err = multierror.Append(err, errRollback)
@@ -373,7 +795,7 @@ func (m *Mysql) SetVersion(version int, dirty bool) error {
 	// empty schema version for failed down migration on the first migration
 	// See: https://github.com/golang-migrate/migrate/issues/330
 	if version >= 0 || (version == database.NilVersion && dirty) {
-		query := "INSERT INTO `" + m.config.MigrationsTable + "` (version, dirty) VALUES (?, ?)"
+		query := "INSERT INTO " + m.migrationsTable() + " (version, dirty) VALUES (?, ?)"
 		if _, err := tx.ExecContext(context.Background(), query, version, dirty); err != nil {
 			if errRollback := tx.Rollback(); errRollback != nil {
 				err = multierror.Append(err, errRollback)
@@ -390,7 +812,7 @@ func (m *Mysql) SetVersion(version int, dirty bool) error {
 }
 
 func (m *Mysql) Version() (version int, dirty bool, err error) {
-	query := "SELECT version, dirty FROM `" + m.config.MigrationsTable + "` LIMIT 1"
+	query := "SELECT version, dirty FROM " + m.migrationsTable() + " LIMIT 1"
 	err = m.conn.QueryRowContext(context.Background(), query).Scan(&version, &dirty)
 	switch {
 	case err == sql.ErrNoRows:
@@ -410,11 +832,34 @@ func (m *Mysql) Version() (version int, dirty bool, err error) {
 }
 
 func (m *Mysql) Drop() (err error) {
+	return m.drop(context.Background(), false)
+}
+
+// DropWithOptions implements database.DropOptionsDriver.
+func (m *Mysql) DropWithOptions(ctx context.Context, opts database.DropOptions) error {
+	return m.drop(ctx, opts.KeepMigrationsTable)
+}
+
+// DropList implements database.DropLister. The migrations table is listed
+// as schema.table if it lives in another database.
+func (m *Mysql) DropList(ctx context.Context, opts database.DropOptions) ([]string, error) {
+	tableNames, err := m.dropTables(ctx, opts.KeepMigrationsTable)
+	if err != nil {
+		return nil, err
+	}
+	if !opts.KeepMigrationsTable && !m.migrationsTableInDatabase() {
+		tableNames = append(tableNames, m.config.MigrationsTableSchema+"."+m.config.MigrationsTable)
+	}
+	return tableNames, nil
+}
+
+// dropTables returns the tables drop deletes.
+func (m *Mysql) dropTables(ctx context.Context, keepMigrationsTable bool) (_ []string, err error) {
 	// select all tables
 	query := `SHOW TABLES LIKE '%'`
-	tables, err := m.conn.QueryContext(context.Background(), query)
+	tables, err := m.conn.QueryContext(ctx, query)
 	if err != nil {
-		return &database.Error{OrigErr: err, Query: []byte(query)}
+		return nil, &database.Error{OrigErr: err, Query: []byte(query)}
 	}
 	defer func() {
 		if errClose := tables.Close(); errClose != nil {
@@ -422,25 +867,43 @@ func (m *Mysql) Drop() (err error) {
 		}
 	}()
 
-	// delete one table after another
 	tableNames := make([]string, 0)
 	for tables.Next() {
 		var tableName string
 		if err := tables.Scan(&tableName); err != nil {
-			return err
+			return nil, err
+		}
+
+		// do not drop the migrations table if asked to keep it
+		if keepMigrationsTable && m.migrationsTableInDatabase() && tableName == m.config.MigrationsTable {
+			continue
+		}
+		// do not drop the lock table while holding the lock
+		if m.config.LockStrategy == LockStrategyTable && tableName == m.config.LockTable {
+			continue
 		}
 		if len(tableName) > 0 {
 			tableNames = append(tableNames, tableName)
 		}
 	}
 	if err := tables.Err(); err != nil {
-		return &database.Error{OrigErr: err, Query: []byte(query)}
+		return nil, &database.Error{OrigErr: err, Query: []byte(query)}
+	}
+
+	return tableNames, nil
+}
+
+func (m *Mysql) drop(ctx context.Context, keepMigrationsTable bool) error {
+	tableNames, err := m.dropTables(ctx, keepMigrationsTable)
+	if err != nil {
+		return err
 	}
 
+	var query string
 	if len(tableNames) > 0 {
 		// disable checking foreign key constraints until finished
 		query = `SET foreign_key_checks = 0`
-		if _, err := m.conn.ExecContext(context.Background(), query); err != nil {
+		if _, err := m.conn.ExecContext(ctx, query); err != nil {
 			return &database.Error{OrigErr: err, Query: []byte(query)}
 		}
 
@@ -452,12 +915,20 @@ func (m *Mysql) Drop() (err error) {
 		// delete one by one ...
 		for _, t := range tableNames {
 			query = "DROP TABLE IF EXISTS `" + t + "`"
-			if _, err := m.conn.ExecContext(context.Background(), query); err != nil {
+			if _, err := m.conn.ExecContext(ctx, query); err != nil {
 				return &database.Error{OrigErr: err, Query: []byte(query)}
 			}
 		}
 	}
 
+	// the migrations table in another database goes with the tables
+	if !keepMigrationsTable && !m.migrationsTableInDatabase() {
+		query = "DROP TABLE IF EXISTS " + m.migrationsTable()
+		if _, err := m.conn.ExecContext(ctx, query); err != nil {
+			return &database.Error{OrigErr: err, Query: []byte(query)}
+		}
+	}
+
 	return nil
 }
 
@@ -482,6 +953,9 @@ func (m *Mysql) ensureVersionTable() (err error) {
 	// check if migration table exists
 	var result string
 	query := `SHOW TABLES LIKE '` + m.config.MigrationsTable + `'`
+	if m.config.MigrationsTableSchema != "" {
+		query = "SHOW TABLES FROM `" + m.config.MigrationsTableSchema + "` LIKE '" + m.config.MigrationsTable + "'"
+	}
 	if err := m.conn.QueryRowContext(context.Background(), query).Scan(&result); err != nil {
 		if err != sql.ErrNoRows {
 			return &database.Error{OrigErr: err, Query: []byte(query)}
@@ -491,7 +965,21 @@ func (m *Mysql) ensureVersionTable() (err error) {
 	}
 
 	// if not, create the empty migration table
-	query = "CREATE TABLE `" + m.config.MigrationsTable + "` (version bigint not null primary key, dirty boolean not null)"
+	query = m.createMigrationsTable()
+	if _, err := m.conn.ExecContext(context.Background(), query); err != nil {
+		return &database.Error{OrigErr: err, Query: []byte(query)}
+	}
+	return nil
+}
+
+// ensureLockTable creates the lock table used by LockStrategyTable,
+// if it doesn't exist yet.
+func (m *Mysql) ensureLockTable() error {
+	if m.config.NoLock || m.config.LockStrategy != LockStrategyTable {
+		return nil
+	}
+
+	query := "CREATE TABLE IF NOT EXISTS `" + m.config.LockTable + "` (lock_id varchar(32) not null primary key)"
 	if _, err := m.conn.ExecContext(context.Background(), query); err != nil {
 		return &database.Error{OrigErr: err, Query: []byte(query)}
 	}
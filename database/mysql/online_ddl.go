@@ -0,0 +1,262 @@
+//go:build go1.9
+// +build go1.9
+
+package mysql
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"os/exec"
+	"regexp"
+	"strings"
+
+	"github.com/go-sql-driver/mysql"
+	"github.com/golang-migrate/migrate/v4/database"
+)
+
+const (
+	// OnlineDDLPTOSC runs ALTER TABLE migrations with pt-online-schema-change.
+	OnlineDDLPTOSC = "ptosc"
+	// OnlineDDLGhost runs ALTER TABLE migrations with gh-ost.
+	OnlineDDLGhost = "ghost"
+)
+
+// onlineDDLTools maps the values of x-online-ddl to their executables.
+var onlineDDLTools = map[string]string{
+	OnlineDDLPTOSC: "pt-online-schema-change",
+	OnlineDDLGhost: "gh-ost",
+}
+
+var ErrOnlineDDL = fmt.Errorf("online ddl must be either %q or %q", OnlineDDLPTOSC, OnlineDDLGhost)
+
+// maxOnlineDDLErrOutput is how many bytes of the end of the output of the
+// tool are part of the error if it fails.
+const maxOnlineDDLErrOutput = 4096
+
+// OnlineDDL runs migrations made of a single ALTER TABLE statement with an
+// external tool, which copies the table instead of locking it. The user and
+// password are given to the tool in an option file only readable by the
+// current user, which is removed once the tool exits.
+type OnlineDDL struct {
+	// Tool is either OnlineDDLPTOSC or OnlineDDLGhost.
+	Tool string
+	Host string
+	Port string
+	// Socket is the path of the unix socket of the server, used instead of
+	// Host and Port if set. gh-ost can't connect through a socket.
+	Socket   string
+	User     string
+	Password string
+	// Output receives the output of the tool. If nil, each line is logged
+	// to Log, or discarded without Log. The end of the output is part of
+	// the error if the tool fails either way.
+	Output io.Writer
+	// Log is set when the driver is opened with a logger.
+	Log database.Logger
+
+	// path of the executable of Tool, set by WithConnection
+	path string
+}
+
+// newOnlineDDL returns the OnlineDDL of tool for the connection of config,
+// logging the output of the tool to l.
+func newOnlineDDL(tool string, config *mysql.Config, l database.Logger) *OnlineDDL {
+	o := &OnlineDDL{
+		Tool:     tool,
+		User:     config.User,
+		Password: config.Passwd,
+		Log:      l,
+	}
+	if config.Net == "unix" {
+		o.Socket = config.Addr
+	} else if host, port, err := net.SplitHostPort(config.Addr); err == nil {
+		o.Host, o.Port = host, port
+	} else {
+		o.Host = config.Addr
+	}
+	return o
+}
+
+// init validates the tool and finds its executable.
+func (o *OnlineDDL) init() error {
+	name, ok := onlineDDLTools[o.Tool]
+	if !ok {
+		return ErrOnlineDDL
+	}
+	if o.Tool == OnlineDDLGhost && o.Socket != "" {
+		return fmt.Errorf("online ddl: gh-ost can't connect through the unix socket %v", o.Socket)
+	}
+	path, err := exec.LookPath(name)
+	if err != nil {
+		return fmt.Errorf("online ddl: %w", err)
+	}
+	o.path = path
+	return nil
+}
+
+// args returns the arguments of the tool to run alter on table of db,
+// reading the user and password from optionFile.
+func (o *OnlineDDL) args(db, table, alter, optionFile string) ([]string, error) {
+	switch o.Tool {
+	case OnlineDDLPTOSC:
+		pairs := [][2]string{{"D", db}, {"t", table}, {"h", o.Host}, {"P", o.Port}, {"S", o.Socket}, {"F", optionFile}}
+		if o.Socket != "" {
+			pairs[2][1], pairs[3][1] = "", ""
+		}
+		var dsn []string
+		for _, kv := range pairs {
+			if kv[1] == "" {
+				continue
+			}
+			// the DSN has no way to escape its separator
+			if strings.Contains(kv[1], ",") {
+				return nil, fmt.Errorf("online ddl: %v can't be passed to pt-online-schema-change, it contains a comma", kv[1])
+			}
+			dsn = append(dsn, kv[0]+"="+kv[1])
+		}
+		return []string{"--alter", alter, "--execute", strings.Join(dsn, ",")}, nil
+	case OnlineDDLGhost:
+		args := []string{"--conf=" + optionFile}
+		for _, kv := range [][2]string{{"host", o.Host}, {"port", o.Port}} {
+			if kv[1] != "" {
+				args = append(args, "--"+kv[0]+"="+kv[1])
+			}
+		}
+		return append(args, "--database="+db, "--table="+table, "--alter="+alter, "--execute"), nil
+	}
+	return nil, ErrOnlineDDL
+}
+
+// writeOptionFile writes the user and password to a new option file,
+// which both tools read from its [client] section, and returns its path.
+func (o *OnlineDDL) writeOptionFile() (string, error) {
+	f, err := os.CreateTemp("", "migrate-online-ddl-*.cnf")
+	if err != nil {
+		return "", err
+	}
+	content := "[client]\n"
+	for _, kv := range [][2]string{{"user", o.User}, {"password", o.Password}} {
+		if kv[1] != "" {
+			content += kv[0] + "=" + quoteOption(kv[1]) + "\n"
+		}
+	}
+	// CreateTemp creates the file with mode 0600
+	_, err = f.WriteString(content)
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		_ = os.Remove(f.Name())
+		return "", err
+	}
+	return f.Name(), nil
+}
+
+// quoteOption quotes v as the value of an option file.
+func quoteOption(v string) string {
+	return `"` + strings.NewReplacer(`\`, `\\`, `"`, `\"`).Replace(v) + `"`
+}
+
+// run runs alter on table of db with the tool.
+func (o *OnlineDDL) run(ctx context.Context, db, table, alter string) error {
+	optionFile, err := o.writeOptionFile()
+	if err != nil {
+		return fmt.Errorf("online ddl: %w", err)
+	}
+	defer os.Remove(optionFile)
+
+	args, err := o.args(db, table, alter, optionFile)
+	if err != nil {
+		return err
+	}
+
+	tail := &tailWriter{max: maxOnlineDDLErrOutput}
+	var output io.Writer = tail
+	var lines *lineLogger
+	if o.Output != nil {
+		output = io.MultiWriter(o.Output, tail)
+	} else if o.Log != nil {
+		lines = &lineLogger{l: o.Log, prefix: o.Tool}
+		output = io.MultiWriter(lines, tail)
+	}
+
+	cmd := exec.CommandContext(ctx, o.path, args...)
+	cmd.Stdout = output
+	cmd.Stderr = output
+	err = cmd.Run()
+	if lines != nil {
+		lines.flush()
+	}
+	if err != nil {
+		if out := strings.TrimSpace(string(tail.buf)); out != "" {
+			return fmt.Errorf("%v: %w: %s", o.Tool, err, out)
+		}
+		return fmt.Errorf("%v: %w", o.Tool, err)
+	}
+	return nil
+}
+
+// tailWriter keeps the last max bytes written to it.
+type tailWriter struct {
+	buf []byte
+	max int
+}
+
+func (w *tailWriter) Write(p []byte) (int, error) {
+	w.buf = append(w.buf, p...)
+	if len(w.buf) > w.max {
+		w.buf = w.buf[len(w.buf)-w.max:]
+	}
+	return len(p), nil
+}
+
+// lineLogger logs each line written to it, prefixed with prefix.
+type lineLogger struct {
+	l      database.Logger
+	prefix string
+	buf    []byte
+}
+
+func (w *lineLogger) Write(p []byte) (int, error) {
+	w.buf = append(w.buf, p...)
+	for {
+		i := bytes.IndexByte(w.buf, '\n')
+		if i < 0 {
+			return len(p), nil
+		}
+		w.l.Printf("%s: %s\n", w.prefix, w.buf[:i])
+		w.buf = w.buf[i+1:]
+	}
+}
+
+// flush logs the last line if it wasn't terminated.
+func (w *lineLogger) flush() {
+	if len(w.buf) > 0 {
+		w.l.Printf("%s: %s\n", w.prefix, w.buf)
+		w.buf = nil
+	}
+}
+
+var (
+	sqlIdentifier = "(`[^`]+`|[\\w$]+)"
+	alterTable    = regexp.MustCompile(`(?is)^\s*ALTER\s+TABLE\s+(?:` + sqlIdentifier + `\s*\.\s*)?` + sqlIdentifier + `\s+(.+?)[\s;]*$`)
+)
+
+// parseAlterTable returns the database, table and alter specification of
+// query if it is a single ALTER TABLE statement. db is empty if the table
+// isn't qualified.
+func parseAlterTable(query string) (db, table, alter string, ok bool) {
+	stmts, err := splitStatements(query)
+	if err != nil || len(stmts) != 1 {
+		return "", "", "", false
+	}
+	m := alterTable.FindStringSubmatch(stmts[0])
+	if m == nil {
+		return "", "", "", false
+	}
+	return strings.Trim(m[1], "`"), strings.Trim(m[2], "`"), m[3], true
+}
@@ -2,16 +2,20 @@ package neo4j
 
 import (
 	"bytes"
+	"crypto/rand"
+	"encoding/hex"
 	"fmt"
 	"io"
 	neturl "net/url"
 	"strconv"
-	"sync/atomic"
+	"strings"
+	"time"
 
 	"github.com/golang-migrate/migrate/v4/database"
 	"github.com/golang-migrate/migrate/v4/database/multistmt"
 	"github.com/hashicorp/go-multierror"
 	"github.com/neo4j/neo4j-go-driver/neo4j"
+	"go.uber.org/atomic"
 )
 
 func init() {
@@ -21,24 +25,59 @@ func init() {
 
 const DefaultMigrationsLabel = "SchemaMigration"
 
+const (
+	// DefaultLockLabel is the label of the node locking the database while
+	// migrating.
+	DefaultLockLabel = "SchemaMigrationLock"
+	// DefaultLockTTL is how long the lock is held at most, in case the
+	// process holding it died.
+	DefaultLockTTL = 10 * time.Minute
+)
+
 var (
 	StatementSeparator           = []byte(";")
 	DefaultMultiStatementMaxSize = 10 * 1 << 20 // 10 MB
 )
 
+// Steps of Drop, see Config.DropOrder.
+const (
+	DropConstraints = "constraints"
+	DropIndexes     = "indexes"
+	DropData        = "data"
+)
+
+// DefaultDropOrder drops constraints before the indexes, as indexes backing
+// a constraint can't be dropped, and both before the data.
+var DefaultDropOrder = []string{DropConstraints, DropIndexes, DropData}
+
 var (
-	ErrNilConfig = fmt.Errorf("no config")
+	ErrNilConfig        = fmt.Errorf("no config")
+	ErrInvalidDropOrder = fmt.Errorf("invalid drop order, expected a list of %v, %v and %v", DropConstraints, DropIndexes, DropData)
+	ErrLockExpired      = fmt.Errorf("lock expired and was taken over before unlocking")
 )
 
 type Config struct {
 	MigrationsLabel       string
 	MultiStatement        bool
 	MultiStatementMaxSize int
+	// DropOrder lists the steps of Drop, defaults to DefaultDropOrder.
+	DropOrder []string
+	// DatabaseName is the database to migrate on Neo4j 4+, defaults to the
+	// default database of the server.
+	DatabaseName string
+	// LockLabel defaults to DefaultLockLabel.
+	LockLabel string
+	// LockTTL defaults to DefaultLockTTL.
+	LockTTL time.Duration
+	// NoLock only locks the driver instance, for databases the user can't
+	// write the lock node to.
+	NoLock bool
 }
 
 type Neo4j struct {
-	driver neo4j.Driver
-	lock   uint32
+	driver    neo4j.Driver
+	isLocked  atomic.Bool
+	lockToken string
 
 	// Open and WithInstance need to guarantee that config is never nil
 	config *Config
@@ -48,15 +87,26 @@ func WithInstance(driver neo4j.Driver, config *Config) (database.Driver, error)
 	if config == nil {
 		return nil, ErrNilConfig
 	}
+	if config.LockLabel == "" {
+		config.LockLabel = DefaultLockLabel
+	}
+	if config.LockTTL <= 0 {
+		config.LockTTL = DefaultLockTTL
+	}
 
 	nDriver := &Neo4j{
 		driver: driver,
 		config: config,
 	}
 
-	if err := nDriver.ensureVersionConstraint(); err != nil {
+	if err := nDriver.ensureUniqueConstraint(config.MigrationsLabel, "version"); err != nil {
 		return nil, err
 	}
+	if !config.NoLock {
+		if err := nDriver.ensureUniqueConstraint(config.LockLabel, "id"); err != nil {
+			return nil, err
+		}
+	}
 
 	return nDriver, nil
 }
@@ -98,7 +148,33 @@ func (n *Neo4j) Open(url string) (database.Driver, error) {
 		}
 	}
 
+	dropOrder, err := parseDropOrder(uri.Query().Get("x-drop-order"))
+	if err != nil {
+		return nil, err
+	}
+
+	var lockTTL time.Duration
+	if s := uri.Query().Get("x-lock-ttl"); s != "" {
+		seconds, err := strconv.Atoi(s)
+		if err != nil {
+			return nil, fmt.Errorf("unable to parse option x-lock-ttl: %w", err)
+		}
+		lockTTL = time.Duration(seconds) * time.Second
+	}
+
+	noLock := false
+	if s := uri.Query().Get("x-no-lock"); s != "" {
+		noLock, err = strconv.ParseBool(s)
+		if err != nil {
+			return nil, fmt.Errorf("unable to parse option x-no-lock: %w", err)
+		}
+	}
+
+	lockLabel := uri.Query().Get("x-lock-label")
+	databaseName := strings.Trim(uri.Path, "/")
+
 	uri.RawQuery = ""
+	uri.Path = ""
 
 	driver, err := neo4j.NewDriver(uri.String(), authToken, func(config *neo4j.Config) {
 		config.Encrypted = encrypted
@@ -111,31 +187,118 @@ func (n *Neo4j) Open(url string) (database.Driver, error) {
 		MigrationsLabel:       DefaultMigrationsLabel,
 		MultiStatement:        multi,
 		MultiStatementMaxSize: multiStatementMaxSize,
+		DropOrder:             dropOrder,
+		DatabaseName:          databaseName,
+		LockLabel:             lockLabel,
+		LockTTL:               lockTTL,
+		NoLock:                noLock,
 	})
 }
 
+// parseDropOrder parses a comma separated list of Drop steps.
+func parseDropOrder(s string) ([]string, error) {
+	if s == "" {
+		return nil, nil
+	}
+	order := strings.Split(s, ",")
+	for i := range order {
+		order[i] = strings.TrimSpace(order[i])
+		switch order[i] {
+		case DropConstraints, DropIndexes, DropData:
+		default:
+			return nil, ErrInvalidDropOrder
+		}
+	}
+	return order, nil
+}
+
 func (n *Neo4j) Close() error {
 	return n.driver.Close()
 }
 
-// local locking in order to pass tests, Neo doesn't support database locking
+// session opens a session on the configured database.
+func (n *Neo4j) session(accessMode neo4j.AccessMode) (neo4j.Session, error) {
+	return n.driver.NewSession(neo4j.SessionConfig{AccessMode: accessMode, DatabaseName: n.config.DatabaseName})
+}
+
+// Lock marks the lock node as locked, unless it is locked already and the
+// lock didn't expire. Neo4j has no advisory locks, so the write lock Neo4j
+// takes on the node makes concurrent Lock calls wait for each other.
 func (n *Neo4j) Lock() error {
-	if !atomic.CompareAndSwapUint32(&n.lock, 0, 1) {
-		return database.ErrLocked
-	}
+	return database.CasRestoreOnErr(&n.isLocked, false, true, database.ErrLocked, func() (err error) {
+		if n.config.NoLock {
+			return nil
+		}
 
-	return nil
+		token := make([]byte, 16)
+		if _, err := rand.Read(token); err != nil {
+			return err
+		}
+		n.lockToken = hex.EncodeToString(token)
+
+		session, err := n.session(neo4j.AccessModeWrite)
+		if err != nil {
+			return err
+		}
+		defer func() {
+			if cerr := session.Close(); cerr != nil {
+				err = multierror.Append(err, cerr)
+			}
+		}()
+
+		// setting the id takes the write lock on the node before it is checked
+		query := fmt.Sprintf(`MERGE (l:%s {id: 1}) SET l.id = 1
+WITH l WHERE COALESCE(l.locked, false) = false OR l.expires < datetime()
+SET l.locked = true, l.token = $token, l.expires = datetime() + duration({seconds: $ttl})
+RETURN l.token`, n.config.LockLabel)
+		records, err := neo4j.Collect(session.Run(query, map[string]interface{}{
+			"token": n.lockToken,
+			"ttl":   int64(n.config.LockTTL / time.Second),
+		}))
+		if err != nil {
+			return &database.Error{OrigErr: err, Err: "try lock failed", Query: []byte(query)}
+		}
+		if len(records) == 0 {
+			return database.ErrLocked
+		}
+		return nil
+	})
 }
 
+// Unlock unlocks the lock node if it is still locked by Lock.
 func (n *Neo4j) Unlock() error {
-	if !atomic.CompareAndSwapUint32(&n.lock, 1, 0) {
-		return database.ErrNotLocked
-	}
-	return nil
+	return database.CasRestoreOnErr(&n.isLocked, true, false, database.ErrNotLocked, func() (err error) {
+		if n.config.NoLock {
+			return nil
+		}
+
+		session, err := n.session(neo4j.AccessModeWrite)
+		if err != nil {
+			return err
+		}
+		defer func() {
+			if cerr := session.Close(); cerr != nil {
+				err = multierror.Append(err, cerr)
+			}
+		}()
+
+		query := fmt.Sprintf(`MATCH (l:%s {id: 1}) WHERE l.token = $token
+SET l.locked = false REMOVE l.token, l.expires
+RETURN l.id`, n.config.LockLabel)
+		records, err := neo4j.Collect(session.Run(query, map[string]interface{}{"token": n.lockToken}))
+		if err != nil {
+			return &database.Error{OrigErr: err, Err: "try unlock failed", Query: []byte(query)}
+		}
+		if len(records) == 0 {
+			// the lock expired and another process may hold it now
+			return ErrLockExpired
+		}
+		return nil
+	})
 }
 
 func (n *Neo4j) Run(migration io.Reader) (err error) {
-	session, err := n.driver.Session(neo4j.AccessModeWrite)
+	session, err := n.session(neo4j.AccessModeWrite)
 	if err != nil {
 		return err
 	}
@@ -182,7 +345,7 @@ func (n *Neo4j) Run(migration io.Reader) (err error) {
 }
 
 func (n *Neo4j) SetVersion(version int, dirty bool) (err error) {
-	session, err := n.driver.Session(neo4j.AccessModeWrite)
+	session, err := n.session(neo4j.AccessModeWrite)
 	if err != nil {
 		return err
 	}
@@ -207,7 +370,7 @@ type MigrationRecord struct {
 }
 
 func (n *Neo4j) Version() (version int, dirty bool, err error) {
-	session, err := n.driver.Session(neo4j.AccessModeRead)
+	session, err := n.session(neo4j.AccessModeRead)
 	if err != nil {
 		return database.NilVersion, false, err
 	}
@@ -254,8 +417,11 @@ ORDER BY COALESCE(sm.ts, datetime({year: 0})) DESC, sm.version DESC LIMIT 1`,
 	return mr.Version, mr.Dirty, err
 }
 
+// Drop runs the steps of Config.DropOrder. The constraints on the version of
+// the migrations and on the lock node and their indexes are kept, as is the
+// lock node.
 func (n *Neo4j) Drop() (err error) {
-	session, err := n.driver.Session(neo4j.AccessModeWrite)
+	session, err := n.session(neo4j.AccessModeWrite)
 	if err != nil {
 		return err
 	}
@@ -265,14 +431,88 @@ func (n *Neo4j) Drop() (err error) {
 		}
 	}()
 
-	if _, err := neo4j.Collect(session.Run("MATCH (n) DETACH DELETE n", nil)); err != nil {
+	order := n.config.DropOrder
+	if len(order) == 0 {
+		order = DefaultDropOrder
+	}
+	for _, step := range order {
+		switch step {
+		case DropConstraints:
+			err = n.dropConstraints(session)
+		case DropIndexes:
+			err = n.dropIndexes(session)
+		case DropData:
+			query := fmt.Sprintf("MATCH (n) WHERE NOT n:%s DETACH DELETE n", n.config.LockLabel)
+			_, err = neo4j.Collect(session.Run(query, nil))
+		default:
+			err = ErrInvalidDropOrder
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// dropConstraints drops all constraints but the ones on the migrations and
+// lock labels.
+// Neo4j 3.5 has no constraint names, so constraints are dropped by their
+// description, which is supported by Neo4j 4 as well.
+func (n *Neo4j) dropConstraints(session neo4j.Session) error {
+	records, err := neo4j.Collect(session.Run("CALL db.constraints()", nil))
+	if err != nil {
+		return err
+	}
+	versionLabel := ":" + n.config.MigrationsLabel + " )"
+	lockLabel := ":" + n.config.LockLabel + " )"
+	for _, record := range records {
+		description, _ := record.Get("description")
+		d, _ := description.(string)
+		if d == "" || strings.Contains(d, versionLabel) || strings.Contains(d, lockLabel) {
+			continue
+		}
+		if _, err := neo4j.Collect(session.Run("DROP "+d, nil)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// dropIndexes drops all indexes but unique ones, which back a constraint
+// and are dropped along with it. Indexes are dropped by name on Neo4j 4 and
+// by description on Neo4j 3.5.
+func (n *Neo4j) dropIndexes(session neo4j.Session) error {
+	records, err := neo4j.Collect(session.Run("CALL db.indexes()", nil))
+	if err != nil {
 		return err
 	}
+	for _, record := range records {
+		if uniqueness, ok := record.Get("uniqueness"); ok && uniqueness == "UNIQUE" {
+			continue
+		}
+		if indexType, ok := record.Get("type"); ok && indexType == "node_unique_property" {
+			continue
+		}
+
+		var query string
+		if name, ok := record.Get("name"); ok {
+			query = fmt.Sprintf("DROP INDEX `%v`", name)
+		} else if description, ok := record.Get("description"); ok {
+			query = fmt.Sprintf("DROP %v", description)
+		} else {
+			continue
+		}
+		if _, err := neo4j.Collect(session.Run(query, nil)); err != nil {
+			return err
+		}
+	}
 	return nil
 }
 
-func (n *Neo4j) ensureVersionConstraint() (err error) {
-	session, err := n.driver.Session(neo4j.AccessModeWrite)
+// ensureUniqueConstraint creates a unique constraint on property of the
+// nodes labeled label, unless the label exists already.
+func (n *Neo4j) ensureUniqueConstraint(label, property string) (err error) {
+	session, err := n.session(neo4j.AccessModeWrite)
 	if err != nil {
 		return err
 	}
@@ -287,7 +527,7 @@ func (n *Neo4j) ensureVersionConstraint() (err error) {
 	using db.labels() to support Neo4j 3 and 4.
 	Neo4J 3 doesn't support db.constraints() YIELD name
 	*/
-	res, err := neo4j.Collect(session.Run(fmt.Sprintf("CALL db.labels() YIELD label WHERE label=\"%s\" RETURN label", n.config.MigrationsLabel), nil))
+	res, err := neo4j.Collect(session.Run(fmt.Sprintf("CALL db.labels() YIELD label WHERE label=\"%s\" RETURN label", label), nil))
 	if err != nil {
 		return err
 	}
@@ -295,7 +535,7 @@ func (n *Neo4j) ensureVersionConstraint() (err error) {
 		return nil
 	}
 
-	query := fmt.Sprintf("CREATE CONSTRAINT ON (a:%s) ASSERT a.version IS UNIQUE", n.config.MigrationsLabel)
+	query := fmt.Sprintf("CREATE CONSTRAINT ON (a:%s) ASSERT a.%s IS UNIQUE", label, property)
 	if _, err := neo4j.Collect(session.Run(query, nil)); err != nil {
 		return err
 	}
@@ -5,12 +5,14 @@ import (
 	"context"
 	"fmt"
 	"log"
+	"reflect"
 	"testing"
 
 	"github.com/dhui/dktest"
 	"github.com/neo4j/neo4j-go-driver/neo4j"
 
 	"github.com/golang-migrate/migrate/v4"
+	"github.com/golang-migrate/migrate/v4/database"
 	dt "github.com/golang-migrate/migrate/v4/database/testing"
 	"github.com/golang-migrate/migrate/v4/dktesting"
 	_ "github.com/golang-migrate/migrate/v4/source/file"
@@ -136,3 +138,146 @@ func TestMalformed(t *testing.T) {
 		}
 	})
 }
+
+func TestDropConstraints(t *testing.T) {
+	dktesting.ParallelTest(t, specs, func(t *testing.T, c dktest.ContainerInfo) {
+		ip, port, err := c.Port(7687)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		n := &Neo4j{}
+		d, err := n.Open(neoConnectionString(ip, port))
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer func() {
+			if err := d.Close(); err != nil {
+				t.Error(err)
+			}
+		}()
+
+		for _, query := range []string{
+			"CREATE CONSTRAINT ON (p:Person) ASSERT p.name IS UNIQUE",
+			"CREATE INDEX ON :Person(age)",
+			"CREATE (:Person {name: 'a', age: 1})-[:KNOWS]->(:Person {name: 'b', age: 2})",
+		} {
+			if err := d.Run(bytes.NewReader([]byte(query))); err != nil {
+				t.Fatal(err)
+			}
+		}
+		if err := d.SetVersion(1, false); err != nil {
+			t.Fatal(err)
+		}
+
+		if err := d.Drop(); err != nil {
+			t.Fatal(err)
+		}
+
+		session, err := d.(*Neo4j).driver.Session(neo4j.AccessModeRead)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer session.Close()
+		for query, expected := range map[string]int{
+			"CALL db.constraints()": 2, // the version and lock constraints
+			"CALL db.indexes()":     2, // the indexes of the version and lock constraints
+			"MATCH (n) RETURN n":    0,
+		} {
+			records, err := neo4j.Collect(session.Run(query, nil))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(records) != expected {
+				t.Errorf("%v: expected %v records, got %v", query, expected, len(records))
+			}
+		}
+
+		version, dirty, err := d.Version()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if version != -1 || dirty {
+			t.Errorf("expected no version after drop, got %v (dirty: %v)", version, dirty)
+		}
+		if err := d.SetVersion(2, false); err != nil {
+			t.Fatal(err)
+		}
+		if version, _, err := d.Version(); err != nil || version != 2 {
+			t.Errorf("expected version 2, got %v (%v)", version, err)
+		}
+	})
+}
+
+func TestLock(t *testing.T) {
+	dktesting.ParallelTest(t, specs, func(t *testing.T, c dktest.ContainerInfo) {
+		ip, port, err := c.Port(7687)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		n := &Neo4j{}
+		d1, err := n.Open(neoConnectionString(ip, port))
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer func() {
+			if err := d1.Close(); err != nil {
+				t.Error(err)
+			}
+		}()
+		d2, err := n.Open(neoConnectionString(ip, port))
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer func() {
+			if err := d2.Close(); err != nil {
+				t.Error(err)
+			}
+		}()
+
+		if err := d1.Lock(); err != nil {
+			t.Fatal(err)
+		}
+		if err := d2.Lock(); err != database.ErrLocked {
+			t.Fatalf("expected %v, got %v", database.ErrLocked, err)
+		}
+		if err := d1.Unlock(); err != nil {
+			t.Fatal(err)
+		}
+		if err := d2.Lock(); err != nil {
+			t.Fatal(err)
+		}
+
+		// the lock node is kept by drop
+		if err := d2.Drop(); err != nil {
+			t.Fatal(err)
+		}
+		if err := d2.Unlock(); err != nil {
+			t.Fatal(err)
+		}
+	})
+}
+
+func TestParseDropOrder(t *testing.T) {
+	tt := []struct {
+		s        string
+		expected []string
+		err      error
+	}{
+		{s: "", expected: nil},
+		{s: "data", expected: []string{DropData}},
+		{s: "indexes, constraints,data", expected: []string{DropIndexes, DropConstraints, DropData}},
+		{s: "data,nodes", err: ErrInvalidDropOrder},
+	}
+	for _, tc := range tt {
+		order, err := parseDropOrder(tc.s)
+		if err != tc.err {
+			t.Errorf("%q: expected error %v, got %v", tc.s, tc.err, err)
+			continue
+		}
+		if !reflect.DeepEqual(order, tc.expected) {
+			t.Errorf("%q: expected %v, got %v", tc.s, tc.expected, order)
+		}
+	}
+}
@@ -3,6 +3,7 @@ package pgx
 // error codes https://github.com/jackc/pgerrcode/blob/master/errcode.go
 
 import (
+	"bufio"
 	"context"
 	"database/sql"
 	sqldriver "database/sql/driver"
@@ -101,10 +102,33 @@ func Test(t *testing.T) {
 				t.Error(err)
 			}
 		}()
+		dt.TestParallelMigrate(t, d, 10)
 		dt.Test(t, d, []byte("SELECT 1"))
 	})
 }
 
+func TestSetVersionRows(t *testing.T) {
+	dktesting.ParallelTest(t, specs, func(t *testing.T, c dktest.ContainerInfo) {
+		ip, port, err := c.FirstPort()
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		addr := pgConnectionString(ip, port)
+		p := &Postgres{}
+		d, err := p.Open(addr)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer func() {
+			if err := d.Close(); err != nil {
+				t.Error(err)
+			}
+		}()
+		dt.TestSetVersionRows(t, d, d.(*Postgres).conn, `"schema_migrations"`)
+	})
+}
+
 func TestMigrate(t *testing.T) {
 	dktesting.ParallelTest(t, specs, func(t *testing.T, c dktest.ContainerInfo) {
 		ip, port, err := c.FirstPort()
@@ -190,6 +214,81 @@ func TestMultipleStatements(t *testing.T) {
 	})
 }
 
+func TestCopy(t *testing.T) {
+	dktesting.ParallelTest(t, specs, func(t *testing.T, c dktest.ContainerInfo) {
+		ip, port, err := c.FirstPort()
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		addr := pgConnectionString(ip, port)
+		p := &Postgres{}
+		d, err := p.Open(addr)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer func() {
+			if err := d.Close(); err != nil {
+				t.Error(err)
+			}
+		}()
+		if err := d.Run(strings.NewReader("CREATE TABLE seeds (id integer, name text)")); err != nil {
+			t.Fatal(err)
+		}
+
+		var migration strings.Builder
+		migration.WriteString("-- migrate:copy seeds(id, name)\n")
+		for i := 1; i <= 5000; i++ {
+			fmt.Fprintf(&migration, "%d,\"seed, %d\"\n", i, i)
+		}
+		if err := d.Run(strings.NewReader(migration.String())); err != nil {
+			t.Fatal(err)
+		}
+
+		var count int
+		if err := d.(*Postgres).conn.QueryRowContext(context.Background(), "SELECT COUNT(*) FROM seeds").Scan(&count); err != nil {
+			t.Fatal(err)
+		}
+		if count != 5000 {
+			t.Fatalf("expected 5000 rows, got %v", count)
+		}
+
+		// invalid CSV data fails the migration
+		if err := d.Run(strings.NewReader("-- migrate:copy seeds(id, name)\nnot a number,foo\n")); err == nil {
+			t.Fatal("expected error for invalid data")
+		}
+	})
+}
+
+func TestParseCopyDirective(t *testing.T) {
+	cases := []struct {
+		name      string
+		migration string
+		query     string
+		ok        bool
+		err       bool
+	}{
+		{"no directive", "CREATE TABLE foo (id integer)", "", false, false},
+		{"short migration", "--", "", false, false},
+		{"columns", "-- migrate:copy foo(id,name)\n1,a\n", `COPY "foo" ("id", "name") FROM STDIN WITH (FORMAT csv)`, true, false},
+		{"schema and spaces", "-- migrate:copy bar.foo ( id , name )\n", `COPY "bar"."foo" ("id", "name") FROM STDIN WITH (FORMAT csv)`, true, false},
+		{"no columns", "-- migrate:copy foo", `COPY "foo" FROM STDIN WITH (FORMAT csv)`, true, false},
+		{"invalid", "-- migrate:copy\n", "", false, true},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			query, ok, err := parseCopyDirective(bufio.NewReader(strings.NewReader(c.migration)))
+			if (err != nil) != c.err {
+				t.Fatalf("expected error %v, got %v", c.err, err)
+			}
+			if ok != c.ok || query != c.query {
+				t.Fatalf("expected %q (%v), got %q (%v)", c.query, c.ok, query, ok)
+			}
+		})
+	}
+}
+
 func TestMultipleStatementsInMultiStatementMode(t *testing.T) {
 	dktesting.ParallelTest(t, specs, func(t *testing.T, c dktest.ContainerInfo) {
 		ip, port, err := c.FirstPort()
@@ -252,6 +351,123 @@ func TestErrorParsing(t *testing.T) {
 	})
 }
 
+func TestSavepoints(t *testing.T) {
+	dktesting.ParallelTest(t, specs, func(t *testing.T, c dktest.ContainerInfo) {
+		ip, port, err := c.FirstPort()
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		tableExists := func(d database.Driver, table string) bool {
+			var exists bool
+			if err := d.(*Postgres).conn.QueryRowContext(context.Background(), "SELECT EXISTS (SELECT 1 FROM information_schema.tables WHERE table_name = $1 AND table_schema = (SELECT current_schema()))", table).Scan(&exists); err != nil {
+				t.Fatal(err)
+			}
+			return exists
+		}
+
+		p := &Postgres{}
+		d, err := p.Open(pgConnectionString(ip, port, "x-transaction=true", "x-savepoints=true"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer func() {
+			if err := d.Close(); err != nil {
+				t.Error(err)
+			}
+		}()
+
+		// the failing statement is identified and the migration rolled back
+		wantErr := `statement 2: migration failed: syntax error at or near "TABLEE" (column 8) in line 3: ` +
+			"\n\nCREATE TABLEE bar (bar text); (details: ERROR: syntax error at or near \"TABLEE\" (SQLSTATE 42601))"
+		err = d.Run(strings.NewReader("CREATE TABLE foo (foo text);\n\nCREATE TABLEE bar (bar text);\nCREATE TABLE baz (baz text);"))
+		if err == nil || err.Error() != wantErr {
+			t.Fatalf("expected '%s' but got '%v'", wantErr, err)
+		}
+		if tableExists(d, "foo") {
+			t.Error("expected the migration to be rolled back")
+		}
+
+		// with x-continue-on-error, only the failing statement is rolled back
+		d2, err := p.Open(pgConnectionString(ip, port, "x-transaction=true", "x-savepoints=true", "x-continue-on-error=true"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer func() {
+			if err := d2.Close(); err != nil {
+				t.Error(err)
+			}
+		}()
+		if err := d2.Run(strings.NewReader("CREATE TABLE foo (foo text); CREATE TABLEE bar (bar text); CREATE TABLE baz (baz text);")); err != nil {
+			t.Fatal(err)
+		}
+		if !tableExists(d2, "foo") || !tableExists(d2, "baz") {
+			t.Error("expected the statements before and after the failing one to be applied")
+		}
+	})
+}
+
+func TestTransaction(t *testing.T) {
+	dktesting.ParallelTest(t, specs, func(t *testing.T, c dktest.ContainerInfo) {
+		ip, port, err := c.FirstPort()
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		p := &Postgres{}
+		d, err := p.Open(pgConnectionString(ip, port, "x-transaction=true"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer func() {
+			if err := d.Close(); err != nil {
+				t.Error(err)
+			}
+		}()
+
+		if err := d.Run(strings.NewReader("CREATE TABLE foo (foo text); CREATE TABLEE bar (bar text);")); err == nil {
+			t.Fatal("expected err but got nil")
+		}
+		var exists bool
+		if err := d.(*Postgres).conn.QueryRowContext(context.Background(), "SELECT EXISTS (SELECT 1 FROM information_schema.tables WHERE table_name = 'foo' AND table_schema = (SELECT current_schema()))").Scan(&exists); err != nil {
+			t.Fatal(err)
+		}
+		if exists {
+			t.Error("expected the migration to be rolled back")
+		}
+	})
+}
+
+func TestTransactionParamValidation(t *testing.T) {
+	p := &Postgres{}
+	_, err := p.Open(pgConnectionString("127.0.0.1", "5432", "x-transaction=not-a-bool"))
+	if !errors.Is(err, strconv.ErrSyntax) {
+		t.Fatalf("expected a syntax error for x-transaction, got %v", err)
+	}
+	if _, err := WithInstance(nil, &Config{Savepoints: true}); !errors.Is(err, ErrNoTransaction) {
+		t.Errorf("expected %v, got %v", ErrNoTransaction, err)
+	}
+	if _, err := WithInstance(nil, &Config{Transaction: true, ContinueOnError: true}); !errors.Is(err, ErrNoSavepoints) {
+		t.Errorf("expected %v, got %v", ErrNoSavepoints, err)
+	}
+}
+
+func TestStatementError(t *testing.T) {
+	err := statementError(database.Error{Err: "migration failed", Line: 2}, 3, 5, nil)
+	if dbErr := err.(database.Error); dbErr.Err != "statement 3: migration failed" || dbErr.Line != 6 {
+		t.Errorf("expected statement 3 in line 6, got %v", err)
+	}
+	// without a position, the line of the statement
+	err = statementError(database.Error{Err: "migration failed"}, 1, 5, []byte("\n\n  "))
+	if dbErr := err.(database.Error); dbErr.Line != 7 {
+		t.Errorf("expected line 7, got %v", dbErr.Line)
+	}
+	other := errors.New("other")
+	if err := statementError(other, 1, 1, nil); err != other {
+		t.Errorf("expected other errors unchanged, got %v", err)
+	}
+}
+
 func TestFilterCustomQuery(t *testing.T) {
 	dktesting.ParallelTest(t, specs, func(t *testing.T, c dktest.ContainerInfo) {
 		ip, port, err := c.FirstPort()
@@ -342,6 +558,80 @@ func TestWithSchema(t *testing.T) {
 	})
 }
 
+func TestWithSearchPath(t *testing.T) {
+	dktesting.ParallelTest(t, specs, func(t *testing.T, c dktest.ContainerInfo) {
+		ip, port, err := c.FirstPort()
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		p := &Postgres{}
+		d, err := p.Open(pgConnectionString(ip, port))
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer func() {
+			if err := d.Close(); err != nil {
+				t.Error(err)
+			}
+		}()
+		// migrator can only create tables in app
+		mustRun(t, d, []string{
+			"CREATE SCHEMA shared AUTHORIZATION postgres",
+			"CREATE SCHEMA app AUTHORIZATION postgres",
+			"CREATE USER migrator WITH ENCRYPTED PASSWORD '" + pgPassword + "'",
+			"GRANT USAGE ON SCHEMA shared TO migrator",
+			"GRANT USAGE, CREATE ON SCHEMA app TO migrator",
+		})
+		tableExists := func(schema, table string) bool {
+			t.Helper()
+			var exists bool
+			query := "SELECT EXISTS (SELECT 1 FROM information_schema.tables WHERE table_schema = $1 AND table_name = $2)"
+			if err := d.(*Postgres).conn.QueryRowContext(context.Background(), query, schema, table).Scan(&exists); err != nil {
+				t.Fatal(err)
+			}
+			return exists
+		}
+		open := func(url string) {
+			t.Helper()
+			d2, err := p.Open(url)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer func() {
+				if err := d2.Close(); err != nil {
+					t.Error(err)
+				}
+			}()
+			if err := d2.SetVersion(1, false); err != nil {
+				t.Fatal(err)
+			}
+			if version, _, err := d2.Version(); err != nil || version != 1 {
+				t.Fatalf("expected version 1, got %v, %v", version, err)
+			}
+		}
+
+		// the first schema of the search path
+		open(pgConnectionString(ip, port, "x-search-path=app,shared", "x-migrations-table=first_migrations"))
+		if !tableExists("app", "first_migrations") {
+			t.Error("expected the migrations table in app")
+		}
+
+		// the first writable schema of the search path
+		open(fmt.Sprintf("postgres://migrator:%s@%v:%v/postgres?sslmode=disable&search_path=shared,app&x-migrations-table=writable_migrations",
+			pgPassword, ip, port))
+		if !tableExists("app", "writable_migrations") || tableExists("shared", "writable_migrations") {
+			t.Error("expected the migrations table in app only")
+		}
+
+		// an explicit schema
+		open(pgConnectionString(ip, port, "x-search-path=app,shared", "x-migrations-table-schema=shared", "x-migrations-table=shared_migrations"))
+		if !tableExists("shared", "shared_migrations") || tableExists("app", "shared_migrations") {
+			t.Error("expected the migrations table in shared only")
+		}
+	})
+}
+
 func TestMigrationTableOption(t *testing.T) {
 	dktesting.ParallelTest(t, specs, func(t *testing.T, c dktest.ContainerInfo) {
 		ip, port, err := c.FirstPort()
@@ -705,6 +995,53 @@ func TestWithInstance_Concurrent(t *testing.T) {
 		}
 	})
 }
+func TestNoLock(t *testing.T) {
+	dktesting.ParallelTest(t, specs, func(t *testing.T, c dktest.ContainerInfo) {
+		ip, port, err := c.FirstPort()
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		p := &Postgres{}
+		d, err := p.Open(pgConnectionString(ip, port))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		lock := d.(*Postgres)
+
+		p = &Postgres{}
+		d, err = p.Open(pgConnectionString(ip, port, "x-no-lock=true"))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		noLock := d.(*Postgres)
+
+		// Should be possible to take real lock and no-lock at the same time
+		if err = lock.Lock(); err != nil {
+			t.Fatal(err)
+		}
+		if err = noLock.Lock(); err != nil {
+			t.Fatal(err)
+		}
+		if err = lock.Unlock(); err != nil {
+			t.Fatal(err)
+		}
+		if err = noLock.Unlock(); err != nil {
+			t.Fatal(err)
+		}
+	})
+}
+
+func TestNoLockParamValidation(t *testing.T) {
+	p := &Postgres{}
+	_, err := p.Open(pgConnectionString("127.0.0.1", "5432", "x-no-lock=not-a-bool"))
+	if !errors.Is(err, strconv.ErrSyntax) {
+		t.Fatal("Expected syntax error when passing a non-bool as x-no-lock parameter")
+	}
+}
+
 func Test_computeLineFromPos(t *testing.T) {
 	testcases := []struct {
 		pos      int
@@ -784,3 +1121,22 @@ func Test_computeLineFromPos(t *testing.T) {
 		})
 	}
 }
+
+func TestLockStrategyNone(t *testing.T) {
+	p := &Postgres{config: &Config{LockStrategy: LockStrategyNone}}
+	if !p.LockDisabled() {
+		t.Fatal("expected locking to be disabled")
+	}
+	// Lock and Unlock don't touch the database
+	if err := p.Lock(); err != nil {
+		t.Fatal(err)
+	}
+	if err := p.Unlock(); err != nil {
+		t.Fatal(err)
+	}
+
+	p = &Postgres{config: &Config{LockStrategy: LockStrategyTable}}
+	if p.LockDisabled() {
+		t.Fatal("expected locking to be enabled")
+	}
+}
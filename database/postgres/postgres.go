@@ -4,11 +4,13 @@
 package postgres
 
 import (
+	"bytes"
 	"context"
 	"database/sql"
 	"fmt"
 	"io"
 	nurl "net/url"
+	"os"
 	"regexp"
 	"strconv"
 	"strings"
@@ -18,7 +20,7 @@ import (
 
 	"github.com/golang-migrate/migrate/v4"
 	"github.com/golang-migrate/migrate/v4/database"
-	"github.com/golang-migrate/migrate/v4/database/multistmt"
+	"github.com/golang-migrate/migrate/v4/database/sqlutil"
 	"github.com/hashicorp/go-multierror"
 	"github.com/lib/pq"
 )
@@ -30,10 +32,21 @@ func init() {
 }
 
 var (
-	multiStmtDelimiter = []byte(";")
+	// multiStmtSplitter splits migrations if MultiStatementEnabled is set
+	multiStmtSplitter = sqlutil.StatementSplitter{EscapeStrings: true, DollarQuotes: true, NestedComments: true}
 
 	DefaultMigrationsTable       = "schema_migrations"
 	DefaultMultiStatementMaxSize = 10 * 1 << 20 // 10 MB
+	DefaultVersionColumnType     = "bigint"
+	DefaultDirtyColumnType       = "boolean"
+)
+
+const (
+	// LockStrategyAdvisory locks using pg_advisory_lock.
+	LockStrategyAdvisory = "advisory"
+	// LockStrategyNone doesn't lock and only allows read-only operations
+	// like Version, for roles lacking the permission to lock.
+	LockStrategyNone = "none"
 )
 
 var (
@@ -53,6 +66,24 @@ type Config struct {
 	migrationsTableName   string
 	StatementTimeout      time.Duration
 	MultiStatementMaxSize int
+	NoLock                bool
+	LockStrategy          string
+	// LockID overrides the advisory lock id generated from the database,
+	// schema and migrations table names. It has to be a bigint.
+	LockID string
+	// TrackAppVersion adds an app_version column to the migrations table,
+	// recording AppVersion, or else the X_MIGRATE_APP_VERSION environment
+	// variable, with the version.
+	TrackAppVersion bool
+	AppVersion      string
+	// StripComments removes the comments of migrations before running them,
+	// for proxies that can't handle them.
+	StripComments bool
+	// VersionColumnType and DirtyColumnType are the column types of a new
+	// migrations table, default to DefaultVersionColumnType and
+	// DefaultDirtyColumnType.
+	VersionColumnType string
+	DirtyColumnType   string
 }
 
 type Postgres struct {
@@ -106,6 +137,30 @@ func WithConnection(ctx context.Context, conn *sql.Conn, config *Config) (*Postg
 		config.MigrationsTable = DefaultMigrationsTable
 	}
 
+	switch config.LockStrategy {
+	case "":
+		config.LockStrategy = LockStrategyAdvisory
+	case LockStrategyAdvisory, LockStrategyNone:
+	default:
+		return nil, fmt.Errorf("unknown lock strategy \"%s\"", config.LockStrategy)
+	}
+
+	if config.LockID != "" {
+		lockID, err := database.ParseAdvisoryLockId(config.LockID)
+		if err != nil {
+			return nil, err
+		}
+		config.LockID = lockID
+	}
+
+	var err error
+	if config.VersionColumnType, err = database.ParseColumnType(config.VersionColumnType, DefaultVersionColumnType); err != nil {
+		return nil, err
+	}
+	if config.DirtyColumnType, err = database.ParseColumnType(config.DirtyColumnType, DefaultDirtyColumnType); err != nil {
+		return nil, err
+	}
+
 	config.migrationsSchemaName = config.SchemaName
 	config.migrationsTableName = config.MigrationsTable
 	if config.MigrationsTableQuoted {
@@ -152,6 +207,11 @@ func WithInstance(instance *sql.DB, config *Config) (database.Driver, error) {
 }
 
 func (p *Postgres) Open(url string) (database.Driver, error) {
+	return p.OpenWithLogger(url, nil)
+}
+
+// OpenWithLogger implements database.LoggingOpener.
+func (p *Postgres) OpenWithLogger(url string, l database.Logger) (database.Driver, error) {
 	purl, err := nurl.Parse(url)
 	if err != nil {
 		return nil, err
@@ -202,6 +262,42 @@ func (p *Postgres) Open(url string) (database.Driver, error) {
 		}
 	}
 
+	noLock := false
+	if s := purl.Query().Get("x-no-lock"); len(s) > 0 {
+		noLock, err = strconv.ParseBool(s)
+		if err != nil {
+			return nil, fmt.Errorf("could not parse x-no-lock as bool: %w", err)
+		}
+	}
+
+	trackAppVersion := false
+	if s := purl.Query().Get("x-track-app-version"); len(s) > 0 {
+		trackAppVersion, err = strconv.ParseBool(s)
+		if err != nil {
+			return nil, fmt.Errorf("Unable to parse option x-track-app-version: %w", err)
+		}
+	}
+
+	stripComments := false
+	if s := purl.Query().Get("x-strip-comments"); len(s) > 0 {
+		stripComments, err = strconv.ParseBool(s)
+		if err != nil {
+			return nil, fmt.Errorf("Unable to parse option x-strip-comments: %w", err)
+		}
+	}
+
+	connectRetry, err := sqlutil.ParseConnectRetry(purl.Query().Get("x-connect-retries"), purl.Query().Get("x-connect-retry-interval"))
+	if err != nil {
+		return nil, err
+	}
+	connectRetry.OnRetry = sqlutil.LogRetries(l)
+	if connectRetry.Retries > 0 {
+		if err := connectRetry.Ping(context.Background(), db); err != nil {
+			db.Close()
+			return nil, err
+		}
+	}
+
 	px, err := WithInstance(db, &Config{
 		DatabaseName:          purl.Path,
 		MigrationsTable:       migrationsTable,
@@ -209,6 +305,13 @@ func (p *Postgres) Open(url string) (database.Driver, error) {
 		StatementTimeout:      time.Duration(statementTimeout) * time.Millisecond,
 		MultiStatementEnabled: multiStatementEnabled,
 		MultiStatementMaxSize: multiStatementMaxSize,
+		NoLock:                noLock,
+		LockStrategy:          purl.Query().Get("x-lock-strategy"),
+		LockID:                purl.Query().Get("x-lock-id"),
+		TrackAppVersion:       trackAppVersion,
+		StripComments:         stripComments,
+		VersionColumnType:     purl.Query().Get("x-version-column-type"),
+		DirtyColumnType:       purl.Query().Get("x-dirty-column-type"),
 	})
 
 	if err != nil {
@@ -231,17 +334,65 @@ func (p *Postgres) Close() error {
 	return nil
 }
 
+// Ping implements database.Pinger.
+func (p *Postgres) Ping(ctx context.Context) error {
+	return p.conn.PingContext(ctx)
+}
+
+// Capabilities implements database.CapabilitiesDriver.
+func (p *Postgres) Capabilities() database.Capabilities {
+	return database.Capabilities{
+		SupportsTx:             true,
+		SupportsMultiStatement: true,
+		SupportsLocking:        !p.config.NoLock && p.config.LockStrategy != LockStrategyNone,
+	}
+}
+
+// Describe implements database.Describer.
+func (p *Postgres) Describe() (database.DriverInfo, error) {
+	return database.DriverInfo{
+		Name:                  "postgres",
+		Capabilities:          p.Capabilities(),
+		SupportsAdvisoryLocks: !p.config.NoLock && p.config.LockStrategy != LockStrategyNone,
+		SupportsSchemas:       true,
+	}, nil
+}
+
+// LockDisabled implements database.LockDisabledDriver.
+func (p *Postgres) LockDisabled() bool {
+	return p.config.LockStrategy == LockStrategyNone
+}
+
+// advisoryLockID returns Config.LockID if set, or else the lock id generated
+// from the database, schema and migrations table names.
+func (p *Postgres) advisoryLockID() (string, error) {
+	if p.config.LockID != "" {
+		return p.config.LockID, nil
+	}
+	return database.GenerateAdvisoryLockId(p.config.DatabaseName, p.config.migrationsSchemaName, p.config.migrationsTableName)
+}
+
 // https://www.postgresql.org/docs/9.6/static/explicit-locking.html#ADVISORY-LOCKS
 func (p *Postgres) Lock() error {
+	return p.LockContext(context.Background())
+}
+
+// LockContext implements database.ContextLocker. Waiting for the advisory
+// lock stops when ctx is done.
+func (p *Postgres) LockContext(ctx context.Context) error {
 	return database.CasRestoreOnErr(&p.isLocked, false, true, database.ErrLocked, func() error {
-		aid, err := database.GenerateAdvisoryLockId(p.config.DatabaseName, p.config.migrationsSchemaName, p.config.migrationsTableName)
+		if p.config.NoLock || p.config.LockStrategy == LockStrategyNone {
+			return nil
+		}
+
+		aid, err := p.advisoryLockID()
 		if err != nil {
 			return err
 		}
 
-		// This will wait indefinitely until the lock can be acquired.
+		// This will wait until the lock can be acquired or ctx is done.
 		query := `SELECT pg_advisory_lock($1)`
-		if _, err := p.conn.ExecContext(context.Background(), query, aid); err != nil {
+		if _, err := p.conn.ExecContext(ctx, query, aid); err != nil {
 			return &database.Error{OrigErr: err, Err: "try lock failed", Query: []byte(query)}
 		}
 
@@ -251,7 +402,11 @@ func (p *Postgres) Lock() error {
 
 func (p *Postgres) Unlock() error {
 	return database.CasRestoreOnErr(&p.isLocked, true, false, database.ErrNotLocked, func() error {
-		aid, err := database.GenerateAdvisoryLockId(p.config.DatabaseName, p.config.migrationsSchemaName, p.config.migrationsTableName)
+		if p.config.NoLock || p.config.LockStrategy == LockStrategyNone {
+			return nil
+		}
+
+		aid, err := p.advisoryLockID()
 		if err != nil {
 			return err
 		}
@@ -265,10 +420,23 @@ func (p *Postgres) Unlock() error {
 }
 
 func (p *Postgres) Run(migration io.Reader) error {
+	return p.RunContext(context.Background(), migration)
+}
+
+// RunContext implements database.ContextRunner. A deadline of ctx replaces
+// StatementTimeout for the statements of the migration.
+func (p *Postgres) RunContext(ctx context.Context, migration io.Reader) error {
+	if p.config.StripComments {
+		migr, err := io.ReadAll(migration)
+		if err != nil {
+			return err
+		}
+		migration = bytes.NewReader(multiStmtSplitter.StripComments(migr))
+	}
 	if p.config.MultiStatementEnabled {
 		var err error
-		if e := multistmt.Parse(migration, multiStmtDelimiter, p.config.MultiStatementMaxSize, func(m []byte) bool {
-			if err = p.runStatement(m); err != nil {
+		if e := multiStmtSplitter.Split(migration, p.config.MultiStatementMaxSize, func(m []byte) bool {
+			if err = p.runStatement(ctx, m); err != nil {
 				return false
 			}
 			return true
@@ -281,12 +449,11 @@ func (p *Postgres) Run(migration io.Reader) error {
 	if err != nil {
 		return err
 	}
-	return p.runStatement(migr)
+	return p.runStatement(ctx, migr)
 }
 
-func (p *Postgres) runStatement(statement []byte) error {
-	ctx := context.Background()
-	if p.config.StatementTimeout != 0 {
+func (p *Postgres) runStatement(ctx context.Context, statement []byte) error {
+	if _, ok := ctx.Deadline(); !ok && p.config.StatementTimeout != 0 {
 		var cancel context.CancelFunc
 		ctx, cancel = context.WithTimeout(ctx, p.config.StatementTimeout)
 		defer cancel()
@@ -296,25 +463,69 @@ func (p *Postgres) runStatement(statement []byte) error {
 		return nil
 	}
 	if _, err := p.conn.ExecContext(ctx, query); err != nil {
-		if pgErr, ok := err.(*pq.Error); ok {
-			var line uint
-			var col uint
-			var lineColOK bool
-			if pgErr.Position != "" {
-				if pos, err := strconv.ParseUint(pgErr.Position, 10, 64); err == nil {
-					line, col, lineColOK = computeLineFromPos(query, int(pos))
-				}
-			}
-			message := fmt.Sprintf("migration failed: %s", pgErr.Message)
-			if lineColOK {
-				message = fmt.Sprintf("%s (column %d)", message, col)
+		return statementError(err, statement)
+	}
+	return nil
+}
+
+// statementError returns a database.Error for the failed statement,
+// locating the error in it if possible.
+func statementError(err error, statement []byte) error {
+	if pgErr, ok := err.(*pq.Error); ok {
+		var line uint
+		var col uint
+		var lineColOK bool
+		if pgErr.Position != "" {
+			if pos, err := strconv.ParseUint(pgErr.Position, 10, 64); err == nil {
+				line, col, lineColOK = computeLineFromPos(string(statement), int(pos))
 			}
-			if pgErr.Detail != "" {
-				message = fmt.Sprintf("%s, %s", message, pgErr.Detail)
+		}
+		message := fmt.Sprintf("migration failed: %s", pgErr.Message)
+		if lineColOK {
+			message = fmt.Sprintf("%s (column %d)", message, col)
+		}
+		if pgErr.Detail != "" {
+			message = fmt.Sprintf("%s, %s", message, pgErr.Detail)
+		}
+		return database.Error{OrigErr: err, Err: message, Query: statement, Line: line}
+	}
+	return database.Error{OrigErr: err, Err: "migration failed", Query: statement}
+}
+
+// RunBatch implements database.BatchDriver, running the migrations and
+// setting the version in a single transaction.
+func (p *Postgres) RunBatch(ctx context.Context, migrations []io.Reader, version int) (err error) {
+	tx, err := p.conn.BeginTx(ctx, &sql.TxOptions{})
+	if err != nil {
+		return &database.Error{OrigErr: err, Err: "transaction start failed"}
+	}
+	defer func() {
+		if err != nil {
+			if errRollback := tx.Rollback(); errRollback != nil {
+				err = multierror.Append(err, errRollback)
 			}
-			return database.Error{OrigErr: err, Err: message, Query: statement, Line: line}
 		}
-		return database.Error{OrigErr: err, Err: "migration failed", Query: statement}
+	}()
+
+	for _, migration := range migrations {
+		statement, err := io.ReadAll(migration)
+		if err != nil {
+			return err
+		}
+		if strings.TrimSpace(string(statement)) == "" {
+			continue
+		}
+		if _, err := tx.ExecContext(ctx, string(statement)); err != nil {
+			return statementError(err, statement)
+		}
+	}
+
+	if err := p.writeVersion(ctx, tx, version, false); err != nil {
+		return err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return &database.Error{OrigErr: err, Err: "transaction commit failed"}
 	}
 	return nil
 }
@@ -355,39 +566,137 @@ func runesLastIndex(input []rune, target rune) int {
 }
 
 func (p *Postgres) SetVersion(version int, dirty bool) error {
-	tx, err := p.conn.BeginTx(context.Background(), &sql.TxOptions{})
+	return p.SetVersionContext(context.Background(), version, dirty)
+}
+
+// SetVersionContext implements database.ContextVersionSetter.
+func (p *Postgres) SetVersionContext(ctx context.Context, version int, dirty bool) error {
+	tx, err := p.conn.BeginTx(ctx, &sql.TxOptions{})
 	if err != nil {
 		return &database.Error{OrigErr: err, Err: "transaction start failed"}
 	}
 
-	query := `TRUNCATE ` + pq.QuoteIdentifier(p.config.migrationsSchemaName) + `.` + pq.QuoteIdentifier(p.config.migrationsTableName)
-	if _, err := tx.Exec(query); err != nil {
+	if err := p.writeVersion(ctx, tx, version, dirty); err != nil {
 		if errRollback := tx.Rollback(); errRollback != nil {
 			err = multierror.Append(err, errRollback)
 		}
-		return &database.Error{OrigErr: err, Query: []byte(query)}
+		return err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return &database.Error{OrigErr: err, Err: "transaction commit failed"}
 	}
 
+	return nil
+}
+
+// writeVersion replaces the version row, with the app version if tracked.
+// The row of an unchanged version is updated in place, e.g. when a migration
+// finishes, instead of being deleted and inserted again.
+func (p *Postgres) writeVersion(ctx context.Context, tx *sql.Tx, version int, dirty bool) error {
+	table := pq.QuoteIdentifier(p.config.migrationsSchemaName) + `.` + pq.QuoteIdentifier(p.config.migrationsTableName)
+
 	// Also re-write the schema version for nil dirty versions to prevent
 	// empty schema version for failed down migration on the first migration
 	// See: https://github.com/golang-migrate/migrate/issues/330
-	if version >= 0 || (version == database.NilVersion && dirty) {
-		query = `INSERT INTO ` + pq.QuoteIdentifier(p.config.migrationsSchemaName) + `.` + pq.QuoteIdentifier(p.config.migrationsTableName) + ` (version, dirty) VALUES ($1, $2)`
-		if _, err := tx.Exec(query, version, dirty); err != nil {
-			if errRollback := tx.Rollback(); errRollback != nil {
-				err = multierror.Append(err, errRollback)
-			}
-			return &database.Error{OrigErr: err, Query: []byte(query)}
+	write := version >= 0 || (version == database.NilVersion && dirty)
+
+	query := `DELETE FROM ` + table
+	var args []interface{}
+	if write {
+		query += ` WHERE version <> $1`
+		args = append(args, version)
+	}
+	if _, err := tx.ExecContext(ctx, query, args...); err != nil {
+		return &database.Error{OrigErr: err, Query: []byte(query)}
+	}
+	if !write {
+		return nil
+	}
+
+	query = `INSERT INTO ` + table + ` (version, dirty) VALUES ($1, $2) ON CONFLICT (version) DO UPDATE SET dirty = EXCLUDED.dirty`
+	args = []interface{}{version, dirty}
+	if p.config.TrackAppVersion {
+		query = `INSERT INTO ` + table + ` (version, dirty, app_version) VALUES ($1, $2, $3) ON CONFLICT (version) DO UPDATE SET dirty = EXCLUDED.dirty, app_version = EXCLUDED.app_version`
+		args = append(args, p.appVersion())
+	}
+	if _, err := tx.ExecContext(ctx, query, args...); err != nil {
+		return &database.Error{OrigErr: err, Query: []byte(query)}
+	}
+	return nil
+}
+
+// appVersion returns the app version to record, NULL if unknown.
+func (p *Postgres) appVersion() sql.NullString {
+	v := p.config.AppVersion
+	if v == "" {
+		v = os.Getenv(database.AppVersionEnv)
+	}
+	return sql.NullString{String: v, Valid: v != ""}
+}
+
+// History implements database.HistoryDriver. The migrations table only
+// holds the current version, so it is the only migration returned.
+func (p *Postgres) History() ([]database.AppliedMigration, error) {
+	columns := `version, dirty, NULL`
+	if p.config.TrackAppVersion {
+		columns = `version, dirty, app_version`
+	}
+	query := `SELECT ` + columns + ` FROM ` + pq.QuoteIdentifier(p.config.migrationsSchemaName) + `.` + pq.QuoteIdentifier(p.config.migrationsTableName) + ` ORDER BY version`
+	rows, err := p.conn.QueryContext(context.Background(), query)
+	if err != nil {
+		return nil, &database.Error{OrigErr: err, Query: []byte(query)}
+	}
+	defer rows.Close()
+
+	var history []database.AppliedMigration
+	for rows.Next() {
+		var (
+			m          database.AppliedMigration
+			appVersion sql.NullString
+		)
+		if err := rows.Scan(&m.Version, &m.Dirty, &appVersion); err != nil {
+			return nil, &database.Error{OrigErr: err, Query: []byte(query)}
 		}
+		m.AppVersion = appVersion.String
+		history = append(history, m)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, &database.Error{OrigErr: err, Query: []byte(query)}
 	}
+	return history, nil
+}
 
-	if err := tx.Commit(); err != nil {
-		return &database.Error{OrigErr: err, Err: "transaction commit failed"}
+// SetChecksum implements database.ChecksumDriver. The checksum column is
+// added to the migrations table when the first checksum is set.
+func (p *Postgres) SetChecksum(version uint, checksum string) error {
+	if err := p.ensureColumn("checksum"); err != nil {
+		return err
 	}
 
+	query := `UPDATE ` + pq.QuoteIdentifier(p.config.migrationsSchemaName) + `.` + pq.QuoteIdentifier(p.config.migrationsTableName) + ` SET checksum = $1 WHERE version = $2`
+	if _, err := p.conn.ExecContext(context.Background(), query, checksum, int64(version)); err != nil {
+		return &database.Error{OrigErr: err, Query: []byte(query)}
+	}
 	return nil
 }
 
+// GetChecksum implements database.ChecksumDriver.
+func (p *Postgres) GetChecksum(version uint) (string, error) {
+	exists, err := p.hasColumn("checksum")
+	if err != nil || !exists {
+		return "", err
+	}
+
+	query := `SELECT checksum FROM ` + pq.QuoteIdentifier(p.config.migrationsSchemaName) + `.` + pq.QuoteIdentifier(p.config.migrationsTableName) + ` WHERE version = $1`
+	var checksum sql.NullString
+	err = p.conn.QueryRowContext(context.Background(), query, int64(version)).Scan(&checksum)
+	if err != nil && err != sql.ErrNoRows {
+		return "", &database.Error{OrigErr: err, Query: []byte(query)}
+	}
+	return checksum.String, nil
+}
+
 func (p *Postgres) Version() (version int, dirty bool, err error) {
 	query := `SELECT version, dirty FROM ` + pq.QuoteIdentifier(p.config.migrationsSchemaName) + `.` + pq.QuoteIdentifier(p.config.migrationsTableName) + ` LIMIT 1`
 	err = p.conn.QueryRowContext(context.Background(), query).Scan(&version, &dirty)
@@ -409,11 +718,26 @@ func (p *Postgres) Version() (version int, dirty bool, err error) {
 }
 
 func (p *Postgres) Drop() (err error) {
+	return p.drop(context.Background(), false)
+}
+
+// DropWithOptions implements database.DropOptionsDriver.
+func (p *Postgres) DropWithOptions(ctx context.Context, opts database.DropOptions) error {
+	return p.drop(ctx, opts.KeepMigrationsTable)
+}
+
+// DropList implements database.DropLister.
+func (p *Postgres) DropList(ctx context.Context, opts database.DropOptions) ([]string, error) {
+	return p.dropTables(ctx, opts.KeepMigrationsTable)
+}
+
+// dropTables returns the tables drop deletes.
+func (p *Postgres) dropTables(ctx context.Context, keepMigrationsTable bool) (_ []string, err error) {
 	// select all tables in current schema
 	query := `SELECT table_name FROM information_schema.tables WHERE table_schema=(SELECT current_schema()) AND table_type='BASE TABLE'`
-	tables, err := p.conn.QueryContext(context.Background(), query)
+	tables, err := p.conn.QueryContext(ctx, query)
 	if err != nil {
-		return &database.Error{OrigErr: err, Query: []byte(query)}
+		return nil, &database.Error{OrigErr: err, Query: []byte(query)}
 	}
 	defer func() {
 		if errClose := tables.Close(); errClose != nil {
@@ -421,26 +745,39 @@ func (p *Postgres) Drop() (err error) {
 		}
 	}()
 
-	// delete one table after another
 	tableNames := make([]string, 0)
 	for tables.Next() {
 		var tableName string
 		if err := tables.Scan(&tableName); err != nil {
-			return err
+			return nil, err
+		}
+
+		// do not drop the migrations table if asked to keep it
+		if keepMigrationsTable && tableName == p.config.migrationsTableName && p.config.migrationsSchemaName == p.config.SchemaName {
+			continue
 		}
 		if len(tableName) > 0 {
 			tableNames = append(tableNames, tableName)
 		}
 	}
 	if err := tables.Err(); err != nil {
-		return &database.Error{OrigErr: err, Query: []byte(query)}
+		return nil, &database.Error{OrigErr: err, Query: []byte(query)}
+	}
+
+	return tableNames, nil
+}
+
+func (p *Postgres) drop(ctx context.Context, keepMigrationsTable bool) error {
+	tableNames, err := p.dropTables(ctx, keepMigrationsTable)
+	if err != nil {
+		return err
 	}
 
 	if len(tableNames) > 0 {
 		// delete one by one ...
 		for _, t := range tableNames {
-			query = `DROP TABLE IF EXISTS ` + pq.QuoteIdentifier(t) + ` CASCADE`
-			if _, err := p.conn.ExecContext(context.Background(), query); err != nil {
+			query := `DROP TABLE IF EXISTS ` + pq.QuoteIdentifier(t) + ` CASCADE`
+			if _, err := p.conn.ExecContext(ctx, query); err != nil {
 				return &database.Error{OrigErr: err, Query: []byte(query)}
 			}
 		}
@@ -480,14 +817,40 @@ func (p *Postgres) ensureVersionTable() (err error) {
 		return &database.Error{OrigErr: err, Query: []byte(query)}
 	}
 
-	if count == 1 {
-		return nil
+	if count == 0 {
+		query = `CREATE TABLE IF NOT EXISTS ` + pq.QuoteIdentifier(p.config.migrationsSchemaName) + `.` + pq.QuoteIdentifier(p.config.migrationsTableName) + ` (version ` + p.config.VersionColumnType + ` not null primary key, dirty ` + p.config.DirtyColumnType + ` not null)`
+		if _, err = p.conn.ExecContext(context.Background(), query); err != nil {
+			return &database.Error{OrigErr: err, Query: []byte(query)}
+		}
 	}
 
-	query = `CREATE TABLE IF NOT EXISTS ` + pq.QuoteIdentifier(p.config.migrationsSchemaName) + `.` + pq.QuoteIdentifier(p.config.migrationsTableName) + ` (version bigint not null primary key, dirty boolean not null)`
-	if _, err = p.conn.ExecContext(context.Background(), query); err != nil {
-		return &database.Error{OrigErr: err, Query: []byte(query)}
+	if p.config.TrackAppVersion {
+		return p.ensureColumn("app_version")
 	}
+	return nil
+}
+
+// hasColumn returns whether the migrations table has the column name.
+func (p *Postgres) hasColumn(name string) (bool, error) {
+	query := `SELECT COUNT(1) FROM information_schema.columns WHERE table_schema = $1 AND table_name = $2 AND column_name = $3`
+	var count int
+	if err := p.conn.QueryRowContext(context.Background(), query, p.config.migrationsSchemaName, p.config.migrationsTableName, name).Scan(&count); err != nil {
+		return false, &database.Error{OrigErr: err, Query: []byte(query)}
+	}
+	return count == 1, nil
+}
 
+// ensureColumn adds the text column name to the migrations table, checking
+// first so that read only users can use it too.
+func (p *Postgres) ensureColumn(name string) error {
+	exists, err := p.hasColumn(name)
+	if err != nil || exists {
+		return err
+	}
+
+	query := `ALTER TABLE ` + pq.QuoteIdentifier(p.config.migrationsSchemaName) + `.` + pq.QuoteIdentifier(p.config.migrationsTableName) + ` ADD COLUMN IF NOT EXISTS ` + pq.QuoteIdentifier(name) + ` text`
+	if _, err := p.conn.ExecContext(context.Background(), query); err != nil {
+		return &database.Error{OrigErr: err, Query: []byte(query)}
+	}
 	return nil
 }
@@ -14,6 +14,7 @@ import (
 	"strings"
 	"sync"
 	"testing"
+	"time"
 
 	"github.com/golang-migrate/migrate/v4"
 
@@ -89,6 +90,7 @@ func Test(t *testing.T) {
 	t.Run("testMigrate", testMigrate)
 	t.Run("testMultipleStatements", testMultipleStatements)
 	t.Run("testMultipleStatementsInMultiStatementMode", testMultipleStatementsInMultiStatementMode)
+	t.Run("testStripComments", testStripComments)
 	t.Run("testErrorParsing", testErrorParsing)
 	t.Run("testFilterCustomQuery", testFilterCustomQuery)
 	t.Run("testWithSchema", testWithSchema)
@@ -99,6 +101,13 @@ func Test(t *testing.T) {
 	t.Run("testPostgresLock", testPostgresLock)
 	t.Run("testWithInstanceConcurrent", testWithInstanceConcurrent)
 	t.Run("testWithConnection", testWithConnection)
+	t.Run("testNoLock", testNoLock)
+	t.Run("testLockID", testLockID)
+	t.Run("testRunBatch", testRunBatch)
+	t.Run("testTrackAppVersion", testTrackAppVersion)
+	t.Run("testColumnTypes", testColumnTypes)
+	t.Run("testChecksum", testChecksum)
+	t.Run("testSetVersionRows", testSetVersionRows)
 
 	t.Cleanup(func() {
 		for _, spec := range specs {
@@ -128,6 +137,7 @@ func test(t *testing.T) {
 				t.Error(err)
 			}
 		}()
+		dt.TestParallelMigrate(t, d, 10)
 		dt.Test(t, d, []byte("SELECT 1"))
 	})
 }
@@ -158,6 +168,28 @@ func testMigrate(t *testing.T) {
 	})
 }
 
+func testSetVersionRows(t *testing.T) {
+	dktesting.ParallelTest(t, specs, func(t *testing.T, c dktest.ContainerInfo) {
+		ip, port, err := c.FirstPort()
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		addr := pgConnectionString(ip, port)
+		p := &Postgres{}
+		d, err := p.Open(addr)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer func() {
+			if err := d.Close(); err != nil {
+				t.Error(err)
+			}
+		}()
+		dt.TestSetVersionRows(t, d, d.(*Postgres).conn, `"schema_migrations"`)
+	})
+}
+
 func testMultipleStatements(t *testing.T) {
 	dktesting.ParallelTest(t, specs, func(t *testing.T, c dktest.ContainerInfo) {
 		ip, port, err := c.FirstPort()
@@ -224,6 +256,39 @@ func testMultipleStatementsInMultiStatementMode(t *testing.T) {
 	})
 }
 
+func testStripComments(t *testing.T) {
+	dktesting.ParallelTest(t, specs, func(t *testing.T, c dktest.ContainerInfo) {
+		ip, port, err := c.FirstPort()
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		addr := pgConnectionString(ip, port, "x-multi-statement=true", "x-strip-comments=true")
+		p := &Postgres{}
+		d, err := p.Open(addr)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer func() {
+			if err := d.Close(); err != nil {
+				t.Error(err)
+			}
+		}()
+		migration := "-- create foo\nCREATE TABLE foo (foo text); /* only a comment; */\nINSERT INTO foo VALUES ('-- kept /* too */');"
+		if err := d.Run(strings.NewReader(migration)); err != nil {
+			t.Fatalf("expected err to be nil, got %v", err)
+		}
+
+		var foo string
+		if err := d.(*Postgres).conn.QueryRowContext(context.Background(), "SELECT foo FROM foo").Scan(&foo); err != nil {
+			t.Fatal(err)
+		}
+		if foo != "-- kept /* too */" {
+			t.Errorf("expected the comments in the string to be kept, got %q", foo)
+		}
+	})
+}
+
 func testErrorParsing(t *testing.T) {
 	dktesting.ParallelTest(t, specs, func(t *testing.T, c dktest.ContainerInfo) {
 		ip, port, err := c.FirstPort()
@@ -748,6 +813,338 @@ func testWithConnection(t *testing.T) {
 	})
 }
 
+func testNoLock(t *testing.T) {
+	dktesting.ParallelTest(t, specs, func(t *testing.T, c dktest.ContainerInfo) {
+		ip, port, err := c.FirstPort()
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		p := &Postgres{}
+		d, err := p.Open(pgConnectionString(ip, port))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		lock := d.(*Postgres)
+
+		p = &Postgres{}
+		d, err = p.Open(pgConnectionString(ip, port, "x-no-lock=true"))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		noLock := d.(*Postgres)
+
+		// Should be possible to take real lock and no-lock at the same time
+		if err = lock.Lock(); err != nil {
+			t.Fatal(err)
+		}
+		if err = noLock.Lock(); err != nil {
+			t.Fatal(err)
+		}
+		if err = lock.Unlock(); err != nil {
+			t.Fatal(err)
+		}
+		if err = noLock.Unlock(); err != nil {
+			t.Fatal(err)
+		}
+	})
+}
+func testLockID(t *testing.T) {
+	dktesting.ParallelTest(t, specs, func(t *testing.T, c dktest.ContainerInfo) {
+		ip, port, err := c.FirstPort()
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		open := func(params ...string) *Postgres {
+			p := &Postgres{}
+			d, err := p.Open(pgConnectionString(ip, port, params...))
+			if err != nil {
+				t.Fatal(err)
+			}
+			return d.(*Postgres)
+		}
+		a := open("x-migrations-table=a_migrations", "x-lock-id=42")
+		b := open("x-migrations-table=b_migrations", "x-lock-id=42")
+		other := open("x-migrations-table=b_migrations")
+
+		if err := a.Lock(); err != nil {
+			t.Fatal(err)
+		}
+		// the generated lock id differs
+		if err := other.Lock(); err != nil {
+			t.Fatal(err)
+		}
+		if err := other.Unlock(); err != nil {
+			t.Fatal(err)
+		}
+
+		// the same lock id excludes, whatever the migrations table
+		locked := make(chan error, 1)
+		go func() {
+			locked <- b.Lock()
+		}()
+		select {
+		case err := <-locked:
+			t.Fatalf("expected lock to wait, got %v", err)
+		case <-time.After(500 * time.Millisecond):
+		}
+
+		if err := a.Unlock(); err != nil {
+			t.Fatal(err)
+		}
+		select {
+		case err := <-locked:
+			if err != nil {
+				t.Fatal(err)
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatal("expected lock to be acquired after unlock")
+		}
+		if err := b.Unlock(); err != nil {
+			t.Fatal(err)
+		}
+
+		p := &Postgres{}
+		if _, err := p.Open(pgConnectionString(ip, port, "x-lock-id=not-a-bigint")); !errors.Is(err, strconv.ErrSyntax) {
+			t.Errorf("expected syntax error, got %v", err)
+		}
+	})
+}
+
+func testRunBatch(t *testing.T) {
+	dktesting.ParallelTest(t, specs, func(t *testing.T, c dktest.ContainerInfo) {
+		ip, port, err := c.FirstPort()
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		p := &Postgres{}
+		d, err := p.Open(pgConnectionString(ip, port))
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer func() {
+			if err := d.Close(); err != nil {
+				t.Error(err)
+			}
+		}()
+		pg := d.(*Postgres)
+
+		ctx := context.Background()
+		err = pg.RunBatch(ctx, []io.Reader{
+			strings.NewReader("CREATE TABLE foo (foo text);"),
+			strings.NewReader("CREATE TABLE bar (bar text);"),
+		}, 2)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if version, dirty, err := pg.Version(); err != nil || version != 2 || dirty {
+			t.Fatalf("expected clean version 2, got %v (dirty: %v, err: %v)", version, dirty, err)
+		}
+
+		// the second migration fails, so the first is rolled back
+		err = pg.RunBatch(ctx, []io.Reader{
+			strings.NewReader("CREATE TABLE baz (baz text);"),
+			strings.NewReader("CREATE TABLE foo (foo text);"),
+		}, 4)
+		if err == nil {
+			t.Fatal("expected an error")
+		}
+		if version, dirty, err := pg.Version(); err != nil || version != 2 || dirty {
+			t.Fatalf("expected clean version 2, got %v (dirty: %v, err: %v)", version, dirty, err)
+		}
+		var exists bool
+		if err := pg.conn.QueryRowContext(ctx, "SELECT EXISTS (SELECT 1 FROM information_schema.tables WHERE table_name = 'baz')").Scan(&exists); err != nil {
+			t.Fatal(err)
+		}
+		if exists {
+			t.Error("expected table baz to be rolled back")
+		}
+	})
+}
+
+func testColumnTypes(t *testing.T) {
+	dktesting.ParallelTest(t, specs, func(t *testing.T, c dktest.ContainerInfo) {
+		ip, port, err := c.FirstPort()
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		p := &Postgres{}
+		d, err := p.Open(pgConnectionString(ip, port, "x-migrations-table=typed_migrations", "x-version-column-type=int", "x-dirty-column-type=bool"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer func() {
+			if err := d.Close(); err != nil {
+				t.Error(err)
+			}
+		}()
+		dt.TestSetVersion(t, d)
+
+		query := `SELECT column_name, data_type FROM information_schema.columns WHERE table_name = 'typed_migrations' ORDER BY column_name`
+		rows, err := d.(*Postgres).conn.QueryContext(context.Background(), query)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer rows.Close()
+		columns := map[string]string{}
+		for rows.Next() {
+			var name, dataType string
+			if err := rows.Scan(&name, &dataType); err != nil {
+				t.Fatal(err)
+			}
+			columns[name] = dataType
+		}
+		if len(columns) != 2 || columns["version"] != "integer" || columns["dirty"] != "boolean" {
+			t.Errorf("expected an integer version and a boolean dirty column, got %v", columns)
+		}
+
+		if _, err := p.Open(pgConnectionString(ip, port, "x-version-column-type=int%29%3B")); err == nil {
+			t.Error("expected an error for an invalid column type")
+		}
+	})
+}
+
+func testTrackAppVersion(t *testing.T) {
+	dktesting.ParallelTest(t, specs, func(t *testing.T, c dktest.ContainerInfo) {
+		ip, port, err := c.FirstPort()
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		// the column is added to an existing migrations table
+		p := &Postgres{}
+		d, err := p.Open(pgConnectionString(ip, port))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := d.SetVersion(1, false); err != nil {
+			t.Fatal(err)
+		}
+		if err := d.Close(); err != nil {
+			t.Fatal(err)
+		}
+
+		d, err = p.Open(pgConnectionString(ip, port, "x-track-app-version=true"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer func() {
+			if err := d.Close(); err != nil {
+				t.Error(err)
+			}
+		}()
+		pg := d.(*Postgres)
+
+		history, err := pg.History()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(history) != 1 || history[0].Version != 1 || history[0].AppVersion != "" {
+			t.Errorf("expected version 1 without app version, got %+v", history)
+		}
+
+		pg.config.AppVersion = "v1.2.3"
+		if err := pg.SetVersion(2, false); err != nil {
+			t.Fatal(err)
+		}
+		history, err = pg.History()
+		if err != nil {
+			t.Fatal(err)
+		}
+		expected := []database.AppliedMigration{{Version: 2, AppVersion: "v1.2.3"}}
+		if len(history) != 1 || history[0] != expected[0] {
+			t.Errorf("expected %+v, got %+v", expected, history)
+		}
+
+		pg.config.AppVersion = "v2.0.0"
+		if err := pg.SetVersion(3, false); err != nil {
+			t.Fatal(err)
+		}
+		history, err = pg.History()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(history) != 1 || history[0].AppVersion != "v2.0.0" {
+			t.Errorf("expected app version v2.0.0, got %+v", history)
+		}
+	})
+}
+
+func testChecksum(t *testing.T) {
+	dktesting.ParallelTest(t, specs, func(t *testing.T, c dktest.ContainerInfo) {
+		ip, port, err := c.FirstPort()
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		p := &Postgres{}
+		d, err := p.Open(pgConnectionString(ip, port))
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer func() {
+			if err := d.Close(); err != nil {
+				t.Error(err)
+			}
+		}()
+		pg := d.(*Postgres)
+
+		// without the checksum column there is no checksum
+		if err := pg.SetVersion(1, false); err != nil {
+			t.Fatal(err)
+		}
+		if checksum, err := pg.GetChecksum(1); err != nil || checksum != "" {
+			t.Fatalf("expected no checksum, got %q, %v", checksum, err)
+		}
+
+		if err := pg.SetChecksum(1, "abc"); err != nil {
+			t.Fatal(err)
+		}
+		if checksum, err := pg.GetChecksum(1); err != nil || checksum != "abc" {
+			t.Errorf("expected checksum abc, got %q, %v", checksum, err)
+		}
+
+		// a new version starts without a checksum
+		if err := pg.SetVersion(2, false); err != nil {
+			t.Fatal(err)
+		}
+		if checksum, err := pg.GetChecksum(2); err != nil || checksum != "" {
+			t.Errorf("expected no checksum, got %q, %v", checksum, err)
+		}
+	})
+}
+
+func TestAppVersion(t *testing.T) {
+	t.Setenv(database.AppVersionEnv, "")
+	p := &Postgres{config: &Config{}}
+	if v := p.appVersion(); v.Valid {
+		t.Errorf("expected NULL, got %v", v.String)
+	}
+
+	t.Setenv(database.AppVersionEnv, "v1.2.3")
+	if v := p.appVersion(); v.String != "v1.2.3" || !v.Valid {
+		t.Errorf("expected v1.2.3 from the environment, got %v", v.String)
+	}
+
+	p.config.AppVersion = "v2.0.0"
+	if v := p.appVersion(); v.String != "v2.0.0" {
+		t.Errorf("expected the configured v2.0.0, got %v", v.String)
+	}
+}
+
+func TestNoLockParamValidation(t *testing.T) {
+	p := &Postgres{}
+	_, err := p.Open(pgConnectionString("127.0.0.1", "5432", "x-no-lock=not-a-bool"))
+	if !errors.Is(err, strconv.ErrSyntax) {
+		t.Fatal("Expected syntax error when passing a non-bool as x-no-lock parameter")
+	}
+}
+
 func Test_computeLineFromPos(t *testing.T) {
 	testcases := []struct {
 		pos      int
@@ -827,3 +1224,68 @@ func Test_computeLineFromPos(t *testing.T) {
 		})
 	}
 }
+
+func TestCapabilities(t *testing.T) {
+	cases := []struct {
+		name     string
+		config   *Config
+		expected database.Capabilities
+	}{
+		{"default", &Config{}, database.Capabilities{SupportsTx: true, SupportsMultiStatement: true, SupportsLocking: true}},
+		{"no lock", &Config{NoLock: true}, database.Capabilities{SupportsTx: true, SupportsMultiStatement: true}},
+		{"lock strategy none", &Config{LockStrategy: LockStrategyNone}, database.Capabilities{SupportsTx: true, SupportsMultiStatement: true}},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			p := &Postgres{config: c.config}
+			if caps := p.Capabilities(); caps != c.expected {
+				t.Fatalf("expected %+v, got %+v", c.expected, caps)
+			}
+		})
+	}
+}
+
+func TestDescribe(t *testing.T) {
+	cases := []struct {
+		name     string
+		config   *Config
+		expected database.DriverInfo
+	}{
+		{"default", &Config{}, database.DriverInfo{Name: "postgres", Capabilities: database.Capabilities{SupportsTx: true, SupportsMultiStatement: true, SupportsLocking: true}, SupportsAdvisoryLocks: true, SupportsSchemas: true}},
+		{"no lock", &Config{NoLock: true}, database.DriverInfo{Name: "postgres", Capabilities: database.Capabilities{SupportsTx: true, SupportsMultiStatement: true}, SupportsSchemas: true}},
+		{"lock strategy none", &Config{LockStrategy: LockStrategyNone}, database.DriverInfo{Name: "postgres", Capabilities: database.Capabilities{SupportsTx: true, SupportsMultiStatement: true}, SupportsSchemas: true}},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			p := &Postgres{config: c.config}
+			info, err := p.Describe()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if info != c.expected {
+				t.Fatalf("expected %+v, got %+v", c.expected, info)
+			}
+		})
+	}
+}
+
+func TestLockStrategyNone(t *testing.T) {
+	p := &Postgres{config: &Config{LockStrategy: LockStrategyNone}}
+	if !p.LockDisabled() {
+		t.Fatal("expected locking to be disabled")
+	}
+	// Lock and Unlock don't touch the database
+	if err := p.Lock(); err != nil {
+		t.Fatal(err)
+	}
+	if err := p.Unlock(); err != nil {
+		t.Fatal(err)
+	}
+
+	p = &Postgres{config: &Config{LockStrategy: LockStrategyAdvisory}}
+	if p.LockDisabled() {
+		t.Fatal("expected locking to be enabled")
+	}
+}
@@ -155,7 +155,7 @@ func (m *Ql) Drop() (err error) {
 
 	if len(tableNames) > 0 {
 		for _, t := range tableNames {
-			query := "DROP TABLE " + t
+			query := "DROP TABLE IF EXISTS " + t
 			err = m.executeQuery(query)
 			if err != nil {
 				return &database.Error{OrigErr: err, Query: []byte(query)}
@@ -0,0 +1,213 @@
+package redis
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/dhui/dktest"
+	"github.com/redis/go-redis/v9"
+
+	"github.com/golang-migrate/migrate/v4"
+	dt "github.com/golang-migrate/migrate/v4/database/testing"
+	"github.com/golang-migrate/migrate/v4/dktesting"
+	_ "github.com/golang-migrate/migrate/v4/source/file"
+)
+
+const defaultPort = 6379
+
+var (
+	opts = dktest.Options{PortRequired: true, ReadyFunc: isReady}
+	// Supported versions: https://redis.io/docs/latest/operate/rs/installing-upgrading/product-lifecycle/
+	specs = []dktesting.ContainerSpec{
+		{ImageName: "redis:6.2", Options: opts},
+		{ImageName: "redis:7.2", Options: opts},
+		{ImageName: "redis:7.4", Options: opts},
+	}
+)
+
+func redisURL(host, port string, path string) string {
+	return fmt.Sprintf("redis://%s:%s%s", host, port, path)
+}
+
+func isReady(ctx context.Context, c dktest.ContainerInfo) bool {
+	ip, port, err := c.Port(defaultPort)
+	if err != nil {
+		return false
+	}
+	client := redis.NewClient(&redis.Options{Addr: net.JoinHostPort(ip, port)})
+	defer client.Close()
+	return client.Ping(ctx).Err() == nil
+}
+
+func Test(t *testing.T) {
+	dktesting.ParallelTest(t, specs, func(t *testing.T, c dktest.ContainerInfo) {
+		ip, port, err := c.Port(defaultPort)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		r := &Redis{}
+		d, err := r.Open(redisURL(ip, port, "/1"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer func() {
+			if err := d.Close(); err != nil {
+				t.Error(err)
+			}
+		}()
+		dt.Test(t, d, []byte("SET foo \"bar baz\"\nZADD scores 1 one"))
+		dt.TestParallelMigrate(t, d, 5)
+	})
+}
+
+func TestMigrate(t *testing.T) {
+	dktesting.ParallelTest(t, specs, func(t *testing.T, c dktest.ContainerInfo) {
+		ip, port, err := c.Port(defaultPort)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		r := &Redis{}
+		d, err := r.Open(redisURL(ip, port, "/2?x-migrations-key=app:migrations"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer func() {
+			if err := d.Close(); err != nil {
+				t.Error(err)
+			}
+		}()
+		m, err := migrate.NewWithDatabaseInstance("file://./examples/migrations", "redis", d)
+		if err != nil {
+			t.Fatal(err)
+		}
+		dt.TestMigrate(t, m)
+	})
+}
+
+func TestRunLua(t *testing.T) {
+	dktesting.ParallelTest(t, specs, func(t *testing.T, c dktest.ContainerInfo) {
+		ip, port, err := c.Port(defaultPort)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		r := &Redis{}
+		d, err := r.Open(redisURL(ip, port, ""))
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer func() {
+			if err := d.Close(); err != nil {
+				t.Error(err)
+			}
+		}()
+
+		script := "-- lua\nredis.call('SET', 'a', '1')\nredis.call('SET', 'b', '2')\nreturn 0"
+		if err := d.Run(strings.NewReader(script)); err != nil {
+			t.Fatal(err)
+		}
+		reply, err := d.(*Redis).client.MGet(context.Background(), "a", "b").Result()
+		if err != nil {
+			t.Fatal(err)
+		}
+		expected := []interface{}{"1", "2"}
+		if !reflect.DeepEqual(reply, expected) {
+			t.Errorf("expected %q, got %q", expected, reply)
+		}
+
+		if err := d.Run(strings.NewReader("SET c 3\nNOSUCHCOMMAND\nSET d 4")); err == nil {
+			t.Error("expected an error")
+		}
+	})
+}
+
+func TestLockRefresh(t *testing.T) {
+	dktesting.ParallelTest(t, specs, func(t *testing.T, c dktest.ContainerInfo) {
+		ip, port, err := c.Port(defaultPort)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		r := &Redis{}
+		d, err := r.Open(redisURL(ip, port, "?x-lock-ttl=1"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer func() {
+			if err := d.Close(); err != nil {
+				t.Error(err)
+			}
+		}()
+		client := d.(*Redis).client
+
+		if err := d.Lock(); err != nil {
+			t.Fatal(err)
+		}
+		// the lock outlives its TTL while locked
+		time.Sleep(2 * time.Second)
+		if n, err := client.Exists(context.Background(), DefaultLockKey).Result(); err != nil || n != 1 {
+			t.Fatalf("expected the lock to be refreshed, got %v %v", n, err)
+		}
+		if err := d.SetVersion(1, false); err != nil {
+			t.Fatal(err)
+		}
+
+		// another process took the lock
+		if err := client.Set(context.Background(), DefaultLockKey, "other", 0).Err(); err != nil {
+			t.Fatal(err)
+		}
+		if err := d.SetVersion(2, false); !errors.Is(err, ErrLockLost) {
+			t.Errorf("expected %v, got %v", ErrLockLost, err)
+		}
+		if err := d.Unlock(); !errors.Is(err, ErrLockLost) {
+			t.Errorf("expected %v, got %v", ErrLockLost, err)
+		}
+		if v, _, err := d.Version(); err != nil || v != 1 {
+			t.Errorf("expected version 1, got %v %v", v, err)
+		}
+		if token, err := client.Get(context.Background(), DefaultLockKey).Result(); err != nil || token != "other" {
+			t.Errorf("expected the lock of the other process to be kept, got %q %v", token, err)
+		}
+	})
+}
+
+func TestSplitArgs(t *testing.T) {
+	tt := []struct {
+		line     string
+		expected []string
+		err      bool
+	}{
+		{line: "SET foo bar", expected: []string{"SET", "foo", "bar"}},
+		{line: "  SET   foo\tbar  ", expected: []string{"SET", "foo", "bar"}},
+		{line: `SET foo "bar baz"`, expected: []string{"SET", "foo", "bar baz"}},
+		{line: `SET foo "a \"quoted\"\n"`, expected: []string{"SET", "foo", "a \"quoted\"\n"}},
+		{line: `SET foo 'it''s'`, expected: []string{"SET", "foo", "its"}},
+		{line: `SET foo ""`, expected: []string{"SET", "foo", ""}},
+		{line: `SET foo "bar`, err: true},
+		{line: `SET foo 'bar`, err: true},
+	}
+	for _, tc := range tt {
+		args, err := splitArgs(tc.line)
+		if tc.err {
+			if err == nil {
+				t.Errorf("%v: expected an error", tc.line)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%v: %v", tc.line, err)
+			continue
+		}
+		if !reflect.DeepEqual(args, tc.expected) {
+			t.Errorf("%v: expected %q, got %q", tc.line, tc.expected, args)
+		}
+	}
+}
@@ -255,7 +255,7 @@ func (r *Rqlite) Drop() error {
 		}
 
 		if len(tableName) > 0 {
-			statement := fmt.Sprintf(`DROP TABLE %s`, tableName)
+			statement := fmt.Sprintf(`DROP TABLE IF EXISTS %s`, tableName)
 			statements = append(statements, statement)
 		}
 	}
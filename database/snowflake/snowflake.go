@@ -1,6 +1,7 @@
 package snowflake
 
 import (
+	"bytes"
 	"context"
 	"database/sql"
 	"fmt"
@@ -12,6 +13,7 @@ import (
 	"go.uber.org/atomic"
 
 	"github.com/golang-migrate/migrate/v4/database"
+	"github.com/golang-migrate/migrate/v4/database/sqlutil"
 	"github.com/hashicorp/go-multierror"
 	"github.com/lib/pq"
 	sf "github.com/snowflakedb/gosnowflake"
@@ -35,6 +37,14 @@ var (
 type Config struct {
 	MigrationsTable string
 	DatabaseName    string
+	// MultiStatementEnabled runs migrations holding several statements in a
+	// single request, passing the number of statements to Snowflake, which
+	// otherwise only accepts one statement per request.
+	MultiStatementEnabled bool
+	// MultiStatementCount is the number of statements of every migration
+	// when MultiStatementEnabled is set. With 0, the statements of each
+	// migration are counted by splitting it on ;.
+	MultiStatementCount int
 }
 
 type Snowflake struct {
@@ -98,24 +108,64 @@ func (p *Snowflake) Open(url string) (database.Driver, error) {
 		return nil, err
 	}
 
+	cfg, config, err := configForURL(purl)
+	if err != nil {
+		return nil, err
+	}
+
+	dsn, err := sf.DSN(cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	db, err := sql.Open("snowflake", dsn)
+	if err != nil {
+		return nil, err
+	}
+
+	px, err := WithInstance(db, config)
+	if err != nil {
+		return nil, err
+	}
+
+	return px, nil
+}
+
+// configForURL returns the Snowflake connection config and the driver
+// config for purl.
+func configForURL(purl *nurl.URL) (*sf.Config, *Config, error) {
 	password, isPasswordSet := purl.User.Password()
 	if !isPasswordSet {
-		return nil, ErrNoPassword
+		return nil, nil, ErrNoPassword
 	}
 
 	splitPath := strings.Split(purl.Path, "/")
 	if len(splitPath) < 3 {
-		return nil, ErrNoSchemaOrDatabase
+		return nil, nil, ErrNoSchemaOrDatabase
 	}
 
 	database := splitPath[2]
 	if len(database) == 0 {
-		return nil, ErrNoDatabaseName
+		return nil, nil, ErrNoDatabaseName
 	}
 
 	schema := splitPath[1]
 	if len(schema) == 0 {
-		return nil, ErrNoSchema
+		return nil, nil, ErrNoSchema
+	}
+
+	multiStatementEnabled := false
+	multiStatementCount := 0
+	if s := purl.Query().Get("x-multi-statement-count"); len(s) > 0 {
+		var err error
+		multiStatementCount, err = strconv.Atoi(s)
+		if err != nil {
+			return nil, nil, fmt.Errorf("Unable to parse option x-multi-statement-count: %w", err)
+		}
+		if multiStatementCount < 0 {
+			return nil, nil, fmt.Errorf("x-multi-statement-count must not be negative, got %d", multiStatementCount)
+		}
+		multiStatementEnabled = true
 	}
 
 	cfg := &sf.Config{
@@ -126,27 +176,13 @@ func (p *Snowflake) Open(url string) (database.Driver, error) {
 		Schema:   schema,
 	}
 
-	dsn, err := sf.DSN(cfg)
-	if err != nil {
-		return nil, err
+	config := &Config{
+		DatabaseName:          database,
+		MigrationsTable:       purl.Query().Get("x-migrations-table"),
+		MultiStatementEnabled: multiStatementEnabled,
+		MultiStatementCount:   multiStatementCount,
 	}
-
-	db, err := sql.Open("snowflake", dsn)
-	if err != nil {
-		return nil, err
-	}
-
-	migrationsTable := purl.Query().Get("x-migrations-table")
-
-	px, err := WithInstance(db, &Config{
-		DatabaseName:    database,
-		MigrationsTable: migrationsTable,
-	})
-	if err != nil {
-		return nil, err
-	}
-
-	return px, nil
+	return cfg, config, nil
 }
 
 func (p *Snowflake) Close() error {
@@ -178,9 +214,22 @@ func (p *Snowflake) Run(migration io.Reader) error {
 		return err
 	}
 
+	ctx := context.Background()
+	if p.config.MultiStatementEnabled {
+		count := p.config.MultiStatementCount
+		if count == 0 {
+			if count, err = countStatements(migr); err != nil {
+				return err
+			}
+		}
+		if ctx, err = sf.WithMultiStatement(ctx, count); err != nil {
+			return err
+		}
+	}
+
 	// run migration
 	query := string(migr[:])
-	if _, err := p.conn.ExecContext(context.Background(), query); err != nil {
+	if _, err := p.conn.ExecContext(ctx, query); err != nil {
 		if pgErr, ok := err.(*pq.Error); ok {
 			var line uint
 			var col uint
@@ -205,6 +254,24 @@ func (p *Snowflake) Run(migration io.Reader) error {
 	return nil
 }
 
+// splitter splits migrations on ; to count their statements, knowing about
+// $$ quoted procedure bodies.
+var splitter = sqlutil.StatementSplitter{DollarQuotes: true}
+
+// countStatements returns the number of statements of migr, ignoring
+// statements only holding comments and whitespace.
+func countStatements(migr []byte) (int, error) {
+	count := 0
+	err := splitter.Split(bytes.NewReader(migr), len(migr)+1, func(stmt []byte) bool {
+		stmt = bytes.TrimSpace(splitter.StripComments(stmt))
+		if len(bytes.TrimSpace(bytes.TrimSuffix(stmt, sqlutil.DefaultDelimiter))) > 0 {
+			count++
+		}
+		return true
+	})
+	return count, err
+}
+
 func computeLineFromPos(s string, pos int) (line uint, col uint, ok bool) {
 	// replace crlf with lf
 	s = strings.Replace(s, "\r\n", "\n", -1)
@@ -10,6 +10,7 @@ import (
 	"regexp"
 	"strconv"
 	"strings"
+	"unicode"
 
 	"cloud.google.com/go/spanner"
 	sdb "cloud.google.com/go/spanner/admin/database/apiv1"
@@ -45,6 +46,8 @@ var (
 	ErrDatabaseDirty  = errors.New("database is dirty")
 	ErrLockHeld       = errors.New("unable to obtain lock")
 	ErrLockNotHeld    = errors.New("unable to release already released lock")
+	ErrNoTenantID     = errors.New("no tenant id, required with a parent table")
+	ErrNoParentTable  = errors.New("no parent table, required with a tenant id")
 )
 
 // Config used for a Spanner instance
@@ -56,6 +59,18 @@ type Config struct {
 	// Parsing outputs clean DDL statements such as reformatted
 	// and void of comments.
 	CleanStatements bool
+	// Whether a migration may contain both DDL and DML statements.
+	// The statements are split into consecutive DDL and DML segments,
+	// which are run one after another in the order they are written.
+	// DDL statements are cleaned like with CleanStatements.
+	AllowMixed bool
+	// ParentTable is the table of the tenants, whose primary key must be
+	// TenantID STRING(MAX). If set, the migrations table is interleaved in
+	// it, keyed by TenantID, and tracks the version of TenantID only.
+	// Drop then only deletes the version of the tenant, as the schema is
+	// shared by all tenants.
+	ParentTable string
+	TenantID    string
 }
 
 // Spanner implements database.Driver for Google Cloud Spanner
@@ -93,6 +108,13 @@ func WithInstance(instance *DB, config *Config) (database.Driver, error) {
 		config.MigrationsTable = DefaultMigrationsTable
 	}
 
+	if len(config.ParentTable) > 0 && len(config.TenantID) == 0 {
+		return nil, ErrNoTenantID
+	}
+	if len(config.TenantID) > 0 && len(config.ParentTable) == 0 {
+		return nil, ErrNoParentTable
+	}
+
 	sx := &Spanner{
 		db:     instance,
 		config: config,
@@ -136,11 +158,23 @@ func (s *Spanner) Open(url string) (database.Driver, error) {
 		}
 	}
 
+	allowMixedQuery := purl.Query().Get("x-allow-mixed")
+	allowMixed := false
+	if allowMixedQuery != "" {
+		allowMixed, err = strconv.ParseBool(allowMixedQuery)
+		if err != nil {
+			return nil, err
+		}
+	}
+
 	db := &DB{admin: adminClient, data: dataClient}
 	return WithInstance(db, &Config{
 		DatabaseName:    dbname,
 		MigrationsTable: migrationsTable,
 		CleanStatements: clean,
+		AllowMixed:      allowMixed,
+		ParentTable:     purl.Query().Get("x-parent-table"),
+		TenantID:        purl.Query().Get("x-tenant-id"),
 	})
 }
 
@@ -150,6 +184,24 @@ func (s *Spanner) Close() error {
 	return s.db.admin.Close()
 }
 
+// Capabilities implements database.CapabilitiesDriver.
+// Lock only guards the driver instance and schema changes are not
+// transactional. Multiple statements are only supported with
+// x-clean-statements or x-allow-mixed.
+func (s *Spanner) Capabilities() database.Capabilities {
+	return database.Capabilities{
+		SupportsMultiStatement: s.config.CleanStatements || s.config.AllowMixed,
+	}
+}
+
+// Describe implements database.Describer.
+func (s *Spanner) Describe() (database.DriverInfo, error) {
+	return database.DriverInfo{
+		Name:         "spanner",
+		Capabilities: s.Capabilities(),
+	}, nil
+}
+
 // Lock implements database.Driver but doesn't do anything because Spanner only
 // enqueues the UpdateDatabaseDdlRequest.
 func (s *Spanner) Lock() error {
@@ -174,6 +226,22 @@ func (s *Spanner) Run(migration io.Reader) error {
 		return err
 	}
 
+	ctx := context.Background()
+	if sectionMarker.Match(migr) {
+		segments, err := parseSections(migr)
+		if err != nil {
+			return &database.Error{OrigErr: err, Err: "migration failed", Query: migr}
+		}
+		return s.runSegments(ctx, segments)
+	}
+	if s.config.AllowMixed {
+		segments, err := parseMixedStatements(migr)
+		if err != nil {
+			return &database.Error{OrigErr: err, Err: "migration failed", Query: migr}
+		}
+		return s.runSegments(ctx, segments)
+	}
+
 	stmts := []string{string(migr)}
 	if s.config.CleanStatements {
 		stmts, err = cleanStatements(migr)
@@ -182,20 +250,72 @@ func (s *Spanner) Run(migration io.Reader) error {
 		}
 	}
 
-	ctx := context.Background()
+	if err := s.runDDL(ctx, stmts); err != nil {
+		return &database.Error{OrigErr: err, Err: "migration failed", Query: migr}
+	}
+
+	return nil
+}
+
+// runSegments runs the segments of a migration in the order they are
+// written. Each DDL segment is applied with a single UpdateDatabaseDdl
+// request, each DML segment in a single read-write transaction and each
+// partitioned DML statement on its own, so a statement can depend on any
+// statement before it. The migration as a whole is not atomic though: if a
+// segment fails, the segments before it remain applied.
+func (s *Spanner) runSegments(ctx context.Context, segments []segment) error {
+	for _, seg := range segments {
+		var err error
+		switch seg.kind {
+		case segmentDML:
+			err = s.runDML(ctx, seg.stmts)
+		case segmentPDML:
+			err = s.runPDML(ctx, seg.stmts)
+		default:
+			err = s.runDDL(ctx, seg.stmts)
+		}
+		if err != nil {
+			return &database.Error{OrigErr: err, Err: "migration failed", Query: []byte(strings.Join(seg.stmts, ";\n"))}
+		}
+	}
+
+	return nil
+}
+
+// runDDL applies DDL statements and waits for them to complete.
+func (s *Spanner) runDDL(ctx context.Context, stmts []string) error {
 	op, err := s.db.admin.UpdateDatabaseDdl(ctx, &adminpb.UpdateDatabaseDdlRequest{
 		Database:   s.config.DatabaseName,
 		Statements: stmts,
 	})
-
 	if err != nil {
-		return &database.Error{OrigErr: err, Err: "migration failed", Query: migr}
+		return err
 	}
+	return op.Wait(ctx)
+}
 
-	if err := op.Wait(ctx); err != nil {
-		return &database.Error{OrigErr: err, Err: "migration failed", Query: migr}
-	}
+// runDML runs DML statements in a single read-write transaction.
+func (s *Spanner) runDML(ctx context.Context, stmts []string) error {
+	_, err := s.db.data.ReadWriteTransaction(ctx,
+		func(ctx context.Context, txn *spanner.ReadWriteTransaction) error {
+			for _, stmt := range stmts {
+				if _, err := txn.Update(ctx, spanner.NewStatement(stmt)); err != nil {
+					return err
+				}
+			}
+			return nil
+		})
+	return err
+}
 
+// runPDML runs each statement as partitioned DML, which is not atomic but
+// can update more rows than a transaction.
+func (s *Spanner) runPDML(ctx context.Context, stmts []string) error {
+	for _, stmt := range stmts {
+		if _, err := s.db.data.PartitionedUpdate(ctx, spanner.NewStatement(stmt)); err != nil {
+			return err
+		}
+	}
 	return nil
 }
 
@@ -203,6 +323,10 @@ func (s *Spanner) Run(migration io.Reader) error {
 func (s *Spanner) SetVersion(version int, dirty bool) error {
 	ctx := context.Background()
 
+	if s.config.ParentTable != "" {
+		return s.setTenantVersion(ctx, version, dirty)
+	}
+
 	_, err := s.db.data.ReadWriteTransaction(ctx,
 		func(ctx context.Context, txn *spanner.ReadWriteTransaction) error {
 			m := []*spanner.Mutation{
@@ -220,6 +344,35 @@ func (s *Spanner) SetVersion(version int, dirty bool) error {
 	return nil
 }
 
+// setTenantVersion replaces the version of the tenant.
+func (s *Spanner) setTenantVersion(ctx context.Context, version int, dirty bool) error {
+	stmt := s.tenantStatement(`DELETE FROM ` + s.config.MigrationsTable + ` WHERE TenantID = @tid`)
+	_, err := s.db.data.ReadWriteTransaction(ctx,
+		func(ctx context.Context, txn *spanner.ReadWriteTransaction) error {
+			if _, err := txn.Update(ctx, stmt); err != nil {
+				return err
+			}
+			return txn.BufferWrite([]*spanner.Mutation{
+				spanner.Insert(s.config.MigrationsTable,
+					[]string{"TenantID", "Version", "Dirty"},
+					[]interface{}{s.config.TenantID, version, dirty},
+				)})
+		})
+	if err != nil {
+		return &database.Error{OrigErr: err, Query: []byte(stmt.SQL)}
+	}
+
+	return nil
+}
+
+// tenantStatement returns a statement with the @tid parameter bound to the
+// tenant id.
+func (s *Spanner) tenantStatement(sql string) spanner.Statement {
+	stmt := spanner.NewStatement(sql)
+	stmt.Params["tid"] = s.config.TenantID
+	return stmt
+}
+
 // Version implements database.Driver
 func (s *Spanner) Version() (version int, dirty bool, err error) {
 	ctx := context.Background()
@@ -227,6 +380,9 @@ func (s *Spanner) Version() (version int, dirty bool, err error) {
 	stmt := spanner.Statement{
 		SQL: `SELECT Version, Dirty FROM ` + s.config.MigrationsTable + ` LIMIT 1`,
 	}
+	if s.config.ParentTable != "" {
+		stmt = s.tenantStatement(`SELECT Version, Dirty FROM ` + s.config.MigrationsTable + ` WHERE TenantID = @tid LIMIT 1`)
+	}
 	iter := s.db.data.Single().Query(ctx, stmt)
 	defer iter.Stop()
 
@@ -255,8 +411,24 @@ var nameMatcher = regexp.MustCompile(`(CREATE TABLE\s(\S+)\s)|(CREATE.+INDEX\s(\
 // provided in the schema. Assuming the schema describes how the database can
 // be "build up", it seems logical to "unbuild" the database simply by going the
 // opposite direction. More testing
+//
+// With a parent table, only the version of the tenant is deleted, as the
+// schema is shared by all tenants.
 func (s *Spanner) Drop() error {
 	ctx := context.Background()
+	if s.config.ParentTable != "" {
+		stmt := s.tenantStatement(`DELETE FROM ` + s.config.MigrationsTable + ` WHERE TenantID = @tid`)
+		_, err := s.db.data.ReadWriteTransaction(ctx,
+			func(ctx context.Context, txn *spanner.ReadWriteTransaction) error {
+				_, err := txn.Update(ctx, stmt)
+				return err
+			})
+		if err != nil {
+			return &database.Error{OrigErr: err, Err: "drop failed", Query: []byte(stmt.SQL)}
+		}
+		return nil
+	}
+
 	res, err := s.db.admin.GetDatabaseDdl(ctx, &adminpb.GetDatabaseDdlRequest{
 		Database: s.config.DatabaseName,
 	})
@@ -324,6 +496,14 @@ func (s *Spanner) ensureVersionTable() (err error) {
     Version INT64 NOT NULL,
     Dirty    BOOL NOT NULL
 	) PRIMARY KEY(Version)`, tbl)
+	if s.config.ParentTable != "" {
+		stmt = fmt.Sprintf(`CREATE TABLE %s (
+    TenantID STRING(MAX) NOT NULL,
+    Version  INT64 NOT NULL,
+    Dirty    BOOL NOT NULL
+	) PRIMARY KEY(TenantID, Version),
+	INTERLEAVE IN PARENT %s ON DELETE CASCADE`, tbl, s.config.ParentTable)
+	}
 
 	op, err := s.db.admin.UpdateDatabaseDdl(ctx, &adminpb.UpdateDatabaseDdlRequest{
 		Database:   s.config.DatabaseName,
@@ -354,3 +534,139 @@ func cleanStatements(migration []byte) ([]string, error) {
 	}
 	return stmts, nil
 }
+
+type segmentKind int
+
+const (
+	segmentDDL segmentKind = iota
+	segmentDML
+	segmentPDML
+)
+
+// segment is a run of consecutive statements of the same kind.
+type segment struct {
+	kind  segmentKind
+	stmts []string
+}
+
+// sectionMarker matches the lines starting the sections of a migration,
+// like -- migrate:ddl.
+var sectionMarker = regexp.MustCompile(`(?m)^[ \t]*-- migrate:(\S*)[ \t]*\r?$`)
+
+var sectionKinds = map[string]segmentKind{
+	"ddl":  segmentDDL,
+	"dml":  segmentDML,
+	"pdml": segmentPDML,
+}
+
+// parseMixedStatements splits a migration into segments of DDL and DML
+// statements, in the order they are written. DDL statements are cleaned
+// like with cleanStatements, DML statements are kept as written.
+func parseMixedStatements(migration []byte) ([]segment, error) {
+	var segments []segment
+	for _, stmt := range splitStatements(string(migration)) {
+		var sql string
+		kind := segmentDDL
+		ddl, ddlErr := spansql.ParseDDLStmt(stmt)
+		if ddlErr == nil {
+			sql = ddl.SQL()
+		} else if _, err := spansql.ParseDMLStmt(stmt); err == nil {
+			sql, kind = stmt, segmentDML
+		} else {
+			return nil, fmt.Errorf("neither DDL (%v) nor DML (%v): %s", ddlErr, err, stmt)
+		}
+
+		if n := len(segments); n > 0 && segments[n-1].kind == kind {
+			segments[n-1].stmts = append(segments[n-1].stmts, sql)
+		} else {
+			segments = append(segments, segment{kind: kind, stmts: []string{sql}})
+		}
+	}
+	return segments, nil
+}
+
+// parseSections splits a migration into segments at the section markers
+// -- migrate:ddl, -- migrate:dml and -- migrate:pdml. DDL statements are
+// cleaned like with cleanStatements, DML statements are kept as written.
+// Sections without statements are skipped.
+func parseSections(migration []byte) ([]segment, error) {
+	markers := sectionMarker.FindAllSubmatchIndex(migration, -1)
+	if len(markers) == 0 {
+		return nil, errors.New("no section markers")
+	}
+	if len(splitStatements(string(migration[:markers[0][0]]))) > 0 {
+		return nil, errors.New("statements before the first section marker")
+	}
+
+	var segments []segment
+	for i, marker := range markers {
+		name := string(migration[marker[2]:marker[3]])
+		kind, ok := sectionKinds[name]
+		if !ok {
+			return nil, fmt.Errorf("unknown section marker -- migrate:%s, expected ddl, dml or pdml", name)
+		}
+
+		end := len(migration)
+		if i+1 < len(markers) {
+			end = markers[i+1][0]
+		}
+		stmts := splitStatements(string(migration[marker[1]:end]))
+		if len(stmts) == 0 {
+			continue
+		}
+		if kind == segmentDDL {
+			for j, stmt := range stmts {
+				ddl, err := spansql.ParseDDLStmt(stmt)
+				if err != nil {
+					return nil, err
+				}
+				stmts[j] = ddl.SQL()
+			}
+		}
+		segments = append(segments, segment{kind: kind, stmts: stmts})
+	}
+	return segments, nil
+}
+
+// splitStatements splits a migration on semicolons outside of string
+// literals, quoted identifiers and comments. Statements consisting of
+// whitespace and comments only are dropped.
+func splitStatements(migration string) []string {
+	var stmts []string
+	start, hasContent := 0, false
+	for i := 0; i < len(migration); i++ {
+		switch c := migration[i]; {
+		case c == '\'' || c == '"' || c == '`':
+			// skip to the closing quote, honoring backslash escapes
+			hasContent = true
+			for i++; i < len(migration) && migration[i] != c; i++ {
+				if migration[i] == '\\' {
+					i++
+				}
+			}
+		case c == '#', strings.HasPrefix(migration[i:], "--"):
+			if j := strings.IndexByte(migration[i:], '\n'); j >= 0 {
+				i += j
+			} else {
+				i = len(migration)
+			}
+		case strings.HasPrefix(migration[i:], "/*"):
+			if j := strings.Index(migration[i+2:], "*/"); j >= 0 {
+				i += j + 3
+			} else {
+				i = len(migration)
+			}
+		case c == ';':
+			if hasContent {
+				stmts = append(stmts, strings.TrimSpace(migration[start:i]))
+			}
+			start, hasContent = i+1, false
+		case !unicode.IsSpace(rune(c)):
+			hasContent = true
+		}
+	}
+	if hasContent {
+		stmts = append(stmts, strings.TrimSpace(migration[start:]))
+	}
+	return stmts
+}
@@ -1,15 +1,19 @@
 package spanner
 
 import (
+	"context"
 	"fmt"
 	"os"
+	"strings"
 	"testing"
 
 	"github.com/golang-migrate/migrate/v4"
+	"github.com/golang-migrate/migrate/v4/database"
 
 	dt "github.com/golang-migrate/migrate/v4/database/testing"
 	_ "github.com/golang-migrate/migrate/v4/source/file"
 
+	"cloud.google.com/go/spanner"
 	"cloud.google.com/go/spanner/spannertest"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
@@ -169,3 +173,246 @@ func TestCleanStatements(t *testing.T) {
 		})
 	}
 }
+
+func TestCapabilities(t *testing.T) {
+	cases := []struct {
+		name     string
+		config   *Config
+		expected database.Capabilities
+	}{
+		{"default", &Config{}, database.Capabilities{}},
+		{"clean statements", &Config{CleanStatements: true}, database.Capabilities{SupportsMultiStatement: true}},
+		{"allow mixed", &Config{AllowMixed: true}, database.Capabilities{SupportsMultiStatement: true}},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			s := &Spanner{config: c.config}
+			if caps := s.Capabilities(); caps != c.expected {
+				t.Fatalf("expected %+v, got %+v", c.expected, caps)
+			}
+		})
+	}
+}
+
+func TestSplitStatements(t *testing.T) {
+	testCases := []struct {
+		name      string
+		migration string
+		expected  []string
+	}{
+		{
+			name:      "no statement",
+			migration: "",
+			expected:  nil,
+		},
+		{
+			name:      "single statement without semicolon",
+			migration: "INSERT INTO t (id) VALUES (1)",
+			expected:  []string{"INSERT INTO t (id) VALUES (1)"},
+		},
+		{
+			name:      "multiple statements",
+			migration: "CREATE TABLE t (id INT64) PRIMARY KEY (id);\nINSERT INTO t (id) VALUES (1);\n",
+			expected:  []string{"CREATE TABLE t (id INT64) PRIMARY KEY (id)", "INSERT INTO t (id) VALUES (1)"},
+		},
+		{
+			name:      "semicolons in string literals",
+			migration: `INSERT INTO t (s) VALUES ('a;b'); INSERT INTO t (s) VALUES ("c;\"d"); INSERT INTO ` + "`t;`" + ` (s) VALUES ('e')`,
+			expected:  []string{`INSERT INTO t (s) VALUES ('a;b')`, `INSERT INTO t (s) VALUES ("c;\"d")`, "INSERT INTO `t;` (s) VALUES ('e')"},
+		},
+		{
+			name: "semicolons in comments",
+			migration: `-- seed; rows
+INSERT INTO t (id) VALUES (1); # trailing; comment
+/* block; comment */ INSERT INTO t (id) VALUES (2);
+-- only a comment;`,
+			expected: []string{"-- seed; rows\nINSERT INTO t (id) VALUES (1)", "# trailing; comment\n/* block; comment */ INSERT INTO t (id) VALUES (2)"},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			assert.Equal(t, tc.expected, splitStatements(tc.migration))
+		})
+	}
+}
+
+func TestParseMixedStatements(t *testing.T) {
+	segments, err := parseMixedStatements([]byte(`CREATE TABLE users (
+	id INT64 NOT NULL, -- the user id
+) PRIMARY KEY (id);
+INSERT INTO users (id) VALUES (1);
+INSERT INTO users (id) VALUES (2);
+CREATE INDEX users_id_idx ON users (id);
+UPDATE users SET id = 3 WHERE id = 2;`))
+	require.NoError(t, err)
+	assert.Equal(t, []segment{
+		{stmts: []string{"CREATE TABLE users (\n  id INT64 NOT NULL,\n) PRIMARY KEY(id)"}},
+		{kind: segmentDML, stmts: []string{"INSERT INTO users (id) VALUES (1)", "INSERT INTO users (id) VALUES (2)"}},
+		{stmts: []string{"CREATE INDEX users_id_idx ON users(id)"}},
+		{kind: segmentDML, stmts: []string{"UPDATE users SET id = 3 WHERE id = 2"}},
+	}, segments)
+
+	_, err = parseMixedStatements([]byte("SELECT 1"))
+	assert.Error(t, err)
+}
+
+func TestParseSections(t *testing.T) {
+	segments, err := parseSections([]byte(`-- migrate:ddl
+ALTER TABLE users ADD COLUMN active BOOL; -- the new column
+-- migrate:pdml
+UPDATE users SET active = true WHERE true;
+-- migrate:ddl
+-- migrate:dml
+INSERT INTO users (id, active) VALUES (1, false);
+INSERT INTO users (id, active) VALUES (2, false);
+`))
+	require.NoError(t, err)
+	assert.Equal(t, []segment{
+		{stmts: []string{"ALTER TABLE users ADD COLUMN active BOOL"}},
+		{kind: segmentPDML, stmts: []string{"UPDATE users SET active = true WHERE true"}},
+		{kind: segmentDML, stmts: []string{"INSERT INTO users (id, active) VALUES (1, false)", "INSERT INTO users (id, active) VALUES (2, false)"}},
+	}, segments)
+
+	_, err = parseSections([]byte("-- migrate:sql\nSELECT 1;"))
+	assert.Error(t, err)
+	_, err = parseSections([]byte("DELETE FROM users WHERE true;\n-- migrate:ddl\nDROP TABLE users;"))
+	assert.Error(t, err)
+}
+
+func TestSections(t *testing.T) {
+	withSpannerEmulator(t, func(t *testing.T) {
+		s := &Spanner{}
+		d, err := s.Open(fmt.Sprintf("spanner://%s", db))
+		require.NoError(t, err)
+		defer func() {
+			require.NoError(t, d.Close())
+		}()
+
+		err = d.Run(strings.NewReader(`-- migrate:ddl
+CREATE TABLE sections (
+	id INT64 NOT NULL,
+	active BOOL,
+) PRIMARY KEY (id);
+-- migrate:dml
+INSERT INTO sections (id) VALUES (1);
+INSERT INTO sections (id) VALUES (2);
+-- migrate:pdml
+UPDATE sections SET active = true WHERE active IS NULL;`))
+		require.NoError(t, err)
+
+		ctx := context.Background()
+		iter := d.(*Spanner).db.data.Single().Query(ctx, spanner.Statement{SQL: "SELECT COUNT(*) FROM sections WHERE active"})
+		defer iter.Stop()
+		row, err := iter.Next()
+		require.NoError(t, err)
+		var count int64
+		require.NoError(t, row.Columns(&count))
+		assert.Equal(t, int64(2), count)
+	})
+}
+
+func TestMixedStatements(t *testing.T) {
+	withSpannerEmulator(t, func(t *testing.T) {
+		s := &Spanner{}
+		d, err := s.Open(fmt.Sprintf("spanner://%s?x-allow-mixed=true", db))
+		require.NoError(t, err)
+		defer func() {
+			require.NoError(t, d.Close())
+		}()
+
+		err = d.Run(strings.NewReader(`CREATE TABLE seeds (
+	id INT64 NOT NULL,
+	name STRING(MAX),
+) PRIMARY KEY (id);
+INSERT INTO seeds (id, name) VALUES (1, 'a;b');
+INSERT INTO seeds (id, name) VALUES (2, 'c');`))
+		require.NoError(t, err)
+
+		ctx := context.Background()
+		iter := d.(*Spanner).db.data.Single().Query(ctx, spanner.Statement{SQL: "SELECT COUNT(*) FROM seeds"})
+		defer iter.Stop()
+		row, err := iter.Next()
+		require.NoError(t, err)
+		var count int64
+		require.NoError(t, row.Columns(&count))
+		assert.Equal(t, int64(2), count)
+	})
+}
+
+func TestTenants(t *testing.T) {
+	withSpannerEmulator(t, func(t *testing.T) {
+		ctx := context.Background()
+		s := &Spanner{}
+		d, err := s.Open(fmt.Sprintf("spanner://%s", db))
+		require.NoError(t, err)
+		defer func() {
+			require.NoError(t, d.Close())
+		}()
+		require.NoError(t, d.Run(strings.NewReader("CREATE TABLE Tenants (TenantID STRING(MAX) NOT NULL) PRIMARY KEY (TenantID)")))
+		_, err = d.(*Spanner).db.data.Apply(ctx, []*spanner.Mutation{
+			spanner.Insert("Tenants", []string{"TenantID"}, []interface{}{"a"}),
+			spanner.Insert("Tenants", []string{"TenantID"}, []interface{}{"b"}),
+		})
+		require.NoError(t, err)
+
+		open := func(tenant string) database.Driver {
+			d, err := s.Open(fmt.Sprintf("spanner://%s?x-migrations-table=TenantMigrations&x-parent-table=Tenants&x-tenant-id=%s", db, tenant))
+			require.NoError(t, err)
+			t.Cleanup(func() { d.Close() })
+			return d
+		}
+		a, b := open("a"), open("b")
+
+		require.NoError(t, a.SetVersion(2, false))
+		require.NoError(t, b.SetVersion(5, true))
+		require.NoError(t, a.SetVersion(3, true))
+
+		version, dirty, err := a.Version()
+		require.NoError(t, err)
+		assert.Equal(t, 3, version)
+		assert.True(t, dirty)
+		version, dirty, err = b.Version()
+		require.NoError(t, err)
+		assert.Equal(t, 5, version)
+		assert.True(t, dirty)
+
+		// Drop only deletes the version of the tenant
+		require.NoError(t, a.Drop())
+		version, _, err = a.Version()
+		require.NoError(t, err)
+		assert.Equal(t, database.NilVersion, version)
+		version, _, err = b.Version()
+		require.NoError(t, err)
+		assert.Equal(t, 5, version)
+	})
+}
+
+func TestTenantConfig(t *testing.T) {
+	_, err := WithInstance(&DB{}, &Config{DatabaseName: db, ParentTable: "Tenants"})
+	assert.ErrorIs(t, err, ErrNoTenantID)
+	_, err = WithInstance(&DB{}, &Config{DatabaseName: db, TenantID: "a"})
+	assert.ErrorIs(t, err, ErrNoParentTable)
+}
+
+func TestDescribe(t *testing.T) {
+	cases := []struct {
+		name     string
+		config   *Config
+		expected database.DriverInfo
+	}{
+		{"default", &Config{}, database.DriverInfo{Name: "spanner"}},
+		{"clean statements", &Config{CleanStatements: true}, database.DriverInfo{Name: "spanner", Capabilities: database.Capabilities{SupportsMultiStatement: true}}},
+		{"allow mixed", &Config{AllowMixed: true}, database.DriverInfo{Name: "spanner", Capabilities: database.Capabilities{SupportsMultiStatement: true}}},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			s := &Spanner{config: c.config}
+			info, err := s.Describe()
+			require.NoError(t, err)
+			assert.Equal(t, c.expected, info)
+		})
+	}
+}
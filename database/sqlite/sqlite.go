@@ -1,6 +1,7 @@
 package sqlite
 
 import (
+	"context"
 	"database/sql"
 	"fmt"
 	"io"
@@ -31,6 +32,8 @@ type Config struct {
 	MigrationsTable string
 	DatabaseName    string
 	NoTxWrap        bool
+	// WAL switches the database to write-ahead logging.
+	WAL bool
 }
 
 type Sqlite struct {
@@ -53,6 +56,13 @@ func WithInstance(instance *sql.DB, config *Config) (database.Driver, error) {
 		config.MigrationsTable = DefaultMigrationsTable
 	}
 
+	if config.WAL {
+		query := "PRAGMA journal_mode=WAL"
+		if _, err := instance.Exec(query); err != nil {
+			return nil, &database.Error{OrigErr: err, Query: []byte(query)}
+		}
+	}
+
 	mx := &Sqlite{
 		db:     instance,
 		config: config,
@@ -118,10 +128,19 @@ func (m *Sqlite) Open(url string) (database.Driver, error) {
 		}
 	}
 
+	wal := false
+	if v := qv.Get("x-wal"); v != "" {
+		wal, err = strconv.ParseBool(v)
+		if err != nil {
+			return nil, fmt.Errorf("x-wal: %s", err)
+		}
+	}
+
 	mx, err := WithInstance(db, &Config{
 		DatabaseName:    purl.Path,
 		MigrationsTable: migrationsTable,
 		NoTxWrap:        noTxWrap,
+		WAL:             wal,
 	})
 	if err != nil {
 		return nil, err
@@ -134,10 +153,25 @@ func (m *Sqlite) Close() error {
 }
 
 func (m *Sqlite) Drop() (err error) {
+	return m.drop(context.Background(), false)
+}
+
+// DropWithOptions implements database.DropOptionsDriver.
+func (m *Sqlite) DropWithOptions(ctx context.Context, opts database.DropOptions) error {
+	return m.drop(ctx, opts.KeepMigrationsTable)
+}
+
+// DropList implements database.DropLister.
+func (m *Sqlite) DropList(ctx context.Context, opts database.DropOptions) ([]string, error) {
+	return m.dropTables(ctx, opts.KeepMigrationsTable)
+}
+
+// dropTables returns the tables drop deletes.
+func (m *Sqlite) dropTables(ctx context.Context, keepMigrationsTable bool) (_ []string, err error) {
 	query := `SELECT name FROM sqlite_master WHERE type = 'table';`
-	tables, err := m.db.Query(query)
+	tables, err := m.db.QueryContext(ctx, query)
 	if err != nil {
-		return &database.Error{OrigErr: err, Query: []byte(query)}
+		return nil, &database.Error{OrigErr: err, Query: []byte(query)}
 	}
 	defer func() {
 		if errClose := tables.Close(); errClose != nil {
@@ -149,19 +183,33 @@ func (m *Sqlite) Drop() (err error) {
 	for tables.Next() {
 		var tableName string
 		if err := tables.Scan(&tableName); err != nil {
-			return err
+			return nil, err
+		}
+
+		// do not drop the migrations table if asked to keep it
+		if keepMigrationsTable && tableName == m.config.MigrationsTable {
+			continue
 		}
 		if len(tableName) > 0 {
 			tableNames = append(tableNames, tableName)
 		}
 	}
 	if err := tables.Err(); err != nil {
-		return &database.Error{OrigErr: err, Query: []byte(query)}
+		return nil, &database.Error{OrigErr: err, Query: []byte(query)}
+	}
+
+	return tableNames, nil
+}
+
+func (m *Sqlite) drop(ctx context.Context, keepMigrationsTable bool) error {
+	tableNames, err := m.dropTables(ctx, keepMigrationsTable)
+	if err != nil {
+		return err
 	}
 
 	if len(tableNames) > 0 {
 		for _, t := range tableNames {
-			query := "DROP TABLE " + t
+			query := "DROP TABLE IF EXISTS " + t
 			err = m.executeQuery(query)
 			if err != nil {
 				return &database.Error{OrigErr: err, Query: []byte(query)}
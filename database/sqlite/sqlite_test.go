@@ -1,6 +1,7 @@
 package sqlite
 
 import (
+	"context"
 	"database/sql"
 	"fmt"
 	"path/filepath"
@@ -119,6 +120,42 @@ func TestNoTxWrapInvalidValue(t *testing.T) {
 	}
 }
 
+func TestWAL(t *testing.T) {
+	dir := t.TempDir()
+	t.Logf("DB path : %s\n", filepath.Join(dir, "sqlite.db"))
+	p := &Sqlite{}
+	addr := fmt.Sprintf("sqlite://%s?x-wal=true", filepath.Join(dir, "sqlite.db"))
+	d, err := p.Open(addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		if err := d.Close(); err != nil {
+			t.Error(err)
+		}
+	}()
+
+	var mode string
+	if err := d.(*Sqlite).db.QueryRow("PRAGMA journal_mode").Scan(&mode); err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, "wal", mode)
+
+	dt.Test(t, d, []byte("CREATE TABLE t (Qty int, Name string);"))
+}
+
+func TestWALInvalidValue(t *testing.T) {
+	dir := t.TempDir()
+	t.Logf("DB path : %s\n", filepath.Join(dir, "sqlite.db"))
+	p := &Sqlite{}
+	addr := fmt.Sprintf("sqlite://%s?x-wal=yeppers", filepath.Join(dir, "sqlite.db"))
+	_, err := p.Open(addr)
+	if assert.Error(t, err) {
+		assert.Contains(t, err.Error(), "x-wal")
+		assert.Contains(t, err.Error(), "invalid syntax")
+	}
+}
+
 func TestMigrateWithDirectoryNameContainsWhitespaces(t *testing.T) {
 	dir := t.TempDir()
 	dbPath := filepath.Join(dir, "sqlite.db")
@@ -131,3 +168,45 @@ func TestMigrateWithDirectoryNameContainsWhitespaces(t *testing.T) {
 	}
 	dt.Test(t, d, []byte("CREATE TABLE t (Qty int, Name string);"))
 }
+
+func TestDropDryRun(t *testing.T) {
+	dir := t.TempDir()
+	p := &Sqlite{}
+	d, err := p.Open(fmt.Sprintf("sqlite://%s", filepath.Join(dir, "sqlite.db")))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer d.Close()
+	m, err := migrate.NewWithDatabaseInstance("file://./examples/migrations", "sqlite", d)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := m.Up(); err != nil {
+		t.Fatal(err)
+	}
+
+	tables, err := m.DropDryRun(context.Background(), migrate.DropOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.ElementsMatch(t, []string{"pets", DefaultMigrationsTable}, tables)
+
+	tables, err = m.DropDryRun(context.Background(), migrate.DropOptions{KeepMigrationsTable: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, []string{"pets"}, tables)
+
+	// nothing was dropped
+	if v, _, err := m.Version(); err != nil || v != 44 {
+		t.Fatalf("expected version 44, got %v, %v", v, err)
+	}
+	if err := m.Drop(); err != nil {
+		t.Fatal(err)
+	}
+	tables, err = d.(*Sqlite).DropList(context.Background(), migrate.DropOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Empty(t, tables)
+}
@@ -0,0 +1,112 @@
+package sqlutil
+
+import (
+	"context"
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"net"
+	"strconv"
+	"syscall"
+	"time"
+
+	"github.com/golang-migrate/migrate/v4/database"
+)
+
+// DefaultConnectRetryInterval is the time waited between two attempts to
+// reach the database, when ConnectRetry.Interval is not set.
+var DefaultConnectRetryInterval = time.Second
+
+// Pinger is implemented by *sql.DB and *sql.Conn.
+type Pinger interface {
+	PingContext(ctx context.Context) error
+}
+
+// ConnectRetry configures how a driver waits for a database which is not
+// accepting connections yet, for instance while its container is starting.
+type ConnectRetry struct {
+	// Retries is the number of times the ping is retried after a
+	// connection error. Zero disables retrying.
+	Retries int
+	// Interval is the time waited between two attempts.
+	Interval time.Duration
+	// OnRetry, if set, is called with the connection error before each
+	// retry, e.g. to log it.
+	OnRetry func(attempt int, err error)
+}
+
+// LogRetries returns an OnRetry func logging each retry with l, or nil if
+// l is nil.
+func LogRetries(l database.Logger) func(attempt int, err error) {
+	if l == nil {
+		return nil
+	}
+	return func(attempt int, err error) {
+		l.Printf("Database not reachable, retrying (attempt %d): %v\n", attempt, err)
+	}
+}
+
+// ParseConnectRetry parses the values of the x-connect-retries and
+// x-connect-retry-interval URL query parameters. Empty values keep the
+// defaults of no retries and DefaultConnectRetryInterval.
+func ParseConnectRetry(retries, interval string) (ConnectRetry, error) {
+	r := ConnectRetry{Interval: DefaultConnectRetryInterval}
+	if retries != "" {
+		n, err := strconv.Atoi(retries)
+		if err != nil {
+			return r, fmt.Errorf("could not parse x-connect-retries as int: %w", err)
+		}
+		if n < 0 {
+			return r, fmt.Errorf("x-connect-retries must not be negative, got %d", n)
+		}
+		r.Retries = n
+	}
+	if interval != "" {
+		d, err := time.ParseDuration(interval)
+		if err != nil {
+			return r, fmt.Errorf("could not parse x-connect-retry-interval as duration: %w", err)
+		}
+		if d < 0 {
+			return r, fmt.Errorf("x-connect-retry-interval must not be negative, got %s", d)
+		}
+		r.Interval = d
+	}
+	return r, nil
+}
+
+// Ping pings the database, retrying up to r.Retries times while the error
+// looks like the database is not accepting connections yet. Each retry is
+// reported to r.OnRetry. Other errors, and the last connection error, are
+// returned as is.
+func (r ConnectRetry) Ping(ctx context.Context, p Pinger) error {
+	for attempt := 1; ; attempt++ {
+		err := p.PingContext(ctx)
+		if err == nil || attempt > r.Retries || !IsConnectError(err) {
+			return err
+		}
+		if r.OnRetry != nil {
+			r.OnRetry(attempt, err)
+		}
+		select {
+		case <-time.After(r.Interval):
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
+
+// IsConnectError reports whether err looks like the database could not be
+// reached, such as a refused or reset connection, as opposed to an error
+// returned by a running database, like failed authentication.
+func IsConnectError(err error) bool {
+	if errors.Is(err, syscall.ECONNREFUSED) || errors.Is(err, syscall.ECONNRESET) ||
+		errors.Is(err, driver.ErrBadConn) {
+		return true
+	}
+	var opErr *net.OpError
+	if errors.As(err, &opErr) && opErr.Op == "dial" {
+		return true
+	}
+	var dnsErr *net.DNSError
+	return errors.As(err, &dnsErr)
+}
@@ -0,0 +1,121 @@
+package sqlutil_test
+
+import (
+	"context"
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"net"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/golang-migrate/migrate/v4/database/sqlutil"
+)
+
+type pingerFunc func(context.Context) error
+
+func (f pingerFunc) PingContext(ctx context.Context) error { return f(ctx) }
+
+type logger struct {
+	lines []string
+}
+
+func (l *logger) Printf(format string, v ...interface{}) {
+	l.lines = append(l.lines, fmt.Sprintf(format, v...))
+}
+
+func TestParseConnectRetry(t *testing.T) {
+	r, err := sqlutil.ParseConnectRetry("", "")
+	require.NoError(t, err)
+	assert.Equal(t, sqlutil.ConnectRetry{Interval: time.Second}, r)
+
+	r, err = sqlutil.ParseConnectRetry("5", "250ms")
+	require.NoError(t, err)
+	assert.Equal(t, sqlutil.ConnectRetry{Retries: 5, Interval: 250 * time.Millisecond}, r)
+
+	for _, tc := range [][2]string{{"a", ""}, {"-1", ""}, {"", "1"}, {"", "-1s"}} {
+		_, err := sqlutil.ParseConnectRetry(tc[0], tc[1])
+		assert.Error(t, err, "%q", tc)
+	}
+}
+
+func TestConnectRetryPing(t *testing.T) {
+	refused := &net.OpError{Op: "dial", Net: "tcp", Err: syscall.ECONNREFUSED}
+	authErr := errors.New("password authentication failed")
+
+	testCases := []struct {
+		name     string
+		retries  int
+		errs     []error
+		expected error
+		pings    int
+	}{
+		{name: "ok", retries: 3, errs: []error{nil}, pings: 1},
+		{name: "no retries", errs: []error{refused, nil}, expected: refused, pings: 1},
+		{name: "ready after retries", retries: 3, errs: []error{refused, driver.ErrBadConn, nil}, pings: 3},
+		{name: "retries exhausted", retries: 2, errs: []error{refused, refused, refused, nil}, expected: refused, pings: 3},
+		{name: "other error", retries: 3, errs: []error{authErr, nil}, expected: authErr, pings: 1},
+	}
+
+	for _, tc := range testCases {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			pings := 0
+			p := pingerFunc(func(context.Context) error {
+				err := tc.errs[pings]
+				pings++
+				return err
+			})
+			err := sqlutil.ConnectRetry{Retries: tc.retries}.Ping(context.Background(), p)
+			assert.Equal(t, tc.expected, err)
+			assert.Equal(t, tc.pings, pings)
+		})
+	}
+
+	t.Run("on retry", func(t *testing.T) {
+		errs := []error{refused, driver.ErrBadConn, nil}
+		p := pingerFunc(func(context.Context) error {
+			err := errs[0]
+			errs = errs[1:]
+			return err
+		})
+		var attempts []int
+		var retried []error
+		r := sqlutil.ConnectRetry{Retries: 3, OnRetry: func(attempt int, err error) {
+			attempts = append(attempts, attempt)
+			retried = append(retried, err)
+		}}
+		assert.NoError(t, r.Ping(context.Background(), p))
+		assert.Equal(t, []int{1, 2}, attempts)
+		assert.Equal(t, []error{refused, driver.ErrBadConn}, retried)
+	})
+
+	t.Run("log retries", func(t *testing.T) {
+		errs := []error{refused, nil}
+		p := pingerFunc(func(context.Context) error {
+			err := errs[0]
+			errs = errs[1:]
+			return err
+		})
+		var l logger
+		r := sqlutil.ConnectRetry{Retries: 3, OnRetry: sqlutil.LogRetries(&l)}
+		assert.NoError(t, r.Ping(context.Background(), p))
+		assert.Equal(t, []string{"Database not reachable, retrying (attempt 1): " + refused.Error() + "\n"}, l.lines)
+
+		assert.Nil(t, sqlutil.LogRetries(nil))
+	})
+
+	t.Run("canceled", func(t *testing.T) {
+		ctx, cancel := context.WithCancel(context.Background())
+		p := pingerFunc(func(context.Context) error {
+			cancel()
+			return refused
+		})
+		err := sqlutil.ConnectRetry{Retries: 3, Interval: time.Hour}.Ping(ctx, p)
+		assert.ErrorIs(t, err, context.Canceled)
+	})
+}
@@ -0,0 +1,256 @@
+// Package sqlutil provides helpers shared by the SQL database drivers
+package sqlutil
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"io"
+	"strings"
+
+	"github.com/golang-migrate/migrate/v4/database/multistmt"
+)
+
+// DefaultDelimiter ends statements if StatementSplitter.Delimiter is empty
+var DefaultDelimiter = []byte(";")
+
+// DefaultQuotes quote strings and identifiers if StatementSplitter.Quotes is empty
+var DefaultQuotes = `'"`
+
+var ErrInvalidDelimiter = errors.New("DELIMITER command without a delimiter")
+
+// StatementSplitter splits multi-statement migrations on a delimiter that is
+// outside of quoted strings and identifiers and outside of comments. The
+// options enable the quirks of each SQL dialect. The zero value splits on
+// DefaultDelimiter and knows about '...' and "..." quotes, -- line comments
+// and /* */ block comments.
+type StatementSplitter struct {
+	// Delimiter ends statements. Statements are handled with their delimiter.
+	Delimiter []byte
+	// Quotes are the characters quoting strings and identifiers, e.g. "'\"`"
+	// for mysql. A quote is escaped by doubling it.
+	Quotes string
+	// BackslashEscapes lets a backslash escape the next character in quotes,
+	// as in mysql and clickhouse.
+	BackslashEscapes bool
+	// EscapeStrings lets a backslash escape the next character in postgres
+	// E'...' strings.
+	EscapeStrings bool
+	// DollarQuotes enables postgres dollar-quoted strings, e.g. $$...$$ or
+	// $body$...$body$, which are used for function bodies.
+	DollarQuotes bool
+	// NestedComments lets /* */ comments nest, as in postgres.
+	NestedComments bool
+	// HashComments enables # line comments, as in mysql.
+	HashComments bool
+	// DelimiterCommand enables the DELIMITER command of the mysql client,
+	// which changes the delimiter until the next DELIMITER command. The
+	// command lines aren't handled and statements ended by a delimiter other
+	// than Delimiter are handled without it, since the server doesn't know it.
+	DelimiterCommand bool
+}
+
+// Split splits the multi-statement migration read from r and hands each
+// statement to h until h returns false. Statements can't be longer than
+// maxStatementSize.
+func (s *StatementSplitter) Split(r io.Reader, maxStatementSize int, h multistmt.Handler) error {
+	delimiter := s.Delimiter
+	if len(delimiter) == 0 {
+		delimiter = DefaultDelimiter
+	}
+	quotes := s.Quotes
+	if len(quotes) == 0 {
+		quotes = DefaultQuotes
+	}
+
+	current := delimiter
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 0, multistmt.StartBufSize), maxStatementSize)
+	scanner.Split(func(d []byte, atEOF bool) (int, []byte, error) {
+		// skip DELIMITER commands, since returning no token at EOF would
+		// stop the scanner
+		n := 0
+		for s.DelimiterCommand {
+			m, next, ok, err := parseDelimiterCommand(d[n:], atEOF)
+			if err != nil {
+				return 0, nil, err
+			}
+			if !ok {
+				break
+			}
+			if next == nil {
+				return 0, nil, nil
+			}
+			current = next
+			n += m
+		}
+		d = d[n:]
+		if atEOF && len(d) == 0 {
+			return n, nil, nil
+		}
+		i, ok := s.index(d, current, quotes)
+		if !ok {
+			if atEOF {
+				return n + len(d), d, nil
+			}
+			return 0, nil, nil
+		}
+		if !bytes.Equal(current, delimiter) {
+			return n + i + len(current), d[:i], nil
+		}
+		return n + i + len(current), d[:i+len(current)], nil
+	})
+	for scanner.Scan() {
+		if !h(scanner.Bytes()) {
+			break
+		}
+	}
+	return scanner.Err()
+}
+
+// index returns the index of the first delimiter in d outside of quotes and
+// comments and whether there is one.
+func (s *StatementSplitter) index(d, delimiter []byte, quotes string) (int, bool) {
+	for i := 0; i < len(d); {
+		switch c := d[i]; {
+		case bytes.HasPrefix(d[i:], delimiter):
+			return i, true
+		case c == '-' && bytes.HasPrefix(d[i:], []byte("--")),
+			c == '#' && s.HashComments:
+			end := bytes.IndexByte(d[i:], '\n')
+			if end < 0 {
+				return 0, false
+			}
+			i += end + 1
+		case c == '/' && bytes.HasPrefix(d[i:], []byte("/*")):
+			end := s.commentEnd(d[i:])
+			if end < 0 {
+				return 0, false
+			}
+			i += end
+		case strings.IndexByte(quotes, c) >= 0:
+			escapes := s.BackslashEscapes ||
+				(s.EscapeStrings && c == '\'' && i > 0 && (d[i-1] == 'E' || d[i-1] == 'e') && (i == 1 || !isIdentByte(d[i-2])))
+			end := quoteEnd(d[i:], escapes)
+			if end < 0 {
+				return 0, false
+			}
+			i += end
+		case c == '$' && s.DollarQuotes && (i == 0 || !isIdentByte(d[i-1])):
+			end, ok := dollarQuoteEnd(d[i:])
+			if !ok {
+				i++
+				continue
+			}
+			if end < 0 {
+				return 0, false
+			}
+			i += end
+		default:
+			i++
+		}
+	}
+	return 0, false
+}
+
+// commentEnd returns the index after the end of the block comment d starts
+// with, or -1 if it doesn't end in d.
+func (s *StatementSplitter) commentEnd(d []byte) int {
+	depth := 0
+	for i := 0; i+1 < len(d); {
+		switch {
+		case d[i] == '/' && d[i+1] == '*' && (depth == 0 || s.NestedComments):
+			depth++
+			i += 2
+		case d[i] == '*' && d[i+1] == '/':
+			depth--
+			i += 2
+			if depth == 0 {
+				return i
+			}
+		default:
+			i++
+		}
+	}
+	return -1
+}
+
+// quoteEnd returns the index after the closing quote of the quoted string d
+// starts with, or -1 if it doesn't end in d. A doubled quote is part of the
+// string, as is an escaped character if escapes is set.
+func quoteEnd(d []byte, escapes bool) int {
+	q := d[0]
+	for i := 1; i < len(d); i++ {
+		switch d[i] {
+		case '\\':
+			if escapes {
+				i++
+			}
+		case q:
+			if i+1 < len(d) && d[i+1] == q {
+				i++
+				continue
+			}
+			if i+1 == len(d) {
+				// the quote may be doubled in the next read
+				return -1
+			}
+			return i + 1
+		}
+	}
+	return -1
+}
+
+// dollarQuoteEnd returns the index after the closing tag of the
+// dollar-quoted string d starts with, or -1 if it doesn't end in d. ok is
+// false if d doesn't start with a tag, e.g. a $1 parameter.
+func dollarQuoteEnd(d []byte) (end int, ok bool) {
+	i := 1
+	for i < len(d) && d[i] != '$' {
+		if !isIdentByte(d[i]) || (i == 1 && d[i] >= '0' && d[i] <= '9') {
+			return 0, false
+		}
+		i++
+	}
+	if i == len(d) {
+		return -1, true
+	}
+	tag := d[:i+1]
+	j := bytes.Index(d[len(tag):], tag)
+	if j < 0 {
+		return -1, true
+	}
+	return len(tag) + j + len(tag), true
+}
+
+// parseDelimiterCommand parses the DELIMITER command d starts with, after
+// whitespace, and returns its length and the new delimiter. ok is false if d
+// doesn't start with the command. The delimiter is nil if the line of the
+// command doesn't end in d yet. Parsing the same commands again when more
+// data was read leaves the same delimiter.
+func parseDelimiterCommand(d []byte, atEOF bool) (n int, delimiter []byte, ok bool, err error) {
+	const command = "DELIMITER"
+	line := bytes.TrimLeft(d, " \t\r\n")
+	if len(line) <= len(command) || !strings.EqualFold(string(line[:len(command)]), command) ||
+		(line[len(command)] != ' ' && line[len(command)] != '\t') {
+		return 0, nil, false, nil
+	}
+	n = len(d)
+	if end := bytes.IndexByte(line, '\n'); end >= 0 {
+		n = len(d) - len(line) + end + 1
+		line = line[:end]
+	} else if !atEOF {
+		return 0, nil, true, nil
+	}
+	fields := bytes.Fields(line[len(command):])
+	if len(fields) == 0 {
+		return 0, nil, false, ErrInvalidDelimiter
+	}
+	// copy the delimiter, the scanner reuses its buffer
+	return n, append([]byte(nil), fields[0]...), true, nil
+}
+
+func isIdentByte(c byte) bool {
+	return c == '_' || c == '$' || c >= 0x80 ||
+		(c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z') || (c >= '0' && c <= '9')
+}
@@ -0,0 +1,153 @@
+package sqlutil_test
+
+import (
+	"io"
+	"strings"
+	"testing"
+	"testing/iotest"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/golang-migrate/migrate/v4/database/multistmt"
+	"github.com/golang-migrate/migrate/v4/database/sqlutil"
+)
+
+const maxStatementSize = 1024
+
+var (
+	postgres = sqlutil.StatementSplitter{EscapeStrings: true, DollarQuotes: true, NestedComments: true}
+	mysql    = sqlutil.StatementSplitter{Quotes: "'\"`", BackslashEscapes: true, HashComments: true, DelimiterCommand: true}
+)
+
+func TestSplit(t *testing.T) {
+	testCases := []struct {
+		name      string
+		splitter  sqlutil.StatementSplitter
+		multiStmt string
+		expected  []string
+	}{
+		{name: "single statement, no delimiter", multiStmt: "single statement, no delimiter",
+			expected: []string{"single statement, no delimiter"}},
+		{name: "single statement, one delimiter", multiStmt: "single statement, one delimiter;",
+			expected: []string{"single statement, one delimiter;"}},
+		{name: "two statements, no trailing delimiter", multiStmt: "statement one; statement two",
+			expected: []string{"statement one;", " statement two"}},
+		{name: "two statements, with trailing delimiter", multiStmt: "statement one; statement two;",
+			expected: []string{"statement one;", " statement two;"}},
+		{name: "custom delimiter", splitter: sqlutil.StatementSplitter{Delimiter: []byte("GO")}, multiStmt: "one; two GO three",
+			expected: []string{"one; two GO", " three"}},
+		{name: "delimiter in single quotes", multiStmt: "SELECT 'a;b'; SELECT 2;",
+			expected: []string{"SELECT 'a;b';", " SELECT 2;"}},
+		{name: "delimiter in double quotes", multiStmt: `CREATE TABLE "a;b" (c int); SELECT 2;`,
+			expected: []string{`CREATE TABLE "a;b" (c int);`, " SELECT 2;"}},
+		{name: "doubled quote", multiStmt: "SELECT 'it''s;'; SELECT 2;",
+			expected: []string{"SELECT 'it''s;';", " SELECT 2;"}},
+		{name: "empty string", multiStmt: "SELECT ''; SELECT ';';",
+			expected: []string{"SELECT '';", " SELECT ';';"}},
+		{name: "backticks are no quotes by default", multiStmt: "SELECT `a;b`;",
+			expected: []string{"SELECT `a;", "b`;"}},
+		{name: "delimiter in line comment", multiStmt: "SELECT 1; -- one; two\nSELECT 2;",
+			expected: []string{"SELECT 1;", " -- one; two\nSELECT 2;"}},
+		{name: "quote in line comment", multiStmt: "SELECT 1; -- it's\nSELECT 2;",
+			expected: []string{"SELECT 1;", " -- it's\nSELECT 2;"}},
+		{name: "delimiter in block comment", multiStmt: "/* one; two */ SELECT 1; SELECT 2;",
+			expected: []string{"/* one; two */ SELECT 1;", " SELECT 2;"}},
+		{name: "unnested comments", multiStmt: "/* /* */ SELECT 1; */ SELECT 2;",
+			expected: []string{"/* /* */ SELECT 1;", " */ SELECT 2;"}},
+		{name: "nested comments", splitter: postgres, multiStmt: "/* /* */ SELECT 1; */ SELECT 2;",
+			expected: []string{"/* /* */ SELECT 1; */ SELECT 2;"}},
+		{name: "backslash without escapes", multiStmt: `SELECT 'a\'; SELECT 2;`,
+			expected: []string{`SELECT 'a\';`, " SELECT 2;"}},
+		{name: "backslash escapes", splitter: mysql, multiStmt: `SELECT 'a\';'; SELECT 2;`,
+			expected: []string{`SELECT 'a\';';`, " SELECT 2;"}},
+		{name: "escape string", splitter: postgres, multiStmt: `SELECT E'a\';'; SELECT 'a\'; SELECT 2;`,
+			expected: []string{`SELECT E'a\';';`, ` SELECT 'a\';`, " SELECT 2;"}},
+		{name: "identifier ending in e", splitter: postgres, multiStmt: `SELECT name'a\'; SELECT 2;`,
+			expected: []string{`SELECT name'a\';`, " SELECT 2;"}},
+		{name: "dollar quotes", splitter: postgres,
+			multiStmt: "CREATE FUNCTION f() RETURNS int AS $$ SELECT 1; $$ LANGUAGE sql; SELECT f();",
+			expected:  []string{"CREATE FUNCTION f() RETURNS int AS $$ SELECT 1; $$ LANGUAGE sql;", " SELECT f();"}},
+		{name: "tagged dollar quotes", splitter: postgres,
+			multiStmt: "DO $body$ BEGIN PERFORM $$;$$; END $body$; SELECT 2;",
+			expected:  []string{"DO $body$ BEGIN PERFORM $$;$$; END $body$;", " SELECT 2;"}},
+		{name: "quote in dollar quotes", splitter: postgres, multiStmt: "SELECT $$it's;$$; SELECT 2;",
+			expected: []string{"SELECT $$it's;$$;", " SELECT 2;"}},
+		{name: "dollar quotes disabled", multiStmt: "SELECT $$a;$$;",
+			expected: []string{"SELECT $$a;", "$$;"}},
+		{name: "positional parameters", splitter: postgres, multiStmt: "PREPARE p AS SELECT $1; SELECT $2;",
+			expected: []string{"PREPARE p AS SELECT $1;", " SELECT $2;"}},
+		{name: "dollar in identifier", splitter: postgres, multiStmt: "SELECT a$b$; SELECT 2;",
+			expected: []string{"SELECT a$b$;", " SELECT 2;"}},
+		{name: "backticks", splitter: mysql, multiStmt: "CREATE TABLE `a;b` (c int); SELECT 2;",
+			expected: []string{"CREATE TABLE `a;b` (c int);", " SELECT 2;"}},
+		{name: "hash comment", splitter: mysql, multiStmt: "SELECT 1; # one; it's\nSELECT 2;",
+			expected: []string{"SELECT 1;", " # one; it's\nSELECT 2;"}},
+		{name: "hash without hash comments", multiStmt: "SELECT '#'; # one; two",
+			expected: []string{"SELECT '#';", " # one;", " two"}},
+		{name: "delimiter command", splitter: mysql,
+			multiStmt: "DELIMITER //\nCREATE PROCEDURE p() BEGIN SELECT 1; END//\nDELIMITER ;\nSELECT 2;",
+			expected:  []string{"CREATE PROCEDURE p() BEGIN SELECT 1; END", "SELECT 2;"}},
+		{name: "lowercase delimiter command", splitter: mysql,
+			multiStmt: "SELECT 1;\n  delimiter $$\nSELECT 2$$",
+			expected:  []string{"SELECT 1;", "SELECT 2"}},
+		{name: "delimiter command without newline", splitter: mysql, multiStmt: "SELECT 1;\nDELIMITER ;",
+			expected: []string{"SELECT 1;"}},
+		{name: "delimiter command disabled", multiStmt: "DELIMITER //\nSELECT 1//",
+			expected: []string{"DELIMITER //\nSELECT 1//"}},
+		{name: "delimiter word in statement", splitter: mysql, multiStmt: "SELECT 'DELIMITER //';",
+			expected: []string{"SELECT 'DELIMITER //';"}},
+		{name: "unterminated quote", multiStmt: "SELECT 1; SELECT 'a;",
+			expected: []string{"SELECT 1;", " SELECT 'a;"}},
+		{name: "unterminated comment", multiStmt: "SELECT 1; /* a;",
+			expected: []string{"SELECT 1;", " /* a;"}},
+		{name: "unterminated dollar quote", splitter: postgres, multiStmt: "SELECT 1; SELECT $a$;",
+			expected: []string{"SELECT 1;", " SELECT $a$;"}},
+	}
+
+	for _, tc := range testCases {
+		tc := tc
+		for _, reader := range []struct {
+			name string
+			wrap func(io.Reader) io.Reader
+		}{
+			{name: "reader", wrap: func(r io.Reader) io.Reader { return r }},
+			{name: "one byte reader", wrap: iotest.OneByteReader},
+		} {
+			t.Run(tc.name+"/"+reader.name, func(t *testing.T) {
+				stmts := make([]string, 0, len(tc.expected))
+				err := tc.splitter.Split(reader.wrap(strings.NewReader(tc.multiStmt)), maxStatementSize, func(b []byte) bool {
+					stmts = append(stmts, string(b))
+					return true
+				})
+				assert.NoError(t, err)
+				assert.Equal(t, tc.expected, stmts)
+			})
+		}
+	}
+}
+
+func TestSplitDiscontinue(t *testing.T) {
+	expected := []string{"statement one;"}
+
+	stmts := make([]string, 0, len(expected))
+	err := (&sqlutil.StatementSplitter{}).Split(strings.NewReader("statement one; statement two"), maxStatementSize, func(b []byte) bool {
+		stmts = append(stmts, string(b))
+		return false
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, expected, stmts)
+}
+
+func TestSplitInvalidDelimiter(t *testing.T) {
+	err := mysql.Split(strings.NewReader("DELIMITER \nSELECT 1;"), maxStatementSize, func(b []byte) bool {
+		return true
+	})
+	assert.Equal(t, sqlutil.ErrInvalidDelimiter, err)
+}
+
+func TestSplitTooLong(t *testing.T) {
+	err := (&sqlutil.StatementSplitter{}).Split(strings.NewReader("SELECT '"+strings.Repeat(";", 2*multistmt.StartBufSize)+"';"), 8, func(b []byte) bool {
+		return true
+	})
+	assert.Error(t, err)
+}
@@ -0,0 +1,71 @@
+package sqlutil
+
+import (
+	"bytes"
+	"strings"
+)
+
+// StripComments returns query without its line and block comments, which
+// are recognized like by Split, so that comments in quoted strings and
+// identifiers and in dollar-quoted strings are kept. Block comments are
+// replaced by a space, to keep the tokens around them apart, and line
+// comments are removed up to the newline, which is kept. Block comments
+// starting with /*! or /*+, which hold mysql conditional code and optimizer
+// hints, are kept as well.
+func (s *StatementSplitter) StripComments(query []byte) []byte {
+	quotes := s.Quotes
+	if len(quotes) == 0 {
+		quotes = DefaultQuotes
+	}
+
+	stripped := make([]byte, 0, len(query))
+	start := 0 // of the query not copied to stripped yet
+	for i := 0; i < len(query); {
+		switch c := query[i]; {
+		case c == '-' && bytes.HasPrefix(query[i:], []byte("--")),
+			c == '#' && s.HashComments:
+			stripped = append(stripped, query[start:i]...)
+			end := bytes.IndexByte(query[i:], '\n')
+			if end < 0 {
+				return stripped
+			}
+			i += end
+			start = i
+		case c == '/' && bytes.HasPrefix(query[i:], []byte("/*")):
+			end := s.commentEnd(query[i:])
+			if end < 0 {
+				end = len(query) - i
+			}
+			if bytes.HasPrefix(query[i:], []byte("/*!")) || bytes.HasPrefix(query[i:], []byte("/*+")) {
+				i += end
+				continue
+			}
+			stripped = append(append(stripped, query[start:i]...), ' ')
+			i += end
+			start = i
+		case strings.IndexByte(quotes, c) >= 0:
+			escapes := s.BackslashEscapes ||
+				(s.EscapeStrings && c == '\'' && i > 0 && (query[i-1] == 'E' || query[i-1] == 'e') && (i == 1 || !isIdentByte(query[i-2])))
+			end := quoteEnd(query[i:], escapes)
+			if end < 0 {
+				// the string ends the query or is unterminated
+				i = len(query)
+				continue
+			}
+			i += end
+		case c == '$' && s.DollarQuotes && (i == 0 || !isIdentByte(query[i-1])):
+			end, ok := dollarQuoteEnd(query[i:])
+			switch {
+			case !ok:
+				i++
+			case end < 0:
+				i = len(query)
+			default:
+				i += end
+			}
+		default:
+			i++
+		}
+	}
+	return append(stripped, query[start:]...)
+}
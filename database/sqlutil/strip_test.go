@@ -0,0 +1,56 @@
+package sqlutil_test
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/golang-migrate/migrate/v4/database/sqlutil"
+)
+
+func TestStripComments(t *testing.T) {
+	testCases := []struct {
+		name     string
+		splitter sqlutil.StatementSplitter
+		query    string
+		expected string
+	}{
+		{name: "no comments", query: "SELECT 1;", expected: "SELECT 1;"},
+		{name: "leading line comment", query: "-- create users\nCREATE TABLE users (id int);",
+			expected: "\nCREATE TABLE users (id int);"},
+		{name: "trailing line comment", query: "SELECT 1; -- one", expected: "SELECT 1; "},
+		{name: "block comment", query: "SELECT/* one */1;", expected: "SELECT 1;"},
+		{name: "multi-line block comment", query: "/*\n * users\n */\nSELECT 1;", expected: " \nSELECT 1;"},
+		{name: "unterminated block comment", query: "SELECT 1; /* one", expected: "SELECT 1;  "},
+		{name: "line comment in string", query: "SELECT '-- not a comment';", expected: "SELECT '-- not a comment';"},
+		{name: "block comment in string", query: "SELECT '/* not */ a comment'; -- a comment",
+			expected: "SELECT '/* not */ a comment'; "},
+		{name: "comment in identifier", query: `SELECT "a--b" FROM t;`, expected: `SELECT "a--b" FROM t;`},
+		{name: "doubled quote", query: "SELECT 'it''s -- kept';", expected: "SELECT 'it''s -- kept';"},
+		{name: "string ending the query", query: "-- one\nSELECT '--'", expected: "\nSELECT '--'"},
+		{name: "unterminated string", query: "SELECT 1; SELECT '-- a", expected: "SELECT 1; SELECT '-- a"},
+		{name: "nested comments", splitter: postgres, query: "/* /* */ SELECT 1; */ SELECT 2;", expected: "  SELECT 2;"},
+		{name: "unnested comments", query: "/* /* */ SELECT 1; */", expected: "  SELECT 1; */"},
+		{name: "dollar quotes", splitter: postgres,
+			query:    "CREATE FUNCTION f() RETURNS int AS $$ SELECT 1; -- kept\n $$ LANGUAGE sql; -- stripped",
+			expected: "CREATE FUNCTION f() RETURNS int AS $$ SELECT 1; -- kept\n $$ LANGUAGE sql; "},
+		{name: "tagged dollar quotes", splitter: postgres, query: "DO $body$ /* kept */ $body$;/* stripped */",
+			expected: "DO $body$ /* kept */ $body$; "},
+		{name: "escape string", splitter: postgres, query: `SELECT E'\' -- kept'; -- stripped`,
+			expected: `SELECT E'\' -- kept'; `},
+		{name: "backslash escapes", splitter: mysql, query: `SELECT 'a\' -- kept'; # stripped`,
+			expected: `SELECT 'a\' -- kept'; `},
+		{name: "hash comment", splitter: mysql, query: "# users\nSELECT `#`;", expected: "\nSELECT `#`;"},
+		{name: "hash without hash comments", query: "SELECT 1 # not a comment", expected: "SELECT 1 # not a comment"},
+		{name: "conditional comment", splitter: mysql, query: "CREATE TABLE t (a int) /*!50100 ENGINE=InnoDB */;",
+			expected: "CREATE TABLE t (a int) /*!50100 ENGINE=InnoDB */;"},
+		{name: "optimizer hint", query: "SELECT /*+ SeqScan(t) */ * FROM t;", expected: "SELECT /*+ SeqScan(t) */ * FROM t;"},
+	}
+
+	for _, tc := range testCases {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			assert.Equal(t, tc.expected, string(tc.splitter.StripComments([]byte(tc.query))))
+		})
+	}
+}
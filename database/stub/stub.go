@@ -1,6 +1,7 @@
 package stub
 
 import (
+	"context"
 	"io"
 	"reflect"
 
@@ -20,6 +21,9 @@ type Stub struct {
 	MigrationSequence []string
 	LastRunMigration  []byte // todo: make []string
 	IsDirty           bool
+	PingErr           error    // returned by Ping to simulate an unreachable database
+	Tables            []string // listed by DropList and removed by a drop
+	Checksums         map[uint]string
 	isLocked          atomic.Bool
 
 	Config *Config
@@ -49,6 +53,10 @@ func (s *Stub) Close() error {
 	return nil
 }
 
+func (s *Stub) Ping(ctx context.Context) error {
+	return s.PingErr
+}
+
 func (s *Stub) Lock() error {
 	if !s.isLocked.CAS(false, true) {
 		return database.ErrLocked
@@ -73,6 +81,14 @@ func (s *Stub) Run(migration io.Reader) error {
 	return nil
 }
 
+// RunContext implements database.ContextRunner.
+func (s *Stub) RunContext(ctx context.Context, migration io.Reader) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	return s.Run(migration)
+}
+
 func (s *Stub) SetVersion(version int, state bool) error {
 	s.CurrentVersion = version
 	s.IsDirty = state
@@ -86,12 +102,41 @@ func (s *Stub) Version() (version int, dirty bool, err error) {
 const DROP = "DROP"
 
 func (s *Stub) Drop() error {
+	s.Tables = nil
 	s.CurrentVersion = database.NilVersion
 	s.LastRunMigration = nil
 	s.MigrationSequence = append(s.MigrationSequence, DROP)
 	return nil
 }
 
+func (s *Stub) DropWithOptions(ctx context.Context, opts database.DropOptions) error {
+	if !opts.KeepMigrationsTable {
+		return s.Drop()
+	}
+	s.Tables = nil
+	s.LastRunMigration = nil
+	s.MigrationSequence = append(s.MigrationSequence, DROP)
+	return nil
+}
+
+func (s *Stub) DropList(ctx context.Context, opts database.DropOptions) ([]string, error) {
+	return append([]string{}, s.Tables...), nil
+}
+
+// SetChecksum implements database.ChecksumDriver.
+func (s *Stub) SetChecksum(version uint, checksum string) error {
+	if s.Checksums == nil {
+		s.Checksums = make(map[uint]string)
+	}
+	s.Checksums[version] = checksum
+	return nil
+}
+
+// GetChecksum implements database.ChecksumDriver.
+func (s *Stub) GetChecksum(version uint) (string, error) {
+	return s.Checksums[version], nil
+}
+
 func (s *Stub) EqualSequence(seq []string) bool {
 	return reflect.DeepEqual(seq, s.MigrationSequence)
 }
@@ -18,6 +18,15 @@ func Test(t *testing.T) {
 	dt.Test(t, d, []byte("/* foobar migration */"))
 }
 
+func TestParallelMigrate(t *testing.T) {
+	s := &Stub{}
+	d, err := s.Open("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	dt.TestParallelMigrate(t, d, 10)
+}
+
 func TestMigrate(t *testing.T) {
 	s := &Stub{}
 	d, err := s.Open("")
@@ -5,9 +5,12 @@ package testing
 
 import (
 	"bytes"
+	"context"
+	"database/sql"
 	"errors"
 	"fmt"
 	"io"
+	"sync"
 	"testing"
 	"time"
 
@@ -99,6 +102,73 @@ func TestLockAndUnlock(t *testing.T, d database.Driver) {
 	}
 }
 
+// TestParallelMigrate calls Lock from n goroutines at the same time and
+// verifies that exactly one of them acquires the lock, while all others
+// receive database.ErrLocked. It then verifies that the lock can be released
+// and acquired again. Use it for drivers that implement locking.
+func TestParallelMigrate(t *testing.T, d database.Driver, n int) {
+	if n < 2 {
+		t.Fatal("n must be >= 2")
+	}
+
+	// add a timeout, in case there is a deadlock
+	done := make(chan struct{})
+	errs := make(chan error, n)
+
+	go func() {
+		start := make(chan struct{})
+		var wg sync.WaitGroup
+		for i := 0; i < n; i++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				<-start
+				errs <- d.Lock()
+			}()
+		}
+		close(start)
+		wg.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+	case <-time.After(15 * time.Second):
+		t.Fatalf("Timeout after 15 seconds. Looks like a deadlock in Lock.\n%#v", d)
+	}
+	close(errs)
+
+	locked := 0
+	for err := range errs {
+		switch {
+		case err == nil:
+			locked++
+		case errors.Is(err, database.ErrLocked):
+		default:
+			t.Fatalf("Lock: expected err to be nil or database.ErrLocked, got %v", err)
+		}
+	}
+	if locked != 1 {
+		t.Fatalf("Lock: expected exactly one goroutine to acquire the lock, got %v", locked)
+	}
+
+	if err := d.Unlock(); err != nil {
+		t.Fatal(err)
+	}
+
+	// the next goroutine must be able to lock again
+	lockErr := make(chan error, 1)
+	go func() {
+		lockErr <- d.Lock()
+	}()
+	if err := <-lockErr; err != nil {
+		t.Fatal(err)
+	}
+	if err := d.Unlock(); err != nil {
+		t.Fatal(err)
+	}
+}
+
 func TestRun(t *testing.T, d database.Driver, migration io.Reader) {
 	if migration == nil {
 		t.Fatal("migration can't be nil")
@@ -153,3 +223,54 @@ func TestSetVersion(t *testing.T, d database.Driver) {
 		})
 	}
 }
+
+// Querier is implemented by *sql.DB and *sql.Conn.
+type Querier interface {
+	QueryContext(ctx context.Context, query string, args ...interface{}) (*sql.Rows, error)
+}
+
+// TestSetVersionRows tests that SetVersion keeps a single row with the
+// version and dirty flag in the migrations table, read from db with
+// SELECT version, dirty FROM table.
+func TestSetVersionRows(t *testing.T, d database.Driver, db Querier, table string) {
+	type row struct {
+		version int
+		dirty   bool
+	}
+	testCases := []struct {
+		version  int
+		dirty    bool
+		expected []row
+	}{
+		{version: 1, dirty: true, expected: []row{{1, true}}},
+		{version: 1, dirty: false, expected: []row{{1, false}}},
+		{version: 2, dirty: true, expected: []row{{2, true}}},
+		{version: 2, dirty: false, expected: []row{{2, false}}},
+		{version: database.NilVersion, dirty: true, expected: []row{{database.NilVersion, true}}},
+		{version: database.NilVersion, dirty: false, expected: nil},
+	}
+
+	for _, tc := range testCases {
+		if err := d.SetVersion(tc.version, tc.dirty); err != nil {
+			t.Fatal(err)
+		}
+		rows, err := db.QueryContext(context.Background(), "SELECT version, dirty FROM "+table)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var got []row
+		for rows.Next() {
+			var r row
+			if err := rows.Scan(&r.version, &r.dirty); err != nil {
+				t.Fatal(err)
+			}
+			got = append(got, r)
+		}
+		if err := rows.Close(); err != nil {
+			t.Fatal(err)
+		}
+		if fmt.Sprint(got) != fmt.Sprint(tc.expected) {
+			t.Errorf("SetVersion(%v, %v): expected rows %v, got %v", tc.version, tc.dirty, tc.expected, got)
+		}
+	}
+}
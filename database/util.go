@@ -4,6 +4,8 @@ import (
 	"fmt"
 	"go.uber.org/atomic"
 	"hash/crc32"
+	"regexp"
+	"strconv"
 	"strings"
 )
 
@@ -19,6 +21,37 @@ func GenerateAdvisoryLockId(databaseName string, additionalNames ...string) (str
 	return fmt.Sprint(sum), nil
 }
 
+// ParseAdvisoryLockId validates an advisory lock id set by users instead of
+// generating it, like with the x-lock-id URL query. It has to be a bigint.
+// Databases sharing a lock id exclude each other's migrations, whatever
+// their migrations tables.
+func ParseAdvisoryLockId(lockID string) (string, error) { // nolint: golint
+	id, err := strconv.ParseInt(lockID, 10, 64)
+	if err != nil {
+		return "", fmt.Errorf("invalid advisory lock id %q, must be a bigint: %w", lockID, err)
+	}
+	return strconv.FormatInt(id, 10), nil
+}
+
+// columnTypeRegexp matches SQL type names like bigint, double precision or
+// numeric(20, 0), but no other SQL.
+var columnTypeRegexp = regexp.MustCompile(`^[A-Za-z][A-Za-z0-9_ ]*(\([0-9, ]+\))?$`)
+
+// ParseColumnType validates a column type of the migrations table set by
+// users, like with the x-version-column-type URL query, which is written
+// into the CREATE TABLE statement as is. It returns defaultType if
+// columnType is empty.
+func ParseColumnType(columnType, defaultType string) (string, error) {
+	columnType = strings.TrimSpace(columnType)
+	if columnType == "" {
+		return defaultType, nil
+	}
+	if !columnTypeRegexp.MatchString(columnType) {
+		return "", fmt.Errorf("invalid column type %q", columnType)
+	}
+	return columnType, nil
+}
+
 // CasRestoreOnErr CAS wrapper to automatically restore the lock state on error
 func CasRestoreOnErr(lock *atomic.Bool, o, n bool, casErr error, f func() error) error {
 	if !lock.CAS(o, n) {
@@ -104,3 +104,70 @@ func TestCasRestoreOnErr(t *testing.T) {
 		})
 	}
 }
+
+func TestParseAdvisoryLockId(t *testing.T) {
+	testcases := []struct {
+		lockID     string
+		expectedID string // empty string signifies that an error is expected
+	}{
+		{lockID: "42", expectedID: "42"},
+		{lockID: "-42", expectedID: "-42"},
+		{lockID: "+0042", expectedID: "42"},
+		{lockID: "9223372036854775807", expectedID: "9223372036854775807"},
+		{lockID: "9223372036854775808"},
+		{lockID: "migrations"},
+		{lockID: ""},
+	}
+
+	for _, tc := range testcases {
+		t.Run(tc.lockID, func(t *testing.T) {
+			id, err := ParseAdvisoryLockId(tc.lockID)
+			if tc.expectedID == "" {
+				if err == nil {
+					t.Errorf("expected an error, got %v", id)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if id != tc.expectedID {
+				t.Errorf("expected %v, got %v", tc.expectedID, id)
+			}
+		})
+	}
+}
+
+func TestParseColumnType(t *testing.T) {
+	testcases := []struct {
+		columnType   string
+		expectedType string // empty string signifies that an error is expected
+	}{
+		{columnType: "", expectedType: "bigint"},
+		{columnType: "int", expectedType: "int"},
+		{columnType: " double precision ", expectedType: "double precision"},
+		{columnType: "numeric(20, 0)", expectedType: "numeric(20, 0)"},
+		{columnType: "tinyint(1)", expectedType: "tinyint(1)"},
+		{columnType: "int primary key); DROP TABLE users; --"},
+		{columnType: "text default 'x'"},
+		{columnType: "(int)"},
+	}
+
+	for _, tc := range testcases {
+		t.Run(tc.columnType, func(t *testing.T) {
+			columnType, err := ParseColumnType(tc.columnType, "bigint")
+			if tc.expectedType == "" {
+				if err == nil {
+					t.Errorf("expected an error, got %v", columnType)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if columnType != tc.expectedType {
+				t.Errorf("expected %v, got %v", tc.expectedType, columnType)
+			}
+		})
+	}
+}
@@ -4,6 +4,7 @@ import (
 	"context"
 	"database/sql"
 	"errors"
+	"fmt"
 	"io"
 	"net/url"
 	"regexp"
@@ -49,6 +50,7 @@ type Config struct {
 	MaxRetryInterval    time.Duration
 	MaxRetryElapsedTime time.Duration
 	MaxRetries          int
+	NoLock              bool
 }
 
 type YugabyteDB struct {
@@ -169,6 +171,14 @@ func (c *YugabyteDB) Open(dbURL string) (database.Driver, error) {
 		maxRetries = DefaultMaxRetries
 	}
 
+	noLock := false
+	if s := purl.Query().Get("x-no-lock"); len(s) > 0 {
+		noLock, err = strconv.ParseBool(s)
+		if err != nil {
+			return nil, fmt.Errorf("could not parse x-no-lock as bool: %w", err)
+		}
+	}
+
 	px, err := WithInstance(db, &Config{
 		DatabaseName:        purl.Path,
 		MigrationsTable:     migrationsTable,
@@ -177,6 +187,7 @@ func (c *YugabyteDB) Open(dbURL string) (database.Driver, error) {
 		MaxRetryInterval:    maxInterval,
 		MaxRetryElapsedTime: maxElapsedTime,
 		MaxRetries:          maxRetries,
+		NoLock:              noLock,
 	})
 	if err != nil {
 		return nil, err
@@ -193,6 +204,10 @@ func (c *YugabyteDB) Close() error {
 // See: https://github.com/yugabyte/yugabyte-db/issues/3642
 func (c *YugabyteDB) Lock() error {
 	return database.CasRestoreOnErr(&c.isLocked, false, true, database.ErrLocked, func() (err error) {
+		if c.config.NoLock {
+			return nil
+		}
+
 		return c.doTxWithRetry(context.Background(), &sql.TxOptions{Isolation: sql.LevelSerializable}, func(tx *sql.Tx) (err error) {
 			aid, err := database.GenerateAdvisoryLockId(c.config.DatabaseName)
 			if err != nil {
@@ -230,6 +245,10 @@ func (c *YugabyteDB) Lock() error {
 // See: https://github.com/yugabyte/yugabyte-db/issues/3642
 func (c *YugabyteDB) Unlock() error {
 	return database.CasRestoreOnErr(&c.isLocked, true, false, database.ErrNotLocked, func() (err error) {
+		if c.config.NoLock {
+			return nil
+		}
+
 		aid, err := database.GenerateAdvisoryLockId(c.config.DatabaseName)
 		if err != nil {
 			return err
@@ -272,15 +291,24 @@ func (c *YugabyteDB) Run(migration io.Reader) error {
 
 func (c *YugabyteDB) SetVersion(version int, dirty bool) error {
 	return c.doTxWithRetry(context.Background(), &sql.TxOptions{Isolation: sql.LevelSerializable}, func(tx *sql.Tx) error {
-		if _, err := tx.Exec(`DELETE FROM "` + c.config.MigrationsTable + `"`); err != nil {
-			return err
-		}
-
 		// Also re-write the schema version for nil dirty versions to prevent
 		// empty schema version for failed down migration on the first migration
 		// See: https://github.com/golang-migrate/migrate/issues/330
-		if version >= 0 || (version == database.NilVersion && dirty) {
-			if _, err := tx.Exec(`INSERT INTO "`+c.config.MigrationsTable+`" (version, dirty) VALUES ($1, $2)`, version, dirty); err != nil {
+		write := version >= 0 || (version == database.NilVersion && dirty)
+
+		// keep the row of an unchanged version, so it is updated in place
+		query := `DELETE FROM "` + c.config.MigrationsTable + `"`
+		var args []interface{}
+		if write {
+			query += ` WHERE version <> $1`
+			args = append(args, version)
+		}
+		if _, err := tx.Exec(query, args...); err != nil {
+			return err
+		}
+
+		if write {
+			if _, err := tx.Exec(`INSERT INTO "`+c.config.MigrationsTable+`" (version, dirty) VALUES ($1, $2) ON CONFLICT (version) DO UPDATE SET dirty = EXCLUDED.dirty`, version, dirty); err != nil {
 				return err
 			}
 		}
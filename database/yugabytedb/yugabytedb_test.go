@@ -5,8 +5,10 @@ package yugabytedb
 import (
 	"context"
 	"database/sql"
+	"errors"
 	"fmt"
 	"log"
+	"strconv"
 	"strings"
 	"testing"
 	"time"
@@ -95,6 +97,8 @@ func Test(t *testing.T) {
 	t.Run("testMigrate", testMigrate)
 	t.Run("testMultiStatement", testMultiStatement)
 	t.Run("testFilterCustomQuery", testFilterCustomQuery)
+	t.Run("testNoLock", testNoLock)
+	t.Run("testSetVersionRows", testSetVersionRows)
 
 	t.Cleanup(func() {
 		for _, spec := range specs {
@@ -121,10 +125,30 @@ func test(t *testing.T) {
 		if err != nil {
 			t.Fatal(err)
 		}
+		dt.TestParallelMigrate(t, d, 10)
 		dt.Test(t, d, []byte("SELECT 1"))
 	})
 }
 
+func testSetVersionRows(t *testing.T) {
+	dktesting.ParallelTest(t, specs, func(t *testing.T, ci dktest.ContainerInfo) {
+		createDB(t, ci)
+
+		ip, port, err := ci.Port(defaultPort)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		addr := getConnectionString(ip, port)
+		c := &YugabyteDB{}
+		d, err := c.Open(addr)
+		if err != nil {
+			t.Fatal(err)
+		}
+		dt.TestSetVersionRows(t, d, d.(*YugabyteDB).db, `"schema_migrations"`)
+	})
+}
+
 func testMigrate(t *testing.T) {
 	dktesting.ParallelTest(t, specs, func(t *testing.T, ci dktest.ContainerInfo) {
 		createDB(t, ci)
@@ -197,3 +221,52 @@ func testFilterCustomQuery(t *testing.T) {
 		dt.Test(t, d, []byte("SELECT 1"))
 	})
 }
+
+func testNoLock(t *testing.T) {
+	dktesting.ParallelTest(t, specs, func(t *testing.T, ci dktest.ContainerInfo) {
+		createDB(t, ci)
+
+		ip, port, err := ci.Port(defaultPort)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		c := &YugabyteDB{}
+		d, err := c.Open(getConnectionString(ip, port))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		lock := d.(*YugabyteDB)
+
+		c = &YugabyteDB{}
+		d, err = c.Open(getConnectionString(ip, port, "x-no-lock=true"))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		noLock := d.(*YugabyteDB)
+
+		// Should be possible to take real lock and no-lock at the same time
+		if err = lock.Lock(); err != nil {
+			t.Fatal(err)
+		}
+		if err = noLock.Lock(); err != nil {
+			t.Fatal(err)
+		}
+		if err = lock.Unlock(); err != nil {
+			t.Fatal(err)
+		}
+		if err = noLock.Unlock(); err != nil {
+			t.Fatal(err)
+		}
+	})
+}
+
+func TestNoLockParamValidation(t *testing.T) {
+	c := &YugabyteDB{}
+	_, err := c.Open(getConnectionString("127.0.0.1", "5433", "x-no-lock=not-a-bool"))
+	if !errors.Is(err, strconv.ErrSyntax) {
+		t.Fatal("Expected syntax error when passing a non-bool as x-no-lock parameter")
+	}
+}
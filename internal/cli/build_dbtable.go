@@ -0,0 +1,9 @@
+//go:build dbtable
+// +build dbtable
+
+package cli
+
+import (
+	_ "github.com/golang-migrate/migrate/v4/source/dbtable"
+	_ "modernc.org/sqlite"
+)
@@ -0,0 +1,8 @@
+//go:build firestore
+// +build firestore
+
+package cli
+
+import (
+	_ "github.com/golang-migrate/migrate/v4/source/firestore"
+)
@@ -0,0 +1,8 @@
+//go:build git
+// +build git
+
+package cli
+
+import (
+	_ "github.com/golang-migrate/migrate/v4/source/git"
+)
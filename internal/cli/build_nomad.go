@@ -0,0 +1,8 @@
+//go:build nomad
+// +build nomad
+
+package cli
+
+import (
+	_ "github.com/golang-migrate/migrate/v4/source/nomad"
+)
@@ -0,0 +1,8 @@
+//go:build vault
+// +build vault
+
+package cli
+
+import (
+	_ "github.com/golang-migrate/migrate/v4/source/vault"
+)
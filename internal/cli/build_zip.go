@@ -0,0 +1,8 @@
+//go:build zip
+// +build zip
+
+package cli
+
+import (
+	_ "github.com/golang-migrate/migrate/v4/source/zip"
+)
@@ -1,16 +1,24 @@
 package cli
 
 import (
+	"bytes"
+	"context"
+	"encoding/json"
 	"errors"
 	"fmt"
+	"io"
+	"net/url"
 	"os"
 	"path/filepath"
+	"sort"
 	"strconv"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/golang-migrate/migrate/v4"
 	_ "github.com/golang-migrate/migrate/v4/database/stub" // TODO remove again
+	"github.com/golang-migrate/migrate/v4/source"
 	_ "github.com/golang-migrate/migrate/v4/source/file"
 )
 
@@ -18,17 +26,54 @@ var (
 	errInvalidSequenceWidth     = errors.New("Digits must be positive")
 	errIncompatibleSeqAndFormat = errors.New("The seq and format options are mutually exclusive")
 	errInvalidTimeFormat        = errors.New("Time format may not be empty")
+	errInvalidOutputStyle       = errors.New("Output style must be either flat or dir")
+	errSeqStartWithoutSeq       = errors.New("The seq-start option requires the seq option")
+	errInvalidSquashRange       = errors.New("FROM must not be greater than TO")
+	errNoAppliedMigration       = errors.New("no migration applied, nothing to roll back")
+	errMixedVersionSchemes      = errors.New("Timestamp migration would be mixed with sequential migrations")
+	errOrphanMigrations         = errors.New("applied migrations are missing from the source")
+
+	// errTimeout is returned when the timeout was reached and the
+	// migrations were stopped after the running one.
+	errTimeout = errors.New("timeout: migrations stopped before completion")
+	// errHardTimeout is returned when the running migration didn't stop
+	// within the grace period after the timeout was reached.
+	errHardTimeout = errors.New("timeout: running migration did not stop within the grace period")
 )
 
-func nextSeqVersion(matches []string, seqDigits int) (string, error) {
+// timeoutGracePeriod is how long the running migration may take to finish
+// after the timeout was reached.
+const timeoutGracePeriod = 5 * time.Second
+
+const (
+	// outputStyleFlat creates migrations as files like 1_name.up.sql
+	outputStyleFlat = "flat"
+	// outputStyleDir creates migrations in a directory like 1_name/up.sql
+	outputStyleDir = "dir"
+)
+
+// maxSeqLikeVersion is the highest version that looks like a sequential
+// version rather than a timestamp, e.g. 000042 but not 20060102150405.
+const maxSeqLikeVersion = 9999999
+
+// onErrorForcePrevious is the value of up -on-error forcing the version
+// before a failed migration.
+const onErrorForcePrevious = "force-previous"
+
+// nextSeqVersion returns the version following the highest one in matches.
+// A non-zero seqStart is used as the version instead, as long as it is
+// higher than all the versions in matches.
+func nextSeqVersion(matches []string, seqDigits int, seqStart uint64) (string, error) {
 	if seqDigits <= 0 {
 		return "", errInvalidSequenceWidth
 	}
 
 	nextSeq := uint64(1)
 
-	if len(matches) > 0 {
-		filename := matches[len(matches)-1]
+	// Versions may be zero-padded to different widths, e.g. 9_name.up.sql
+	// next to 0010_name.up.sql, so the lexical order of matches cannot be
+	// relied on. Find the highest version numerically instead.
+	for _, filename := range matches {
 		matchSeqStr := filepath.Base(filename)
 		idx := strings.Index(matchSeqStr, "_")
 
@@ -36,15 +81,22 @@ func nextSeqVersion(matches []string, seqDigits int) (string, error) {
 			return "", fmt.Errorf("Malformed migration filename: %s", filename)
 		}
 
-		var err error
-		matchSeqStr = matchSeqStr[0:idx]
-		nextSeq, err = strconv.ParseUint(matchSeqStr, 10, 64)
+		matchSeq, err := strconv.ParseUint(matchSeqStr[0:idx], 10, 64)
 
 		if err != nil {
 			return "", err
 		}
 
-		nextSeq++
+		if matchSeq >= nextSeq {
+			nextSeq = matchSeq + 1
+		}
+	}
+
+	if seqStart > 0 {
+		if nextSeq > seqStart {
+			return "", fmt.Errorf("Sequence start %d is not greater than the existing version %d", seqStart, nextSeq-1)
+		}
+		nextSeq = seqStart
 	}
 
 	version := fmt.Sprintf("%0[2]*[1]d", nextSeq, seqDigits)
@@ -72,11 +124,19 @@ func timeVersion(startTime time.Time, format string) (version string, err error)
 }
 
 // createCmd (meant to be called via a CLI command) creates a new migration
-func createCmd(dir string, startTime time.Time, format string, name string, ext string, seq bool, seqDigits int, print bool) error {
+func createCmd(dir string, startTime time.Time, format string, name string, ext string, seq bool, seqDigits int, seqStart uint64, outputStyle string, strictScheme bool, print bool) error {
 	if seq && format != defaultTimeFormat {
 		return errIncompatibleSeqAndFormat
 	}
 
+	if seqStart > 0 && !seq {
+		return errSeqStartWithoutSeq
+	}
+
+	if outputStyle != outputStyleFlat && outputStyle != outputStyleDir {
+		return errInvalidOutputStyle
+	}
+
 	var version string
 	var err error
 
@@ -84,13 +144,13 @@ func createCmd(dir string, startTime time.Time, format string, name string, ext
 	ext = "." + strings.TrimPrefix(ext, ".")
 
 	if seq {
-		matches, err := filepath.Glob(filepath.Join(dir, "*"+ext))
+		matches, err := seqMatches(dir, ext)
 
 		if err != nil {
 			return err
 		}
 
-		version, err = nextSeqVersion(matches, seqDigits)
+		version, err = nextSeqVersion(matches, seqDigits, seqStart)
 
 		if err != nil {
 			return err
@@ -101,6 +161,10 @@ func createCmd(dir string, startTime time.Time, format string, name string, ext
 		if err != nil {
 			return err
 		}
+
+		if err := checkVersionScheme(dir, ext, version, strictScheme); err != nil {
+			return err
+		}
 	}
 
 	versionGlob := filepath.Join(dir, version+"_*"+ext)
@@ -110,19 +174,87 @@ func createCmd(dir string, startTime time.Time, format string, name string, ext
 		return err
 	}
 
-	if len(matches) > 0 {
+	versionDirGlob := filepath.Join(dir, version+"_*", "*"+ext)
+	dirMatches, err := filepath.Glob(versionDirGlob)
+
+	if err != nil {
+		return err
+	}
+
+	if len(matches) > 0 || len(dirMatches) > 0 {
 		return fmt.Errorf("duplicate migration version: %s", version)
 	}
 
-	if err = os.MkdirAll(dir, os.ModePerm); err != nil {
+	return createMigrationFiles(dir, version, name, ext, outputStyle, nil, nil, print)
+}
+
+// seqLikeVersions returns the versions in matches that look like sequential
+// versions, i.e. small integers.
+func seqLikeVersions(matches []string) []string {
+	var versions []string
+	seen := make(map[string]bool)
+	for _, filename := range matches {
+		base := filepath.Base(filename)
+		idx := strings.Index(base, "_")
+		if idx < 1 {
+			continue
+		}
+		v, err := strconv.ParseUint(base[:idx], 10, 64)
+		if err != nil || v > maxSeqLikeVersion || seen[base[:idx]] {
+			continue
+		}
+		seen[base[:idx]] = true
+		versions = append(versions, base[:idx])
+	}
+	return versions
+}
+
+// checkVersionScheme warns if the timestamp version would be mixed with
+// existing migrations in dir that look sequential, which results in a
+// confusing order of the migrations. With strict, it returns an error instead.
+func checkVersionScheme(dir string, ext string, version string, strict bool) error {
+	// a custom format may produce small versions itself
+	if v, err := strconv.ParseUint(version, 10, 64); err != nil || v <= maxSeqLikeVersion {
+		return nil
+	}
+
+	matches, err := seqMatches(dir, ext)
+	if err != nil {
 		return err
 	}
 
+	versions := seqLikeVersions(matches)
+	if len(versions) == 0 {
+		return nil
+	}
+
+	if strict {
+		return fmt.Errorf("%w: %s", errMixedVersionSchemes, strings.Join(versions, ", "))
+	}
+	log.Printf("warning: %s looks like a sequential version, but %s is a timestamp version. Use -seq to create sequential migrations\n", strings.Join(versions, ", "), version)
+	return nil
+}
+
+// createMigrationFiles creates the up and down migration files of version
+// with the given bodies, which may be empty.
+func createMigrationFiles(dir string, version string, name string, ext string, outputStyle string, up []byte, down []byte, print bool) error {
+	if outputStyle == outputStyleDir {
+		dir = filepath.Join(dir, version+"_"+name)
+	}
+
+	if err := os.MkdirAll(dir, os.ModePerm); err != nil {
+		return err
+	}
+
+	bodies := map[string][]byte{"up": up, "down": down}
 	for _, direction := range []string{"up", "down"} {
 		basename := fmt.Sprintf("%s_%s.%s%s", version, name, direction, ext)
+		if outputStyle == outputStyleDir {
+			basename = direction + ext
+		}
 		filename := filepath.Join(dir, basename)
 
-		if err = createFile(filename); err != nil {
+		if err := createFile(filename, bodies[direction]); err != nil {
 			return err
 		}
 
@@ -135,7 +267,33 @@ func createCmd(dir string, startTime time.Time, format string, name string, ext
 	return nil
 }
 
-func createFile(filename string) error {
+// seqMatches returns the sorted paths of all existing migrations in dir,
+// both flat files like 1_name.up.sql and directories like 1_name/up.sql.
+func seqMatches(dir string, ext string) ([]string, error) {
+	matches, err := filepath.Glob(filepath.Join(dir, "*"+ext))
+	if err != nil {
+		return nil, err
+	}
+
+	dirFiles, err := filepath.Glob(filepath.Join(dir, "*_*", "*"+ext))
+	if err != nil {
+		return nil, err
+	}
+
+	seen := make(map[string]bool)
+	for _, f := range dirFiles {
+		d := filepath.Dir(f)
+		if !seen[d] {
+			seen[d] = true
+			matches = append(matches, d)
+		}
+	}
+
+	sort.Strings(matches)
+	return matches, nil
+}
+
+func createFile(filename string, body []byte) error {
 	// create exclusive (fails if file already exists)
 	// os.Create() specifies 0666 as the FileMode, so we're doing the same
 	f, err := os.OpenFile(filename, os.O_RDWR|os.O_CREATE|os.O_EXCL, 0666)
@@ -144,12 +302,181 @@ func createFile(filename string) error {
 		return err
 	}
 
+	if _, err := f.Write(body); err != nil {
+		f.Close()
+		return err
+	}
+
 	return f.Close()
 }
 
+// squashCmd (meant to be called via a CLI command) merges the up and down
+// migrations from version from to version to of the source into a single
+// migration squash_<from>_<to> with version from, in directory dir with
+// extension ext. The squashed migrations found in dir are removed.
+func squashCmd(m *migrate.Migrate, srcDrv source.Driver, dir string, ext string, from uint, to uint, print bool) error {
+	if from > to {
+		return errInvalidSquashRange
+	}
+
+	// the squashed migration would never be applied to databases
+	// which already applied any of the squashed migrations
+	v, _, err := m.Version()
+	if err != nil && !errors.Is(err, migrate.ErrNilVersion) {
+		return err
+	}
+	if err == nil && v >= from {
+		return fmt.Errorf("can't squash migrations %d to %d, version %d is already applied", from, to, v)
+	}
+
+	dir = filepath.Clean(dir)
+	ext = "." + strings.TrimPrefix(ext, ".")
+
+	versions, err := source.SortedVersionRange(srcDrv, from, to)
+	if err != nil {
+		return err
+	}
+	if len(versions) == 0 || versions[0] != from {
+		return fmt.Errorf("no migration found for version %d", from)
+	}
+	if versions[len(versions)-1] != to {
+		return fmt.Errorf("no migration found for version %d", to)
+	}
+
+	var up, down []byte
+	for _, version := range versions {
+		upBody, err := readBody(srcDrv.ReadUp, version)
+		if err != nil {
+			return err
+		}
+		downBody, err := readBody(srcDrv.ReadDown, version)
+		if err != nil {
+			return err
+		}
+
+		up = append(up, upBody...)
+		if downBody == nil {
+			log.Printf("warning: version %d has no down migration, the squashed down migration may be incomplete\n", version)
+		}
+		// down migrations run in reverse order
+		down = append(downBody, down...)
+	}
+
+	paths, fromVersion, err := squashedPaths(dir, ext, from, to)
+	if err != nil {
+		return err
+	}
+	if fromVersion == "" {
+		fromVersion = strconv.FormatUint(uint64(from), 10)
+	}
+
+	name := fmt.Sprintf("squash_%d_%d", from, to)
+	if err := createMigrationFiles(dir, fromVersion, name, ext, outputStyleFlat, up, down, print); err != nil {
+		return err
+	}
+
+	for _, path := range paths {
+		if err := os.RemoveAll(path); err != nil {
+			return err
+		}
+		if print {
+			absPath, _ := filepath.Abs(path)
+			log.Println("removed", absPath)
+		}
+	}
+
+	return nil
+}
+
+// readBody reads the migration of version using read, which is either
+// ReadUp or ReadDown of a source driver. The body is terminated with a blank
+// line so that bodies can be concatenated. It is nil if there is no migration.
+func readBody(read func(version uint) (io.ReadCloser, string, error), version uint) ([]byte, error) {
+	r, _, err := read(version)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+	defer r.Close()
+
+	body, err := io.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+	body = bytes.TrimRight(body, "\n")
+	return append(body, '\n', '\n'), nil
+}
+
+// inspectCmd writes the up migration of version in srcDrv to w, or the down
+// migration if down is set. The migration follows a header naming it unless
+// raw is set.
+func inspectCmd(w io.Writer, srcDrv source.Driver, version uint, down bool, raw bool) error {
+	read, direction := srcDrv.ReadUp, source.Up
+	if down {
+		read, direction = srcDrv.ReadDown, source.Down
+	}
+	r, identifier, err := read(version)
+	if errors.Is(err, os.ErrNotExist) {
+		return fmt.Errorf("no %v migration found for version %d", direction, version)
+	} else if err != nil {
+		return err
+	}
+	defer r.Close()
+
+	if !raw {
+		if _, err := fmt.Fprintf(w, "-- Migration %d (%v): %v\n", version, direction, identifier); err != nil {
+			return err
+		}
+	}
+	_, err = io.Copy(w, r)
+	return err
+}
+
+// squashedPaths returns the paths of the migration files and directories in
+// dir with versions from from to to, and how version from is written in them,
+// e.g. with zero padding.
+func squashedPaths(dir string, ext string, from uint, to uint) (paths []string, fromVersion string, err error) {
+	entries, err := os.ReadDir(dir)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, "", nil
+	} else if err != nil {
+		return nil, "", err
+	}
+
+	for _, e := range entries {
+		var match []string
+		if e.IsDir() {
+			match = source.DirRegex.FindStringSubmatch(e.Name())
+		} else if strings.HasSuffix(e.Name(), ext) {
+			match = source.Regex.FindStringSubmatch(e.Name())
+		}
+		if match == nil {
+			continue
+		}
+		v, err := strconv.ParseUint(match[1], 10, 64)
+		if err != nil || uint(v) < from || uint(v) > to {
+			continue
+		}
+		if uint(v) == from {
+			fromVersion = match[1]
+		}
+		paths = append(paths, filepath.Join(dir, e.Name()))
+	}
+	return paths, fromVersion, nil
+}
+
+// isNoChange reports whether err means there was nothing left to migrate,
+// either because the database was up to date or because another instance
+// applied the migrations concurrently.
+func isNoChange(err error) bool {
+	var conflict migrate.ErrMigrationConflict
+	return errors.Is(err, migrate.ErrNoChange) || errors.As(err, &conflict)
+}
+
 func gotoCmd(m *migrate.Migrate, v uint) error {
 	if err := m.Migrate(v); err != nil {
-		if err != migrate.ErrNoChange {
+		if !isNoChange(err) {
 			return err
 		}
 		log.Println(err)
@@ -160,14 +487,14 @@ func gotoCmd(m *migrate.Migrate, v uint) error {
 func upCmd(m *migrate.Migrate, limit int) error {
 	if limit >= 0 {
 		if err := m.Steps(limit); err != nil {
-			if err != migrate.ErrNoChange {
+			if !isNoChange(err) {
 				return err
 			}
 			log.Println(err)
 		}
 	} else {
 		if err := m.Up(); err != nil {
-			if err != migrate.ErrNoChange {
+			if !isNoChange(err) {
 				return err
 			}
 			log.Println(err)
@@ -176,17 +503,39 @@ func upCmd(m *migrate.Migrate, limit int) error {
 	return nil
 }
 
+// migrateCmd applies n up migrations if n is positive, or -n down migrations
+// if n is negative. If fewer migrations are available, those are applied and
+// their number is reported.
+func migrateCmd(m *migrate.Migrate, n int) error {
+	err := m.Steps(n)
+	var short migrate.ErrShortLimit
+	switch {
+	case err == nil:
+	case errors.As(err, &short):
+		limit := n
+		if limit < 0 {
+			limit = -limit
+		}
+		log.Printf("Applied %v of %v migrations, no more migrations available\n", limit-int(short.Short), limit)
+	case isNoChange(err):
+		log.Println(err)
+	default:
+		return err
+	}
+	return nil
+}
+
 func downCmd(m *migrate.Migrate, limit int) error {
 	if limit >= 0 {
 		if err := m.Steps(-limit); err != nil {
-			if err != migrate.ErrNoChange {
+			if !isNoChange(err) {
 				return err
 			}
 			log.Println(err)
 		}
 	} else {
 		if err := m.Down(); err != nil {
-			if err != migrate.ErrNoChange {
+			if !isNoChange(err) {
 				return err
 			}
 			log.Println(err)
@@ -195,13 +544,70 @@ func downCmd(m *migrate.Migrate, limit int) error {
 	return nil
 }
 
-func dropCmd(m *migrate.Migrate) error {
-	if err := m.Drop(); err != nil {
+// downOneCmd rolls back the last applied migration, like Steps(-1), but
+// fails if no migration is applied.
+func downOneCmd(m *migrate.Migrate) error {
+	from, _, err := m.Version()
+	if errors.Is(err, migrate.ErrNilVersion) {
+		return errNoAppliedMigration
+	}
+	if err != nil {
+		return err
+	}
+	if err := m.Steps(-1); err != nil {
+		return err
+	}
+
+	to, _, err := m.Version()
+	switch {
+	case errors.Is(err, migrate.ErrNilVersion):
+		log.Printf("Rolled back version %v, no migrations applied anymore\n", from)
+	case err != nil:
+		return err
+	default:
+		log.Printf("Rolled back version %v to version %v\n", from, to)
+	}
+	return nil
+}
+
+// resetCmd applies all down migrations, then all up migrations.
+func resetCmd(m *migrate.Migrate) error {
+	if err := m.Rebuild(); err != nil {
+		if !isNoChange(err) {
+			return err
+		}
+		log.Println(err)
+	}
+	return nil
+}
+
+func dropCmd(ctx context.Context, m *migrate.Migrate, keepMigrationsTable bool) error {
+	opts := migrate.DropOptions{KeepMigrationsTable: keepMigrationsTable}
+	if err := m.DropWithOptions(ctx, opts); err != nil {
 		return err
 	}
 	return nil
 }
 
+// dropDryRunCmd writes the tables dropCmd would drop to w, one per line.
+func dropDryRunCmd(ctx context.Context, w io.Writer, m *migrate.Migrate, keepMigrationsTable bool) error {
+	opts := migrate.DropOptions{KeepMigrationsTable: keepMigrationsTable}
+	tables, err := m.DropDryRun(ctx, opts)
+	if err != nil {
+		return err
+	}
+	if len(tables) == 0 {
+		log.Println("no tables to drop")
+		return nil
+	}
+	for _, table := range tables {
+		if _, err := fmt.Fprintln(w, table); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
 func forceCmd(m *migrate.Migrate, v int) error {
 	if err := m.Force(v); err != nil {
 		return err
@@ -209,8 +615,42 @@ func forceCmd(m *migrate.Migrate, v int) error {
 	return nil
 }
 
-func versionCmd(m *migrate.Migrate) error {
+func baselineCmd(m *migrate.Migrate, v uint) error {
+	if err := m.Baseline(v); err != nil {
+		return err
+	}
+	return nil
+}
+
+const (
+	versionFormatText = "text"
+	versionFormatJSON = "json"
+)
+
+// versionOutput is the output of the version command with -format json.
+// Version is nil if no migration was applied.
+type versionOutput struct {
+	Version *uint `json:"version"`
+	Dirty   bool  `json:"dirty"`
+}
+
+// versionCmd logs the current version, or with format json writes it to w
+// as versionOutput.
+func versionCmd(w io.Writer, m *migrate.Migrate, format string) error {
+	if format != versionFormatText && format != versionFormatJSON {
+		return fmt.Errorf("unknown format %q, expected %q or %q", format, versionFormatText, versionFormatJSON)
+	}
+
 	v, dirty, err := m.Version()
+	if format == versionFormatJSON {
+		out := versionOutput{Version: &v, Dirty: dirty}
+		if errors.Is(err, migrate.ErrNilVersion) {
+			out.Version = nil
+		} else if err != nil {
+			return err
+		}
+		return json.NewEncoder(w).Encode(out)
+	}
 	if err != nil {
 		return err
 	}
@@ -222,6 +662,169 @@ func versionCmd(m *migrate.Migrate) error {
 	return nil
 }
 
+// diffCmd prints the versions of the source not applied yet, and the
+// versions applied but missing from the source if the database driver
+// records a history. It returns errOrphanMigrations if any applied version is
+// missing.
+func diffCmd(w io.Writer, m *migrate.Migrate) error {
+	diff, err := m.Diff()
+	if err != nil {
+		return err
+	}
+
+	if _, err := fmt.Fprintf(w, "pending: %v\n", versionList(diff.Pending)); err != nil {
+		return err
+	}
+	orphans := versionList(diff.Orphans)
+	if !diff.HistoryChecked {
+		orphans += " (only the current version was checked)"
+	}
+	if _, err := fmt.Fprintf(w, "orphan-applied: %v\n", orphans); err != nil {
+		return err
+	}
+
+	if len(diff.Orphans) > 0 {
+		return errOrphanMigrations
+	}
+	return nil
+}
+
+// versionList formats versions separated by spaces, or "none".
+func versionList(versions []uint) string {
+	if len(versions) == 0 {
+		return "none"
+	}
+	list := make([]string, len(versions))
+	for i, v := range versions {
+		list[i] = strconv.FormatUint(uint64(v), 10)
+	}
+	return strings.Join(list, " ")
+}
+
+// healthCmd checks the database with Health. With allowDirty, a dirty
+// version is reported instead of failing, so that a failed migration can be
+// diagnosed.
+func healthCmd(ctx context.Context, m *migrate.Migrate, allowDirty bool) error {
+	err := m.Health(ctx)
+	var dirtyErr migrate.ErrDirty
+	if allowDirty && errors.As(err, &dirtyErr) {
+		log.Printf("ok (dirty at version %v)\n", dirtyErr.Version)
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	log.Println("ok")
+	return nil
+}
+
+// withTimeout returns a copy of ctx with the given timeout.
+// A timeout of 0 means no timeout.
+func withTimeout(ctx context.Context, timeout time.Duration) (context.Context, context.CancelFunc) {
+	if timeout <= 0 {
+		return context.WithCancel(ctx)
+	}
+	return context.WithTimeout(ctx, timeout)
+}
+
+// runWithContext runs fn, which is meant to run migrations, and requests a
+// graceful stop on stop once ctx is done. If fn doesn't return within grace
+// after that, errHardTimeout is returned without waiting for it, and the
+// caller is expected to exit, closing the database connection.
+func runWithContext(ctx context.Context, stop chan<- bool, grace time.Duration, fn func() error) error {
+	done := make(chan error, 1)
+	go func() {
+		done <- fn()
+	}()
+
+	select {
+	case err := <-done:
+		return err
+	case <-ctx.Done():
+	}
+
+	log.Println("Timeout reached, stopping after this running migration ...")
+	select {
+	case stop <- true:
+	default:
+		// a graceful stop was already requested
+	}
+
+	select {
+	case err := <-done:
+		if err != nil {
+			return fmt.Errorf("%w: %v", errTimeout, err)
+		}
+		return errTimeout
+	case <-time.After(grace):
+		return errHardTimeout
+	}
+}
+
+// logDriverInfo logs the features supported by the database driver,
+// if it describes them.
+func logDriverInfo(m *migrate.Migrate) {
+	info, err := m.Describe()
+	if err != nil {
+		if !errors.Is(err, migrate.ErrDescribeNotSupported) {
+			log.Println("error: can't describe database driver:", err)
+		}
+		return
+	}
+	log.Printf("Database driver %s: transactions=%v advisory-locks=%v multi-statement=%v schemas=%v\n",
+		info.Name, info.SupportsTx, info.SupportsAdvisoryLocks, info.SupportsMultiStatement, info.SupportsSchemas)
+}
+
+// addLabelToSourceURL sets the x-label option of sourceURL to label.
+func addLabelToSourceURL(sourceURL string, label string) (string, error) {
+	u, err := url.Parse(sourceURL)
+	if err != nil {
+		return "", err
+	}
+	q := u.Query()
+	q.Set("x-label", label)
+	u.RawQuery = q.Encode()
+	return u.String(), nil
+}
+
+// readURLFile returns value, or else the URL read from file, trimmed. The
+// flag names are used in errors.
+func readURLFile(value, file, urlFlag, fileFlag string) (string, error) {
+	if file == "" {
+		return value, nil
+	}
+	if value != "" {
+		return "", fmt.Errorf("-%s and -%s cannot be used together", urlFlag, fileFlag)
+	}
+	content, err := os.ReadFile(file)
+	if err != nil {
+		return "", fmt.Errorf("reading -%s: %w", fileFlag, err)
+	}
+	value = strings.TrimSpace(string(content))
+	if value == "" {
+		return "", fmt.Errorf("-%s %v is empty", fileFlag, file)
+	}
+	return value, nil
+}
+
+// stepsFromArgs takes the relative +N or -N argument of the migrate command
+// out of args, as the flag package would read -N as a flag. The remaining
+// args are returned for parsing flags.
+func stepsFromArgs(args []string) (int, []string, error) {
+	for i, arg := range args {
+		if len(arg) < 2 || arg[0] != '+' && arg[0] != '-' || strings.Trim(arg[1:], "0123456789") != "" {
+			continue
+		}
+		n, err := strconv.ParseInt(arg, 10, 64)
+		if err != nil {
+			return 0, nil, errors.New("can't read relative argument +N or -N")
+		}
+		rest := append(append([]string{}, args[:i]...), args[i+1:]...)
+		return int(n), rest, nil
+	}
+	return 0, nil, errors.New("missing relative argument +N or -N")
+}
+
 // numDownMigrationsFromArgs returns an int for number of migrations to apply
 // and a bool indicating if we need a confirm before applying
 func numDownMigrationsFromArgs(applyAll bool, args []string) (int, bool, error) {
@@ -246,3 +849,150 @@ func numDownMigrationsFromArgs(applyAll bool, args []string) (int, bool, error)
 		return 0, false, errors.New("too many arguments")
 	}
 }
+
+// databaseList is the value of the -database flag, which can be repeated to
+// run a command against several databases.
+type databaseList []string
+
+func (l *databaseList) String() string {
+	return strings.Join(*l, ",")
+}
+
+func (l *databaseList) Set(value string) error {
+	*l = append(*l, value)
+	return nil
+}
+
+// readDatabasesFile returns the database URLs listed in file, one per line.
+// Blank lines and lines starting with # are skipped.
+func readDatabasesFile(file string) ([]string, error) {
+	content, err := os.ReadFile(file)
+	if err != nil {
+		return nil, fmt.Errorf("reading -databases-file: %w", err)
+	}
+	var urls []string
+	for _, line := range strings.Split(string(content), "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		urls = append(urls, line)
+	}
+	if len(urls) == 0 {
+		return nil, fmt.Errorf("-databases-file %v lists no database", file)
+	}
+	return urls, nil
+}
+
+// redactDatabaseURL hides the password of databaseURL, for printing it.
+func redactDatabaseURL(databaseURL string) string {
+	u, err := url.Parse(databaseURL)
+	if err != nil {
+		// don't risk printing a password that wasn't parsed
+		return "invalid URL"
+	}
+	return u.Redacted()
+}
+
+// targetResult is the outcome of a command run against one of several
+// databases.
+type targetResult struct {
+	database string // with the password hidden
+	err      error
+	version  string // empty if it couldn't be read
+	duration time.Duration
+}
+
+// fanOut runs cmd against each of databaseURLs, opening a Migrate instance
+// with its own lock for each one with newMigrate and closing it afterwards.
+// At most parallel databases are migrated at once. Like with runWithContext,
+// the migrations are stopped gracefully once ctx is done. The results are
+// in the order of databaseURLs.
+func fanOut(ctx context.Context, databaseURLs []string, parallel int, newMigrate func(databaseURL string) (*migrate.Migrate, error), cmd func(m *migrate.Migrate) error) []targetResult {
+	if parallel < 1 {
+		parallel = 1
+	}
+	results := make([]targetResult, len(databaseURLs))
+	sem := make(chan struct{}, parallel)
+	var wg sync.WaitGroup
+	for i, databaseURL := range databaseURLs {
+		wg.Add(1)
+		go func(r *targetResult, databaseURL string) {
+			defer wg.Done()
+			sem <- struct{}{}
+			defer func() { <-sem }()
+
+			start := time.Now()
+			r.database = redactDatabaseURL(databaseURL)
+			defer func() { r.duration = time.Since(start) }()
+
+			if err := ctx.Err(); err != nil {
+				r.err = err
+				return
+			}
+			m, err := newMigrate(databaseURL)
+			if err != nil {
+				r.err = err
+				return
+			}
+			defer func() {
+				if err := m.CloseAll(); err != nil && r.err == nil {
+					r.err = err
+				}
+			}()
+
+			r.err = runWithContext(ctx, m.GracefulStop, timeoutGracePeriod, func() error {
+				return cmd(m)
+			})
+			if r.err != nil && errors.Is(r.err, errHardTimeout) {
+				// the migration is still running, don't read the version
+				return
+			}
+			v, dirty, err := m.Version()
+			switch {
+			case errors.Is(err, migrate.ErrNilVersion):
+				r.version = "no version"
+			case err != nil:
+				if r.err == nil {
+					r.err = err
+				}
+			case dirty:
+				r.version = fmt.Sprintf("version %v (dirty)", v)
+			default:
+				r.version = fmt.Sprintf("version %v", v)
+			}
+		}(&results[i], databaseURL)
+	}
+	wg.Wait()
+	return results
+}
+
+// printTargetResults prints a summary line per database to w and returns an
+// error if the command failed against any of them. A timeout error is
+// returned if all failed databases were stopped by the timeout.
+func printTargetResults(w io.Writer, results []targetResult) error {
+	failed, timedOut := 0, 0
+	for _, r := range results {
+		status := "ok"
+		if r.err != nil {
+			failed++
+			if errors.Is(r.err, errTimeout) || errors.Is(r.err, errHardTimeout) || errors.Is(r.err, context.DeadlineExceeded) {
+				timedOut++
+			}
+			status = fmt.Sprintf("error: %v", r.err)
+		}
+		if r.version != "" {
+			status += ", " + r.version
+		}
+		fmt.Fprintf(w, "%v: %v (%v)\n", r.database, status, r.duration.Round(time.Millisecond))
+	}
+
+	switch {
+	case failed == 0:
+		return nil
+	case failed == timedOut:
+		return fmt.Errorf("%w: %v of %v databases", errTimeout, failed, len(results))
+	default:
+		return fmt.Errorf("%v of %v databases failed", failed, len(results))
+	}
+}
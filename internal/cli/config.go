@@ -0,0 +1,191 @@
+package cli
+
+import (
+	"fmt"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/BurntSushi/toml"
+	"gopkg.in/yaml.v3"
+)
+
+const (
+	// envSource and envDatabase are read if -source and -database are not
+	// given, before the -config file.
+	envSource   = "MIGRATE_SOURCE"
+	envDatabase = "MIGRATE_DATABASE"
+)
+
+// configFile is the content of the -config file, like:
+//
+//	[source]
+//	path = "db/migrations"
+//
+//	[database]
+//	dsn = "postgres://localhost:5432/app"
+//	migrations_table = "app_migrations"
+//
+// or the same in YAML.
+type configFile struct {
+	Source   configSection `yaml:"source" toml:"source"`
+	Database configSection `yaml:"database" toml:"database"`
+}
+
+// configSection holds the URL of a driver, as url or dsn, or as path for
+// the file source, and the options added to the query of the URL. Options
+// are prefixed with x- and underscores are replaced by dashes, so
+// migrations_table is x-migrations-table. Options starting with x- are
+// used as is.
+type configSection map[string]interface{}
+
+// readConfigFile reads the -config file, TOML or YAML according to its
+// extension.
+func readConfigFile(file string) (*configFile, error) {
+	content, err := os.ReadFile(file)
+	if err != nil {
+		return nil, fmt.Errorf("reading -config: %w", err)
+	}
+	var config configFile
+	switch ext := strings.ToLower(filepath.Ext(file)); ext {
+	case ".toml":
+		err = toml.Unmarshal(content, &config)
+	case ".yaml", ".yml":
+		err = yaml.Unmarshal(content, &config)
+	default:
+		return nil, fmt.Errorf("-config %v must be a .toml, .yaml or .yml file", file)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("parsing -config %v: %w", file, err)
+	}
+	return &config, nil
+}
+
+// baseURL returns the URL of the section, if any.
+func (s configSection) baseURL(section string) (string, error) {
+	var found []string
+	for _, key := range []string{"url", "dsn", "path"} {
+		if _, ok := s[key]; ok {
+			found = append(found, key)
+		}
+	}
+	if len(found) > 1 {
+		return "", fmt.Errorf("[%s] of -config can only have one of %s", section, strings.Join(found, ", "))
+	}
+	if len(found) == 0 {
+		return "", nil
+	}
+	value, ok := s[found[0]].(string)
+	if !ok || value == "" {
+		return "", fmt.Errorf("%s in [%s] of -config must be a non-empty string", found[0], section)
+	}
+	if found[0] == "path" {
+		return "file://" + value, nil
+	}
+	return value, nil
+}
+
+// apply returns rawURL, or else the URL of the section, with the options of
+// the section added to its query. Options already in the query are kept.
+func (s configSection) apply(rawURL string, section string) (string, error) {
+	if rawURL == "" {
+		var err error
+		if rawURL, err = s.baseURL(section); err != nil {
+			return "", err
+		}
+	}
+
+	options := url.Values{}
+	for key, value := range s {
+		switch key {
+		case "url", "dsn", "path":
+			continue
+		}
+		switch value.(type) {
+		case string, bool, int, int64, float64:
+		default:
+			return "", fmt.Errorf("%s in [%s] of -config must be a string, a number or a bool", key, section)
+		}
+		options.Set(optionName(key), fmt.Sprint(value))
+	}
+	if len(options) == 0 {
+		return rawURL, nil
+	}
+	if rawURL == "" {
+		return "", fmt.Errorf("[%s] of -config has options but no url", section)
+	}
+
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return "", err
+	}
+	query := u.Query()
+	keys := make([]string, 0, len(options))
+	for key := range options {
+		if !query.Has(key) {
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+	// append the options to keep the query of the URL as it is
+	for _, key := range keys {
+		if u.RawQuery != "" {
+			u.RawQuery += "&"
+		}
+		u.RawQuery += url.QueryEscape(key) + "=" + url.QueryEscape(options.Get(key))
+	}
+	return u.String(), nil
+}
+
+// optionName returns the URL query option of a -config key.
+func optionName(key string) string {
+	key = strings.ReplaceAll(key, "_", "-")
+	if strings.HasPrefix(key, "x-") {
+		return key
+	}
+	return "x-" + key
+}
+
+// resolveURLs returns the source and database URLs with the precedence
+// flags > environment > -config file. The options of the -config file are
+// added to the URLs wherever they come from.
+func resolveURLs(sourceURL string, databaseURLs []string, configPath string) (string, []string, error) {
+	if sourceURL == "" {
+		sourceURL = os.Getenv(envSource)
+	}
+	if len(databaseURLs) == 0 {
+		if databaseURL := os.Getenv(envDatabase); databaseURL != "" {
+			databaseURLs = []string{databaseURL}
+		}
+	}
+	if configPath == "" {
+		return sourceURL, databaseURLs, nil
+	}
+
+	config, err := readConfigFile(configPath)
+	if err != nil {
+		return "", nil, err
+	}
+	if sourceURL, err = config.Source.apply(sourceURL, "source"); err != nil {
+		return "", nil, err
+	}
+	if len(databaseURLs) == 0 {
+		databaseURL, err := config.Database.apply("", "database")
+		if err != nil {
+			return "", nil, err
+		}
+		if databaseURL != "" {
+			databaseURLs = []string{databaseURL}
+		}
+		return sourceURL, databaseURLs, nil
+	}
+	resolved := make([]string, len(databaseURLs))
+	for i, databaseURL := range databaseURLs {
+		if resolved[i], err = config.Database.apply(databaseURL, "database"); err != nil {
+			return "", nil, fmt.Errorf("%s: %w", redactDatabaseURL(databaseURL), err)
+		}
+	}
+	return sourceURL, resolved, nil
+}
@@ -0,0 +1,142 @@
+package cli
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func writeConfig(t *testing.T, name, content string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), name)
+	if err := os.WriteFile(path, []byte(content), 0600); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestResolveURLs(t *testing.T) {
+	tomlConfig := writeConfig(t, "migrate.toml", `
+[source]
+path = "db/migrations"
+
+[database]
+dsn = "postgres://localhost:5432/app?sslmode=disable"
+migrations_table = "app_migrations"
+statement_timeout = 5000
+x-multi-statement = true
+`)
+	yamlConfig := writeConfig(t, "migrate.yml", `
+source:
+  url: file://db/migrations
+database:
+  url: postgres://localhost:5432/app
+  migrations_table: app_migrations
+`)
+
+	cases := []struct {
+		name              string
+		source            string
+		databases         []string
+		env               map[string]string
+		config            string
+		expectedSource    string
+		expectedDatabases []string
+	}{
+		{
+			name:              "no config",
+			source:            "file://migrations",
+			databases:         []string{"stub://"},
+			expectedSource:    "file://migrations",
+			expectedDatabases: []string{"stub://"},
+		},
+		{
+			name:              "env",
+			env:               map[string]string{envSource: "file://env", envDatabase: "stub://env"},
+			expectedSource:    "file://env",
+			expectedDatabases: []string{"stub://env"},
+		},
+		{
+			name:              "flags over env",
+			source:            "file://flag",
+			databases:         []string{"stub://flag"},
+			env:               map[string]string{envSource: "file://env", envDatabase: "stub://env"},
+			expectedSource:    "file://flag",
+			expectedDatabases: []string{"stub://flag"},
+		},
+		{
+			name:              "toml",
+			config:            tomlConfig,
+			expectedSource:    "file://db/migrations",
+			expectedDatabases: []string{"postgres://localhost:5432/app?sslmode=disable&x-migrations-table=app_migrations&x-multi-statement=true&x-statement-timeout=5000"},
+		},
+		{
+			name:              "yaml",
+			config:            yamlConfig,
+			expectedSource:    "file://db/migrations",
+			expectedDatabases: []string{"postgres://localhost:5432/app?x-migrations-table=app_migrations"},
+		},
+		{
+			name:              "env over config",
+			env:               map[string]string{envDatabase: "postgres://env:5432/app"},
+			config:            yamlConfig,
+			expectedSource:    "file://db/migrations",
+			expectedDatabases: []string{"postgres://env:5432/app?x-migrations-table=app_migrations"},
+		},
+		{
+			name:              "options added to each database",
+			source:            "file://flag",
+			databases:         []string{"postgres://shard1:5432/app?x-migrations-table=shard_migrations", "postgres://shard2:5432/app"},
+			config:            yamlConfig,
+			expectedSource:    "file://flag",
+			expectedDatabases: []string{"postgres://shard1:5432/app?x-migrations-table=shard_migrations", "postgres://shard2:5432/app?x-migrations-table=app_migrations"},
+		},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			t.Setenv(envSource, c.env[envSource])
+			t.Setenv(envDatabase, c.env[envDatabase])
+			source, databases, err := resolveURLs(c.source, c.databases, c.config)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if source != c.expectedSource {
+				t.Errorf("expected source %v, got %v", c.expectedSource, source)
+			}
+			if !reflect.DeepEqual(databases, c.expectedDatabases) {
+				t.Errorf("expected databases %v, got %v", c.expectedDatabases, databases)
+			}
+		})
+	}
+}
+
+func TestResolveURLsErrors(t *testing.T) {
+	t.Setenv(envSource, "")
+	t.Setenv(envDatabase, "")
+
+	cases := []struct {
+		name    string
+		file    string
+		content string
+	}{
+		{name: "extension", file: "migrate.json", content: `{}`},
+		{name: "syntax", file: "migrate.toml", content: `[database`},
+		{name: "url and path", file: "migrate.yaml", content: "source:\n  url: file://a\n  path: b\n"},
+		{name: "empty url", file: "migrate.yaml", content: "database:\n  url: \"\"\n"},
+		{name: "options without url", file: "migrate.yaml", content: "database:\n  migrations_table: m\n"},
+		{name: "nested option", file: "migrate.yaml", content: "database:\n  url: stub://\n  tls:\n    ca: ca.pem\n"},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			config := writeConfig(t, c.file, c.content)
+			if _, _, err := resolveURLs("", nil, config); err == nil {
+				t.Error("expected an error")
+			}
+		})
+	}
+
+	if _, _, err := resolveURLs("", nil, filepath.Join(t.TempDir(), "missing.toml")); err == nil {
+		t.Error("expected an error for a missing -config")
+	}
+}
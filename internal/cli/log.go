@@ -42,3 +42,15 @@ func (l *Log) fatal(args ...interface{}) {
 func (l *Log) fatalErr(err error) {
 	l.fatal("error:", err)
 }
+
+// prefixLog prefixes the lines logged by a Migrate instance, to tell the
+// databases apart when a command runs against several of them.
+type prefixLog struct {
+	*Log
+	prefix string
+}
+
+// Printf prints out formatted string into a log, after the prefix
+func (l prefixLog) Printf(format string, v ...interface{}) {
+	l.Log.Printf("%s"+format, append([]interface{}{l.prefix}, v...)...)
+}
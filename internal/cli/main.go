@@ -1,12 +1,15 @@
 package cli
 
 import (
+	"context"
+	"errors"
 	"flag"
 	"fmt"
 	"os"
 	"os/signal"
 	"strconv"
 	"strings"
+	"sync"
 	"syscall"
 	"time"
 
@@ -18,19 +21,55 @@ import (
 const (
 	defaultTimeFormat = "20060102150405"
 	defaultTimezone   = "UTC"
-	createUsage       = `create [-ext E] [-dir D] [-seq] [-digits N] [-format] [-tz] NAME
+	createUsage       = `create [-ext E] [-dir D] [-seq] [-digits N] [-seq-start N] [-format] [-tz] [-output-style S] [-strict-scheme] NAME
 	   Create a set of timestamped up/down migrations titled NAME, in directory D with extension E.
 	   Use -seq option to generate sequential up/down migrations with N digits.
+	   Use -seq-start N with -seq to use N as the sequence number instead of the one following the existing migrations.
 	   Use -format option to specify a Go time format string. Note: migrations with the same time cause "duplicate migration version" error.
            Use -tz option to specify the timezone that will be used when generating non-sequential migrations (defaults: UTC).
+	   Use -output-style dir to create the up/down migrations in a directory per migration, like V_NAME/up.E (defaults: flat).
+	   Use -strict-scheme to fail instead of warn when timestamped migrations would be mixed with sequential ones.
 `
-	gotoUsage = `goto V       Migrate to version V`
-	upUsage   = `up [N]       Apply all or N up migrations`
-	downUsage = `down [N] [-all]    Apply all or N down migrations
-	Use -all to apply all down migrations`
-	dropUsage = `drop [-f]    Drop everything inside database
-	Use -f to bypass confirmation`
-	forceUsage = `force V      Set version V but don't run migration (ignores dirty state)`
+	gotoUsage = `goto [-timeout D] V    Migrate to version V
+	Use -timeout to stop migrating after duration D, like 300s`
+	upUsage = `up [-timeout D] [-on-error force-previous] [N]    Apply all or N up migrations
+	Use -timeout to stop migrating after duration D, like 300s
+	Use -on-error force-previous to force the version before a failed migration instead of leaving the database dirty`
+	downUsage = `down [-timeout D] [N] [-all] [-one]    Apply all or N down migrations
+	Use -all to apply all down migrations
+	Use -one (or -to-previous) to roll back only the last applied migration
+	Use -timeout to stop migrating after duration D, like 300s`
+	migrateUsage = `migrate [-timeout D] +N|-N    Apply N up migrations with +N, or N down migrations with -N
+	Use -timeout to stop migrating after duration D, like 300s`
+	dropUsage = `drop [-f] [-keep-migrations-table] [-dry-run]    Drop everything inside database
+	Use -f to bypass confirmation
+	Use -keep-migrations-table to keep the migrations table and its history
+	Use -dry-run to print the tables that would be dropped on stdout, without dropping them`
+	resetUsage = `reset [-f] [-timeout D]    Apply all down migrations, then all up migrations, holding the lock in between
+	Use -f to bypass confirmation
+	Use -timeout to stop migrating after duration D, like 300s`
+	forceUsage  = `force V      Set version V but don't run migration (ignores dirty state)`
+	squashUsage = `squash [-ext E] [-dir D] FROM TO
+	   Merge the up/down migrations from version FROM to TO into one migration titled squash_FROM_TO with version FROM, in directory D with extension E.
+	   The squashed migrations found in directory D are removed. None of them may be applied to the database yet.
+`
+	baselineUsage = `baseline V   Mark the migrations up to version V as applied without running them
+	   For adopting migrate on an existing database, which must not have a version yet.`
+	inspectUsage = `inspect [-down] [-raw] V
+	   Print the up migration of version V read from the source, or the down migration with -down.
+	   Use -raw to print only the migration, without the header naming it.`
+	versionUsage = `version [-format F]    Print current migration version
+	   Use -format json to print {"version":V,"dirty":D} as a single line on stdout, with a null version if no migration was applied.`
+	healthUsage = `health [-allow-dirty]    Check the database is reachable and not dirty, without migrating
+	   Use -allow-dirty to only report a dirty version, for diagnosing a failed migration.`
+	diffUsage = `diff    Print the versions of the source not applied yet, and the applied versions missing from the source
+	   Missing versions make diff exit with an error. Only the current version is checked with drivers keeping a single row
+	   in their migrations table, like postgres; the other applied versions are only checked with drivers recording them.`
+
+	// exitCodeTimeout is the exit code when migrating was stopped by
+	// -timeout, to tell it apart from a failed migration.
+	exitCodeTimeout = 3
+	timeoutUsage    = "Stop migrating after this duration, like 300s (default: no timeout)"
 )
 
 func handleSubCmdHelp(help bool, usage string, flagSet *flag.FlagSet) {
@@ -47,6 +86,16 @@ func newFlagSetWithHelp(name string) (*flag.FlagSet, *bool) {
 	return flagSet, helpPtr
 }
 
+// fatalMigrateErr exits like log.fatalErr, but with exitCodeTimeout
+// if the command was stopped by -timeout.
+func fatalMigrateErr(err error) {
+	if errors.Is(err, errTimeout) || errors.Is(err, errHardTimeout) || errors.Is(err, context.DeadlineExceeded) {
+		log.Println("error:", err)
+		os.Exit(exitCodeTimeout)
+	}
+	log.fatalErr(err)
+}
+
 // set main log
 var log = &Log{}
 
@@ -65,9 +114,18 @@ func Main(version string) {
 	verbosePtr := flag.Bool("verbose", false, "")
 	prefetchPtr := flag.Uint("prefetch", 10, "")
 	lockTimeoutPtr := flag.Uint("lock-timeout", 15, "")
+	maxDBCallsPtr := flag.Int("max-concurrent-schema-locks", migrate.DefaultMaxConcurrentDBCalls, "")
 	pathPtr := flag.String("path", "", "")
-	databasePtr := flag.String("database", "", "")
+	var databaseURLs databaseList
+	flag.Var(&databaseURLs, "database", "")
 	sourcePtr := flag.String("source", "", "")
+	databaseFilePtr := flag.String("database-file", "", "")
+	sourceFilePtr := flag.String("source-file", "", "")
+	databasesFilePtr := flag.String("databases-file", "", "")
+	parallelPtr := flag.Uint("parallel", 4, "")
+	labelPtr := flag.String("label", "", "")
+	timeoutPtr := flag.Duration("timeout", 0, "")
+	configPtr := flag.String("config", "", "")
 
 	flag.Usage = func() {
 		fmt.Fprintf(os.Stderr,
@@ -78,8 +136,20 @@ Options:
   -source          Location of the migrations (driver://url)
   -path            Shorthand for -source=file://path
   -database        Run migrations against this database (driver://url)
+                   Repeat it to run up, down or goto against each database
+  -source-file F   Read -source from file F, like a mounted secret
+  -database-file F Read -database from file F, keeping it out of process listings
+  -databases-file F  Run up, down or goto against each database listed in file F, one per line
+  -config F        Read the source, the database and their options from the TOML or YAML file F
+                   -source and -database, then MIGRATE_SOURCE and MIGRATE_DATABASE, take precedence
+  -parallel N      Number of databases migrated at once with several databases (default 4)
+  -label L         Only apply migrations labeled L, like NAME.L.up.sql
   -prefetch N      Number of migrations to load in advance before executing (default 10)
+                   Use 0 to stream each migration to the database without buffering it
   -lock-timeout N  Allow N seconds to acquire database lock (default 15)
+  -max-concurrent-schema-locks N  Allow N database calls at once, for databases limiting connections (default 2)
+                   1 only works with drivers locking sequentially, 0 disables the limit
+  -timeout D       Stop the command after duration D, like 300s (default: no timeout)
   -verbose         Print verbose logging
   -version         Print version
   -help            Print usage
@@ -91,10 +161,17 @@ Commands:
   %s
   %s
   %s
-  version      Print current migration version
+  %s
+  %s
+  %s
+  %s
+  %s
+  %s
+  %s
+  %s
 
 Source drivers: `+strings.Join(source.List(), ", ")+`
-Database drivers: `+strings.Join(database.List(), ", ")+"\n", createUsage, gotoUsage, upUsage, downUsage, dropUsage, forceUsage)
+Database drivers: `+strings.Join(database.List(), ", ")+"\n", createUsage, gotoUsage, upUsage, downUsage, migrateUsage, dropUsage, resetUsage, forceUsage, baselineUsage, squashUsage, inspectUsage, versionUsage, healthUsage, diffUsage)
 	}
 
 	flag.Parse()
@@ -114,41 +191,146 @@ Database drivers: `+strings.Join(database.List(), ", ")+"\n", createUsage, gotoU
 		os.Exit(0)
 	}
 
+	// read -source and -database from their files if given
+	var err error
+	if *sourcePtr, err = readURLFile(*sourcePtr, *sourceFilePtr, "source", "source-file"); err != nil {
+		log.fatalErr(err)
+	}
+	if *databaseFilePtr != "" {
+		if len(databaseURLs) > 1 {
+			log.fatalErr(errors.New("-database and -database-file cannot be used together"))
+		}
+		databaseURL, err := readURLFile(strings.Join(databaseURLs, ""), *databaseFilePtr, "database", "database-file")
+		if err != nil {
+			log.fatalErr(err)
+		}
+		databaseURLs = databaseList{databaseURL}
+	}
+	if *databasesFilePtr != "" {
+		urls, err := readDatabasesFile(*databasesFilePtr)
+		if err != nil {
+			log.fatalErr(err)
+		}
+		databaseURLs = append(databaseURLs, urls...)
+	}
+
 	// translate -path into -source if given
 	if *sourcePtr == "" && *pathPtr != "" {
 		*sourcePtr = fmt.Sprintf("file://%v", *pathPtr)
 	}
 
+	// fill in -source and -database from the environment and -config
+	sourceURL, urls, err := resolveURLs(*sourcePtr, databaseURLs, *configPtr)
+	if err != nil {
+		log.fatalErr(err)
+	}
+	*sourcePtr, databaseURLs = sourceURL, urls
+
+	// translate -label into the x-label source option
+	if *labelPtr != "" {
+		sourceURL, err := addLabelToSourceURL(*sourcePtr, *labelPtr)
+		if err != nil {
+			log.fatalErr(err)
+		}
+		*sourcePtr = sourceURL
+	}
+
+	// newMigrater opens and configures a Migrate instance for databaseURL
+	newMigrater := func(databaseURL string, logger migrate.Logger) (*migrate.Migrate, error) {
+		m, err := migrate.New(*sourcePtr, databaseURL, migrate.WithLogger(logger))
+		if err != nil {
+			return nil, err
+		}
+		m.PrefetchMigrations = *prefetchPtr
+		m.LockTimeout = time.Duration(int64(*lockTimeoutPtr)) * time.Second
+		m.MaxConcurrentDBCalls = *maxDBCallsPtr
+
+		if caps, ok := m.Capabilities(); ok && !caps.SupportsLocking {
+			logger.Printf("warning: database driver does not support locking, make sure migrations are not run concurrently\n")
+		}
+
+		if log.verbose {
+			logDriverInfo(m)
+		}
+		return m, nil
+	}
+
+	// migraters are cancelled on Ctrl+c
+	var (
+		migratersMu sync.Mutex
+		migraters   []*migrate.Migrate
+	)
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, syscall.SIGINT)
+	go func() {
+		for range signals {
+			log.Println("Stopping after this running migration ...")
+			migratersMu.Lock()
+			for _, m := range migraters {
+				m.Cancel()
+			}
+			migratersMu.Unlock()
+			return
+		}
+	}()
+
 	// initialize migrate
 	// don't catch migraterErr here and let each command decide
 	// how it wants to handle the error
-	migrater, migraterErr := migrate.New(*sourcePtr, *databasePtr)
-	defer func() {
+	var migrater *migrate.Migrate
+	var migraterErr error
+	multipleDatabases := len(databaseURLs) > 1
+	if multipleDatabases {
+		switch flag.Arg(0) {
+		case "up", "down", "goto":
+		default:
+			log.fatal("error: several databases are only supported by up, down and goto")
+		}
+	} else {
+		databaseURL := ""
+		if len(databaseURLs) == 1 {
+			databaseURL = databaseURLs[0]
+		}
+		migrater, migraterErr = newMigrater(databaseURL, log)
 		if migraterErr == nil {
-			if _, err := migrater.Close(); err != nil {
+			migraters = append(migraters, migrater)
+		}
+	}
+	defer func() {
+		if migrater != nil {
+			if err := migrater.CloseAll(); err != nil {
 				log.Println(err)
 			}
 		}
 	}()
-	if migraterErr == nil {
-		migrater.Log = log
-		migrater.PrefetchMigrations = *prefetchPtr
-		migrater.LockTimeout = time.Duration(int64(*lockTimeoutPtr)) * time.Second
-
-		// handle Ctrl+c
-		signals := make(chan os.Signal, 1)
-		signal.Notify(signals, syscall.SIGINT)
-		go func() {
-			for range signals {
-				log.Println("Stopping after this running migration ...")
-				migrater.GracefulStop <- true
-				return
+
+	// runMigrater runs cmd against the database, or against each database
+	// with its own Migrate instance if several were given
+	runMigrater := func(ctx context.Context, cmd func(m *migrate.Migrate) error) error {
+		if !multipleDatabases {
+			return runWithContext(ctx, migrater.GracefulStop, timeoutGracePeriod, func() error {
+				return cmd(migrater)
+			})
+		}
+		results := fanOut(ctx, databaseURLs, int(*parallelPtr), func(databaseURL string) (*migrate.Migrate, error) {
+			m, err := newMigrater(databaseURL, prefixLog{Log: log, prefix: redactDatabaseURL(databaseURL) + ": "})
+			if err != nil {
+				return nil, err
 			}
-		}()
+			migratersMu.Lock()
+			migraters = append(migraters, m)
+			migratersMu.Unlock()
+			return m, nil
+		}, cmd)
+		return printTargetResults(os.Stderr, results)
 	}
 
 	startTime := time.Now()
 
+	// -timeout limits the whole command, including acquiring the lock
+	ctx, cancel := withTimeout(context.Background(), *timeoutPtr)
+	defer cancel()
+
 	if len(flag.Args()) < 1 {
 		printUsageAndExit()
 	}
@@ -159,14 +341,19 @@ Database drivers: `+strings.Join(database.List(), ", ")+"\n", createUsage, gotoU
 
 		seq := false
 		seqDigits := 6
+		var seqStart uint64
+		strictScheme := false
 
 		createFlagSet, help := newFlagSetWithHelp("create")
 		extPtr := createFlagSet.String("ext", "", "File extension")
 		dirPtr := createFlagSet.String("dir", "", "Directory to place file in (default: current working directory)")
 		formatPtr := createFlagSet.String("format", defaultTimeFormat, `The Go time format string to use. If the string "unix" or "unixNano" is specified, then the seconds or nanoseconds since January 1, 1970 UTC respectively will be used. Caution, due to the behavior of time.Time.Format(), invalid format strings will not error`)
 		timezoneName := createFlagSet.String("tz", defaultTimezone, `The timezone that will be used for generating timestamps (default: utc)`)
+		outputStylePtr := createFlagSet.String("output-style", outputStyleFlat, `Either "flat" to create files like V_NAME.up.E or "dir" to create files like V_NAME/up.E (default: flat)`)
 		createFlagSet.BoolVar(&seq, "seq", seq, "Use sequential numbers instead of timestamps (default: false)")
 		createFlagSet.IntVar(&seqDigits, "digits", seqDigits, "The number of digits to use in sequences (default: 6)")
+		createFlagSet.Uint64Var(&seqStart, "seq-start", seqStart, "The sequence number of the migration, instead of the one following the existing migrations")
+		createFlagSet.BoolVar(&strictScheme, "strict-scheme", strictScheme, "Fail if timestamped migrations would be mixed with sequential ones, instead of warning (default: false)")
 
 		if err := createFlagSet.Parse(args); err != nil {
 			log.fatalErr(err)
@@ -188,13 +375,14 @@ Database drivers: `+strings.Join(database.List(), ", ")+"\n", createUsage, gotoU
 			log.fatal(err)
 		}
 
-		if err := createCmd(*dirPtr, startTime.In(timezone), *formatPtr, name, *extPtr, seq, seqDigits, true); err != nil {
+		if err := createCmd(*dirPtr, startTime.In(timezone), *formatPtr, name, *extPtr, seq, seqDigits, seqStart, *outputStylePtr, strictScheme, true); err != nil {
 			log.fatalErr(err)
 		}
 
 	case "goto":
 
 		gotoSet, helpPtr := newFlagSetWithHelp("goto")
+		cmdTimeoutPtr := gotoSet.Duration("timeout", 0, timeoutUsage)
 
 		if err := gotoSet.Parse(args); err != nil {
 			log.fatalErr(err)
@@ -215,8 +403,13 @@ Database drivers: `+strings.Join(database.List(), ", ")+"\n", createUsage, gotoU
 			log.fatal("error: can't read version argument V")
 		}
 
-		if err := gotoCmd(migrater, uint(v)); err != nil {
-			log.fatalErr(err)
+		cmdCtx, cmdCancel := withTimeout(ctx, *cmdTimeoutPtr)
+		defer cmdCancel()
+		err = runMigrater(cmdCtx, func(m *migrate.Migrate) error {
+			return gotoCmd(m, uint(v))
+		})
+		if err != nil {
+			fatalMigrateErr(err)
 		}
 
 		if log.verbose {
@@ -225,6 +418,8 @@ Database drivers: `+strings.Join(database.List(), ", ")+"\n", createUsage, gotoU
 
 	case "up":
 		upSet, helpPtr := newFlagSetWithHelp("up")
+		cmdTimeoutPtr := upSet.Duration("timeout", 0, timeoutUsage)
+		onErrorPtr := upSet.String("on-error", "", `Set to "force-previous" to force the version before a failed migration`)
 
 		if err := upSet.Parse(args); err != nil {
 			log.fatalErr(err)
@@ -236,6 +431,15 @@ Database drivers: `+strings.Join(database.List(), ", ")+"\n", createUsage, gotoU
 			log.fatalErr(migraterErr)
 		}
 
+		forcePrevious := false
+		switch *onErrorPtr {
+		case "":
+		case onErrorForcePrevious:
+			forcePrevious = true
+		default:
+			log.fatal("error: -on-error must be " + onErrorForcePrevious)
+		}
+
 		limit := -1
 		if upSet.NArg() > 0 {
 			n, err := strconv.ParseUint(upSet.Arg(0), 10, 64)
@@ -245,8 +449,14 @@ Database drivers: `+strings.Join(database.List(), ", ")+"\n", createUsage, gotoU
 			limit = int(n)
 		}
 
-		if err := upCmd(migrater, limit); err != nil {
-			log.fatalErr(err)
+		cmdCtx, cmdCancel := withTimeout(ctx, *cmdTimeoutPtr)
+		defer cmdCancel()
+		err := runMigrater(cmdCtx, func(m *migrate.Migrate) error {
+			m.ForcePreviousOnError = forcePrevious
+			return upCmd(m, limit)
+		})
+		if err != nil {
+			fatalMigrateErr(err)
 		}
 
 		if log.verbose {
@@ -256,6 +466,9 @@ Database drivers: `+strings.Join(database.List(), ", ")+"\n", createUsage, gotoU
 	case "down":
 		downFlagSet, helpPtr := newFlagSetWithHelp("down")
 		applyAll := downFlagSet.Bool("all", false, "Apply all down migrations")
+		applyOne := downFlagSet.Bool("one", false, "Roll back the last applied migration")
+		downFlagSet.BoolVar(applyOne, "to-previous", false, "Alias of -one")
+		cmdTimeoutPtr := downFlagSet.Duration("timeout", 0, timeoutUsage)
 
 		if err := downFlagSet.Parse(args); err != nil {
 			log.fatalErr(err)
@@ -268,6 +481,22 @@ Database drivers: `+strings.Join(database.List(), ", ")+"\n", createUsage, gotoU
 		}
 
 		downArgs := downFlagSet.Args()
+		if *applyOne {
+			if *applyAll || len(downArgs) > 0 {
+				log.fatalErr(errors.New("-one cannot be used with other arguments"))
+			}
+			cmdCtx, cmdCancel := withTimeout(ctx, *cmdTimeoutPtr)
+			defer cmdCancel()
+			err := runMigrater(cmdCtx, downOneCmd)
+			if err != nil {
+				fatalMigrateErr(err)
+			}
+			if log.verbose {
+				log.Println("Finished after", time.Since(startTime))
+			}
+			break
+		}
+
 		num, needsConfirm, err := numDownMigrationsFromArgs(*applyAll, downArgs)
 		if err != nil {
 			log.fatalErr(err)
@@ -285,10 +514,53 @@ Database drivers: `+strings.Join(database.List(), ", ")+"\n", createUsage, gotoU
 			}
 		}
 
-		if err := downCmd(migrater, num); err != nil {
+		cmdCtx, cmdCancel := withTimeout(ctx, *cmdTimeoutPtr)
+		defer cmdCancel()
+		err = runMigrater(cmdCtx, func(m *migrate.Migrate) error {
+			return downCmd(m, num)
+		})
+		if err != nil {
+			fatalMigrateErr(err)
+		}
+
+		if log.verbose {
+			log.Println("Finished after", time.Since(startTime))
+		}
+
+	case "migrate":
+		migrateSet, helpPtr := newFlagSetWithHelp("migrate")
+		cmdTimeoutPtr := migrateSet.Duration("timeout", 0, timeoutUsage)
+
+		steps, rest, stepsErr := stepsFromArgs(args)
+		if stepsErr != nil {
+			rest = args
+		}
+		if err := migrateSet.Parse(rest); err != nil {
 			log.fatalErr(err)
 		}
 
+		handleSubCmdHelp(*helpPtr, migrateUsage, migrateSet)
+
+		if migraterErr != nil {
+			log.fatalErr(migraterErr)
+		}
+
+		if stepsErr != nil {
+			log.fatal("error: " + stepsErr.Error())
+		}
+		if migrateSet.NArg() > 0 {
+			log.fatal("error: too many arguments")
+		}
+
+		cmdCtx, cmdCancel := withTimeout(ctx, *cmdTimeoutPtr)
+		defer cmdCancel()
+		err := runWithContext(cmdCtx, migrater.GracefulStop, timeoutGracePeriod, func() error {
+			return migrateCmd(migrater, steps)
+		})
+		if err != nil {
+			fatalMigrateErr(err)
+		}
+
 		if log.verbose {
 			log.Println("Finished after", time.Since(startTime))
 		}
@@ -296,6 +568,8 @@ Database drivers: `+strings.Join(database.List(), ", ")+"\n", createUsage, gotoU
 	case "drop":
 		dropFlagSet, help := newFlagSetWithHelp("drop")
 		forceDrop := dropFlagSet.Bool("f", false, "Force the drop command by bypassing the confirmation prompt")
+		keepMigrationsTable := dropFlagSet.Bool("keep-migrations-table", false, "Keep the migrations table and its history")
+		dryRun := dropFlagSet.Bool("dry-run", false, "Print the tables that would be dropped without dropping them")
 
 		if err := dropFlagSet.Parse(args); err != nil {
 			log.fatalErr(err)
@@ -303,6 +577,19 @@ Database drivers: `+strings.Join(database.List(), ", ")+"\n", createUsage, gotoU
 
 		handleSubCmdHelp(*help, dropUsage, dropFlagSet)
 
+		if *dryRun {
+			if migraterErr != nil {
+				log.fatalErr(migraterErr)
+			}
+			err := runWithContext(ctx, migrater.GracefulStop, timeoutGracePeriod, func() error {
+				return dropDryRunCmd(ctx, os.Stdout, migrater, *keepMigrationsTable)
+			})
+			if err != nil {
+				fatalMigrateErr(err)
+			}
+			break
+		}
+
 		if !*forceDrop {
 			log.Println("Are you sure you want to drop the entire database schema? [y/N]")
 			var response string
@@ -320,10 +607,58 @@ Database drivers: `+strings.Join(database.List(), ", ")+"\n", createUsage, gotoU
 			log.fatalErr(migraterErr)
 		}
 
-		if err := dropCmd(migrater); err != nil {
+		err := runWithContext(ctx, migrater.GracefulStop, timeoutGracePeriod, func() error {
+			return dropCmd(ctx, migrater, *keepMigrationsTable)
+		})
+		if err != nil {
+			fatalMigrateErr(err)
+		}
+
+		if log.verbose {
+			log.Println("Finished after", time.Since(startTime))
+		}
+
+	case "reset":
+		resetSet, helpPtr := newFlagSetWithHelp("reset")
+		forceReset := resetSet.Bool("f", false, "Force the reset command by bypassing the confirmation prompt")
+		cmdTimeoutPtr := resetSet.Duration("timeout", 0, timeoutUsage)
+
+		if err := resetSet.Parse(args); err != nil {
 			log.fatalErr(err)
 		}
 
+		handleSubCmdHelp(*helpPtr, resetUsage, resetSet)
+
+		if resetSet.NArg() > 0 {
+			log.fatal("error: too many arguments")
+		}
+
+		if !*forceReset {
+			log.Println("Are you sure you want to apply all down migrations, then all up migrations? [y/N]")
+			var response string
+			_, _ = fmt.Scanln(&response)
+			response = strings.ToLower(strings.TrimSpace(response))
+
+			if response == "y" {
+				log.Println("Resetting the database")
+			} else {
+				log.fatal("Aborted resetting the database")
+			}
+		}
+
+		if migraterErr != nil {
+			log.fatalErr(migraterErr)
+		}
+
+		cmdCtx, cmdCancel := withTimeout(ctx, *cmdTimeoutPtr)
+		defer cmdCancel()
+		err := runWithContext(cmdCtx, migrater.GracefulStop, timeoutGracePeriod, func() error {
+			return resetCmd(migrater)
+		})
+		if err != nil {
+			fatalMigrateErr(err)
+		}
+
 		if log.verbose {
 			log.Println("Finished after", time.Since(startTime))
 		}
@@ -354,23 +689,185 @@ Database drivers: `+strings.Join(database.List(), ", ")+"\n", createUsage, gotoU
 			log.fatal("error: argument V must be >= -1")
 		}
 
-		if err := forceCmd(migrater, int(v)); err != nil {
+		err = runWithContext(ctx, migrater.GracefulStop, timeoutGracePeriod, func() error {
+			return forceCmd(migrater, int(v))
+		})
+		if err != nil {
+			fatalMigrateErr(err)
+		}
+
+		if log.verbose {
+			log.Println("Finished after", time.Since(startTime))
+		}
+
+	case "squash":
+		squashFlagSet, helpPtr := newFlagSetWithHelp("squash")
+		extPtr := squashFlagSet.String("ext", "", "File extension")
+		dirPtr := squashFlagSet.String("dir", "", "Directory to place file in (default: current working directory)")
+
+		if err := squashFlagSet.Parse(args); err != nil {
 			log.fatalErr(err)
 		}
 
+		handleSubCmdHelp(*helpPtr, squashUsage, squashFlagSet)
+
+		if migraterErr != nil {
+			log.fatalErr(migraterErr)
+		}
+
+		if squashFlagSet.NArg() < 2 {
+			log.fatal("error: please specify version arguments FROM and TO")
+		}
+
+		from, err := strconv.ParseUint(squashFlagSet.Arg(0), 10, 64)
+		if err != nil {
+			log.fatal("error: can't read version argument FROM")
+		}
+		to, err := strconv.ParseUint(squashFlagSet.Arg(1), 10, 64)
+		if err != nil {
+			log.fatal("error: can't read version argument TO")
+		}
+
+		if *extPtr == "" {
+			log.fatal("error: -ext flag must be specified")
+		}
+
+		srcDrv, err := source.Open(*sourcePtr)
+		if err != nil {
+			log.fatalErr(err)
+		}
+		defer srcDrv.Close()
+
+		if err := squashCmd(migrater, srcDrv, *dirPtr, *extPtr, uint(from), uint(to), true); err != nil {
+			log.fatalErr(err)
+		}
+
+	case "baseline":
+		baselineSet, helpPtr := newFlagSetWithHelp("baseline")
+
+		if err := baselineSet.Parse(args); err != nil {
+			log.fatalErr(err)
+		}
+
+		handleSubCmdHelp(*helpPtr, baselineUsage, baselineSet)
+
+		if migraterErr != nil {
+			log.fatalErr(migraterErr)
+		}
+
+		if baselineSet.NArg() == 0 {
+			log.fatal("error: please specify version argument V")
+		}
+
+		v, err := strconv.ParseUint(baselineSet.Arg(0), 10, 64)
+		if err != nil {
+			log.fatal("error: can't read version argument V")
+		}
+
+		err = runWithContext(ctx, migrater.GracefulStop, timeoutGracePeriod, func() error {
+			return baselineCmd(migrater, uint(v))
+		})
+		if err != nil {
+			fatalMigrateErr(err)
+		}
+
 		if log.verbose {
 			log.Println("Finished after", time.Since(startTime))
 		}
 
+	case "inspect":
+		inspectSet, helpPtr := newFlagSetWithHelp("inspect")
+		downPtr := inspectSet.Bool("down", false, "Print the down migration")
+		rawPtr := inspectSet.Bool("raw", false, "Print only the migration, without a header")
+
+		if err := inspectSet.Parse(args); err != nil {
+			log.fatalErr(err)
+		}
+
+		handleSubCmdHelp(*helpPtr, inspectUsage, inspectSet)
+
+		if inspectSet.NArg() == 0 {
+			log.fatal("error: please specify version argument V")
+		}
+
+		v, err := strconv.ParseUint(inspectSet.Arg(0), 10, 64)
+		if err != nil {
+			log.fatal("error: can't read version argument V")
+		}
+
+		// only the source is needed, no database
+		srcDrv, err := source.Open(*sourcePtr)
+		if err != nil {
+			log.fatalErr(err)
+		}
+		defer srcDrv.Close()
+
+		if err := inspectCmd(os.Stdout, srcDrv, uint(v), *downPtr, *rawPtr); err != nil {
+			log.fatalErr(err)
+		}
+
 	case "version":
+		versionSet, helpPtr := newFlagSetWithHelp("version")
+		formatPtr := versionSet.String("format", versionFormatText, `Output format, either "text" or "json"`)
+
+		if err := versionSet.Parse(args); err != nil {
+			log.fatalErr(err)
+		}
+
+		handleSubCmdHelp(*helpPtr, versionUsage, versionSet)
+
+		if migraterErr != nil {
+			log.fatalErr(migraterErr)
+		}
+
+		err := runWithContext(ctx, migrater.GracefulStop, timeoutGracePeriod, func() error {
+			return versionCmd(os.Stdout, migrater, *formatPtr)
+		})
+		if err != nil {
+			fatalMigrateErr(err)
+		}
+
+	case "health":
+		healthSet, helpPtr := newFlagSetWithHelp("health")
+		allowDirtyPtr := healthSet.Bool("allow-dirty", false, "Report a dirty version instead of failing")
+
+		if err := healthSet.Parse(args); err != nil {
+			log.fatalErr(err)
+		}
+
+		handleSubCmdHelp(*helpPtr, healthUsage, healthSet)
+
 		if migraterErr != nil {
 			log.fatalErr(migraterErr)
 		}
 
-		if err := versionCmd(migrater); err != nil {
+		err := runWithContext(ctx, migrater.GracefulStop, timeoutGracePeriod, func() error {
+			return healthCmd(ctx, migrater, *allowDirtyPtr)
+		})
+		if err != nil {
+			fatalMigrateErr(err)
+		}
+
+	case "diff":
+		diffSet, helpPtr := newFlagSetWithHelp("diff")
+
+		if err := diffSet.Parse(args); err != nil {
 			log.fatalErr(err)
 		}
 
+		handleSubCmdHelp(*helpPtr, diffUsage, diffSet)
+
+		if migraterErr != nil {
+			log.fatalErr(migraterErr)
+		}
+
+		err := runWithContext(ctx, migrater.GracefulStop, timeoutGracePeriod, func() error {
+			return diffCmd(os.Stdout, migrater)
+		})
+		if err != nil {
+			fatalMigrateErr(err)
+		}
+
 	default:
 		printUsageAndExit()
 	}
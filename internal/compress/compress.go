@@ -0,0 +1,60 @@
+// Package compress decompresses migrations based on the suffix of their
+// name, for sources where transferring them compressed saves bandwidth.
+package compress
+
+import (
+	"compress/bzip2"
+	"compress/gzip"
+	"io"
+	"strings"
+
+	"github.com/klauspost/compress/zstd"
+)
+
+// Suffixes of the supported compression formats.
+const (
+	Gzip  = ".gz"
+	Bzip2 = ".bz2"
+	Zstd  = ".zst"
+)
+
+type readCloser struct {
+	io.Reader
+	close func() error
+}
+
+func (r *readCloser) Close() error {
+	return r.close()
+}
+
+// Decompress returns a reader decompressing r if name ends with a
+// compression suffix, otherwise it returns r as is. Closing the returned
+// reader closes r.
+func Decompress(name string, r io.ReadCloser) (io.ReadCloser, error) {
+	switch {
+	case strings.HasSuffix(name, Gzip):
+		gr, err := gzip.NewReader(r)
+		if err != nil {
+			r.Close()
+			return nil, err
+		}
+		return &readCloser{Reader: gr, close: func() error {
+			gr.Close()
+			return r.Close()
+		}}, nil
+	case strings.HasSuffix(name, Bzip2):
+		return &readCloser{Reader: bzip2.NewReader(r), close: r.Close}, nil
+	case strings.HasSuffix(name, Zstd):
+		zr, err := zstd.NewReader(r)
+		if err != nil {
+			r.Close()
+			return nil, err
+		}
+		return &readCloser{Reader: zr, close: func() error {
+			zr.Close()
+			return r.Close()
+		}}, nil
+	default:
+		return r, nil
+	}
+}
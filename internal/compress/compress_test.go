@@ -0,0 +1,85 @@
+package compress
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/hex"
+	"io"
+	"testing"
+
+	"github.com/klauspost/compress/zstd"
+)
+
+type closeRecorder struct {
+	io.Reader
+	closed bool
+}
+
+func (c *closeRecorder) Close() error {
+	c.closed = true
+	return nil
+}
+
+func TestDecompress(t *testing.T) {
+	var gz bytes.Buffer
+	gw := gzip.NewWriter(&gz)
+	if _, err := gw.Write([]byte("1 up")); err != nil {
+		t.Fatal(err)
+	}
+	if err := gw.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	bz, err := hex.DecodeString("425a6839314159265359c4437f6a00000098804000200042002000219a68334d0cbc5dc914e14243110dfda8")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	enc, err := zstd.NewWriter(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	zst := enc.EncodeAll([]byte("1 up"), nil)
+
+	tt := []struct {
+		name string
+		body []byte
+	}{
+		{name: "1_foobar.up.sql", body: []byte("1 up")},
+		{name: "1_foobar.up.sql.gz", body: gz.Bytes()},
+		{name: "1_foobar.up.sql.bz2", body: bz},
+		{name: "1_foobar.up.sql.zst", body: zst},
+	}
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			body := &closeRecorder{Reader: bytes.NewReader(tc.body)}
+			r, err := Decompress(tc.name, body)
+			if err != nil {
+				t.Fatal(err)
+			}
+			b, err := io.ReadAll(r)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(b) != "1 up" {
+				t.Errorf("expected %q, got %q", "1 up", b)
+			}
+			if err := r.Close(); err != nil {
+				t.Fatal(err)
+			}
+			if !body.closed {
+				t.Error("expected the body to be closed")
+			}
+		})
+	}
+}
+
+func TestDecompressInvalid(t *testing.T) {
+	body := &closeRecorder{Reader: bytes.NewReader([]byte("not gzip"))}
+	if _, err := Decompress("1_foobar.up.sql.gz", body); err == nil {
+		t.Error("expected an error")
+	}
+	if !body.closed {
+		t.Error("expected the body to be closed")
+	}
+}
@@ -2,6 +2,7 @@ package url
 
 import (
 	"errors"
+	nurl "net/url"
 	"strings"
 )
 
@@ -23,3 +24,16 @@ func SchemeFromURL(url string) (string, error) {
 
 	return url[0:i], nil
 }
+
+// FilterCustomQuery filters all query values starting with `x-`
+func FilterCustomQuery(u *nurl.URL) *nurl.URL {
+	ux := *u
+	vx := make(nurl.Values)
+	for k, v := range ux.Query() {
+		if len(k) <= 1 || k[0:2] != "x-" {
+			vx[k] = v
+		}
+	}
+	ux.RawQuery = vx.Encode()
+	return &ux
+}
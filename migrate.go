@@ -5,10 +5,16 @@
 package migrate
 
 import (
+	"bytes"
+	"context"
+	"encoding/json"
 	"errors"
 	"fmt"
+	"io"
 	"os"
+	"sort"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/hashicorp/go-multierror"
@@ -28,12 +34,25 @@ var DefaultPrefetchMigrations = uint(10)
 // DefaultLockTimeout sets the max time a database driver has to acquire a lock.
 var DefaultLockTimeout = 15 * time.Second
 
+// DefaultMaxConcurrentDBCalls sets the number of calls to the database
+// driver that may run at once, see Migrate.MaxConcurrentDBCalls.
+var DefaultMaxConcurrentDBCalls = 2
+
 var (
 	ErrNoChange       = errors.New("no change")
 	ErrNilVersion     = errors.New("no migration")
 	ErrInvalidVersion = errors.New("version must be >= -1")
 	ErrLocked         = errors.New("database locked")
 	ErrLockTimeout    = errors.New("timeout: can't acquire database lock")
+
+	ErrDropOptionsNotSupported = errors.New("database driver does not support drop options")
+	ErrDropListNotSupported    = errors.New("database driver does not support listing the tables to drop")
+	ErrDescribeNotSupported    = errors.New("database driver does not support describe")
+	ErrBatchNotSupported       = errors.New("database driver does not support batches")
+	ErrNoDownMigration         = errors.New("no down migration for the current version")
+	ErrLockDisabled            = database.ErrLockDisabled
+	ErrReadOnly                = errors.New("migrate is in verify only mode")
+	ErrTimeoutNotSupported     = errors.New("database driver does not support migration timeouts")
 )
 
 // ErrShortLimit is an error returned when not enough migrations
@@ -49,12 +68,142 @@ func (e ErrShortLimit) Error() string {
 
 type ErrDirty struct {
 	Version int
+	// Identifier is the identifier of the migration of Version in the
+	// source, if found.
+	Identifier string
+
+	// missing is true if the source has no migration for Version.
+	missing bool
 }
 
 func (e ErrDirty) Error() string {
+	switch {
+	case e.missing:
+		return fmt.Sprintf("Dirty database version %v, which has no migration in the source. Fix and force version.", e.Version)
+	case e.Identifier != "":
+		return fmt.Sprintf("Dirty database version %v (%v). Fix and force version.", e.Version, e.Identifier)
+	}
 	return fmt.Sprintf("Dirty database version %v. Fix and force version.", e.Version)
 }
 
+// Is reports whether target is an ErrDirty of the same version, whatever
+// its identifier.
+func (e ErrDirty) Is(target error) bool {
+	t, ok := target.(ErrDirty)
+	return ok && t.Version == e.Version
+}
+
+// ErrAlreadyVersioned is returned by Baseline if the database already has
+// a version.
+type ErrAlreadyVersioned struct {
+	Version int
+}
+
+func (e ErrAlreadyVersioned) Error() string {
+	return fmt.Sprintf("database already has version %v, baseline only a database without version", e.Version)
+}
+
+// ErrEmptyMigration is returned if ErrorOnEmpty is set and an up migration
+// has no statements.
+type ErrEmptyMigration struct {
+	Version    uint
+	Identifier string
+}
+
+func (e ErrEmptyMigration) Error() string {
+	return fmt.Sprintf("up migration %v (%v) is empty, add %q to apply it anyway", e.Version, e.Identifier, EmptyMigrationMarker)
+}
+
+// ErrInvalidMigration is returned when the database driver rejects a
+// migration before running it, see database.MigrationValidator. The database
+// is left clean.
+type ErrInvalidMigration struct {
+	Version    uint
+	Identifier string
+	Err        error
+}
+
+// Error implements the error interface.
+func (e ErrInvalidMigration) Error() string {
+	return fmt.Sprintf("migration %v (%v) is invalid: %v", e.Version, e.Identifier, e.Err)
+}
+
+// Unwrap returns the validation error.
+func (e ErrInvalidMigration) Unwrap() error {
+	return e.Err
+}
+
+// ErrMigrationConflict is returned when another migrate instance applied
+// migrations while this one was waiting for the lock. Nothing is run and the
+// database is left clean, so it can be handled like ErrNoChange.
+type ErrMigrationConflict struct {
+	AtVersion uint
+}
+
+// Error implements the error interface.
+func (e ErrMigrationConflict) Error() string {
+	return fmt.Sprintf("migration %v was already applied by another instance", e.AtVersion)
+}
+
+// CloseError is returned by CloseAll when closing the source,
+// the database or both failed.
+type CloseError struct {
+	Source   error
+	Database error
+}
+
+// Error implements the error interface.
+func (e CloseError) Error() string {
+	switch {
+	case e.Source != nil && e.Database != nil:
+		return fmt.Sprintf("failed to close source: %v and database: %v", e.Source, e.Database)
+	case e.Source != nil:
+		return fmt.Sprintf("failed to close source: %v", e.Source)
+	default:
+		return fmt.Sprintf("failed to close database: %v", e.Database)
+	}
+}
+
+// Unwrap returns the non-nil source and database close errors.
+func (e CloseError) Unwrap() []error {
+	errs := make([]error, 0, 2)
+	if e.Source != nil {
+		errs = append(errs, e.Source)
+	}
+	if e.Database != nil {
+		errs = append(errs, e.Database)
+	}
+	return errs
+}
+
+// MigrationStatus describes the outcome of a single migration.
+type MigrationStatus string
+
+const (
+	MigrationApplied MigrationStatus = "applied"
+	MigrationFailed  MigrationStatus = "failed"
+	MigrationSkipped MigrationStatus = "skipped"
+)
+
+// MigrationResult holds the outcome of a single attempted migration.
+type MigrationResult struct {
+	// Identifier is the identifier of the migration in the source.
+	Identifier string
+
+	// Version is the version of the migration.
+	Version uint
+
+	// TargetVersion is the version the database is at after the migration.
+	TargetVersion int
+
+	// Status is either MigrationApplied, MigrationFailed or MigrationSkipped.
+	Status MigrationStatus
+
+	// Err holds the error if Status is MigrationFailed, or the
+	// ErrInvalidMigration the migration was skipped with.
+	Err error
+}
+
 type Migrate struct {
 	sourceName   string
 	sourceDrv    source.Driver
@@ -66,26 +215,116 @@ type Migrate struct {
 
 	// GracefulStop accepts `true` and will stop executing migrations
 	// as soon as possible at a safe break point, so that the database
-	// is not corrupted.
+	// is not corrupted. It has a capacity of 1, so prefer Cancel, which
+	// doesn't block if a stop was already requested.
 	GracefulStop chan bool
 	isLockedMu   *sync.Mutex
 
-	isGracefulStop bool
+	isGracefulStop atomic.Bool // read by the reading and the running goroutine
 	isLocked       bool
 
 	// PrefetchMigrations defaults to DefaultPrefetchMigrations,
-	// but can be set per Migrate instance.
+	// but can be set per Migrate instance. With 0, migrations are not
+	// read in advance and each body is streamed to the database driver
+	// without being buffered, keeping memory usage flat for large
+	// migrations.
 	PrefetchMigrations uint
 
 	// LockTimeout defaults to DefaultLockTimeout,
 	// but can be set per Migrate instance.
 	LockTimeout time.Duration
+
+	// MaxConcurrentDBCalls limits the calls to Run, SetVersion, Lock and
+	// Unlock of the database driver running at once, for databases with
+	// strict connection limits. It defaults to DefaultMaxConcurrentDBCalls,
+	// which is the minimum needed for one lock and one migration. 1 is
+	// valid if the driver takes its lock sequentially, i.e. doesn't hold a
+	// call open while locked. A Lock call that timed out no longer counts,
+	// even if it keeps running. Values below 1 don't limit the calls. It
+	// must not be changed after the first call.
+	MaxConcurrentDBCalls int
+	dbCallsOnce          sync.Once
+	dbCalls              chan struct{}
+
+	// BeforeEach, if set, is called before each migration is run, while
+	// the database is locked. A non-nil error aborts migrating before the
+	// migration runs and is returned. The migration body must not be read.
+	BeforeEach func(migr *Migration) error
+
+	// AfterEach, if set, is called after each migration was run, while
+	// the database is locked, with the error of the migration if it
+	// failed. A non-nil error stops migrating after a successful migration
+	// and is returned; the error of a failed migration takes precedence.
+	AfterEach func(migr *Migration, err error) error
+
+	// ErrorOnEmpty, if set, fails up migrations whose body is empty or only
+	// holds whitespace and -- comments with ErrEmptyMigration, unless the
+	// body contains EmptyMigrationMarker. The up bodies are then read into
+	// memory before they are run.
+	ErrorOnEmpty bool
+
+	// ForcePreviousOnError, if set, forces the clean version before a
+	// failed migration, instead of leaving the database dirty at the
+	// version of the failed migration. The error of the migration is still
+	// returned. Only use it if failed migrations leave no partial changes,
+	// e.g. with transactional DDL.
+	ForcePreviousOnError bool
+
+	// RetryUp, if set, retries Up after an error the database driver
+	// reports as transient with database.Retryable, like a serialization
+	// failure of CockroachDB, waiting for the backoff of the driver. Up is
+	// not retried after a migration body started to run, even if it was
+	// forced clean with ForcePreviousOnError, so that no migration is
+	// partially applied twice.
+	RetryUp bool
+	// bodyRan is set from the start of a migration body until the
+	// migration is clean, see RetryUp.
+	bodyRan atomic.Bool
+
+	// VerifyOnly, if set, makes every call changing the database, like Up,
+	// Force or Drop, return ErrReadOnly before the database is locked, for
+	// verification jobs with read-only database access. Reading calls like
+	// Version and Health still work.
+	VerifyOnly bool
+
+	// ctx is set with WithContext and defaults to context.Background().
+	ctx context.Context
+	// forwardCtx is set with WithContext to pass ctx to the database driver.
+	forwardCtx bool
+}
+
+// Option configures a Migrate instance when it is created.
+type Option func(*Migrate)
+
+// WithContext makes migrations stop when ctx is done, like with
+// GracefulStop, at a safe break point after the running migration. The
+// migrating method then returns ctx.Err(). Acquiring the database lock is
+// aborted when ctx is done.
+//
+// ctx is also passed to the database driver if it implements
+// database.ContextRunner, database.ContextLocker or
+// database.ContextVersionSetter, so that a running migration is interrupted
+// too, leaving the database dirty.
+func WithContext(ctx context.Context) Option {
+	return func(m *Migrate) {
+		m.ctx = ctx
+		m.forwardCtx = true
+	}
+}
+
+// WithLogger sets Log when creating the instance, so that the database
+// driver can log while it is opened, e.g. the retries of x-connect-retries,
+// if it implements database.LoggingOpener.
+func WithLogger(l Logger) Option {
+	return func(m *Migrate) {
+		m.Log = l
+	}
 }
 
 // New returns a new Migrate instance from a source URL and a database URL.
 // The URL scheme is defined by each driver.
-func New(sourceURL, databaseURL string) (*Migrate, error) {
-	m := newCommon()
+func New(sourceURL, databaseURL string, opts ...Option) (*Migrate, error) {
+	m := newCommon(opts...)
 
 	sourceName, err := iurl.SchemeFromURL(sourceURL)
 	if err != nil {
@@ -105,7 +344,7 @@ func New(sourceURL, databaseURL string) (*Migrate, error) {
 	}
 	m.sourceDrv = sourceDrv
 
-	databaseDrv, err := database.Open(databaseURL)
+	databaseDrv, err := m.openDatabase(databaseURL)
 	if err != nil {
 		return nil, fmt.Errorf("failed to open database: %w", err)
 	}
@@ -118,8 +357,8 @@ func New(sourceURL, databaseURL string) (*Migrate, error) {
 // and an existing database instance. The source URL scheme is defined by each driver.
 // Use any string that can serve as an identifier during logging as databaseName.
 // You are responsible for closing the underlying database client if necessary.
-func NewWithDatabaseInstance(sourceURL string, databaseName string, databaseInstance database.Driver) (*Migrate, error) {
-	m := newCommon()
+func NewWithDatabaseInstance(sourceURL string, databaseName string, databaseInstance database.Driver, opts ...Option) (*Migrate, error) {
+	m := newCommon(opts...)
 
 	sourceName, err := iurl.SchemeFromURL(sourceURL)
 	if err != nil {
@@ -144,8 +383,8 @@ func NewWithDatabaseInstance(sourceURL string, databaseName string, databaseInst
 // and a database URL. The database URL scheme is defined by each driver.
 // Use any string that can serve as an identifier during logging as sourceName.
 // You are responsible for closing the underlying source client if necessary.
-func NewWithSourceInstance(sourceName string, sourceInstance source.Driver, databaseURL string) (*Migrate, error) {
-	m := newCommon()
+func NewWithSourceInstance(sourceName string, sourceInstance source.Driver, databaseURL string, opts ...Option) (*Migrate, error) {
+	m := newCommon(opts...)
 
 	databaseName, err := iurl.SchemeFromURL(databaseURL)
 	if err != nil {
@@ -155,7 +394,7 @@ func NewWithSourceInstance(sourceName string, sourceInstance source.Driver, data
 
 	m.sourceName = sourceName
 
-	databaseDrv, err := database.Open(databaseURL)
+	databaseDrv, err := m.openDatabase(databaseURL)
 	if err != nil {
 		return nil, fmt.Errorf("failed to open database: %w", err)
 	}
@@ -170,8 +409,8 @@ func NewWithSourceInstance(sourceName string, sourceInstance source.Driver, data
 // database instance. Use any string that can serve as an identifier during logging
 // as sourceName and databaseName. You are responsible for closing down
 // the underlying source and database client if necessary.
-func NewWithInstance(sourceName string, sourceInstance source.Driver, databaseName string, databaseInstance database.Driver) (*Migrate, error) {
-	m := newCommon()
+func NewWithInstance(sourceName string, sourceInstance source.Driver, databaseName string, databaseInstance database.Driver, opts ...Option) (*Migrate, error) {
+	m := newCommon(opts...)
 
 	m.sourceName = sourceName
 	m.databaseName = databaseName
@@ -182,13 +421,27 @@ func NewWithInstance(sourceName string, sourceInstance source.Driver, databaseNa
 	return m, nil
 }
 
-func newCommon() *Migrate {
-	return &Migrate{
-		GracefulStop:       make(chan bool, 1),
-		PrefetchMigrations: DefaultPrefetchMigrations,
-		LockTimeout:        DefaultLockTimeout,
-		isLockedMu:         &sync.Mutex{},
+// openDatabase opens databaseURL, logging to Log while opening if set.
+func (m *Migrate) openDatabase(databaseURL string) (database.Driver, error) {
+	if m.Log == nil {
+		return database.Open(databaseURL)
 	}
+	return database.OpenWithLogger(databaseURL, m.Log)
+}
+
+func newCommon(opts ...Option) *Migrate {
+	m := &Migrate{
+		GracefulStop:         make(chan bool, 1),
+		PrefetchMigrations:   DefaultPrefetchMigrations,
+		LockTimeout:          DefaultLockTimeout,
+		MaxConcurrentDBCalls: DefaultMaxConcurrentDBCalls,
+		isLockedMu:           &sync.Mutex{},
+		ctx:                  context.Background(),
+	}
+	for _, opt := range opts {
+		opt(m)
+	}
+	return m
 }
 
 // Close closes the source and the database.
@@ -209,6 +462,41 @@ func (m *Migrate) Close() (source error, database error) {
 	return <-sourceSrvClose, <-databaseSrvClose
 }
 
+// CloseAll closes the source and the database like Close, but returns
+// a single error. If either side failed to close, the returned error is a
+// CloseError holding both results.
+func (m *Migrate) CloseAll() error {
+	sourceErr, databaseErr := m.Close()
+	if sourceErr == nil && databaseErr == nil {
+		return nil
+	}
+	return CloseError{Source: sourceErr, Database: databaseErr}
+}
+
+// Cancel requests a graceful stop: running migrations stop as soon as
+// possible at a safe break point, like after sending `true` on GracefulStop.
+// It doesn't block and does nothing if a stop was already requested.
+func (m *Migrate) Cancel() {
+	select {
+	case m.GracefulStop <- true:
+	default:
+	}
+}
+
+// Reset clears a stop requested with Cancel or GracefulStop, so that m can
+// run migrations again after a cancelled operation.
+//
+// Reset is not safe to call while migrations are running, as the stop may
+// be cleared before it is seen. Creating a new Migrate instance is the
+// safest way to start over.
+func (m *Migrate) Reset() {
+	select {
+	case <-m.GracefulStop:
+	default:
+	}
+	m.isGracefulStop.Store(false)
+}
+
 // Migrate looks at the currently active migration version,
 // then migrates either up or down to the specified version.
 func (m *Migrate) Migrate(version uint) error {
@@ -222,13 +510,13 @@ func (m *Migrate) Migrate(version uint) error {
 	}
 
 	if dirty {
-		return m.unlockErr(ErrDirty{curVersion})
+		return m.unlockErr(m.errDirty(curVersion))
 	}
 
 	ret := make(chan interface{}, m.PrefetchMigrations)
-	go m.read(curVersion, int(version), ret)
+	go m.read(m.ctx, curVersion, int(version), ret)
 
-	return m.unlockErr(m.runMigrations(ret))
+	return m.unlockErr(m.runMigrations(ret, curVersion))
 }
 
 // Steps looks at the currently active migration version.
@@ -238,6 +526,63 @@ func (m *Migrate) Steps(n int) error {
 		return ErrNoChange
 	}
 
+	curVersion, err := m.lockPlanned()
+	if err != nil {
+		return err
+	}
+
+	ret := make(chan interface{}, m.PrefetchMigrations)
+
+	if n > 0 {
+		go m.readUp(curVersion, n, ret)
+	} else {
+		go m.readDown(curVersion, -n, ret)
+	}
+
+	return m.unlockErr(m.runMigrations(ret, curVersion))
+}
+
+// MigrateRange applies the migrations from version from to version to, both
+// included, regardless of the current version of the database: the up
+// migrations if from <= to, otherwise the down migrations. For instance,
+// MigrateRange(ctx, 5, 8) applies the up migrations 5 to 8 again after a
+// schema reset, and sets the version to 8. The whole range is applied even
+// if some of its migrations are already applied, including from when it is
+// the current version. Both versions must exist in the source, otherwise an
+// error wrapping os.ErrNotExist is returned before any migration is run.
+// Like the other migrating methods, it locks the database, refuses to run if
+// it is dirty, and marks every migration dirty while it runs. If ctx is done,
+// no further migration is started and ctx.Err() is returned once the running
+// one finished.
+func (m *Migrate) MigrateRange(ctx context.Context, from, to uint) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	idx, err := m.sourceIndex()
+	if err != nil {
+		return err
+	}
+	for _, version := range []uint{from, to} {
+		if err := m.versionExists(idx, version); err != nil {
+			return err
+		}
+	}
+
+	// read from the version before the range going up, and down to the
+	// version before it, so that both ends of the range are applied
+	var start, target int
+	if from <= to {
+		start, err = m.versionBefore(idx, from)
+		target = int(to)
+	} else {
+		start = int(from)
+		target, err = m.versionBefore(idx, to)
+	}
+	if err != nil {
+		return err
+	}
+
 	if err := m.lock(); err != nil {
 		return err
 	}
@@ -246,25 +591,26 @@ func (m *Migrate) Steps(n int) error {
 	if err != nil {
 		return m.unlockErr(err)
 	}
-
 	if dirty {
-		return m.unlockErr(ErrDirty{curVersion})
+		return m.unlockErr(m.errDirty(curVersion))
 	}
 
 	ret := make(chan interface{}, m.PrefetchMigrations)
+	go m.read(ctx, start, target, ret)
 
-	if n > 0 {
-		go m.readUp(curVersion, n, ret)
-	} else {
-		go m.readDown(curVersion, -n, ret)
-	}
-
-	return m.unlockErr(m.runMigrations(ret))
+	return m.unlockErr(m.runMigrationsReport(ctx, ret, curVersion, nil))
 }
 
-// Up looks at the currently active migration version
-// and will migrate all the way up (applying all up migrations).
-func (m *Migrate) Up() error {
+// Redo rolls back the current migration and applies it again, holding the
+// lock in between. It returns ErrNilVersion if no migration was applied and
+// ErrNoDownMigration if the source has no down migration for the current
+// version. If ctx is done after rolling back, the migration is not applied
+// again and ctx.Err() is returned.
+func (m *Migrate) Redo(ctx context.Context) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
 	if err := m.lock(); err != nil {
 		return err
 	}
@@ -273,20 +619,138 @@ func (m *Migrate) Up() error {
 	if err != nil {
 		return m.unlockErr(err)
 	}
-
 	if dirty {
-		return m.unlockErr(ErrDirty{curVersion})
+		return m.unlockErr(m.errDirty(curVersion))
+	}
+	if curVersion == database.NilVersion {
+		return m.unlockErr(ErrNilVersion)
+	}
+
+	down, _, err := m.sourceDrv.ReadDown(suint(curVersion))
+	if errors.Is(err, os.ErrNotExist) {
+		return m.unlockErr(ErrNoDownMigration)
+	} else if err != nil {
+		return m.unlockErr(err)
+	}
+	if err := down.Close(); err != nil {
+		return m.unlockErr(err)
 	}
 
 	ret := make(chan interface{}, m.PrefetchMigrations)
+	go m.readDown(curVersion, 1, ret)
+	if err := m.runMigrations(ret, curVersion); err != nil {
+		return m.unlockErr(err)
+	}
+
+	if err := ctx.Err(); err != nil {
+		return m.unlockErr(err)
+	}
+
+	prevVersion, _, err := m.databaseDrv.Version()
+	if err != nil {
+		return m.unlockErr(err)
+	}
+	ret = make(chan interface{}, m.PrefetchMigrations)
+	go m.readUp(prevVersion, 1, ret)
+	if err := m.runMigrations(ret, prevVersion); err != nil {
+		return m.unlockErr(err)
+	}
+
+	newVersion, dirty, err := m.databaseDrv.Version()
+	if err != nil {
+		return m.unlockErr(err)
+	}
+	if newVersion != curVersion || dirty {
+		return m.unlockErr(fmt.Errorf("redo ended at version %v (dirty: %v), expected %v", newVersion, dirty, curVersion))
+	}
+	return m.unlock()
+}
+
+// Rebuild applies all down migrations, then all up migrations, holding the
+// lock in between so no other migration runs in the meantime, e.g. to
+// rebuild the schema of a development database. If no migration was
+// applied, it only applies the up migrations. Reset is unrelated, it clears
+// a stop requested with Cancel.
+func (m *Migrate) Rebuild() error {
+	curVersion, err := m.lockPlanned()
+	if err != nil {
+		return err
+	}
+
+	if curVersion != database.NilVersion {
+		ret := make(chan interface{}, m.PrefetchMigrations)
+		go m.readDown(curVersion, -1, ret)
+		if err := m.runMigrations(ret, curVersion); err != nil {
+			return m.unlockErr(err)
+		}
+		// stopped with GracefulStop
+		if m.stop() {
+			return m.unlock()
+		}
+
+		var dirty bool
+		if curVersion, dirty, err = m.databaseDrv.Version(); err != nil {
+			return m.unlockErr(err)
+		}
+		if dirty {
+			return m.unlockErr(m.errDirty(curVersion))
+		}
+	}
 
+	ret := make(chan interface{}, m.PrefetchMigrations)
 	go m.readUp(curVersion, -1, ret)
-	return m.unlockErr(m.runMigrations(ret))
+	return m.unlockErr(m.runMigrations(ret, curVersion))
 }
 
-// Down looks at the currently active migration version
-// and will migrate all the way down (applying all down migrations).
-func (m *Migrate) Down() error {
+// CheckpointToken records the database version at the time of Checkpoint.
+// It can be marshalled to JSON and stored, e.g. by a CI/CD system, to
+// Restore the version from another process after a failed deployment.
+type CheckpointToken struct {
+	// Version is database.NilVersion if no migration was applied.
+	Version   int       `json:"version"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// Checkpoint returns a token recording the current version of the database,
+// for rolling back to it with Restore. It returns ErrDirty if the database
+// is dirty.
+func (m *Migrate) Checkpoint(ctx context.Context) (CheckpointToken, error) {
+	if err := ctx.Err(); err != nil {
+		return CheckpointToken{}, err
+	}
+
+	curVersion, dirty, err := m.databaseDrv.Version()
+	if err != nil {
+		return CheckpointToken{}, err
+	}
+	if dirty {
+		return CheckpointToken{}, m.errDirty(curVersion)
+	}
+	return CheckpointToken{Version: curVersion, CreatedAt: time.Now().UTC()}, nil
+}
+
+// Restore migrates up or down to the version recorded by Checkpoint. The
+// version must still exist in the source, otherwise an error wrapping
+// os.ErrNotExist is returned before any migration is run. Like Migrate, it
+// returns ErrNoChange if the database is already at the version.
+func (m *Migrate) Restore(ctx context.Context, token CheckpointToken) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	if token.Version < database.NilVersion {
+		return ErrInvalidVersion
+	}
+
+	if token.Version != database.NilVersion {
+		idx, err := m.sourceIndex()
+		if err != nil {
+			return err
+		}
+		if err := m.versionExists(idx, suint(token.Version)); err != nil {
+			return fmt.Errorf("checkpoint: %w", err)
+		}
+	}
+
 	if err := m.lock(); err != nil {
 		return err
 	}
@@ -295,33 +759,261 @@ func (m *Migrate) Down() error {
 	if err != nil {
 		return m.unlockErr(err)
 	}
+	if dirty {
+		return m.unlockErr(m.errDirty(curVersion))
+	}
+
+	ret := make(chan interface{}, m.PrefetchMigrations)
+	go m.read(m.ctx, curVersion, token.Version, ret)
+
+	return m.unlockErr(m.runMigrations(ret, curVersion))
+}
+
+// Up looks at the currently active migration version
+// and will migrate all the way up (applying all up migrations).
+func (m *Migrate) Up() error {
+	r, ok := m.databaseDrv.(database.Retryable)
+	if !m.RetryUp || !ok {
+		return m.up()
+	}
+
+	for attempt := 1; ; attempt++ {
+		err := m.up()
+		if err == nil || m.bodyRan.Load() || !r.IsRetryable(err) {
+			return err
+		}
+		backoff, ok := r.RetryBackoff(attempt)
+		if !ok {
+			return err
+		}
+		m.logPrintf("Retrying up in %v after: %v\n", backoff, err)
+		select {
+		case <-time.After(backoff):
+		case <-m.ctx.Done():
+			return err
+		}
+	}
+}
+
+// up applies all up migrations once, see Up.
+func (m *Migrate) up() error {
+	m.bodyRan.Store(false)
+	curVersion, err := m.lockPlanned()
+	if err != nil {
+		return err
+	}
 
+	ret := make(chan interface{}, m.PrefetchMigrations)
+
+	go m.readUp(curVersion, -1, ret)
+	return m.unlockErr(m.runMigrations(ret, curVersion))
+}
+
+// UpDry writes the migrations Up would apply to w, each preceded by a
+// "-- Migration <version>: <identifier>" line, without running them. Up
+// migrations missing in the source only get the line. It doesn't lock the
+// database. Like Up, it returns ErrNoChange if there are no migrations to
+// apply and ErrDirty if the database is dirty.
+func (m *Migrate) UpDry(ctx context.Context, w io.Writer) error {
+	curVersion, dirty, err := m.databaseDrv.Version()
+	if err != nil {
+		return err
+	}
 	if dirty {
-		return m.unlockErr(ErrDirty{curVersion})
+		return m.errDirty(curVersion)
+	}
+
+	ret := make(chan interface{}, m.PrefetchMigrations)
+	go m.readUp(curVersion, -1, ret)
+
+	// read all of ret, even after an error, so readUp can return
+	var dryErr error
+	for r := range ret {
+		switch r := r.(type) {
+		case error:
+			if dryErr == nil {
+				dryErr = r
+			}
+		case *Migration:
+			if dryErr == nil {
+				dryErr = ctx.Err()
+			}
+			if dryErr == nil {
+				dryErr = m.writeMigration(w, r)
+			} else if r.Body != nil {
+				if err := discardMigration(r, m.PrefetchMigrations > 0); err != nil {
+					m.logErr(err)
+				}
+			}
+		}
+	}
+	return dryErr
+}
+
+// writeMigration writes a header line and the body of migr to w, followed
+// by a newline in case the body doesn't end with one.
+func (m *Migrate) writeMigration(w io.Writer, migr *Migration) error {
+	if _, err := fmt.Fprintf(w, "-- Migration %v: %v\n", migr.Version, migr.Identifier); err != nil {
+		if migr.Body != nil {
+			if derr := discardMigration(migr, m.PrefetchMigrations > 0); derr != nil {
+				m.logErr(derr)
+			}
+		}
+		return err
+	}
+	if migr.Body == nil {
+		return nil
+	}
+
+	var err error
+	if m.PrefetchMigrations > 0 {
+		if _, err = io.Copy(w, migr.BufferedBody); err != nil {
+			// drain the buffer, so the buffering goroutine returns
+			if _, derr := io.Copy(io.Discard, migr.BufferedBody); derr != nil {
+				m.logErr(derr)
+			}
+		}
+	} else {
+		err = migr.stream(func(r io.Reader) error {
+			_, err := io.Copy(w, r)
+			return err
+		})
+	}
+	if err != nil {
+		return err
+	}
+	_, err = io.WriteString(w, "\n")
+	return err
+}
+
+// UpResult works like Up, but additionally returns the outcome of every
+// migration that was attempted. If a migration fails, it is the last entry
+// of the result and carries the error. Migrations that were queued but not
+// run because of a stop signal on GracefulStop are reported as skipped.
+func (m *Migrate) UpResult() ([]MigrationResult, error) {
+	results := make([]MigrationResult, 0)
+
+	curVersion, err := m.lockPlanned()
+	if err != nil {
+		return results, err
+	}
+
+	ret := make(chan interface{}, m.PrefetchMigrations)
+
+	go m.readUp(curVersion, -1, ret)
+	err = m.runMigrationsReport(m.ctx, ret, curVersion, func(migr *Migration, status MigrationStatus, err error) {
+		results = append(results, MigrationResult{
+			Identifier:    migr.Identifier,
+			Version:       migr.Version,
+			TargetVersion: migr.TargetVersion,
+			Status:        status,
+			Err:           err,
+		})
+	})
+	return results, m.unlockErr(err)
+}
+
+// Down looks at the currently active migration version
+// and will migrate all the way down (applying all down migrations).
+func (m *Migrate) Down() error {
+	curVersion, err := m.lockPlanned()
+	if err != nil {
+		return err
 	}
 
 	ret := make(chan interface{}, m.PrefetchMigrations)
 	go m.readDown(curVersion, -1, ret)
-	return m.unlockErr(m.runMigrations(ret))
+	return m.unlockErr(m.runMigrations(ret, curVersion))
 }
 
-// Drop deletes everything in the database.
+// Drop deletes everything in the database. In verbose mode, the tables are
+// logged before they are dropped if the database driver implements
+// database.DropLister.
 func (m *Migrate) Drop() error {
 	if err := m.lock(); err != nil {
 		return err
 	}
+	if err := m.logDropList(m.ctx, DropOptions{}); err != nil {
+		return m.unlockErr(err)
+	}
 	if err := m.databaseDrv.Drop(); err != nil {
 		return m.unlockErr(err)
 	}
 	return m.unlock()
 }
 
-// Run runs any migration provided by you against the database.
-// It does not check any currently active version in database.
-// Usually you don't need this function at all. Use Migrate,
-// Steps, Up or Down instead.
-func (m *Migrate) Run(migration ...*Migration) error {
-	if len(migration) == 0 {
+// DropOptions configures DropWithOptions.
+type DropOptions = database.DropOptions
+
+// DropWithOptions deletes everything in the database like Drop, but
+// respects the given DropOptions. If the database driver doesn't implement
+// database.DropOptionsDriver, only the zero DropOptions are supported and
+// ErrDropOptionsNotSupported is returned otherwise.
+func (m *Migrate) DropWithOptions(ctx context.Context, opts DropOptions) error {
+	if err := m.lock(); err != nil {
+		return err
+	}
+	if err := m.logDropList(ctx, opts); err != nil {
+		return m.unlockErr(err)
+	}
+
+	var err error
+	if d, ok := m.databaseDrv.(database.DropOptionsDriver); ok {
+		err = d.DropWithOptions(ctx, opts)
+	} else if opts != (DropOptions{}) {
+		err = ErrDropOptionsNotSupported
+	} else {
+		err = m.databaseDrv.Drop()
+	}
+	if err != nil {
+		return m.unlockErr(err)
+	}
+	return m.unlock()
+}
+
+// DropDryRun returns the tables DropWithOptions would delete with opts,
+// without deleting them or locking the database. ErrDropListNotSupported is
+// returned if the database driver doesn't implement database.DropLister.
+func (m *Migrate) DropDryRun(ctx context.Context, opts DropOptions) ([]string, error) {
+	d, ok := m.databaseDrv.(database.DropLister)
+	if !ok {
+		return nil, ErrDropListNotSupported
+	}
+	return d.DropList(ctx, opts)
+}
+
+// logDropList logs the tables a drop with opts deletes in verbose mode, so
+// that a drop resumed after an interruption shows what was left.
+func (m *Migrate) logDropList(ctx context.Context, opts DropOptions) error {
+	if m.Log == nil || !m.Log.Verbose() {
+		return nil
+	}
+	d, ok := m.databaseDrv.(database.DropLister)
+	if !ok {
+		return nil
+	}
+	tables, err := d.DropList(ctx, opts)
+	if err != nil {
+		return err
+	}
+	for _, table := range tables {
+		m.logVerbosePrintf("Dropping table %v\n", table)
+	}
+	return nil
+}
+
+// RunBatch runs the migrations of batch in order against the database, all
+// or none, like in a single transaction. The version is then set to the
+// highest version in the batch. Like Run, it does not check the currently
+// active version, only that the database is not dirty.
+// ErrBatchNotSupported is returned if the database driver doesn't implement
+// database.BatchDriver.
+func (m *Migrate) RunBatch(ctx context.Context, batch Batch) error {
+	d, ok := m.databaseDrv.(database.BatchDriver)
+	if !ok {
+		return ErrBatchNotSupported
+	}
+	if len(batch) == 0 {
 		return ErrNoChange
 	}
 
@@ -333,9 +1025,48 @@ func (m *Migrate) Run(migration ...*Migration) error {
 	if err != nil {
 		return m.unlockErr(err)
 	}
-
 	if dirty {
-		return m.unlockErr(ErrDirty{curVersion})
+		return m.unlockErr(m.errDirty(curVersion))
+	}
+
+	version := batch.Version()
+	bodies := make([]io.Reader, 0, len(batch))
+	for _, migr := range batch {
+		m.logVerbosePrintf("Batched %v\n", migr.LogString())
+		if migr.Body != nil {
+			bodies = append(bodies, migr.Body)
+		}
+	}
+
+	start := time.Now()
+	err = d.RunBatch(ctx, bodies, int(version))
+	for _, migr := range batch {
+		if migr.Body != nil {
+			if closeErr := migr.Body.Close(); closeErr != nil {
+				m.logErr(closeErr)
+			}
+		}
+	}
+	if err != nil {
+		return m.unlockErr(err)
+	}
+	m.logPrintf("Applied batch of %v migrations up to %v (%v)\n", len(batch), version, time.Since(start))
+
+	return m.unlock()
+}
+
+// Run runs any migration provided by you against the database.
+// It does not check any currently active version in database.
+// Usually you don't need this function at all. Use Migrate,
+// Steps, Up or Down instead.
+func (m *Migrate) Run(migration ...*Migration) error {
+	if len(migration) == 0 {
+		return ErrNoChange
+	}
+
+	curVersion, err := m.lockPlanned()
+	if err != nil {
+		return err
 	}
 
 	ret := make(chan interface{}, m.PrefetchMigrations)
@@ -349,16 +1080,11 @@ func (m *Migrate) Run(migration ...*Migration) error {
 				m.logVerbosePrintf("Scheduled %v\n", migr.LogString())
 			}
 
-			ret <- migr
-			go func(migr *Migration) {
-				if err := migr.Buffer(); err != nil {
-					m.logErr(err)
-				}
-			}(migr)
+			m.pushMigration(ret, migr)
 		}
 	}()
 
-	return m.unlockErr(m.runMigrations(ret))
+	return m.unlockErr(m.runMigrations(ret, curVersion))
 }
 
 // Force sets a migration version.
@@ -372,39 +1098,425 @@ func (m *Migrate) Force(version int) error {
 	if err := m.lock(); err != nil {
 		return err
 	}
-
-	if err := m.databaseDrv.SetVersion(version, false); err != nil {
-		return m.unlockErr(err)
+
+	if err := m.setVersion(m.ctx, version, false); err != nil {
+		return m.unlockErr(err)
+	}
+
+	return m.unlock()
+}
+
+// Baseline marks the migrations up to version as applied without running
+// them, for adopting migrate on an existing database. The version has to
+// exist in the source and the database must not have a version yet,
+// otherwise ErrAlreadyVersioned is returned. Unlike Force, the database is
+// left unchanged on errors.
+func (m *Migrate) Baseline(version uint) error {
+	if err := m.lock(); err != nil {
+		return err
+	}
+
+	curVersion, dirty, err := m.databaseDrv.Version()
+	if err != nil {
+		return m.unlockErr(err)
+	}
+	if dirty {
+		return m.unlockErr(m.errDirty(curVersion))
+	}
+	if curVersion != database.NilVersion {
+		return m.unlockErr(ErrAlreadyVersioned{curVersion})
+	}
+
+	if err := m.versionExists(nil, version); err != nil {
+		return m.unlockErr(err)
+	}
+
+	if err := m.setVersion(m.ctx, int(version), false); err != nil {
+		return m.unlockErr(err)
+	}
+	m.logPrintf("Baselined at version %v\n", version)
+
+	return m.unlock()
+}
+
+// Version returns the currently active migration version.
+// If no migration has been applied, yet, it will return ErrNilVersion.
+func (m *Migrate) Version() (version uint, dirty bool, err error) {
+	v, d, err := m.databaseDrv.Version()
+	if err != nil {
+		return 0, false, err
+	}
+
+	if v == database.NilVersion {
+		return 0, false, ErrNilVersion
+	}
+
+	return suint(v), d, nil
+}
+
+// VersionChange is sent by WatchVersion when the version or the dirty state
+// of the database changed. Versions are database.NilVersion if the database
+// has no version.
+type VersionChange struct {
+	OldVersion int
+	NewVersion int
+	Dirty      bool
+}
+
+// WatchVersion polls the version of the database every interval and sends
+// a VersionChange on the returned channel whenever it changed, e.g. when
+// migrations were applied by another process. The channel is closed when
+// ctx is done. Errors reading the version after the first one are logged
+// and polling goes on. The database driver must be safe for concurrent use
+// if migrations are run with the same instance while watching.
+func (m *Migrate) WatchVersion(ctx context.Context, interval time.Duration) (<-chan VersionChange, error) {
+	if interval <= 0 {
+		return nil, fmt.Errorf("watch interval must be positive, got %v", interval)
+	}
+	version, dirty, err := m.databaseDrv.Version()
+	if err != nil {
+		return nil, err
+	}
+
+	changes := make(chan VersionChange)
+	go func() {
+		defer close(changes)
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+
+			v, d, err := m.databaseDrv.Version()
+			if err != nil {
+				m.logErr(fmt.Errorf("watch version: %w", err))
+				continue
+			}
+			if v == version && d == dirty {
+				continue
+			}
+
+			select {
+			case changes <- VersionChange{OldVersion: version, NewVersion: v, Dirty: d}:
+				version, dirty = v, d
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+	return changes, nil
+}
+
+// PendingCount returns how many migrations are not applied yet, i.e. how
+// many migrations Up would run. It is 0 if all migrations are applied.
+// Like Up, it returns ErrDirty if the database is dirty.
+func (m *Migrate) PendingCount() (int, error) {
+	curVersion, dirty, err := m.databaseDrv.Version()
+	if err != nil {
+		return 0, err
+	}
+	if dirty {
+		return 0, m.errDirty(curVersion)
+	}
+	return m.pendingCount(curVersion)
+}
+
+// Diff is the difference between the migrations of the source and the
+// migrations applied to the database, see Migrate.Diff.
+type Diff struct {
+	// Pending are the versions of the source after the current version,
+	// in ascending order.
+	Pending []uint
+
+	// Orphans are the versions recorded as applied by the database but
+	// missing from the source, in ascending order. The current version is
+	// always checked, the versions applied before it only if HistoryChecked
+	// is true.
+	Orphans []uint
+
+	// HistoryChecked is true if the database driver implements
+	// database.HistoryDriver, so that its history was checked too. Most
+	// drivers, postgres included, keep a single row for the current version
+	// in their migrations table, so their history adds nothing to it.
+	HistoryChecked bool
+}
+
+// Diff compares the versions of the source with the current version and
+// the history of the database. Unlike PendingCount, it doesn't fail on a
+// dirty database or a current version missing from the source.
+func (m *Migrate) Diff() (Diff, error) {
+	var diff Diff
+	curVersion, _, err := m.databaseDrv.Version()
+	if err != nil {
+		return diff, err
+	}
+
+	idx, err := m.sourceIndex()
+	if err != nil {
+		return diff, err
+	}
+	versions, err := m.versions(idx)
+	if err != nil {
+		return diff, err
+	}
+	inSource := make(map[int]bool, len(versions))
+	for _, v := range versions {
+		inSource[int(v)] = true
+		if int(v) > curVersion {
+			diff.Pending = append(diff.Pending, v)
+		}
+	}
+
+	applied := []int{curVersion}
+	if h, ok := m.databaseDrv.(database.HistoryDriver); ok {
+		history, err := h.History()
+		if err != nil {
+			return diff, err
+		}
+		diff.HistoryChecked = true
+		for _, a := range history {
+			applied = append(applied, a.Version)
+		}
+	}
+	for _, v := range applied {
+		if v >= 0 && !inSource[v] {
+			inSource[v] = true // report each orphan once
+			diff.Orphans = append(diff.Orphans, suint(v))
+		}
+	}
+	sort.Slice(diff.Orphans, func(i, j int) bool { return diff.Orphans[i] < diff.Orphans[j] })
+	return diff, nil
+}
+
+// Health checks the database is reachable and the migrations table is
+// clean, without running any migrations. The database is pinged if the
+// driver implements database.Pinger. ErrDirty is returned if the current
+// version is dirty.
+func (m *Migrate) Health(ctx context.Context) error {
+	if p, ok := m.databaseDrv.(database.Pinger); ok {
+		if err := p.Ping(ctx); err != nil {
+			return err
+		}
+	}
+
+	v, dirty, err := m.databaseDrv.Version()
+	if err != nil {
+		return err
+	}
+	if dirty {
+		return m.errDirty(v)
+	}
+	return nil
+}
+
+// Capabilities returns the features supported by the database driver.
+// ok is false if the driver doesn't implement database.CapabilitiesDriver,
+// in which case nothing can be assumed about its capabilities.
+func (m *Migrate) Capabilities() (caps database.Capabilities, ok bool) {
+	if d, ok := m.databaseDrv.(database.CapabilitiesDriver); ok {
+		return d.Capabilities(), true
+	}
+	return database.Capabilities{}, false
+}
+
+// Describe returns the description of the database driver, or
+// ErrDescribeNotSupported if it doesn't implement database.Describer.
+func (m *Migrate) Describe() (database.DriverInfo, error) {
+	d, ok := m.databaseDrv.(database.Describer)
+	if !ok {
+		return database.DriverInfo{}, ErrDescribeNotSupported
+	}
+	return d.Describe()
+}
+
+// PlanStep is a migration Migrate would run, see Plan.
+type PlanStep struct {
+	Version    uint             `json:"version"`
+	Direction  source.Direction `json:"direction"`
+	Identifier string           `json:"identifier"`
+	// HasBody is false if the source has no migration of Version in
+	// Direction, in which case only the version is set.
+	HasBody bool `json:"hasBody"`
+}
+
+// Plan returns the migrations Migrate would run to migrate from the current
+// version to target, in order, without running them. Use -1 as target to
+// plan running all down migrations. The plan is empty if the database is
+// already at target. Like Migrate, it returns ErrDirty if the database is
+// dirty.
+func (m *Migrate) Plan(target int) ([]PlanStep, error) {
+	if target < -1 {
+		return nil, ErrInvalidVersion
+	}
+
+	curVersion, dirty, err := m.databaseDrv.Version()
+	if err != nil {
+		return nil, err
+	}
+	if dirty {
+		return nil, m.errDirty(curVersion)
+	}
+
+	ret := make(chan interface{}, m.PrefetchMigrations)
+	go m.read(m.ctx, curVersion, target, ret)
+
+	// read all of ret, even after an error, so read can return
+	plan := []PlanStep{}
+	var planErr error
+	for r := range ret {
+		switch r := r.(type) {
+		case error:
+			if planErr == nil && !errors.Is(r, ErrNoChange) {
+				planErr = r
+			}
+		case *Migration:
+			step := PlanStep{
+				Version:   r.Version,
+				Direction: source.Up,
+				HasBody:   r.Body != nil,
+			}
+			if r.TargetVersion < int(r.Version) {
+				step.Direction = source.Down
+			}
+			if step.HasBody {
+				step.Identifier = r.Identifier
+				if err := discardMigration(r, m.PrefetchMigrations > 0); err != nil && planErr == nil {
+					planErr = err
+				}
+			}
+			plan = append(plan, step)
+		}
+	}
+	if planErr != nil {
+		return nil, planErr
+	}
+	return plan, nil
+}
+
+// PlanJSON returns Plan as a JSON array of objects with the version,
+// direction, identifier and hasBody of each migration.
+func (m *Migrate) PlanJSON(target int) ([]byte, error) {
+	plan, err := m.Plan(target)
+	if err != nil {
+		return nil, err
+	}
+	return json.Marshal(plan)
+}
+
+// TargetUp returns the version Up would migrate to, the last version of the
+// source, without running any migration. It returns ErrNilVersion if the
+// source has no migrations and the database has no version.
+func (m *Migrate) TargetUp() (uint, error) {
+	idx, _, err := m.targetStart()
+	if err != nil {
+		return 0, err
+	}
+
+	versions, err := m.versions(idx)
+	if err != nil {
+		return 0, err
+	}
+	if len(versions) == 0 {
+		return 0, ErrNilVersion
+	}
+	return versions[len(versions)-1], nil
+}
+
+// TargetDown returns the version rolling back n migrations would migrate
+// to, without running any migration. Use a negative n for all down
+// migrations, like Down. It returns ErrNilVersion if no migration would be
+// applied anymore.
+func (m *Migrate) TargetDown(n int) (uint, error) {
+	idx, curVersion, err := m.targetStart()
+	if err != nil {
+		return 0, err
+	}
+	if curVersion == database.NilVersion || n < 0 {
+		return 0, ErrNilVersion
+	}
+
+	version := suint(curVersion)
+	for i := 0; i < n; i++ {
+		prev, err := m.prev(idx, version)
+		if errors.Is(err, os.ErrNotExist) {
+			return 0, ErrNilVersion
+		} else if err != nil {
+			return 0, err
+		}
+		version = prev
+	}
+	return version, nil
+}
+
+// TargetGoto returns the version Migrate(version) would migrate to, which
+// is version if it exists in the source, without running any migration.
+func (m *Migrate) TargetGoto(version uint) (uint, error) {
+	idx, _, err := m.targetStart()
+	if err != nil {
+		return 0, err
+	}
+	if err := m.versionExists(idx, version); err != nil {
+		return 0, err
 	}
-
-	return m.unlock()
+	return version, nil
 }
 
-// Version returns the currently active migration version.
-// If no migration has been applied, yet, it will return ErrNilVersion.
-func (m *Migrate) Version() (version uint, dirty bool, err error) {
-	v, d, err := m.databaseDrv.Version()
+// targetStart returns the source index and the current version the Target
+// methods start from. Like the commands they mirror, it returns ErrDirty if
+// the database is dirty.
+func (m *Migrate) targetStart() (*source.Migrations, int, error) {
+	curVersion, dirty, err := m.databaseDrv.Version()
 	if err != nil {
-		return 0, false, err
+		return nil, 0, err
+	}
+	if dirty {
+		return nil, 0, m.errDirty(curVersion)
 	}
 
-	if v == database.NilVersion {
-		return 0, false, ErrNilVersion
+	idx, err := m.sourceIndex()
+	if err != nil {
+		return nil, 0, err
+	}
+	if curVersion != database.NilVersion {
+		if err := m.versionExists(idx, suint(curVersion)); err != nil {
+			return nil, 0, err
+		}
 	}
+	return idx, curVersion, nil
+}
 
-	return suint(v), d, nil
+// discardMigration releases the body of a migration that won't be run. A
+// buffered body is drained, so the buffering goroutine returns and closes
+// the body.
+func discardMigration(migr *Migration, buffered bool) error {
+	if buffered {
+		_, err := io.Copy(io.Discard, migr.BufferedBody)
+		return err
+	}
+	return migr.Body.Close()
 }
 
 // read reads either up or down migrations from source `from` to `to`.
 // Each migration is then written to the ret channel.
 // If an error occurs during reading, that error is written to the ret channel, too.
 // Once read is done reading it will close the ret channel.
-func (m *Migrate) read(from int, to int, ret chan<- interface{}) {
+// It stops early like the other readers, or when ctx is done.
+func (m *Migrate) read(ctx context.Context, from int, to int, ret chan<- interface{}) {
 	defer close(ret)
 
+	idx, err := m.sourceIndex()
+	if err != nil {
+		ret <- err
+		return
+	}
+
 	// check if from version exists
 	if from >= 0 {
-		if err := m.versionExists(suint(from)); err != nil {
+		if err := m.versionExists(idx, suint(from)); err != nil {
 			ret <- err
 			return
 		}
@@ -412,7 +1524,7 @@ func (m *Migrate) read(from int, to int, ret chan<- interface{}) {
 
 	// check if to version exists
 	if to >= 0 {
-		if err := m.versionExists(suint(to)); err != nil {
+		if err := m.versionExists(idx, suint(to)); err != nil {
 			ret <- err
 			return
 		}
@@ -428,7 +1540,7 @@ func (m *Migrate) read(from int, to int, ret chan<- interface{}) {
 		// it's going up
 		// apply first migration if from is nil version
 		if from == -1 {
-			firstVersion, err := m.sourceDrv.First()
+			firstVersion, err := m.first(idx)
 			if err != nil {
 				ret <- err
 				return
@@ -440,23 +1552,18 @@ func (m *Migrate) read(from int, to int, ret chan<- interface{}) {
 				return
 			}
 
-			ret <- migr
-			go func() {
-				if err := migr.Buffer(); err != nil {
-					m.logErr(err)
-				}
-			}()
+			m.pushMigration(ret, migr)
 
 			from = int(firstVersion)
 		}
 
 		// run until we reach target ...
 		for from < to {
-			if m.stop() {
+			if m.stopContext(ctx) {
 				return
 			}
 
-			next, err := m.sourceDrv.Next(suint(from))
+			next, err := m.next(idx, suint(from))
 			if err != nil {
 				ret <- err
 				return
@@ -468,12 +1575,7 @@ func (m *Migrate) read(from int, to int, ret chan<- interface{}) {
 				return
 			}
 
-			ret <- migr
-			go func() {
-				if err := migr.Buffer(); err != nil {
-					m.logErr(err)
-				}
-			}()
+			m.pushMigration(ret, migr)
 
 			from = int(next)
 		}
@@ -482,11 +1584,11 @@ func (m *Migrate) read(from int, to int, ret chan<- interface{}) {
 		// it's going down
 		// run until we reach target ...
 		for from > to && from >= 0 {
-			if m.stop() {
+			if m.stopContext(ctx) {
 				return
 			}
 
-			prev, err := m.sourceDrv.Prev(suint(from))
+			prev, err := m.prev(idx, suint(from))
 			if errors.Is(err, os.ErrNotExist) && to == -1 {
 				// apply nil migration
 				migr, err := m.newMigration(suint(from), -1)
@@ -494,12 +1596,7 @@ func (m *Migrate) read(from int, to int, ret chan<- interface{}) {
 					ret <- err
 					return
 				}
-				ret <- migr
-				go func() {
-					if err := migr.Buffer(); err != nil {
-						m.logErr(err)
-					}
-				}()
+				m.pushMigration(ret, migr)
 
 				return
 
@@ -514,12 +1611,7 @@ func (m *Migrate) read(from int, to int, ret chan<- interface{}) {
 				return
 			}
 
-			ret <- migr
-			go func() {
-				if err := migr.Buffer(); err != nil {
-					m.logErr(err)
-				}
-			}()
+			m.pushMigration(ret, migr)
 
 			from = int(prev)
 		}
@@ -534,9 +1626,15 @@ func (m *Migrate) read(from int, to int, ret chan<- interface{}) {
 func (m *Migrate) readUp(from int, limit int, ret chan<- interface{}) {
 	defer close(ret)
 
+	idx, err := m.sourceIndex()
+	if err != nil {
+		ret <- err
+		return
+	}
+
 	// check if from version exists
 	if from >= 0 {
-		if err := m.versionExists(suint(from)); err != nil {
+		if err := m.versionExists(idx, suint(from)); err != nil {
 			ret <- err
 			return
 		}
@@ -555,7 +1653,7 @@ func (m *Migrate) readUp(from int, limit int, ret chan<- interface{}) {
 
 		// apply first migration if from is nil version
 		if from == -1 {
-			firstVersion, err := m.sourceDrv.First()
+			firstVersion, err := m.first(idx)
 			if err != nil {
 				ret <- err
 				return
@@ -567,19 +1665,14 @@ func (m *Migrate) readUp(from int, limit int, ret chan<- interface{}) {
 				return
 			}
 
-			ret <- migr
-			go func() {
-				if err := migr.Buffer(); err != nil {
-					m.logErr(err)
-				}
-			}()
+			m.pushMigration(ret, migr)
 			from = int(firstVersion)
 			count++
 			continue
 		}
 
 		// apply next migration
-		next, err := m.sourceDrv.Next(suint(from))
+		next, err := m.next(idx, suint(from))
 		if errors.Is(err, os.ErrNotExist) {
 			// no limit, but no migrations applied?
 			if limit == -1 && count == 0 {
@@ -615,17 +1708,40 @@ func (m *Migrate) readUp(from int, limit int, ret chan<- interface{}) {
 			return
 		}
 
-		ret <- migr
-		go func() {
-			if err := migr.Buffer(); err != nil {
-				m.logErr(err)
-			}
-		}()
+		m.pushMigration(ret, migr)
 		from = int(next)
 		count++
 	}
 }
 
+// pendingCount counts the migrations readUp reads from `from` without a
+// limit, but without reading them.
+func (m *Migrate) pendingCount(from int) (int, error) {
+	idx, err := m.sourceIndex()
+	if err != nil {
+		return 0, err
+	}
+
+	// check if from version exists
+	if from >= 0 {
+		if err := m.versionExists(idx, suint(from)); err != nil {
+			return 0, err
+		}
+	}
+
+	versions, err := m.versions(idx)
+	if err != nil {
+		return 0, err
+	}
+	count := 0
+	for _, version := range versions {
+		if from == -1 || version > suint(from) {
+			count++
+		}
+	}
+	return count, nil
+}
+
 // readDown reads down migrations from `from` limitted by `limit`.
 // limit can be -1, implying no limit and reading until there are no more migrations.
 // Each migration is then written to the ret channel.
@@ -634,9 +1750,15 @@ func (m *Migrate) readUp(from int, limit int, ret chan<- interface{}) {
 func (m *Migrate) readDown(from int, limit int, ret chan<- interface{}) {
 	defer close(ret)
 
+	idx, err := m.sourceIndex()
+	if err != nil {
+		ret <- err
+		return
+	}
+
 	// check if from version exists
 	if from >= 0 {
-		if err := m.versionExists(suint(from)); err != nil {
+		if err := m.versionExists(idx, suint(from)); err != nil {
 			ret <- err
 			return
 		}
@@ -665,11 +1787,11 @@ func (m *Migrate) readDown(from int, limit int, ret chan<- interface{}) {
 			return
 		}
 
-		prev, err := m.sourceDrv.Prev(suint(from))
+		prev, err := m.prev(idx, suint(from))
 		if errors.Is(err, os.ErrNotExist) {
 			// no limit or haven't reached limit, apply "first" migration
 			if limit == -1 || limit-count > 0 {
-				firstVersion, err := m.sourceDrv.First()
+				firstVersion, err := m.first(idx)
 				if err != nil {
 					ret <- err
 					return
@@ -680,12 +1802,7 @@ func (m *Migrate) readDown(from int, limit int, ret chan<- interface{}) {
 					ret <- err
 					return
 				}
-				ret <- migr
-				go func() {
-					if err := migr.Buffer(); err != nil {
-						m.logErr(err)
-					}
-				}()
+				m.pushMigration(ret, migr)
 				count++
 			}
 
@@ -705,12 +1822,7 @@ func (m *Migrate) readDown(from int, limit int, ret chan<- interface{}) {
 			return
 		}
 
-		ret <- migr
-		go func() {
-			if err := migr.Buffer(); err != nil {
-				m.logErr(err)
-			}
-		}()
+		m.pushMigration(ret, migr)
 		from = int(prev)
 		count++
 	}
@@ -722,11 +1834,25 @@ func (m *Migrate) readDown(from int, limit int, ret chan<- interface{}) {
 // Before running a newly received migration it will check if it's supposed
 // to stop execution because it might have received a stop signal on the
 // GracefulStop channel.
-func (m *Migrate) runMigrations(ret <-chan interface{}) error {
+//
+// curVersion is the version read after taking the lock, which is forced
+// back with ForcePreviousOnError if the first migration fails.
+func (m *Migrate) runMigrations(ret <-chan interface{}, curVersion int) error {
+	return m.runMigrationsReport(m.ctx, ret, curVersion, nil)
+}
+
+// runMigrationsReport works like runMigrations, but additionally stops when
+// ctx is done and calls report (if not nil) with the outcome of each
+// received migration.
+func (m *Migrate) runMigrationsReport(ctx context.Context, ret <-chan interface{}, curVersion int, report func(migr *Migration, status MigrationStatus, err error)) error {
 	for r := range ret {
 
-		if m.stop() {
-			return nil
+		if m.stopContext(ctx) {
+			if migr, ok := r.(*Migration); ok && report != nil {
+				report(migr, MigrationSkipped, nil)
+			}
+			// nil if stopped with GracefulStop
+			return m.stopErr(ctx)
 		}
 
 		switch r := r.(type) {
@@ -734,48 +1860,198 @@ func (m *Migrate) runMigrations(ret <-chan interface{}) error {
 			return r
 
 		case *Migration:
-			migr := r
-
-			// set version with dirty state
-			if err := m.databaseDrv.SetVersion(migr.TargetVersion, true); err != nil {
-				return err
-			}
-
-			if migr.Body != nil {
-				m.logVerbosePrintf("Read and execute %v\n", migr.LogString())
-				if err := m.databaseDrv.Run(migr.BufferedBody); err != nil {
+			if m.BeforeEach != nil {
+				if err := m.BeforeEach(r); err != nil {
+					if report != nil {
+						report(r, MigrationSkipped, nil)
+					}
 					return err
 				}
 			}
 
-			// set clean state
-			if err := m.databaseDrv.SetVersion(migr.TargetVersion, false); err != nil {
-				return err
+			err := m.runMigration(r, curVersion)
+			var hookErr error
+			if m.AfterEach != nil {
+				hookErr = m.AfterEach(r, err)
 			}
 
-			endTime := time.Now()
-			readTime := migr.FinishedReading.Sub(migr.StartedBuffering)
-			runTime := endTime.Sub(migr.FinishedReading)
-
-			// log either verbose or normal
-			if m.Log != nil {
-				if m.Log.Verbose() {
-					m.logPrintf("Finished %v (read %v, ran %v)\n", migr.LogString(), readTime, runTime)
-				} else {
-					m.logPrintf("%v (%v)\n", migr.LogString(), readTime+runTime)
+			if err != nil {
+				if hookErr != nil {
+					m.logErr(hookErr)
+				}
+				var invalid ErrInvalidMigration
+				if errors.As(err, &invalid) {
+					// rejected before the database was touched
+					if report != nil {
+						report(r, MigrationSkipped, err)
+					}
+					return err
+				}
+				if report != nil {
+					report(r, MigrationFailed, err)
 				}
+				return err
+			}
+			curVersion = r.TargetVersion
+			if report != nil {
+				report(r, MigrationApplied, nil)
+			}
+			if hookErr != nil {
+				return hookErr
 			}
 
 		default:
 			return fmt.Errorf("unknown type: %T with value: %+v", r, r)
 		}
 	}
+	if m.stopContext(ctx) {
+		// the reading goroutine stopped early
+		return m.stopErr(ctx)
+	}
+	return nil
+}
+
+// runMigration runs a single migration against the database and
+// keeps track of the dirty state. curVersion is the version of the database
+// before the migration.
+func (m *Migrate) runMigration(migr *Migration, curVersion int) error {
+	// validate before marking the database dirty
+	var err error
+	var validated []byte
+	if v, ok := m.databaseDrv.(database.MigrationValidator); ok && migr.Body != nil {
+		if validated, err = m.validateMigration(v, migr); err != nil {
+			return err
+		}
+	}
+
+	// set version with dirty state
+	if err := m.setVersion(m.ctx, migr.TargetVersion, true); err != nil {
+		return err
+	}
+
+	if migr.Body != nil {
+		m.bodyRan.Store(true)
+		m.logVerbosePrintf("Read and execute %v\n", migr.LogString())
+		run := m.timeoutRun(migr)
+		switch {
+		case validated != nil:
+			err = run(bytes.NewReader(validated))
+		case m.PrefetchMigrations > 0:
+			err = run(migr.BufferedBody)
+		default:
+			err = migr.stream(run)
+		}
+		if err != nil {
+			return m.forcePrevious(curVersion, err)
+		}
+	}
+
+	// set clean state, even if ctx is done, since the migration was applied
+	if err := m.setVersion(context.WithoutCancel(m.ctx), migr.TargetVersion, false); err != nil {
+		return m.forcePrevious(curVersion, err)
+	}
+	m.bodyRan.Store(false)
+
+	// record the checksum of applied up migrations
+	if d, ok := m.databaseDrv.(database.ChecksumDriver); ok && migr.Checksum != "" && migr.TargetVersion == int(migr.Version) {
+		if err := d.SetChecksum(migr.Version, migr.Checksum); err != nil {
+			return err
+		}
+	}
+
+	endTime := time.Now()
+	readTime := migr.FinishedReading.Sub(migr.StartedBuffering)
+	runTime := endTime.Sub(migr.FinishedReading)
+
+	// log either verbose or normal
+	if m.Log != nil {
+		if m.Log.Verbose() {
+			m.logPrintf("Finished %v (read %v, ran %v)\n", migr.LogString(), readTime, runTime)
+		} else {
+			m.logPrintf("%v (%v)\n", migr.LogString(), readTime+runTime)
+		}
+	}
 	return nil
 }
 
+// validateMigration reads the body of migr and validates it with v. It
+// returns the body, so it can be run after being read.
+func (m *Migrate) validateMigration(v database.MigrationValidator, migr *Migration) ([]byte, error) {
+	var body []byte
+	read := func(r io.Reader) (err error) {
+		body, err = io.ReadAll(r)
+		return err
+	}
+	var err error
+	if m.PrefetchMigrations > 0 {
+		err = read(migr.BufferedBody)
+	} else {
+		err = migr.stream(read)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	m.logVerbosePrintf("Validate %v\n", migr.LogString())
+	if err := v.Validate(m.ctx, bytes.NewReader(body)); err != nil {
+		return nil, ErrInvalidMigration{Version: migr.Version, Identifier: migr.Identifier, Err: err}
+	}
+	return body, nil
+}
+
+// forcePrevious forces the clean version before a migration failed with
+// err, if ForcePreviousOnError is set. It returns err, along with the error
+// forcing the version if any.
+func (m *Migrate) forcePrevious(version int, err error) error {
+	if !m.ForcePreviousOnError {
+		return err
+	}
+	if serr := m.setVersion(context.WithoutCancel(m.ctx), version, false); serr != nil {
+		return multierror.Append(err, serr)
+	}
+	m.logPrintf("Forced version %v after the migration failed\n", version)
+	return err
+}
+
+// errDirty returns ErrDirty for version, with the identifier of its
+// migration read from the source.
+func (m *Migrate) errDirty(version int) ErrDirty {
+	e := ErrDirty{Version: version}
+	if version < 0 {
+		return e
+	}
+
+	r, identifier, err := m.sourceDrv.ReadUp(uint(version))
+	if errors.Is(err, os.ErrNotExist) {
+		r, identifier, err = m.sourceDrv.ReadDown(uint(version))
+	}
+	switch {
+	case err == nil:
+		if errClose := r.Close(); errClose != nil {
+			m.logErr(errClose)
+		}
+		e.Identifier = identifier
+	case errors.Is(err, os.ErrNotExist):
+		e.missing = true
+	}
+	return e
+}
+
 // versionExists checks the source if either the up or down migration for
 // the specified migration version exists.
-func (m *Migrate) versionExists(version uint) (result error) {
+func (m *Migrate) versionExists(idx *source.Migrations, version uint) (result error) {
+	if idx != nil {
+		if _, ok := idx.Up(version); ok {
+			return nil
+		}
+		if _, ok := idx.Down(version); ok {
+			return nil
+		}
+		err := fmt.Errorf("no migration found for version %d: %w", version, os.ErrNotExist)
+		m.logErr(err)
+		return err
+	}
+
 	// try up migration first
 	up, _, err := m.sourceDrv.ReadUp(version)
 	if err == nil {
@@ -811,17 +2087,97 @@ func (m *Migrate) versionExists(version uint) (result error) {
 	return err
 }
 
+// sourceIndex returns all migrations of the source listed in a single call,
+// if the source driver implements source.Lister. Otherwise it returns nil
+// and the source driver is traversed version by version.
+func (m *Migrate) sourceIndex() (*source.Migrations, error) {
+	lister, ok := m.sourceDrv.(source.Lister)
+	if !ok {
+		return nil, nil
+	}
+	ms, err := lister.List()
+	if err != nil {
+		return nil, err
+	}
+	idx := source.NewMigrations()
+	for k := range ms {
+		if !idx.Append(&ms[k]) {
+			return nil, fmt.Errorf("source listed duplicate migration %v for version %d", ms[k].Identifier, ms[k].Version)
+		}
+	}
+	return idx, nil
+}
+
+// versions returns all versions in ascending order from idx, or from the
+// source driver if idx is nil.
+func (m *Migrate) versions(idx *source.Migrations) ([]uint, error) {
+	if idx == nil {
+		return source.SortedVersions(m.sourceDrv)
+	}
+	return idx.Versions(), nil
+}
+
+// first returns the first version from idx, or from the source driver
+// if idx is nil.
+func (m *Migrate) first(idx *source.Migrations) (uint, error) {
+	if idx == nil {
+		return m.sourceDrv.First()
+	}
+	if v, ok := idx.First(); ok {
+		return v, nil
+	}
+	return 0, os.ErrNotExist
+}
+
+// next returns the version after version from idx, or from the source
+// driver if idx is nil.
+func (m *Migrate) next(idx *source.Migrations, version uint) (uint, error) {
+	if idx == nil {
+		return m.sourceDrv.Next(version)
+	}
+	if v, ok := idx.Next(version); ok {
+		return v, nil
+	}
+	return 0, os.ErrNotExist
+}
+
+// prev returns the version before version from idx, or from the source
+// driver if idx is nil.
+func (m *Migrate) prev(idx *source.Migrations, version uint) (uint, error) {
+	if idx == nil {
+		return m.sourceDrv.Prev(version)
+	}
+	if v, ok := idx.Prev(version); ok {
+		return v, nil
+	}
+	return 0, os.ErrNotExist
+}
+
+// versionBefore returns the version before version from idx, or from the
+// source driver if idx is nil, or database.NilVersion if version is the
+// first one.
+func (m *Migrate) versionBefore(idx *source.Migrations, version uint) (int, error) {
+	prev, err := m.prev(idx, version)
+	if errors.Is(err, os.ErrNotExist) {
+		return database.NilVersion, nil
+	} else if err != nil {
+		return 0, err
+	}
+	return int(prev), nil
+}
+
 // stop returns true if no more migrations should be run against the database
-// because a stop signal was received on the GracefulStop channel.
+// because a stop signal was received on the GracefulStop channel, or the
+// context set with WithContext is done.
 // Calls are cheap and this function is not blocking.
 func (m *Migrate) stop() bool {
-	if m.isGracefulStop {
+	if m.isGracefulStop.Load() || m.ctx.Err() != nil {
 		return true
 	}
 
 	select {
 	case <-m.GracefulStop:
-		m.isGracefulStop = true
+		m.isGracefulStop.Store(true)
 		return true
 
 	default:
@@ -829,6 +2185,34 @@ func (m *Migrate) stop() bool {
 	}
 }
 
+// stopContext works like stop, but also returns true if ctx is done.
+func (m *Migrate) stopContext(ctx context.Context) bool {
+	return m.stop() || ctx.Err() != nil
+}
+
+// stopErr returns the error of ctx or of the context of Migrate after
+// stopContext returned true, or nil if stopped with GracefulStop.
+func (m *Migrate) stopErr(ctx context.Context) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	return m.ctx.Err()
+}
+
+// pushMigration sends migr to ret. If migrations are prefetched, its body
+// is buffered in the background. Otherwise it is streamed to the database
+// driver when the migration runs.
+func (m *Migrate) pushMigration(ret chan<- interface{}, migr *Migration) {
+	ret <- migr
+	if m.PrefetchMigrations > 0 {
+		go func() {
+			if err := migr.Buffer(); err != nil {
+				m.logErr(err)
+			}
+		}()
+	}
+}
+
 // newMigration is a helper func that returns a *Migration for the
 // specified version and targetVersion.
 func (m *Migrate) newMigration(version uint, targetVersion int) (*Migration, error) {
@@ -847,6 +2231,12 @@ func (m *Migrate) newMigration(version uint, targetVersion int) (*Migration, err
 			return nil, err
 
 		} else {
+			if m.ErrorOnEmpty {
+				if r, err = m.checkEmpty(r, identifier, version); err != nil {
+					return nil, err
+				}
+			}
+
 			// create migration from up source
 			migr, err = NewMigration(r, identifier, version, targetVersion)
 			if err != nil {
@@ -884,9 +2274,28 @@ func (m *Migrate) newMigration(version uint, targetVersion int) (*Migration, err
 	return migr, nil
 }
 
+// checkEmpty reads the up migration r and returns ErrEmptyMigration if it
+// is empty, otherwise a reader of its body.
+func (m *Migrate) checkEmpty(r io.ReadCloser, identifier string, version uint) (io.ReadCloser, error) {
+	defer r.Close()
+	body, err := io.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+	if isEmptyBody(body) {
+		return nil, ErrEmptyMigration{Version: version, Identifier: identifier}
+	}
+	return io.NopCloser(bytes.NewReader(body)), nil
+}
+
 // lock is a thread safe helper function to lock the database.
 // It should be called as late as possible when running migrations.
 func (m *Migrate) lock() error {
+	// every change is made while locked, so refusing the lock refuses them
+	if m.VerifyOnly {
+		return ErrReadOnly
+	}
+
 	m.isLockedMu.Lock()
 	defer m.isLockedMu.Unlock()
 
@@ -894,46 +2303,164 @@ func (m *Migrate) lock() error {
 		return ErrLocked
 	}
 
-	// create done channel, used in the timeout goroutine
-	done := make(chan bool, 1)
-	defer func() {
-		done <- true
-	}()
-
-	// use errchan to signal error back to this context
-	errchan := make(chan error, 2)
+	// refuse unprotected changes if the driver has locking disabled
+	if d, ok := m.databaseDrv.(database.LockDisabledDriver); ok && d.LockDisabled() {
+		return ErrLockDisabled
+	}
 
-	// start timeout goroutine
+	// waiting for a free call counts against the lock timeout
 	timeout := time.After(m.LockTimeout)
-	go func() {
-		for {
-			select {
-			case <-done:
-				return
-			case <-timeout:
-				errchan <- ErrLockTimeout
-				return
-			}
-		}
-	}()
+	release, err := m.acquireDBCall(timeout, m.ctx.Done())
+	if err != nil {
+		return err
+	}
+	// free the call if Lock times out, even though it keeps running
+	defer release()
 
 	// now try to acquire the lock
+	errchan := make(chan error, 1)
 	go func() {
-		if err := m.databaseDrv.Lock(); err != nil {
-			errchan <- err
-		} else {
-			errchan <- nil
-		}
+		err := m.lockDriver()
+		release()
+		errchan <- err
 	}()
 
 	// wait until we either receive ErrLockTimeout or error from Lock operation
-	err := <-errchan
+	select {
+	case err = <-errchan:
+	case <-timeout:
+		err = ErrLockTimeout
+	case <-m.ctx.Done():
+		err = m.ctx.Err()
+	}
 	if err == nil {
 		m.isLocked = true
 	}
 	return err
 }
 
+// lockPlanned reads the version the caller plans to migrate from, locks
+// the database and reads the version again, returning it. If another
+// instance applied migrations while waiting for the lock, the changes
+// planned from the first version were made already: the database is
+// unlocked and ErrMigrationConflict is returned, so that the caller aborts
+// cleanly. ErrDirty is returned if the database is dirty.
+func (m *Migrate) lockPlanned() (int, error) {
+	plannedVersion, _, err := m.databaseDrv.Version()
+	if err != nil {
+		return 0, err
+	}
+
+	if err := m.lock(); err != nil {
+		return 0, err
+	}
+
+	curVersion, dirty, err := m.databaseDrv.Version()
+	if err != nil {
+		return 0, m.unlockErr(err)
+	}
+	if dirty {
+		return 0, m.unlockErr(m.errDirty(curVersion))
+	}
+	if curVersion > plannedVersion {
+		return 0, m.unlockErr(ErrMigrationConflict{AtVersion: suint(curVersion)})
+	}
+	return curVersion, nil
+}
+
+// acquireDBCall waits until fewer than MaxConcurrentDBCalls calls to the
+// database driver are running, or until timeout or done. It returns a func
+// ending the call, which may be called more than once.
+func (m *Migrate) acquireDBCall(timeout <-chan time.Time, done <-chan struct{}) (func(), error) {
+	m.dbCallsOnce.Do(func() {
+		if m.MaxConcurrentDBCalls > 0 {
+			m.dbCalls = make(chan struct{}, m.MaxConcurrentDBCalls)
+		}
+	})
+	if m.dbCalls == nil {
+		return func() {}, nil
+	}
+
+	select {
+	case m.dbCalls <- struct{}{}:
+	case <-timeout:
+		return nil, ErrLockTimeout
+	case <-done:
+		return nil, m.ctx.Err()
+	}
+	var once sync.Once
+	return func() {
+		once.Do(func() { <-m.dbCalls })
+	}, nil
+}
+
+// dbCall runs call, waiting while MaxConcurrentDBCalls calls to the
+// database driver are running. It doesn't give up when the context of
+// Migrate is done, so that the version is still recorded and the database
+// unlocked after a cancellation.
+func (m *Migrate) dbCall(call func() error) error {
+	release, err := m.acquireDBCall(nil, nil)
+	if err != nil {
+		return err
+	}
+	defer release()
+	return call()
+}
+
+// lockDriver calls Lock of the database driver, or LockContext with the
+// context set with WithContext if the driver implements
+// database.ContextLocker.
+func (m *Migrate) lockDriver() error {
+	if l, ok := m.databaseDrv.(database.ContextLocker); ok && m.forwardCtx {
+		return l.LockContext(m.ctx)
+	}
+	return m.databaseDrv.Lock()
+}
+
+// setVersion calls SetVersion of the database driver, or SetVersionContext
+// with ctx if a context was set with WithContext and the driver implements
+// database.ContextVersionSetter, see dbCall.
+func (m *Migrate) setVersion(ctx context.Context, version int, dirty bool) error {
+	return m.dbCall(func() error {
+		if s, ok := m.databaseDrv.(database.ContextVersionSetter); ok && m.forwardCtx {
+			return s.SetVersionContext(ctx, version, dirty)
+		}
+		return m.databaseDrv.SetVersion(version, dirty)
+	})
+}
+
+// timeoutRun returns a func running a body of migr with its Timeout, if
+// any, derived from the context set with WithContext.
+func (m *Migrate) timeoutRun(migr *Migration) func(io.Reader) error {
+	return func(r io.Reader) error {
+		if migr.Timeout == 0 {
+			return m.runBody(r)
+		}
+
+		runner, ok := m.databaseDrv.(database.ContextRunner)
+		if !ok {
+			return fmt.Errorf("migration %v: %w", migr.LogString(), ErrTimeoutNotSupported)
+		}
+		ctx, cancel := context.WithTimeout(m.ctx, migr.Timeout)
+		defer cancel()
+		return m.dbCall(func() error {
+			return runner.RunContext(ctx, r)
+		})
+	}
+}
+
+// runBody calls Run of the database driver, or RunContext with the
+// context set with WithContext if the driver implements
+// database.ContextRunner, see dbCall.
+func (m *Migrate) runBody(r io.Reader) error {
+	return m.dbCall(func() error {
+		if runner, ok := m.databaseDrv.(database.ContextRunner); ok && m.forwardCtx {
+			return runner.RunContext(m.ctx, r)
+		}
+		return m.databaseDrv.Run(r)
+	})
+}
+
 // unlock is a thread safe helper function to unlock the database.
 // It should be called as early as possible when no more migrations are
 // expected to be executed.
@@ -941,7 +2468,7 @@ func (m *Migrate) unlock() error {
 	m.isLockedMu.Lock()
 	defer m.isLockedMu.Unlock()
 
-	if err := m.databaseDrv.Unlock(); err != nil {
+	if err := m.dbCall(m.databaseDrv.Unlock); err != nil {
 		// BUG: Can potentially create a deadlock. Add a timeout.
 		return err
 	}
@@ -2,16 +2,26 @@ package migrate
 
 import (
 	"bytes"
+	"context"
 	"database/sql"
+	"encoding/json"
 	"errors"
+	"fmt"
 	"io"
 	"log"
 	"os"
+	"reflect"
 	"strings"
+	"sync"
+	"sync/atomic"
 	"testing"
+	"testing/fstest"
+	"time"
 
+	"github.com/golang-migrate/migrate/v4/database"
 	dStub "github.com/golang-migrate/migrate/v4/database/stub"
 	"github.com/golang-migrate/migrate/v4/source"
+	"github.com/golang-migrate/migrate/v4/source/iofs"
 	sStub "github.com/golang-migrate/migrate/v4/source/stub"
 )
 
@@ -232,6 +242,64 @@ func TestClose(t *testing.T) {
 	}
 }
 
+type closeFailSource struct {
+	sStub.Stub
+	err error
+}
+
+func (s *closeFailSource) Close() error {
+	return s.err
+}
+
+type closeFailDatabase struct {
+	dStub.Stub
+	err error
+}
+
+func (d *closeFailDatabase) Close() error {
+	return d.err
+}
+
+type testCloseErr struct{ side string }
+
+func (e *testCloseErr) Error() string { return e.side + " close failed" }
+
+func TestCloseAll(t *testing.T) {
+	m, _ := New("stub://", "stub://")
+	if err := m.CloseAll(); err != nil {
+		t.Fatal(err)
+	}
+
+	srcErr := &testCloseErr{"source"}
+	dbErr := &os.PathError{Op: "close", Path: "stub", Err: os.ErrClosed}
+	m, err := NewWithInstance(srcDrvNameStub, &closeFailSource{err: srcErr},
+		dbDrvNameStub, &closeFailDatabase{err: dbErr})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = m.CloseAll()
+	var closeErr CloseError
+	if !errors.As(err, &closeErr) {
+		t.Fatalf("expected CloseError, got %v", err)
+	}
+	if closeErr.Source != srcErr || closeErr.Database != dbErr {
+		t.Errorf("expected source %v and database %v, got %+v", srcErr, dbErr, closeErr)
+	}
+
+	var gotSrcErr *testCloseErr
+	if !errors.As(err, &gotSrcErr) || gotSrcErr != srcErr {
+		t.Errorf("expected source close error to be retrievable, got %v", gotSrcErr)
+	}
+	var gotDbErr *os.PathError
+	if !errors.As(err, &gotDbErr) || gotDbErr != dbErr {
+		t.Errorf("expected database close error to be retrievable, got %v", gotDbErr)
+	}
+	if !errors.Is(err, os.ErrClosed) {
+		t.Error("expected error to wrap os.ErrClosed")
+	}
+}
+
 func TestMigrate(t *testing.T) {
 	m, _ := New("stub://", "stub://")
 	m.sourceDrv.(*sStub.Stub).Migrations = sourceStubMigrations
@@ -891,6 +959,73 @@ func TestUpDirty(t *testing.T) {
 	}
 }
 
+type runFailDatabase struct {
+	dStub.Stub
+	failOn string
+}
+
+func (d *runFailDatabase) Run(migration io.Reader) error {
+	body, err := io.ReadAll(migration)
+	if err != nil {
+		return err
+	}
+	if string(body) == d.failOn {
+		return errors.New("failed to run " + d.failOn)
+	}
+	return d.Stub.Run(bytes.NewReader(body))
+}
+
+func TestUpResult(t *testing.T) {
+	dbDrv := &runFailDatabase{failOn: "CREATE 4"}
+	dbDrv.CurrentVersion = -1
+	srcDrv, _ := (&sStub.Stub{}).Open("stub://")
+	srcDrv.(*sStub.Stub).Migrations = sourceStubMigrations
+	m, _ := NewWithInstance(srcDrvNameStub, srcDrv, dbDrvNameStub, dbDrv)
+
+	results, err := m.UpResult()
+	if err == nil {
+		t.Fatal("expected error")
+	}
+
+	expected := []MigrationResult{
+		{Version: 1, TargetVersion: 1, Status: MigrationApplied},
+		{Version: 3, TargetVersion: 3, Status: MigrationApplied},
+		{Version: 4, TargetVersion: 4, Status: MigrationFailed},
+	}
+	if len(results) != len(expected) {
+		t.Fatalf("expected %v results, got %v: %+v", len(expected), len(results), results)
+	}
+	for i, r := range results {
+		if r.Version != expected[i].Version || r.TargetVersion != expected[i].TargetVersion || r.Status != expected[i].Status {
+			t.Errorf("expected %+v, got %+v, in %v", expected[i], r, i)
+		}
+	}
+	if results[2].Err != err {
+		t.Errorf("expected last result to carry %v, got %v", err, results[2].Err)
+	}
+	if results[0].Err != nil || results[1].Err != nil {
+		t.Error("expected applied results not to carry an error")
+	}
+	if !dbDrv.IsDirty || dbDrv.CurrentVersion != 4 {
+		t.Errorf("expected dirty version 4, got %v (dirty: %v)", dbDrv.CurrentVersion, dbDrv.IsDirty)
+	}
+}
+
+func TestUpResultNoChange(t *testing.T) {
+	m, _ := New("stub://", "stub://")
+	m.sourceDrv.(*sStub.Stub).Migrations = sourceStubMigrations
+	dbDrv := m.databaseDrv.(*dStub.Stub)
+	dbDrv.CurrentVersion = 7
+
+	results, err := m.UpResult()
+	if !errors.Is(err, ErrNoChange) {
+		t.Fatalf("expected ErrNoChange, got %v", err)
+	}
+	if len(results) != 0 {
+		t.Errorf("expected no results, got %+v", results)
+	}
+}
+
 func TestDownDirty(t *testing.T) {
 	m, _ := New("stub://", "stub://")
 	dbDrv := m.databaseDrv.(*dStub.Stub)
@@ -918,6 +1053,95 @@ func TestDrop(t *testing.T) {
 	}
 }
 
+func TestDropWithOptions(t *testing.T) {
+	m, _ := New("stub://", "stub://")
+	m.sourceDrv.(*sStub.Stub).Migrations = sourceStubMigrations
+	dbDrv := m.databaseDrv.(*dStub.Stub)
+
+	if err := m.Up(); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := m.DropWithOptions(context.Background(), DropOptions{KeepMigrationsTable: true}); err != nil {
+		t.Fatal(err)
+	}
+	if dbDrv.MigrationSequence[len(dbDrv.MigrationSequence)-1] != dStub.DROP {
+		t.Fatalf("expected database to DROP, got sequence %v", dbDrv.MigrationSequence)
+	}
+	if dbDrv.CurrentVersion != 7 {
+		t.Errorf("expected version 7 to be kept, got %v", dbDrv.CurrentVersion)
+	}
+
+	if err := m.DropWithOptions(context.Background(), DropOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	if dbDrv.CurrentVersion != database.NilVersion {
+		t.Errorf("expected nil version, got %v", dbDrv.CurrentVersion)
+	}
+}
+
+func TestDropWithOptionsNotSupported(t *testing.T) {
+	// hide the optional interfaces implemented by the stub driver
+	dbDrv, _ := (&dStub.Stub{}).Open("stub://")
+	m, _ := NewWithDatabaseInstance("stub://", dbDrvNameStub, struct{ database.Driver }{dbDrv})
+
+	err := m.DropWithOptions(context.Background(), DropOptions{KeepMigrationsTable: true})
+	if !errors.Is(err, ErrDropOptionsNotSupported) {
+		t.Fatalf("expected ErrDropOptionsNotSupported, got %v", err)
+	}
+}
+
+type bufferLogger struct {
+	bytes.Buffer
+}
+
+func (l *bufferLogger) Printf(format string, v ...interface{}) {
+	fmt.Fprintf(&l.Buffer, format, v...)
+}
+
+func (l *bufferLogger) Verbose() bool {
+	return true
+}
+
+func TestDropDryRun(t *testing.T) {
+	m, _ := New("stub://", "stub://")
+	dbDrv := m.databaseDrv.(*dStub.Stub)
+	dbDrv.Tables = []string{"users", "orders"}
+
+	tables, err := m.DropDryRun(context.Background(), DropOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(tables, []string{"users", "orders"}) {
+		t.Fatalf("expected tables users and orders, got %v", tables)
+	}
+	if len(dbDrv.MigrationSequence) != 0 || len(dbDrv.Tables) != 2 {
+		t.Fatalf("expected database not to be changed, got sequence %v", dbDrv.MigrationSequence)
+	}
+
+	// the dropped tables are logged in verbose mode
+	logger := &bufferLogger{}
+	m.Log = logger
+	if err := m.Drop(); err != nil {
+		t.Fatal(err)
+	}
+	if expected := "Dropping table users\nDropping table orders\n"; logger.String() != expected {
+		t.Fatalf("expected log %q, got %q", expected, logger.String())
+	}
+	if tables, err := m.DropDryRun(context.Background(), DropOptions{}); err != nil || len(tables) != 0 {
+		t.Fatalf("expected no tables left, got %v, %v", tables, err)
+	}
+}
+
+func TestDropDryRunNotSupported(t *testing.T) {
+	dbDrv, _ := (&dStub.Stub{}).Open("stub://")
+	m, _ := NewWithDatabaseInstance("stub://", dbDrvNameStub, struct{ database.Driver }{dbDrv})
+
+	if _, err := m.DropDryRun(context.Background(), DropOptions{}); !errors.Is(err, ErrDropListNotSupported) {
+		t.Fatalf("expected ErrDropListNotSupported, got %v", err)
+	}
+}
+
 func TestVersion(t *testing.T) {
 	m, _ := New("stub://", "stub://")
 	dbDrv := m.databaseDrv.(*dStub.Stub)
@@ -965,6 +1189,11 @@ func TestRun(t *testing.T) {
 	if v != 2 {
 		t.Errorf("expected version 2, got %v", v)
 	}
+
+	// running a migration to the current version again is no conflict
+	if err := m.Run(mx); err != nil {
+		t.Fatal(err)
+	}
 }
 
 func TestRunDirty(t *testing.T) {
@@ -1140,7 +1369,7 @@ func TestRead(t *testing.T) {
 
 	for i, v := range tt {
 		ret := make(chan interface{})
-		go m.read(v.from, v.to, ret)
+		go m.read(context.Background(), v.from, v.to, ret)
 		migrations, err := migrationsFromChannel(ret)
 
 		if (v.expectErr == os.ErrNotExist && !errors.Is(err, os.ErrNotExist)) ||
@@ -1231,6 +1460,116 @@ func TestReadUp(t *testing.T) {
 	}
 }
 
+func TestPendingCount(t *testing.T) {
+	m, _ := New("stub://", "stub://")
+	m.sourceDrv.(*sStub.Stub).Migrations = sourceStubMigrations
+	dbDrv := m.databaseDrv.(*dStub.Stub)
+
+	tt := []struct {
+		version     int
+		expectCount int
+		expectErr   error
+	}{
+		{version: -1, expectCount: 5},
+		{version: 0, expectErr: os.ErrNotExist},
+		{version: 1, expectCount: 4},
+		{version: 2, expectErr: os.ErrNotExist},
+		{version: 3, expectCount: 3},
+		{version: 4, expectCount: 2},
+		{version: 5, expectCount: 1},
+		{version: 6, expectErr: os.ErrNotExist},
+		{version: 7, expectCount: 0},
+		{version: 8, expectErr: os.ErrNotExist},
+	}
+
+	for i, v := range tt {
+		dbDrv.CurrentVersion = v.version
+		count, err := m.PendingCount()
+		if v.expectErr == nil && err != nil || v.expectErr != nil && !errors.Is(err, v.expectErr) {
+			t.Errorf("expected %v, got %v, in %v", v.expectErr, err, i)
+			continue
+		}
+		if count != v.expectCount {
+			t.Errorf("expected %v pending migrations, got %v, in %v", v.expectCount, count, i)
+		}
+	}
+
+	dbDrv.CurrentVersion = 3
+	dbDrv.IsDirty = true
+	if _, err := m.PendingCount(); !errors.Is(err, ErrDirty{Version: 3}) {
+		t.Errorf("expected ErrDirty, got %v", err)
+	}
+}
+
+func TestPendingCountEmptySource(t *testing.T) {
+	m, _ := New("stub://", "stub://")
+	count, err := m.PendingCount()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if count != 0 {
+		t.Fatalf("expected no pending migrations, got %v", count)
+	}
+}
+
+type historyDatabase struct {
+	dStub.Stub
+	history []database.AppliedMigration
+}
+
+func (d *historyDatabase) History() ([]database.AppliedMigration, error) {
+	return d.history, nil
+}
+
+func TestDiff(t *testing.T) {
+	m, _ := New("stub://", "stub://")
+	m.sourceDrv.(*sStub.Stub).Migrations = sourceStubMigrations
+	m.databaseDrv.(*dStub.Stub).CurrentVersion = 3
+
+	diff, err := m.Diff()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if expected := []uint{4, 5, 7}; !reflect.DeepEqual(diff.Pending, expected) {
+		t.Errorf("expected pending %v, got %v", expected, diff.Pending)
+	}
+	if diff.HistoryChecked || diff.Orphans != nil {
+		t.Errorf("expected no orphans and no history, got %+v", diff)
+	}
+
+	// the current version is checked without history too
+	m.databaseDrv.(*dStub.Stub).CurrentVersion = 6
+	diff, err = m.Diff()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if expected := []uint{6}; diff.HistoryChecked || !reflect.DeepEqual(diff.Orphans, expected) {
+		t.Errorf("expected orphans %v without history, got %+v", expected, diff)
+	}
+
+	dbDrv := &historyDatabase{history: []database.AppliedMigration{
+		{Version: 6}, {Version: 3}, {Version: 2}, {Version: 1},
+	}}
+	dbDrv.CurrentVersion = 6
+	srcDrv, _ := (&sStub.Stub{}).Open("stub://")
+	srcDrv.(*sStub.Stub).Migrations = sourceStubMigrations
+	m, _ = NewWithInstance(srcDrvNameStub, srcDrv, dbDrvNameStub, dbDrv)
+
+	diff, err = m.Diff()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if expected := []uint{7}; !reflect.DeepEqual(diff.Pending, expected) {
+		t.Errorf("expected pending %v, got %v", expected, diff.Pending)
+	}
+	if !diff.HistoryChecked {
+		t.Error("expected orphans to be checked")
+	}
+	if expected := []uint{2, 6}; !reflect.DeepEqual(diff.Orphans, expected) {
+		t.Errorf("expected orphans %v, got %v", expected, diff.Orphans)
+	}
+}
+
 func TestReadDown(t *testing.T) {
 	m, _ := New("stub://", "stub://")
 	m.sourceDrv.(*sStub.Stub).Migrations = sourceStubMigrations
@@ -1414,3 +1753,1820 @@ func equalDbSeq(t *testing.T, i int, expected migrationSequence, got *dStub.Stub
 		t.Fatalf("\nexpected sequence %v,\ngot               %v, in %v", bs, got.MigrationSequence, i)
 	}
 }
+
+type capabilitiesDatabase struct {
+	dStub.Stub
+	caps database.Capabilities
+}
+
+func (d *capabilitiesDatabase) Capabilities() database.Capabilities {
+	return d.caps
+}
+
+func TestCapabilities(t *testing.T) {
+	m, _ := New("stub://", "stub://")
+	if _, ok := m.Capabilities(); ok {
+		t.Fatal("expected stub driver not to report capabilities")
+	}
+
+	expected := database.Capabilities{SupportsTx: true, SupportsLocking: true}
+	dbDrv := &capabilitiesDatabase{caps: expected}
+	srcDrv, _ := (&sStub.Stub{}).Open("stub://")
+	m, _ = NewWithInstance(srcDrvNameStub, srcDrv, dbDrvNameStub, dbDrv)
+	caps, ok := m.Capabilities()
+	if !ok {
+		t.Fatal("expected driver to report capabilities")
+	}
+	if caps != expected {
+		t.Fatalf("expected %+v, got %+v", expected, caps)
+	}
+}
+
+type describingDatabase struct {
+	dStub.Stub
+	info database.DriverInfo
+	err  error
+}
+
+func (d *describingDatabase) Describe() (database.DriverInfo, error) {
+	return d.info, d.err
+}
+
+func TestDescribe(t *testing.T) {
+	m, _ := New("stub://", "stub://")
+	if _, err := m.Describe(); !errors.Is(err, ErrDescribeNotSupported) {
+		t.Fatalf("expected ErrDescribeNotSupported, got %v", err)
+	}
+
+	expected := database.DriverInfo{Name: "describing", Capabilities: database.Capabilities{SupportsTx: true}, SupportsSchemas: true}
+	srcDrv, _ := (&sStub.Stub{}).Open("stub://")
+	m, _ = NewWithInstance(srcDrvNameStub, srcDrv, dbDrvNameStub, &describingDatabase{info: expected})
+	info, err := m.Describe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info != expected {
+		t.Fatalf("expected %+v, got %+v", expected, info)
+	}
+
+	errDescribe := errors.New("describe failed")
+	m, _ = NewWithInstance(srcDrvNameStub, srcDrv, dbDrvNameStub, &describingDatabase{err: errDescribe})
+	if _, err := m.Describe(); !errors.Is(err, errDescribe) {
+		t.Fatalf("expected %v, got %v", errDescribe, err)
+	}
+}
+
+func TestHealth(t *testing.T) {
+	errUnreachable := errors.New("unreachable")
+
+	tt := []struct {
+		name        string
+		version     int
+		dirty       bool
+		pingErr     error
+		expectedErr error
+	}{
+		{name: "healthy", version: 1},
+		{name: "healthy nil version", version: database.NilVersion},
+		{name: "dirty", version: 1, dirty: true, expectedErr: ErrDirty{Version: 1}},
+		{name: "unreachable", version: 1, pingErr: errUnreachable, expectedErr: errUnreachable},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			m, _ := New("stub://", "stub://")
+			dbDrv := m.databaseDrv.(*dStub.Stub)
+			dbDrv.CurrentVersion = tc.version
+			dbDrv.IsDirty = tc.dirty
+			dbDrv.PingErr = tc.pingErr
+
+			err := m.Health(context.Background())
+			if tc.expectedErr == nil {
+				if err != nil {
+					t.Fatalf("expected no error, got %v", err)
+				}
+			} else if !errors.Is(err, tc.expectedErr) {
+				t.Fatalf("expected %v, got %v", tc.expectedErr, err)
+			}
+		})
+	}
+}
+
+// conflictDatabase reports versions from versions on each call to Version,
+// to simulate another instance migrating the database concurrently.
+type conflictDatabase struct {
+	dStub.Stub
+	versions []int
+}
+
+func (d *conflictDatabase) Version() (int, bool, error) {
+	if len(d.versions) > 0 {
+		d.CurrentVersion, d.versions = d.versions[0], d.versions[1:]
+	}
+	return d.Stub.Version()
+}
+
+func TestUpMigrationConflict(t *testing.T) {
+	// Up plans from -1, but another instance migrated to 1 while waiting for the lock
+	dbDrv := &conflictDatabase{versions: []int{database.NilVersion, 1}}
+	srcDrv, _ := (&sStub.Stub{}).Open("stub://")
+	srcDrv.(*sStub.Stub).Migrations = sourceStubMigrations
+	m, _ := NewWithInstance(srcDrvNameStub, srcDrv, dbDrvNameStub, dbDrv)
+
+	err := m.Up()
+	if !errors.Is(err, ErrMigrationConflict{AtVersion: 1}) {
+		t.Fatalf("expected ErrMigrationConflict, got %v", err)
+	}
+	if dbDrv.IsDirty {
+		t.Fatal("expected database not to be dirty")
+	}
+	if len(dbDrv.MigrationSequence) != 0 {
+		t.Fatalf("expected no migrations to run, got %v", dbDrv.MigrationSequence)
+	}
+	if err := dbDrv.Lock(); err != nil {
+		t.Fatalf("expected database to be unlocked, got %v", err)
+	}
+}
+
+type lockDisabledDatabase struct {
+	dStub.Stub
+}
+
+func (d *lockDisabledDatabase) LockDisabled() bool {
+	return true
+}
+
+func TestLockDisabled(t *testing.T) {
+	dbDrv := &lockDisabledDatabase{}
+	dbDrv.CurrentVersion = 1
+	srcDrv, _ := (&sStub.Stub{}).Open("stub://")
+	srcDrv.(*sStub.Stub).Migrations = sourceStubMigrations
+	m, _ := NewWithInstance(srcDrvNameStub, srcDrv, dbDrvNameStub, dbDrv)
+
+	// reading the version doesn't need a lock
+	if v, _, err := m.Version(); err != nil || v != 1 {
+		t.Fatalf("expected version 1, got %v, %v", v, err)
+	}
+
+	ops := map[string]func() error{
+		"Up":      m.Up,
+		"Down":    m.Down,
+		"Steps":   func() error { return m.Steps(1) },
+		"Migrate": func() error { return m.Migrate(3) },
+		"Run": func() error {
+			migr, err := NewMigration(nil, "", 3, 3)
+			if err != nil {
+				return err
+			}
+			return m.Run(migr)
+		},
+		"Force": func() error { return m.Force(3) },
+		"Drop":  m.Drop,
+	}
+	for name, op := range ops {
+		t.Run(name, func(t *testing.T) {
+			if err := op(); !errors.Is(err, ErrLockDisabled) {
+				t.Fatalf("expected ErrLockDisabled, got %v", err)
+			}
+		})
+	}
+
+	if dbDrv.CurrentVersion != 1 || len(dbDrv.MigrationSequence) != 0 {
+		t.Fatal("expected database not to be changed")
+	}
+}
+
+type lockFailingDatabase struct {
+	dStub.Stub
+	t *testing.T
+}
+
+func (d *lockFailingDatabase) Lock() error {
+	d.t.Error("expected the database not to be locked")
+	return d.Stub.Lock()
+}
+
+func TestVerifyOnly(t *testing.T) {
+	dbDrv := &lockFailingDatabase{t: t}
+	dbDrv.CurrentVersion = 1
+	srcDrv, _ := (&sStub.Stub{}).Open("stub://")
+	srcDrv.(*sStub.Stub).Migrations = sourceStubMigrations
+	m, _ := NewWithInstance(srcDrvNameStub, srcDrv, dbDrvNameStub, dbDrv)
+	m.VerifyOnly = true
+
+	if v, dirty, err := m.Version(); err != nil || v != 1 || dirty {
+		t.Fatalf("expected clean version 1, got %v, %v, %v", v, dirty, err)
+	}
+	if err := m.Health(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if n, err := m.PendingCount(); err != nil || n != 4 {
+		t.Fatalf("expected 4 pending migrations, got %v, %v", n, err)
+	}
+
+	ops := map[string]func() error{
+		"Up":       m.Up,
+		"Down":     m.Down,
+		"Steps":    func() error { return m.Steps(1) },
+		"Migrate":  func() error { return m.Migrate(3) },
+		"Redo":     func() error { return m.Redo(context.Background()) },
+		"Restore":  func() error { return m.Restore(context.Background(), CheckpointToken{Version: 3}) },
+		"Force":    func() error { return m.Force(3) },
+		"Baseline": func() error { return m.Baseline(3) },
+		"Drop":     m.Drop,
+		"Run": func() error {
+			migr, err := NewMigration(nil, "", 3, 3)
+			if err != nil {
+				return err
+			}
+			return m.Run(migr)
+		},
+	}
+	for name, op := range ops {
+		t.Run(name, func(t *testing.T) {
+			if err := op(); !errors.Is(err, ErrReadOnly) {
+				t.Fatalf("expected ErrReadOnly, got %v", err)
+			}
+		})
+	}
+
+	if dbDrv.CurrentVersion != 1 || len(dbDrv.MigrationSequence) != 0 {
+		t.Fatal("expected database not to be changed")
+	}
+}
+
+func TestUpDownWithLabel(t *testing.T) {
+	// orders migrations interleaved with migrations of other services
+	srcDrv, err := iofs.New(fstest.MapFS{
+		"1_create_users.users.up.sql":     {Data: []byte("CREATE users")},
+		"1_create_users.users.down.sql":   {Data: []byte("DROP users")},
+		"2_create_orders.orders.up.sql":   {Data: []byte("CREATE orders")},
+		"2_create_orders.orders.down.sql": {Data: []byte("DROP orders")},
+		"3_create_shared.up.sql":          {Data: []byte("CREATE shared")},
+		"4_add_index.orders.up.sql":       {Data: []byte("INDEX orders")},
+		"4_add_index.orders.down.sql":     {Data: []byte("DROP INDEX orders")},
+		"5_add_email.users.up.sql":        {Data: []byte("ALTER users")},
+	}, ".")
+	if err != nil {
+		t.Fatal(err)
+	}
+	dbDrv, _ := dStub.WithInstance(nil, &dStub.Config{})
+	m, err := NewWithInstance("iofs", source.NewLabelSource(srcDrv, "orders"), dbDrvNameStub, dbDrv)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := m.Up(); err != nil {
+		t.Fatal(err)
+	}
+	// the global version is recorded, but only labeled migrations have a body
+	equalDbSeq(t, 0, migrationSequence{mr(""), mr("CREATE orders"), mr(""), mr("INDEX orders"), mr("")}, dbDrv.(*dStub.Stub))
+	if v, dirty, err := m.Version(); err != nil || v != 5 || dirty {
+		t.Fatalf("expected clean version 5, got %v, %v, %v", v, dirty, err)
+	}
+
+	if err := m.Down(); err != nil {
+		t.Fatal(err)
+	}
+	equalDbSeq(t, 1, migrationSequence{mr(""), mr("CREATE orders"), mr(""), mr("INDEX orders"), mr(""),
+		mr("DROP INDEX orders"), mr("DROP orders"), mr("")}, dbDrv.(*dStub.Stub))
+	if _, _, err := m.Version(); !errors.Is(err, ErrNilVersion) {
+		t.Fatalf("expected ErrNilVersion, got %v", err)
+	}
+}
+
+// listingSource implements source.Lister and counts the calls traversing
+// the source version by version.
+type listingSource struct {
+	*sStub.Stub
+	traversals int
+}
+
+func (s *listingSource) First() (uint, error) {
+	s.traversals++
+	return s.Stub.First()
+}
+
+func (s *listingSource) Prev(version uint) (uint, error) {
+	s.traversals++
+	return s.Stub.Prev(version)
+}
+
+func (s *listingSource) Next(version uint) (uint, error) {
+	s.traversals++
+	return s.Stub.Next(version)
+}
+
+func (s *listingSource) List() ([]source.Migration, error) {
+	return s.Migrations.List(), nil
+}
+
+func TestUpDownWithLister(t *testing.T) {
+	srcDrv, _ := sStub.WithInstance(nil, &sStub.Config{})
+	srcDrv.(*sStub.Stub).Migrations = sourceStubMigrations
+	lister := &listingSource{Stub: srcDrv.(*sStub.Stub)}
+	dbDrv, _ := dStub.WithInstance(nil, &dStub.Config{})
+	m, err := NewWithInstance(srcDrvNameStub, lister, dbDrvNameStub, dbDrv)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := m.Up(); err != nil {
+		t.Fatal(err)
+	}
+	equalDbSeq(t, 0, migrationSequence{mr("CREATE 1"), mr("CREATE 3"), mr("CREATE 4"), mr("CREATE 7")}, dbDrv.(*dStub.Stub))
+
+	if err := m.Migrate(3); err != nil {
+		t.Fatal(err)
+	}
+	equalDbSeq(t, 1, migrationSequence{mr("CREATE 1"), mr("CREATE 3"), mr("CREATE 4"), mr("CREATE 7"),
+		mr("DROP 7"), mr("DROP 5"), mr("DROP 4")}, dbDrv.(*dStub.Stub))
+
+	if err := m.Migrate(2); !errors.Is(err, os.ErrNotExist) {
+		t.Fatalf("expected os.ErrNotExist, got %v", err)
+	}
+
+	if err := m.Down(); err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := m.Version(); !errors.Is(err, ErrNilVersion) {
+		t.Fatalf("expected ErrNilVersion, got %v", err)
+	}
+
+	if lister.traversals != 0 {
+		t.Errorf("expected no calls to First, Next or Prev, got %v", lister.traversals)
+	}
+}
+
+func TestCancelAndReset(t *testing.T) {
+	m, _ := New("stub://", "stub://")
+	m.sourceDrv.(*sStub.Stub).Migrations = sourceStubMigrations
+	dbDrv := m.databaseDrv.(*dStub.Stub)
+
+	// a second Cancel doesn't block
+	m.Cancel()
+	m.Cancel()
+
+	if err := m.Up(); err != nil {
+		t.Fatal(err)
+	}
+	if dbDrv.CurrentVersion != -1 {
+		t.Fatalf("expected no migration to run after Cancel, got version %v", dbDrv.CurrentVersion)
+	}
+
+	m.Reset()
+	if err := m.Up(); err != nil {
+		t.Fatal(err)
+	}
+	if dbDrv.CurrentVersion != 7 {
+		t.Errorf("expected version 7 after Reset, got %v", dbDrv.CurrentVersion)
+	}
+}
+
+// cancelingDatabase cancels a context after running its nth migration.
+type cancelingDatabase struct {
+	*dStub.Stub
+	cancel context.CancelFunc
+	n      int
+	runs   int
+}
+
+func (d *cancelingDatabase) RunContext(ctx context.Context, migration io.Reader) error {
+	return d.count(d.Stub.RunContext(ctx, migration))
+}
+
+func (d *cancelingDatabase) Run(migration io.Reader) error {
+	return d.count(d.Stub.Run(migration))
+}
+
+func (d *cancelingDatabase) count(err error) error {
+	d.runs++
+	if d.runs == d.n {
+		d.cancel()
+	}
+	return err
+}
+
+// blockingDatabase never acquires its lock.
+type blockingDatabase struct {
+	*dStub.Stub
+}
+
+func (d *blockingDatabase) Lock() error {
+	select {}
+}
+
+func TestWithContext(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	srcDrv, _ := sStub.WithInstance(nil, &sStub.Config{})
+	srcDrv.(*sStub.Stub).Migrations = sourceStubMigrations
+	dbDrv, _ := dStub.WithInstance(nil, &dStub.Config{})
+	db := &cancelingDatabase{Stub: dbDrv.(*dStub.Stub), cancel: cancel, n: 2}
+
+	m, err := NewWithInstance("stub", srcDrv, "stub", db, WithContext(ctx))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := m.Up(); !errors.Is(err, context.Canceled) {
+		t.Fatalf("expected %v, got %v", context.Canceled, err)
+	}
+	// stopped after the running migration
+	if db.CurrentVersion != 3 || db.IsDirty {
+		t.Errorf("expected clean version 3, got %v (dirty: %v)", db.CurrentVersion, db.IsDirty)
+	}
+}
+
+func TestWithContextLock(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	srcDrv, _ := sStub.WithInstance(nil, &sStub.Config{})
+	srcDrv.(*sStub.Stub).Migrations = sourceStubMigrations
+	dbDrv, _ := dStub.WithInstance(nil, &dStub.Config{})
+
+	m, err := NewWithInstance("stub", srcDrv, "stub", &blockingDatabase{dbDrv.(*dStub.Stub)}, WithContext(ctx))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := m.Up(); !errors.Is(err, context.Canceled) {
+		t.Errorf("expected %v, got %v", context.Canceled, err)
+	}
+}
+
+type ctxKey struct{}
+
+// contextDatabase records the values of ctxKey of the contexts it is
+// called with.
+type contextDatabase struct {
+	*dStub.Stub
+	values []interface{}
+}
+
+func (d *contextDatabase) LockContext(ctx context.Context) error {
+	d.values = append(d.values, ctx.Value(ctxKey{}))
+	return d.Stub.Lock()
+}
+
+func (d *contextDatabase) SetVersionContext(ctx context.Context, version int, dirty bool) error {
+	d.values = append(d.values, ctx.Value(ctxKey{}))
+	return d.Stub.SetVersion(version, dirty)
+}
+
+func (d *contextDatabase) RunContext(ctx context.Context, migration io.Reader) error {
+	d.values = append(d.values, ctx.Value(ctxKey{}))
+	return d.Stub.RunContext(ctx, migration)
+}
+
+func TestWithContextForwarded(t *testing.T) {
+	srcDrv, _ := sStub.WithInstance(nil, &sStub.Config{})
+	srcDrv.(*sStub.Stub).Migrations = sourceStubMigrations
+	dbDrv, _ := dStub.WithInstance(nil, &dStub.Config{})
+	db := &contextDatabase{Stub: dbDrv.(*dStub.Stub)}
+
+	// without WithContext, the driver is called without a context
+	m, _ := NewWithInstance("stub", srcDrv, "stub", db)
+	if err := m.Steps(1); err != nil {
+		t.Fatal(err)
+	}
+	if len(db.values) != 0 {
+		t.Fatalf("expected no context to be passed, got %v", db.values)
+	}
+
+	ctx := context.WithValue(context.Background(), ctxKey{}, "up")
+	m, _ = NewWithInstance("stub", srcDrv, "stub", db, WithContext(ctx))
+	if err := m.Steps(1); err != nil {
+		t.Fatal(err)
+	}
+	// lock, dirty version, run and clean version
+	expected := []interface{}{"up", "up", "up", "up"}
+	if !reflect.DeepEqual(db.values, expected) {
+		t.Errorf("expected contexts %v, got %v", expected, db.values)
+	}
+}
+
+// trackingBody counts the bytes read from it.
+type trackingBody struct {
+	io.ReadCloser
+	version uint
+	n       atomic.Int64
+	closed  atomic.Bool
+}
+
+func (b *trackingBody) Read(p []byte) (int, error) {
+	n, err := b.ReadCloser.Read(p)
+	b.n.Add(int64(n))
+	return n, err
+}
+
+func (b *trackingBody) Close() error {
+	b.closed.Store(true)
+	return b.ReadCloser.Close()
+}
+
+// trackingSource returns trackingBody bodies.
+type trackingSource struct {
+	*sStub.Stub
+	mu     sync.Mutex
+	bodies []*trackingBody
+}
+
+func (s *trackingSource) ReadUp(version uint) (io.ReadCloser, string, error) {
+	r, identifier, err := s.Stub.ReadUp(version)
+	if err != nil {
+		return nil, "", err
+	}
+	body := &trackingBody{ReadCloser: r, version: version}
+	s.mu.Lock()
+	s.bodies = append(s.bodies, body)
+	s.mu.Unlock()
+	return body, identifier, nil
+}
+
+// streamingDatabase checks that bodies are not read before they run.
+type streamingDatabase struct {
+	*dStub.Stub
+	src *trackingSource
+	t   *testing.T
+}
+
+func (d *streamingDatabase) Run(migration io.Reader) error {
+	// only the header of the next migration is read for TimeoutMarker
+	d.src.mu.Lock()
+	for _, body := range d.src.bodies {
+		if int(body.version) > d.CurrentVersion && body.n.Load() > timeoutHeaderSize {
+			d.t.Errorf("expected body of version %v not to be read before running %v, read %v bytes", body.version, d.CurrentVersion, body.n.Load())
+		}
+	}
+	d.src.mu.Unlock()
+	return d.Stub.Run(migration)
+}
+
+func TestNoPrefetchStreams(t *testing.T) {
+	large := strings.Repeat("-- large\n", timeoutHeaderSize)
+	migrations := source.NewMigrations()
+	migrations.Append(&source.Migration{Version: 1, Direction: source.Up, Identifier: "CREATE 1"})
+	migrations.Append(&source.Migration{Version: 2, Direction: source.Up, Identifier: large})
+	migrations.Append(&source.Migration{Version: 3, Direction: source.Up, Identifier: large})
+	srcDrv, _ := sStub.WithInstance(nil, &sStub.Config{})
+	srcDrv.(*sStub.Stub).Migrations = migrations
+	src := &trackingSource{Stub: srcDrv.(*sStub.Stub)}
+	dbDrv, _ := dStub.WithInstance(nil, &dStub.Config{})
+	db := &streamingDatabase{Stub: dbDrv.(*dStub.Stub), src: src, t: t}
+
+	m, err := NewWithInstance("stub", src, "stub", db)
+	if err != nil {
+		t.Fatal(err)
+	}
+	m.PrefetchMigrations = 0
+
+	if err := m.Up(); err != nil {
+		t.Fatal(err)
+	}
+
+	if expected := []string{"CREATE 1", large, large}; !reflect.DeepEqual(db.MigrationSequence, expected) {
+		t.Errorf("expected the migrations to run, got %d", len(db.MigrationSequence))
+	}
+	for _, body := range src.bodies {
+		if !body.closed.Load() {
+			t.Errorf("expected body of version %v to be closed", body.version)
+		}
+	}
+}
+
+// batchingDatabase runs batches against its stub, keeping the stub
+// unchanged if a migration body is "fail".
+type batchingDatabase struct {
+	*dStub.Stub
+}
+
+func (d *batchingDatabase) RunBatch(ctx context.Context, migrations []io.Reader, version int) error {
+	var sequence []string
+	for _, migration := range migrations {
+		body, err := io.ReadAll(migration)
+		if err != nil {
+			return err
+		}
+		if string(body) == "fail" {
+			return errors.New("migration failed")
+		}
+		sequence = append(sequence, string(body))
+	}
+	d.MigrationSequence = append(d.MigrationSequence, sequence...)
+	return d.SetVersion(version, false)
+}
+
+func newBatchMigration(t *testing.T, version uint, body string) *Migration {
+	t.Helper()
+	migr, err := NewMigration(io.NopCloser(strings.NewReader(body)), "", version, int(version))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return migr
+}
+
+func TestRunBatch(t *testing.T) {
+	srcDrv, _ := sStub.WithInstance(nil, &sStub.Config{})
+	dbDrv, _ := dStub.WithInstance(nil, &dStub.Config{})
+	db := &batchingDatabase{dbDrv.(*dStub.Stub)}
+	m, err := NewWithInstance("stub", srcDrv, "stub", db)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := m.RunBatch(context.Background(), NewBatch().Build()); !errors.Is(err, ErrNoChange) {
+		t.Errorf("expected %v, got %v", ErrNoChange, err)
+	}
+
+	batch := NewBatch().
+		Add(newBatchMigration(t, 2, "2 up")).
+		Add(newBatchMigration(t, 1, "1 up")).
+		Build()
+	if v := batch.Version(); v != 2 {
+		t.Errorf("expected batch version 2, got %v", v)
+	}
+	if err := m.RunBatch(context.Background(), batch); err != nil {
+		t.Fatal(err)
+	}
+	if db.CurrentVersion != 2 || db.IsDirty {
+		t.Errorf("expected clean version 2, got %v (dirty: %v)", db.CurrentVersion, db.IsDirty)
+	}
+	if seq := strings.Join(db.MigrationSequence, ","); seq != "2 up,1 up" {
+		t.Errorf("expected migrations in batch order, got %v", seq)
+	}
+
+	batch = NewBatch().
+		Add(newBatchMigration(t, 3, "3 up")).
+		Add(newBatchMigration(t, 4, "fail")).
+		Build()
+	if err := m.RunBatch(context.Background(), batch); err == nil {
+		t.Fatal("expected an error")
+	}
+	if db.CurrentVersion != 2 || db.IsDirty || len(db.MigrationSequence) != 2 {
+		t.Errorf("expected the failed batch to change nothing, got version %v (dirty: %v) and %v",
+			db.CurrentVersion, db.IsDirty, db.MigrationSequence)
+	}
+
+	db.IsDirty = true
+	batch = NewBatch().Add(newBatchMigration(t, 3, "3 up")).Build()
+	if err := m.RunBatch(context.Background(), batch); !errors.As(err, &ErrDirty{}) {
+		t.Errorf("expected ErrDirty, got %v", err)
+	}
+}
+
+func TestRunBatchNotSupported(t *testing.T) {
+	m, _ := New("stub://", "stub://")
+	batch := NewBatch().Add(newBatchMigration(t, 1, "1 up")).Build()
+	if err := m.RunBatch(context.Background(), batch); !errors.Is(err, ErrBatchNotSupported) {
+		t.Errorf("expected %v, got %v", ErrBatchNotSupported, err)
+	}
+}
+
+func TestBeforeAfterEach(t *testing.T) {
+	m, _ := New("stub://", "stub://")
+	m.sourceDrv.(*sStub.Stub).Migrations = sourceStubMigrations
+	dbDrv := m.databaseDrv.(*dStub.Stub)
+
+	var calls []string
+	m.BeforeEach = func(migr *Migration) error {
+		m.isLockedMu.Lock()
+		defer m.isLockedMu.Unlock()
+		if !m.isLocked {
+			t.Errorf("expected the database to be locked before %v", migr.Version)
+		}
+		calls = append(calls, fmt.Sprintf("before %v", migr.Version))
+		return nil
+	}
+	m.AfterEach = func(migr *Migration, err error) error {
+		calls = append(calls, fmt.Sprintf("after %v %v", migr.Version, err))
+		return nil
+	}
+	if err := m.Steps(2); err != nil {
+		t.Fatal(err)
+	}
+	expected := "before 1,after 1 <nil>,before 3,after 3 <nil>"
+	if got := strings.Join(calls, ","); got != expected {
+		t.Errorf("expected %v, got %v", expected, got)
+	}
+
+	// BeforeEach aborts before the migration runs
+	errBefore := errors.New("before")
+	m.BeforeEach = func(migr *Migration) error {
+		if migr.Version == 4 {
+			return errBefore
+		}
+		return nil
+	}
+	if err := m.Up(); !errors.Is(err, errBefore) {
+		t.Fatalf("expected %v, got %v", errBefore, err)
+	}
+	if dbDrv.CurrentVersion != 3 || dbDrv.IsDirty {
+		t.Errorf("expected clean version 3, got %v (dirty: %v)", dbDrv.CurrentVersion, dbDrv.IsDirty)
+	}
+
+	// AfterEach stops after the migration ran
+	errAfter := errors.New("after")
+	m.BeforeEach = nil
+	m.AfterEach = func(migr *Migration, err error) error {
+		return errAfter
+	}
+	if err := m.Up(); !errors.Is(err, errAfter) {
+		t.Fatalf("expected %v, got %v", errAfter, err)
+	}
+	if dbDrv.CurrentVersion != 4 || dbDrv.IsDirty {
+		t.Errorf("expected clean version 4, got %v (dirty: %v)", dbDrv.CurrentVersion, dbDrv.IsDirty)
+	}
+}
+
+func TestBaseline(t *testing.T) {
+	m, _ := New("stub://", "stub://")
+	m.sourceDrv.(*sStub.Stub).Migrations = sourceStubMigrations
+	dbDrv := m.databaseDrv.(*dStub.Stub)
+
+	if err := m.Baseline(2); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("expected %v for a version missing in the source, got %v", os.ErrNotExist, err)
+	}
+	if dbDrv.CurrentVersion != database.NilVersion {
+		t.Fatalf("expected no version, got %v", dbDrv.CurrentVersion)
+	}
+
+	if err := m.Baseline(4); err != nil {
+		t.Fatal(err)
+	}
+	if dbDrv.CurrentVersion != 4 || dbDrv.IsDirty {
+		t.Errorf("expected clean version 4, got %v (dirty: %v)", dbDrv.CurrentVersion, dbDrv.IsDirty)
+	}
+	if len(dbDrv.MigrationSequence) != 0 {
+		t.Errorf("expected no migration to run, got %v", dbDrv.MigrationSequence)
+	}
+
+	var versioned ErrAlreadyVersioned
+	if err := m.Baseline(1); !errors.As(err, &versioned) || versioned.Version != 4 {
+		t.Errorf("expected ErrAlreadyVersioned at 4, got %v", err)
+	}
+
+	// up continues after the baseline
+	if err := m.Up(); err != nil {
+		t.Fatal(err)
+	}
+	equalDbSeq(t, 0, newMigSeq(M(7)), dbDrv)
+	if dbDrv.CurrentVersion != 7 {
+		t.Errorf("expected version 7, got %v", dbDrv.CurrentVersion)
+	}
+}
+
+func TestErrDirtyIdentifier(t *testing.T) {
+	m, _ := New("stub://", "stub://")
+	m.sourceDrv.(*sStub.Stub).Migrations = sourceStubMigrations
+	dbDrv := m.databaseDrv.(*dStub.Stub)
+
+	tt := []struct {
+		name     string
+		version  int
+		expected string
+	}{
+		{name: "up", version: 3, expected: "Dirty database version 3 (3.up.stub). Fix and force version."},
+		{name: "down only", version: 5, expected: "Dirty database version 5 (5.down.stub). Fix and force version."},
+		{name: "orphaned", version: 6, expected: "Dirty database version 6, which has no migration in the source. Fix and force version."},
+		{name: "nil version", version: database.NilVersion, expected: "Dirty database version -1. Fix and force version."},
+	}
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			dbDrv.CurrentVersion = tc.version
+			dbDrv.IsDirty = true
+
+			err := m.Up()
+			var dirty ErrDirty
+			if !errors.As(err, &dirty) {
+				t.Fatalf("expected ErrDirty, got %v", err)
+			}
+			if err.Error() != tc.expected {
+				t.Errorf("expected %q, got %q", tc.expected, err.Error())
+			}
+			if !errors.Is(err, ErrDirty{Version: tc.version}) {
+				t.Errorf("expected %v to match ErrDirty of version %v", err, tc.version)
+			}
+		})
+	}
+}
+
+func TestErrorOnEmpty(t *testing.T) {
+	migrations := source.NewMigrations()
+	migrations.Append(&source.Migration{Version: 1, Direction: source.Up, Identifier: "CREATE 1"})
+	migrations.Append(&source.Migration{Version: 2, Direction: source.Up, Identifier: EmptyMigrationMarker + "\n"})
+	migrations.Append(&source.Migration{Version: 3, Direction: source.Up, Identifier: " \n-- forgot the SQL\n\t"})
+	migrations.Append(&source.Migration{Version: 3, Direction: source.Down, Identifier: ""})
+
+	m, _ := New("stub://", "stub://")
+	m.sourceDrv.(*sStub.Stub).Migrations = migrations
+	dbDrv := m.databaseDrv.(*dStub.Stub)
+
+	// empty migrations are applied by default
+	if err := m.Up(); err != nil {
+		t.Fatal(err)
+	}
+	if dbDrv.CurrentVersion != 3 {
+		t.Fatalf("expected version 3, got %v", dbDrv.CurrentVersion)
+	}
+	// down migrations are not checked
+	if err := m.Steps(-1); err != nil {
+		t.Fatal(err)
+	}
+
+	m.ErrorOnEmpty = true
+	err := m.Up()
+	expected := ErrEmptyMigration{Version: 3, Identifier: "3.up.stub"}
+	if !errors.Is(err, expected) {
+		t.Fatalf("expected %v, got %v", expected, err)
+	}
+	if dbDrv.CurrentVersion != 2 || dbDrv.IsDirty {
+		t.Errorf("expected clean version 2, got %v (dirty: %v)", dbDrv.CurrentVersion, dbDrv.IsDirty)
+	}
+	if n := len(dbDrv.MigrationSequence); n != 4 {
+		t.Errorf("expected 4 migrations to be run, got %v", n)
+	}
+}
+
+func TestIsEmptyBody(t *testing.T) {
+	tt := []struct {
+		body  string
+		empty bool
+	}{
+		{body: "", empty: true},
+		{body: " \n\t\n", empty: true},
+		{body: "-- TODO\n", empty: true},
+		{body: "-- TODO\nCREATE TABLE t ();", empty: false},
+		{body: EmptyMigrationMarker, empty: false},
+		{body: "-- intentionally left blank\n  " + EmptyMigrationMarker + "  \n", empty: false},
+	}
+	for _, tc := range tt {
+		if empty := isEmptyBody([]byte(tc.body)); empty != tc.empty {
+			t.Errorf("%q: expected %v, got %v", tc.body, tc.empty, empty)
+		}
+	}
+}
+
+// lockingDatabase guards the version of its stub, which is read
+// concurrently by WatchVersion.
+type lockingDatabase struct {
+	*dStub.Stub
+	mu sync.Mutex
+}
+
+func (d *lockingDatabase) SetVersion(version int, dirty bool) error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return d.Stub.SetVersion(version, dirty)
+}
+
+func (d *lockingDatabase) Version() (int, bool, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return d.Stub.Version()
+}
+
+func TestWatchVersion(t *testing.T) {
+	srcDrv, _ := sStub.WithInstance(nil, &sStub.Config{})
+	dbDrv, _ := dStub.WithInstance(nil, &dStub.Config{})
+	db := &lockingDatabase{Stub: dbDrv.(*dStub.Stub)}
+	m, err := NewWithInstance("stub", srcDrv, "stub", db)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := m.WatchVersion(context.Background(), 0); err == nil {
+		t.Error("expected an error for a zero interval")
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	changes, err := m.WatchVersion(ctx, time.Millisecond)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	receive := func() VersionChange {
+		t.Helper()
+		select {
+		case c := <-changes:
+			return c
+		case <-time.After(5 * time.Second):
+			t.Fatal("timeout waiting for a version change")
+		}
+		return VersionChange{}
+	}
+
+	if err := db.SetVersion(1, true); err != nil {
+		t.Fatal(err)
+	}
+	if c, expected := receive(), (VersionChange{OldVersion: database.NilVersion, NewVersion: 1, Dirty: true}); c != expected {
+		t.Errorf("expected %+v, got %+v", expected, c)
+	}
+	if err := db.SetVersion(1, false); err != nil {
+		t.Fatal(err)
+	}
+	if c, expected := receive(), (VersionChange{OldVersion: 1, NewVersion: 1}); c != expected {
+		t.Errorf("expected %+v, got %+v", expected, c)
+	}
+
+	cancel()
+	for range changes {
+	}
+}
+
+func TestTargetVersion(t *testing.T) {
+	m, _ := New("stub://", "stub://")
+	m.sourceDrv.(*sStub.Stub).Migrations = sourceStubMigrations
+	dbDrv := m.databaseDrv.(*dStub.Stub)
+
+	tt := []struct {
+		name        string
+		from        int
+		target      func() (uint, error)
+		expected    uint
+		expectedErr error
+	}{
+		{name: "up from nil version", from: -1, target: m.TargetUp, expected: 7},
+		{name: "up", from: 4, target: m.TargetUp, expected: 7},
+		{name: "up at the last version", from: 7, target: m.TargetUp, expected: 7},
+		{name: "down 1", from: 7, target: func() (uint, error) { return m.TargetDown(1) }, expected: 5},
+		{name: "down 3", from: 7, target: func() (uint, error) { return m.TargetDown(3) }, expected: 3},
+		{name: "down 0", from: 4, target: func() (uint, error) { return m.TargetDown(0) }, expected: 4},
+		{name: "down past the first version", from: 3, target: func() (uint, error) { return m.TargetDown(5) }, expectedErr: ErrNilVersion},
+		{name: "down all", from: 7, target: func() (uint, error) { return m.TargetDown(-1) }, expectedErr: ErrNilVersion},
+		{name: "down from nil version", from: -1, target: func() (uint, error) { return m.TargetDown(1) }, expectedErr: ErrNilVersion},
+		{name: "goto", from: 1, target: func() (uint, error) { return m.TargetGoto(5) }, expected: 5},
+		{name: "goto missing version", from: 1, target: func() (uint, error) { return m.TargetGoto(2) }, expectedErr: os.ErrNotExist},
+		{name: "current version missing", from: 2, target: m.TargetUp, expectedErr: os.ErrNotExist},
+	}
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			dbDrv.CurrentVersion = tc.from
+			v, err := tc.target()
+			if tc.expectedErr != nil {
+				if !errors.Is(err, tc.expectedErr) {
+					t.Errorf("expected %v, got %v (version %v)", tc.expectedErr, err, v)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if v != tc.expected {
+				t.Errorf("expected version %v, got %v", tc.expected, v)
+			}
+		})
+	}
+
+	// nothing is run
+	if len(dbDrv.MigrationSequence) != 0 {
+		t.Errorf("expected no migrations to be run, got %v", dbDrv.MigrationSequence)
+	}
+
+	dbDrv.CurrentVersion, dbDrv.IsDirty = 4, true
+	var dirty ErrDirty
+	if _, err := m.TargetUp(); !errors.As(err, &dirty) {
+		t.Errorf("expected ErrDirty, got %v", err)
+	}
+	dbDrv.IsDirty = false
+
+	// the targets match where the commands land
+	v, err := m.TargetDown(2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := m.Steps(-2); err != nil {
+		t.Fatal(err)
+	}
+	if dbDrv.CurrentVersion != int(v) {
+		t.Errorf("expected down 2 to land at %v, got %v", v, dbDrv.CurrentVersion)
+	}
+	if v, err = m.TargetUp(); err != nil {
+		t.Fatal(err)
+	}
+	if err := m.Up(); err != nil {
+		t.Fatal(err)
+	}
+	if dbDrv.CurrentVersion != int(v) {
+		t.Errorf("expected up to land at %v, got %v", v, dbDrv.CurrentVersion)
+	}
+}
+
+func TestPlanJSON(t *testing.T) {
+	m, _ := New("stub://", "stub://")
+	m.sourceDrv.(*sStub.Stub).Migrations = sourceStubMigrations
+	dbDrv := m.databaseDrv.(*dStub.Stub)
+
+	tt := []struct {
+		from     int
+		target   int
+		expected string
+	}{
+		{from: -1, target: 4, expected: `[{"version":1,"direction":"up","identifier":"1.up.stub","hasBody":true},` +
+			`{"version":3,"direction":"up","identifier":"3.up.stub","hasBody":true},` +
+			`{"version":4,"direction":"up","identifier":"4.up.stub","hasBody":true}]`},
+		{from: 4, target: 7, expected: `[{"version":5,"direction":"up","identifier":"","hasBody":false},` +
+			`{"version":7,"direction":"up","identifier":"7.up.stub","hasBody":true}]`},
+		{from: 5, target: -1, expected: `[{"version":5,"direction":"down","identifier":"5.down.stub","hasBody":true},` +
+			`{"version":4,"direction":"down","identifier":"4.down.stub","hasBody":true},` +
+			`{"version":3,"direction":"down","identifier":"","hasBody":false},` +
+			`{"version":1,"direction":"down","identifier":"1.down.stub","hasBody":true}]`},
+		{from: 3, target: 3, expected: `[]`},
+	}
+	for _, prefetch := range []uint{0, DefaultPrefetchMigrations} {
+		m.PrefetchMigrations = prefetch
+		for _, tc := range tt {
+			dbDrv.CurrentVersion = tc.from
+			b, err := m.PlanJSON(tc.target)
+			if err != nil {
+				t.Fatalf("%v => %v: %v", tc.from, tc.target, err)
+			}
+			if string(b) != tc.expected {
+				t.Errorf("%v => %v:\nexpected %s\ngot      %s", tc.from, tc.target, tc.expected, b)
+			}
+		}
+	}
+
+	// nothing is run
+	if len(dbDrv.MigrationSequence) != 0 {
+		t.Errorf("expected no migrations to be run, got %v", dbDrv.MigrationSequence)
+	}
+
+	dbDrv.CurrentVersion = 1
+	if _, err := m.PlanJSON(2); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("expected %v, got %v", os.ErrNotExist, err)
+	}
+	if _, err := m.PlanJSON(-2); !errors.Is(err, ErrInvalidVersion) {
+		t.Errorf("expected %v, got %v", ErrInvalidVersion, err)
+	}
+	dbDrv.IsDirty = true
+	if _, err := m.PlanJSON(4); !errors.Is(err, ErrDirty{Version: 1}) {
+		t.Errorf("expected %v, got %v", ErrDirty{Version: 1}, err)
+	}
+}
+
+func TestCheckpointRestore(t *testing.T) {
+	m, _ := New("stub://", "stub://")
+	m.sourceDrv.(*sStub.Stub).Migrations = sourceStubMigrations
+	dbDrv := m.databaseDrv.(*dStub.Stub)
+	ctx := context.Background()
+
+	nilToken, err := m.Checkpoint(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if nilToken.Version != database.NilVersion {
+		t.Errorf("expected nil version, got %v", nilToken.Version)
+	}
+
+	if err := m.Steps(2); err != nil {
+		t.Fatal(err)
+	}
+	token, err := m.Checkpoint(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// the token survives a round trip through JSON
+	b, err := json.Marshal(token)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var restored CheckpointToken
+	if err := json.Unmarshal(b, &restored); err != nil {
+		t.Fatal(err)
+	}
+	if restored.Version != 3 || !restored.CreatedAt.Equal(token.CreatedAt) {
+		t.Fatalf("expected %+v, got %+v", token, restored)
+	}
+
+	if err := m.Up(); err != nil {
+		t.Fatal(err)
+	}
+	if err := m.Restore(ctx, restored); err != nil {
+		t.Fatal(err)
+	}
+	equalDbSeq(t, 0, newMigSeq(M(1), M(3), M(4), M(7), M(7, 5), M(5, 4), M(4, 3)), dbDrv)
+	if dbDrv.CurrentVersion != 3 || dbDrv.IsDirty {
+		t.Errorf("expected clean version 3, got %v (dirty: %v)", dbDrv.CurrentVersion, dbDrv.IsDirty)
+	}
+
+	if err := m.Restore(ctx, restored); !errors.Is(err, ErrNoChange) {
+		t.Errorf("expected %v, got %v", ErrNoChange, err)
+	}
+
+	// a version missing in the source is rejected before migrating
+	dbDrv.MigrationSequence = nil
+	if err := m.Restore(ctx, CheckpointToken{Version: 2}); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("expected %v, got %v", os.ErrNotExist, err)
+	}
+	if len(dbDrv.MigrationSequence) != 0 || dbDrv.CurrentVersion != 3 {
+		t.Errorf("expected no migration to run, got %v", dbDrv.MigrationSequence)
+	}
+
+	cancelled, cancel := context.WithCancel(ctx)
+	cancel()
+	if err := m.Restore(cancelled, nilToken); !errors.Is(err, context.Canceled) {
+		t.Errorf("expected %v, got %v", context.Canceled, err)
+	}
+
+	if err := m.Restore(ctx, nilToken); err != nil {
+		t.Fatal(err)
+	}
+	if dbDrv.CurrentVersion != database.NilVersion {
+		t.Errorf("expected nil version, got %v", dbDrv.CurrentVersion)
+	}
+}
+
+func TestRedo(t *testing.T) {
+	m, _ := New("stub://", "stub://")
+	m.sourceDrv.(*sStub.Stub).Migrations = sourceStubMigrations
+	dbDrv := m.databaseDrv.(*dStub.Stub)
+	ctx := context.Background()
+
+	if err := m.Redo(ctx); !errors.Is(err, ErrNilVersion) {
+		t.Fatalf("expected %v, got %v", ErrNilVersion, err)
+	}
+
+	// the first migration is rolled back to nil version and applied again
+	if err := m.Steps(1); err != nil {
+		t.Fatal(err)
+	}
+	if err := m.Redo(ctx); err != nil {
+		t.Fatal(err)
+	}
+	equalDbSeq(t, 0, newMigSeq(M(1), M(1, -1), M(1)), dbDrv)
+
+	// version 3 has no down migration
+	if err := m.Steps(1); err != nil {
+		t.Fatal(err)
+	}
+	if err := m.Redo(ctx); !errors.Is(err, ErrNoDownMigration) {
+		t.Fatalf("expected %v, got %v", ErrNoDownMigration, err)
+	}
+
+	if err := m.Steps(1); err != nil {
+		t.Fatal(err)
+	}
+	if err := m.Redo(ctx); err != nil {
+		t.Fatal(err)
+	}
+	equalDbSeq(t, 1, newMigSeq(M(1), M(1, -1), M(1), M(3), M(4), M(4, 3), M(4)), dbDrv)
+	if dbDrv.CurrentVersion != 4 || dbDrv.IsDirty {
+		t.Errorf("expected clean version 4, got %v (dirty: %v)", dbDrv.CurrentVersion, dbDrv.IsDirty)
+	}
+
+	cancelled, cancel := context.WithCancel(ctx)
+	cancel()
+	if err := m.Redo(cancelled); !errors.Is(err, context.Canceled) {
+		t.Fatalf("expected %v, got %v", context.Canceled, err)
+	}
+
+	// the lock is released
+	if err := m.lock(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// lockRecordDatabase records the calls to Lock and Unlock with the number
+// of migrations run at the time.
+type lockRecordDatabase struct {
+	dStub.Stub
+	events []string
+}
+
+func (d *lockRecordDatabase) Lock() error {
+	d.events = append(d.events, fmt.Sprintf("lock after %v", len(d.MigrationSequence)))
+	return d.Stub.Lock()
+}
+
+func (d *lockRecordDatabase) Unlock() error {
+	d.events = append(d.events, fmt.Sprintf("unlock after %v", len(d.MigrationSequence)))
+	return d.Stub.Unlock()
+}
+
+func TestRebuild(t *testing.T) {
+	dbDrv := &lockRecordDatabase{}
+	dbDrv.CurrentVersion = -1
+	srcDrv, _ := (&sStub.Stub{}).Open("stub://")
+	srcDrv.(*sStub.Stub).Migrations = sourceStubMigrations
+	m, _ := NewWithInstance(srcDrvNameStub, srcDrv, dbDrvNameStub, dbDrv)
+
+	// only up at nil version
+	if err := m.Rebuild(); err != nil {
+		t.Fatal(err)
+	}
+	equalDbSeq(t, 0, newMigSeq(M(1), M(3), M(4), M(7)), &dbDrv.Stub)
+	if !reflect.DeepEqual(dbDrv.events, []string{"lock after 0", "unlock after 4"}) {
+		t.Errorf("expected one lock around the migrations, got %v", dbDrv.events)
+	}
+
+	dbDrv.MigrationSequence = nil
+	dbDrv.events = nil
+	if err := m.Rebuild(); err != nil {
+		t.Fatal(err)
+	}
+	equalDbSeq(t, 1, newMigSeq(M(7, 5), M(5, 4), M(4, 3), M(1, -1), M(1), M(3), M(4), M(7)), &dbDrv.Stub)
+	if !reflect.DeepEqual(dbDrv.events, []string{"lock after 0", "unlock after 8"}) {
+		t.Errorf("expected one lock around the migrations, got %v", dbDrv.events)
+	}
+	if dbDrv.CurrentVersion != 7 || dbDrv.IsDirty {
+		t.Errorf("expected clean version 7, got %v (dirty: %v)", dbDrv.CurrentVersion, dbDrv.IsDirty)
+	}
+
+	// a dirty database is not rebuilt
+	dbDrv.IsDirty = true
+	if err := m.Rebuild(); !errors.As(err, new(ErrDirty)) {
+		t.Fatalf("expected ErrDirty, got %v", err)
+	}
+}
+
+func TestForcePreviousOnError(t *testing.T) {
+	dbDrv := &runFailDatabase{failOn: "CREATE 4"}
+	dbDrv.CurrentVersion = -1
+	srcDrv, _ := (&sStub.Stub{}).Open("stub://")
+	srcDrv.(*sStub.Stub).Migrations = sourceStubMigrations
+	m, _ := NewWithInstance(srcDrvNameStub, srcDrv, dbDrvNameStub, dbDrv)
+	m.ForcePreviousOnError = true
+
+	err := m.Up()
+	if err == nil || err.Error() != "failed to run CREATE 4" {
+		t.Fatalf("expected the migration error, got %v", err)
+	}
+	if dbDrv.IsDirty || dbDrv.CurrentVersion != 3 {
+		t.Errorf("expected clean version 3, got %v (dirty: %v)", dbDrv.CurrentVersion, dbDrv.IsDirty)
+	}
+	equalDbSeq(t, 0, newMigSeq(M(1), M(3)), &dbDrv.Stub)
+
+	// the first migration fails back to nil version
+	dbDrv = &runFailDatabase{failOn: "CREATE 1"}
+	dbDrv.CurrentVersion = -1
+	m, _ = NewWithInstance(srcDrvNameStub, srcDrv, dbDrvNameStub, dbDrv)
+	m.ForcePreviousOnError = true
+	if err := m.Up(); err == nil {
+		t.Fatal("expected an error")
+	}
+	if dbDrv.IsDirty || dbDrv.CurrentVersion != database.NilVersion {
+		t.Errorf("expected clean nil version, got %v (dirty: %v)", dbDrv.CurrentVersion, dbDrv.IsDirty)
+	}
+}
+
+func TestUpDry(t *testing.T) {
+	m, _ := New("stub://", "stub://")
+	m.sourceDrv.(*sStub.Stub).Migrations = sourceStubMigrations
+	dbDrv := m.databaseDrv.(*dStub.Stub)
+	ctx := context.Background()
+
+	expected := "-- Migration 4: 4.up.stub\nCREATE 4\n" +
+		"-- Migration 5: <empty>\n" +
+		"-- Migration 7: 7.up.stub\nCREATE 7\n"
+	for _, prefetch := range []uint{0, DefaultPrefetchMigrations} {
+		m.PrefetchMigrations = prefetch
+		dbDrv.CurrentVersion = 3
+
+		var buf bytes.Buffer
+		if err := m.UpDry(ctx, &buf); err != nil {
+			t.Fatal(err)
+		}
+		if buf.String() != expected {
+			t.Errorf("prefetch %v: expected\n%v\ngot\n%v", prefetch, expected, buf.String())
+		}
+	}
+
+	// nothing is run
+	if len(dbDrv.MigrationSequence) != 0 || dbDrv.CurrentVersion != 3 {
+		t.Errorf("expected no migrations to be run, got %v at version %v", dbDrv.MigrationSequence, dbDrv.CurrentVersion)
+	}
+
+	// the database isn't locked
+	if err := m.lock(); err != nil {
+		t.Fatal(err)
+	}
+	if err := m.UpDry(ctx, io.Discard); err != nil {
+		t.Fatal(err)
+	}
+	if err := m.unlock(); err != nil {
+		t.Fatal(err)
+	}
+
+	dbDrv.CurrentVersion = 7
+	if err := m.UpDry(ctx, io.Discard); !errors.Is(err, ErrNoChange) {
+		t.Errorf("expected %v, got %v", ErrNoChange, err)
+	}
+
+	dbDrv.CurrentVersion = 3
+	cancelled, cancel := context.WithCancel(ctx)
+	cancel()
+	if err := m.UpDry(cancelled, io.Discard); !errors.Is(err, context.Canceled) {
+		t.Errorf("expected %v, got %v", context.Canceled, err)
+	}
+
+	dbDrv.IsDirty = true
+	if err := m.UpDry(ctx, io.Discard); !errors.Is(err, ErrDirty{Version: 3}) {
+		t.Errorf("expected %v, got %v", ErrDirty{Version: 3}, err)
+	}
+}
+
+type validatingDatabase struct {
+	dStub.Stub
+	invalid string
+}
+
+func (d *validatingDatabase) Validate(ctx context.Context, migration io.Reader) error {
+	body, err := io.ReadAll(migration)
+	if err != nil {
+		return err
+	}
+	if string(body) == d.invalid {
+		return errors.New("syntax error in " + d.invalid)
+	}
+	return nil
+}
+
+func TestMigrationValidator(t *testing.T) {
+	for _, prefetch := range []uint{0, DefaultPrefetchMigrations} {
+		dbDrv := &validatingDatabase{invalid: "CREATE 4"}
+		dbDrv.CurrentVersion = -1
+		srcDrv, _ := (&sStub.Stub{}).Open("stub://")
+		srcDrv.(*sStub.Stub).Migrations = sourceStubMigrations
+		m, _ := NewWithInstance(srcDrvNameStub, srcDrv, dbDrvNameStub, dbDrv)
+		m.PrefetchMigrations = prefetch
+
+		results, err := m.UpResult()
+		var invalid ErrInvalidMigration
+		if !errors.As(err, &invalid) || invalid.Version != 4 {
+			t.Fatalf("expected ErrInvalidMigration for version 4, got %v", err)
+		}
+		if dbDrv.IsDirty || dbDrv.CurrentVersion != 3 {
+			t.Errorf("expected clean version 3, got %v (dirty: %v)", dbDrv.CurrentVersion, dbDrv.IsDirty)
+		}
+		equalDbSeq(t, 0, newMigSeq(M(1), M(3)), &dbDrv.Stub)
+		if len(results) != 3 || results[2].Status != MigrationSkipped || results[2].Err != err {
+			t.Errorf("expected migration 4 to be skipped with the error, got %+v", results)
+		}
+
+		// valid migrations are run with their body
+		dbDrv.invalid = ""
+		if err := m.Up(); err != nil {
+			t.Fatal(err)
+		}
+		equalDbSeq(t, 1, newMigSeq(M(1), M(3), M(4), M(7)), &dbDrv.Stub)
+	}
+}
+
+func TestMigrateRange(t *testing.T) {
+	m, _ := New("stub://", "stub://")
+	m.sourceDrv.(*sStub.Stub).Migrations = sourceStubMigrations
+	dbDrv := m.databaseDrv.(*dStub.Stub)
+	ctx := context.Background()
+
+	if err := m.Up(); err != nil {
+		t.Fatal(err)
+	}
+
+	// the range is applied regardless of the current version
+	dbDrv.MigrationSequence = nil
+	if err := m.MigrateRange(ctx, 3, 5); err != nil {
+		t.Fatal(err)
+	}
+	equalDbSeq(t, 0, newMigSeq(M(3), M(4)), dbDrv) // 5 has no up migration
+	if dbDrv.CurrentVersion != 5 || dbDrv.IsDirty {
+		t.Errorf("expected clean version 5, got %v (dirty: %v)", dbDrv.CurrentVersion, dbDrv.IsDirty)
+	}
+
+	// going down applies the down migrations of both ends
+	dbDrv.MigrationSequence = nil
+	if err := m.MigrateRange(ctx, 4, 1); err != nil {
+		t.Fatal(err)
+	}
+	equalDbSeq(t, 1, newMigSeq(M(4, 3), M(1, -1)), dbDrv) // 3 has no down migration
+	if dbDrv.CurrentVersion != database.NilVersion {
+		t.Errorf("expected nil version, got %v", dbDrv.CurrentVersion)
+	}
+
+	// a single version
+	dbDrv.MigrationSequence = nil
+	if err := m.MigrateRange(ctx, 1, 1); err != nil {
+		t.Fatal(err)
+	}
+	equalDbSeq(t, 2, newMigSeq(M(1)), dbDrv)
+
+	// versions missing in the source are rejected before migrating
+	dbDrv.MigrationSequence = nil
+	for _, r := range [][2]uint{{2, 4}, {3, 6}} {
+		if err := m.MigrateRange(ctx, r[0], r[1]); !errors.Is(err, os.ErrNotExist) {
+			t.Errorf("%v: expected %v, got %v", r, os.ErrNotExist, err)
+		}
+	}
+	if len(dbDrv.MigrationSequence) != 0 || dbDrv.CurrentVersion != 1 {
+		t.Errorf("expected no migration to run, got %v", dbDrv.MigrationSequence)
+	}
+
+	// starting at the current version, it is applied again too
+	dbDrv.CurrentVersion = 3
+	if err := m.MigrateRange(ctx, 3, 7); err != nil {
+		t.Fatal(err)
+	}
+	equalDbSeq(t, 3, newMigSeq(M(3), M(4), M(7)), dbDrv)
+	if dbDrv.CurrentVersion != 7 || dbDrv.IsDirty {
+		t.Errorf("expected clean version 7, got %v (dirty: %v)", dbDrv.CurrentVersion, dbDrv.IsDirty)
+	}
+
+	dbDrv.IsDirty = true
+	if err := m.MigrateRange(ctx, 3, 7); !errors.As(err, new(ErrDirty)) {
+		t.Errorf("expected ErrDirty, got %v", err)
+	}
+}
+
+func TestMigrateRangeContext(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	srcDrv, _ := sStub.WithInstance(nil, &sStub.Config{})
+	srcDrv.(*sStub.Stub).Migrations = sourceStubMigrations
+	dbDrv, _ := dStub.WithInstance(nil, &dStub.Config{})
+	db := &cancelingDatabase{Stub: dbDrv.(*dStub.Stub), cancel: cancel, n: 2}
+
+	m, err := NewWithInstance("stub", srcDrv, "stub", db)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := m.MigrateRange(ctx, 1, 7); !errors.Is(err, context.Canceled) {
+		t.Fatalf("expected %v, got %v", context.Canceled, err)
+	}
+	// stopped after the running migration
+	equalDbSeq(t, 0, newMigSeq(M(1), M(3)), db.Stub)
+	if db.CurrentVersion != 3 || db.IsDirty {
+		t.Errorf("expected clean version 3, got %v (dirty: %v)", db.CurrentVersion, db.IsDirty)
+	}
+
+	// the context of MigrateRange doesn't stop later operations
+	if err := m.Up(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestHasher(t *testing.T) {
+	testCases := []struct {
+		algorithm string
+		expected  string
+	}{
+		{"", "2cf24dba5fb0a30e26e83b2ac5b9e29e1b161e5c1fa7425e73043362938b9824"},
+		{"sha256", "2cf24dba5fb0a30e26e83b2ac5b9e29e1b161e5c1fa7425e73043362938b9824"},
+		{"sha1", "aaf4c61ddcc5e8a2dabede0f3b482cd9aea9434d"},
+		{"sha512", "9b71d224bd62f3785d96d46ad3ea3d73319bfbc2890caadae2dff72519673ca72323c3d99ba5c11d7c7acc6e14b8c5da0c4663475c2e5c3adef46f73bcdec043"},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.algorithm, func(t *testing.T) {
+			sum, err := Hasher{Algorithm: tc.algorithm}.Hash(strings.NewReader("hello"))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if sum != tc.expected {
+				t.Errorf("expected %v, got %v", tc.expected, sum)
+			}
+		})
+	}
+
+	if _, err := (Hasher{Algorithm: "crc32"}).Hash(strings.NewReader("hello")); err == nil {
+		t.Error("expected an error for an unknown algorithm")
+	}
+}
+
+func TestMigrationChecksum(t *testing.T) {
+	for _, prefetch := range []uint{0, DefaultPrefetchMigrations} {
+		t.Run(fmt.Sprintf("prefetch %v", prefetch), func(t *testing.T) {
+			m, _ := New("stub://", "stub://")
+			m.sourceDrv.(*sStub.Stub).Migrations = sourceStubMigrations
+			m.PrefetchMigrations = prefetch
+			dbDrv := m.databaseDrv.(*dStub.Stub)
+
+			if err := m.Up(); err != nil {
+				t.Fatal(err)
+			}
+			for _, v := range []uint{1, 3, 4, 7} {
+				expected, err := DefaultHasher.Hash(strings.NewReader(fmt.Sprintf("CREATE %v", v)))
+				if err != nil {
+					t.Fatal(err)
+				}
+				if got, _ := dbDrv.GetChecksum(v); got != expected {
+					t.Errorf("expected checksum %v for version %v, got %v", expected, v, got)
+				}
+			}
+
+			// down migrations don't overwrite the checksums of up migrations
+			want := dbDrv.Checksums[4]
+			if err := m.Steps(-1); err != nil {
+				t.Fatal(err)
+			}
+			if got := dbDrv.Checksums[4]; got != want {
+				t.Errorf("expected checksum %v for version 4, got %v", want, got)
+			}
+		})
+	}
+}
+
+func TestMaxConcurrentDBCalls(t *testing.T) {
+	m, _ := New("stub://", "stub://")
+	if m.MaxConcurrentDBCalls != DefaultMaxConcurrentDBCalls {
+		t.Fatalf("expected %v, got %v", DefaultMaxConcurrentDBCalls, m.MaxConcurrentDBCalls)
+	}
+
+	for _, limit := range []int{1, 2, 0} {
+		t.Run(fmt.Sprintf("limit %v", limit), func(t *testing.T) {
+			m, _ := New("stub://", "stub://")
+			m.MaxConcurrentDBCalls = limit
+
+			// block calls until released, recording how many ran at once
+			var (
+				mu           sync.Mutex
+				running, max int
+			)
+			release := make(chan struct{})
+			call := func() error {
+				mu.Lock()
+				running++
+				if running > max {
+					max = running
+				}
+				mu.Unlock()
+				<-release
+				mu.Lock()
+				running--
+				mu.Unlock()
+				return nil
+			}
+
+			const calls = 3
+			var wg sync.WaitGroup
+			for i := 0; i < calls; i++ {
+				wg.Add(1)
+				go func() {
+					defer wg.Done()
+					if err := m.dbCall(call); err != nil {
+						t.Error(err)
+					}
+				}()
+			}
+			time.Sleep(50 * time.Millisecond)
+			close(release)
+			wg.Wait()
+
+			expected := limit
+			if limit <= 0 {
+				expected = calls
+			}
+			if max != expected {
+				t.Errorf("expected %v calls at once, got %v", expected, max)
+			}
+		})
+	}
+
+	// migrating works with a single call at once
+	m.sourceDrv.(*sStub.Stub).Migrations = sourceStubMigrations
+	m.MaxConcurrentDBCalls = 1
+	if err := m.Up(); err != nil {
+		t.Fatal(err)
+	}
+
+	// a Lock that timed out frees its call
+	srcDrv, _ := sStub.WithInstance(nil, &sStub.Config{})
+	dbDrv, _ := dStub.WithInstance(nil, &dStub.Config{})
+	m, _ = NewWithInstance("stub", srcDrv, "stub", &blockingDatabase{dbDrv.(*dStub.Stub)})
+	m.MaxConcurrentDBCalls = 1
+	m.LockTimeout = 10 * time.Millisecond
+	if err := m.Up(); !errors.Is(err, ErrLockTimeout) {
+		t.Fatalf("expected %v, got %v", ErrLockTimeout, err)
+	}
+	called := make(chan error, 1)
+	go func() {
+		called <- m.dbCall(func() error { return nil })
+	}()
+	select {
+	case err := <-called:
+		if err != nil {
+			t.Fatal(err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("expected the call of the timed out Lock to be freed")
+	}
+}
+
+func TestReadTimeout(t *testing.T) {
+	tt := []struct {
+		body    string
+		timeout time.Duration
+		err     bool
+	}{
+		{body: "CREATE TABLE t ();"},
+		{body: "-- migrate:timeout 30s\nCREATE TABLE t ();", timeout: 30 * time.Second},
+		{body: "\n-- long running\n  -- migrate:timeout\t1h30m \nCREATE INDEX i ON t (id);", timeout: 90 * time.Minute},
+		{body: "CREATE TABLE t ();\n-- migrate:timeout 30s\n"},
+		{body: "-- migrate:timeouts 30s\n"},
+		{body: "-- migrate:timeout\n", err: true},
+		{body: "-- migrate:timeout soon\n", err: true},
+		{body: "-- migrate:timeout -1s\n", err: true},
+	}
+	for _, tc := range tt {
+		r, timeout, err := readTimeout(strings.NewReader(tc.body))
+		if (err != nil) != tc.err {
+			t.Errorf("%q: expected error %v, got %v", tc.body, tc.err, err)
+			continue
+		}
+		if err != nil {
+			continue
+		}
+		if timeout != tc.timeout {
+			t.Errorf("%q: expected timeout %v, got %v", tc.body, tc.timeout, timeout)
+		}
+		// the whole body is still read
+		if body, _ := io.ReadAll(r); string(body) != tc.body {
+			t.Errorf("expected body %q, got %q", tc.body, body)
+		}
+	}
+}
+
+// deadlineDatabase records the deadlines of the contexts migrations run
+// with, and their values of ctxKey.
+type deadlineDatabase struct {
+	*dStub.Stub
+	deadlines []time.Duration
+	values    []interface{}
+}
+
+func (d *deadlineDatabase) RunContext(ctx context.Context, migration io.Reader) error {
+	if deadline, ok := ctx.Deadline(); ok {
+		d.deadlines = append(d.deadlines, time.Until(deadline))
+		d.values = append(d.values, ctx.Value(ctxKey{}))
+	}
+	return d.Stub.RunContext(ctx, migration)
+}
+
+func TestMigrationTimeout(t *testing.T) {
+	migrations := source.NewMigrations()
+	migrations.Append(&source.Migration{Version: 1, Direction: source.Up, Identifier: "CREATE 1"})
+	migrations.Append(&source.Migration{Version: 2, Direction: source.Up, Identifier: TimeoutMarker + " 1h\nCREATE 2"})
+	migrations.Append(&source.Migration{Version: 2, Direction: source.Down, Identifier: TimeoutMarker + " 1m\nDROP 2"})
+
+	m, _ := New("stub://", "stub://")
+	m.sourceDrv.(*sStub.Stub).Migrations = migrations
+	stub := m.databaseDrv.(*dStub.Stub)
+
+	// drivers without RunContext refuse migrations with a timeout
+	m.databaseDrv = struct{ database.Driver }{stub}
+	if err := m.Up(); !errors.Is(err, ErrTimeoutNotSupported) {
+		t.Fatalf("expected ErrTimeoutNotSupported, got %v", err)
+	}
+	if stub.CurrentVersion != 2 || !stub.IsDirty {
+		t.Errorf("expected dirty version 2, got %v (dirty: %v)", stub.CurrentVersion, stub.IsDirty)
+	}
+
+	if err := m.Force(1); err != nil {
+		t.Fatal(err)
+	}
+	db := &deadlineDatabase{Stub: stub}
+	m.databaseDrv = db
+	if err := m.Up(); err != nil {
+		t.Fatal(err)
+	}
+	if err := m.Steps(-1); err != nil {
+		t.Fatal(err)
+	}
+	if len(db.deadlines) != 2 ||
+		db.deadlines[0] <= 59*time.Minute || db.deadlines[0] > time.Hour ||
+		db.deadlines[1] <= 59*time.Second || db.deadlines[1] > time.Minute {
+		t.Errorf("expected deadlines in 1h and 1m, got %v", db.deadlines)
+	}
+}
+
+func TestNewMigrationTimeout(t *testing.T) {
+	migr, err := NewMigration(io.NopCloser(strings.NewReader(TimeoutMarker+" 30s\nCREATE 1")), "1_create", 1, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if migr.Timeout != 30*time.Second {
+		t.Errorf("expected timeout 30s, got %v", migr.Timeout)
+	}
+
+	// invalid markers are rejected before the migration runs
+	if _, err := NewMigration(io.NopCloser(strings.NewReader(TimeoutMarker+" soon\nCREATE 1")), "1_create", 1, 1); err == nil {
+		t.Error("expected an error for an invalid timeout")
+	}
+}
+
+func TestMigrationTimeoutWithContext(t *testing.T) {
+	migrations := source.NewMigrations()
+	migrations.Append(&source.Migration{Version: 1, Direction: source.Up, Identifier: TimeoutMarker + " 1h\nCREATE 1"})
+	srcDrv, _ := sStub.WithInstance(nil, &sStub.Config{})
+	srcDrv.(*sStub.Stub).Migrations = migrations
+	dbDrv, _ := dStub.WithInstance(nil, &dStub.Config{})
+
+	// the timeout is derived from the context of Migrate
+	db := &deadlineDatabase{Stub: dbDrv.(*dStub.Stub)}
+	ctx := context.WithValue(context.Background(), ctxKey{}, "up")
+	m, _ := NewWithInstance("stub", srcDrv, "stub", db, WithContext(ctx))
+	if err := m.Up(); err != nil {
+		t.Fatal(err)
+	}
+	if len(db.deadlines) != 1 || !reflect.DeepEqual(db.values, []interface{}{"up"}) {
+		t.Errorf("expected a deadline and the value of ctx, got %v and %v", db.deadlines, db.values)
+	}
+}
+
+var errSerialization = errors.New("serialization failure")
+
+// retryableDatabase fails SetVersion and Run with errSerialization as long
+// as their fail counters are positive.
+type retryableDatabase struct {
+	*dStub.Stub
+	failSetVersion, failRun int
+	backoffs                []int
+}
+
+func (d *retryableDatabase) SetVersion(version int, dirty bool) error {
+	if dirty && d.failSetVersion > 0 {
+		d.failSetVersion--
+		return errSerialization
+	}
+	return d.Stub.SetVersion(version, dirty)
+}
+
+func (d *retryableDatabase) Run(migration io.Reader) error {
+	if d.failRun > 0 {
+		d.failRun--
+		return errSerialization
+	}
+	return d.Stub.Run(migration)
+}
+
+func (d *retryableDatabase) IsRetryable(err error) bool {
+	return errors.Is(err, errSerialization)
+}
+
+func (d *retryableDatabase) RetryBackoff(attempt int) (time.Duration, bool) {
+	d.backoffs = append(d.backoffs, attempt)
+	return time.Millisecond, attempt <= 2
+}
+
+func TestRetryUp(t *testing.T) {
+	newRetrying := func(t *testing.T, db *retryableDatabase) *Migrate {
+		m, _ := New("stub://", "stub://")
+		m.sourceDrv.(*sStub.Stub).Migrations = sourceStubMigrations
+		db.Stub = m.databaseDrv.(*dStub.Stub)
+		m.databaseDrv = db
+		m.RetryUp = true
+		return m
+	}
+
+	t.Run("setting the version", func(t *testing.T) {
+		db := &retryableDatabase{failSetVersion: 2}
+		m := newRetrying(t, db)
+		if err := m.Up(); err != nil {
+			t.Fatal(err)
+		}
+		if db.CurrentVersion != 7 || db.IsDirty {
+			t.Errorf("expected clean version 7, got %v (dirty: %v)", db.CurrentVersion, db.IsDirty)
+		}
+		if !reflect.DeepEqual(db.backoffs, []int{1, 2}) {
+			t.Errorf("expected 2 retries, got %v", db.backoffs)
+		}
+	})
+
+	t.Run("retries exhausted", func(t *testing.T) {
+		db := &retryableDatabase{failSetVersion: 3}
+		m := newRetrying(t, db)
+		if err := m.Up(); !errors.Is(err, errSerialization) {
+			t.Fatalf("expected errSerialization, got %v", err)
+		}
+		if !reflect.DeepEqual(db.backoffs, []int{1, 2, 3}) {
+			t.Errorf("expected 3 backoffs, got %v", db.backoffs)
+		}
+	})
+
+	t.Run("running a migration", func(t *testing.T) {
+		db := &retryableDatabase{failRun: 1}
+		m := newRetrying(t, db)
+		m.ForcePreviousOnError = true
+		if err := m.Up(); !errors.Is(err, errSerialization) {
+			t.Fatalf("expected errSerialization, got %v", err)
+		}
+		if len(db.backoffs) != 0 {
+			t.Errorf("expected no retry after a migration body ran, got %v", db.backoffs)
+		}
+	})
+
+	t.Run("disabled", func(t *testing.T) {
+		db := &retryableDatabase{failSetVersion: 1}
+		m := newRetrying(t, db)
+		m.RetryUp = false
+		if err := m.Up(); !errors.Is(err, errSerialization) {
+			t.Fatalf("expected errSerialization, got %v", err)
+		}
+		if len(db.backoffs) != 0 {
+			t.Errorf("expected no retry, got %v", db.backoffs)
+		}
+	})
+}
@@ -2,7 +2,13 @@ package migrate
 
 import (
 	"bufio"
+	"bytes"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/hex"
 	"fmt"
+	"hash"
 	"io"
 	"time"
 )
@@ -11,6 +17,53 @@ import (
 // pre-read migration (see DefaultPrefetchMigrations).
 var DefaultBufferSize = uint(100000)
 
+// EmptyMigrationMarker marks an up migration as intentionally empty, see
+// Migrate.ErrorOnEmpty.
+const EmptyMigrationMarker = "-- migrate:empty"
+
+// DefaultHasher computes the Checksum of migrations created by NewMigration.
+var DefaultHasher = Hasher{}
+
+// Hasher computes deterministic content hashes of migrations.
+type Hasher struct {
+	// Algorithm is one of "sha256", "sha512" or "sha1".
+	// It defaults to "sha256".
+	Algorithm string
+}
+
+// Hash returns the hex-encoded hash of everything read from r.
+func (h Hasher) Hash(r io.Reader) (string, error) {
+	hh, err := h.new()
+	if err != nil {
+		return "", err
+	}
+	if _, err := io.Copy(hh, r); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(hh.Sum(nil)), nil
+}
+
+func (h Hasher) new() (hash.Hash, error) {
+	switch h.Algorithm {
+	case "", "sha256":
+		return sha256.New(), nil
+	case "sha512":
+		return sha512.New(), nil
+	case "sha1":
+		return sha1.New(), nil
+	default:
+		return nil, fmt.Errorf("unknown hash algorithm: %q", h.Algorithm)
+	}
+}
+
+// TimeoutMarker, followed by a duration in the leading comments of a
+// migration, like "-- migrate:timeout 30s", sets its Timeout.
+const TimeoutMarker = "-- migrate:timeout"
+
+// timeoutHeaderSize is how much of the start of a migration is searched for
+// TimeoutMarker.
+const timeoutHeaderSize = 4096
+
 // Migration holds information about a migration.
 // It is initially created from data coming from the source and then
 // used when run against the database.
@@ -54,12 +107,26 @@ type Migration struct {
 
 	// BytesRead holds the number of Bytes read from the migration source.
 	BytesRead int64
+
+	// Timeout is how long the migration may run, set with TimeoutMarker
+	// when the migration is created. It replaces the statement timeout of
+	// the database driver, which has to implement database.ContextRunner.
+	// 0 means no timeout.
+	Timeout time.Duration
+
+	// Checksum is the hex-encoded hash of the body, computed with
+	// DefaultHasher. It is set once the body has been read.
+	Checksum string
+
+	// hash computes Checksum while the body is read.
+	hash hash.Hash
 }
 
 // NewMigration returns a new Migration and sets the body, identifier,
 // version and targetVersion. Body can be nil, which turns this migration
 // into a "NilMigration". If no identifier is provided, it will default to "<empty>".
-// targetVersion can be -1, implying it is a NilVersion.
+// targetVersion can be -1, implying it is a NilVersion. The leading
+// comments of body are read for TimeoutMarker, setting Timeout.
 //
 // What is a NilMigration?
 // Usually each migration version coming from source is expected to have an
@@ -94,8 +161,24 @@ func NewMigration(body io.ReadCloser, identifier string,
 		return m, nil
 	}
 
+	r, timeout, err := readTimeout(body)
+	if err != nil {
+		return nil, fmt.Errorf("migration %v: %w", m.LogString(), err)
+	}
+	m.Timeout = timeout
+
+	h, err := DefaultHasher.new()
+	if err != nil {
+		return nil, err
+	}
+
 	br, bw := io.Pipe()
-	m.Body = body // want to simulate low latency? newSlowReader(body)
+	m.hash = h
+	// keep the header read by readTimeout
+	m.Body = struct {
+		io.Reader
+		io.Closer
+	}{r, body} // want to simulate low latency? newSlowReader(body)
 	m.BufferSize = DefaultBufferSize
 	m.BufferedBody = br
 	m.bufferWriter = bw
@@ -125,7 +208,7 @@ func (m *Migration) Buffer() error {
 
 	m.StartedBuffering = time.Now()
 
-	b := bufio.NewReaderSize(m.Body, int(m.BufferSize))
+	b := bufio.NewReaderSize(m.hashedBody(), int(m.BufferSize))
 
 	// start reading from body, peek won't move the read pointer though
 	// poor man's solution?
@@ -144,6 +227,7 @@ func (m *Migration) Buffer() error {
 
 	m.FinishedReading = time.Now()
 	m.BytesRead = n
+	m.setChecksum()
 
 	// close bufferWriter so Buffer knows that there is no
 	// more data coming
@@ -158,3 +242,132 @@ func (m *Migration) Buffer() error {
 
 	return nil
 }
+
+// stream calls run with Body, unbuffered, and closes Body afterwards.
+// It replaces Buffer and BufferedBody when migrations aren't prefetched.
+func (m *Migration) stream(run func(io.Reader) error) error {
+	m.StartedBuffering = time.Now()
+	m.FinishedBuffering = m.StartedBuffering
+
+	body := &countingReader{r: m.hashedBody()}
+	runErr := run(body)
+
+	m.FinishedReading = time.Now()
+	m.BytesRead = body.n
+	if runErr == nil {
+		m.setChecksum()
+	}
+
+	if err := m.Body.Close(); err != nil && runErr == nil {
+		return err
+	}
+	return runErr
+}
+
+// hashedBody returns Body, feeding everything read into the hash.
+func (m *Migration) hashedBody() io.Reader {
+	if m.hash == nil {
+		return m.Body
+	}
+	return io.TeeReader(m.Body, m.hash)
+}
+
+// setChecksum sets Checksum from the hash of the body read so far.
+func (m *Migration) setChecksum() {
+	if m.hash != nil {
+		m.Checksum = hex.EncodeToString(m.hash.Sum(nil))
+	}
+}
+
+// countingReader counts the bytes read from r.
+type countingReader struct {
+	r io.Reader
+	n int64
+}
+
+func (c *countingReader) Read(p []byte) (int, error) {
+	n, err := c.r.Read(p)
+	c.n += int64(n)
+	return n, err
+}
+
+// Batch is a group of migrations which succeed or fail together,
+// see Migrate.RunBatch.
+type Batch []*Migration
+
+// Version returns the highest version in the batch.
+func (b Batch) Version() uint {
+	var version uint
+	for _, migr := range b {
+		if migr.Version > version {
+			version = migr.Version
+		}
+	}
+	return version
+}
+
+// BatchBuilder builds a Batch, like NewBatch().Add(m1).Add(m2).Build().
+type BatchBuilder struct {
+	batch Batch
+}
+
+// NewBatch returns a builder for an empty Batch.
+func NewBatch() *BatchBuilder {
+	return &BatchBuilder{}
+}
+
+// Add appends migr to the batch.
+func (b *BatchBuilder) Add(migr *Migration) *BatchBuilder {
+	b.batch = append(b.batch, migr)
+	return b
+}
+
+// Build returns the batch, with the migrations in the order they were added.
+func (b *BatchBuilder) Build() Batch {
+	return append(Batch(nil), b.batch...)
+}
+
+// readTimeout returns the duration following TimeoutMarker in the leading
+// comments of body, or 0 if there is none, along with a reader for all of
+// body.
+func readTimeout(body io.Reader) (io.Reader, time.Duration, error) {
+	br := bufio.NewReaderSize(body, timeoutHeaderSize)
+	head, err := br.Peek(timeoutHeaderSize)
+	if err != nil && err != io.EOF {
+		return nil, 0, err
+	}
+	for _, line := range bytes.Split(head, []byte("\n")) {
+		line = bytes.TrimSpace(line)
+		if len(line) == 0 {
+			continue
+		}
+		if !bytes.HasPrefix(line, []byte("--")) {
+			break
+		}
+		rest, ok := bytes.CutPrefix(line, []byte(TimeoutMarker))
+		if !ok || (len(rest) > 0 && rest[0] != ' ' && rest[0] != '\t') {
+			continue
+		}
+		d, err := time.ParseDuration(string(bytes.TrimSpace(rest)))
+		if err != nil || d <= 0 {
+			return nil, 0, fmt.Errorf("invalid timeout in %q, expected a positive duration like 30s", line)
+		}
+		return br, d, nil
+	}
+	return br, 0, nil
+}
+
+// isEmptyBody reports whether body only holds whitespace and -- comments,
+// without EmptyMigrationMarker.
+func isEmptyBody(body []byte) bool {
+	for _, line := range bytes.Split(body, []byte("\n")) {
+		line = bytes.TrimSpace(line)
+		if bytes.Equal(line, []byte(EmptyMigrationMarker)) {
+			return false
+		}
+		if len(line) > 0 && !bytes.HasPrefix(line, []byte("--")) {
+			return false
+		}
+	}
+	return true
+}
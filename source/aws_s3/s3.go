@@ -7,11 +7,13 @@ import (
 	"os"
 	"path"
 	"strings"
+	"time"
 
 	"github.com/aws/aws-sdk-go/aws"
 	"github.com/aws/aws-sdk-go/aws/session"
 	"github.com/aws/aws-sdk-go/service/s3"
 	"github.com/aws/aws-sdk-go/service/s3/s3iface"
+	"github.com/golang-migrate/migrate/v4/internal/compress"
 	"github.com/golang-migrate/migrate/v4/source"
 )
 
@@ -28,6 +30,10 @@ type s3Driver struct {
 type Config struct {
 	Bucket string
 	Prefix string
+	// CacheFile is the path of a local file caching the migrations index.
+	// The bucket is only scanned again if objects were added, modified or
+	// deleted after the cache was written.
+	CacheFile string
 }
 
 func (s *s3Driver) Open(folder string) (source.Driver, error) {
@@ -70,12 +76,19 @@ func parseURI(uri string) (*Config, error) {
 	}
 
 	return &Config{
-		Bucket: u.Host,
-		Prefix: prefix,
+		Bucket:    u.Host,
+		Prefix:    prefix,
+		CacheFile: u.Query().Get("x-cache-file"),
 	}, nil
 }
 
 func (s *s3Driver) loadMigrations() error {
+	if s.config.CacheFile != "" {
+		if ok, err := s.loadCache(); err != nil || ok {
+			return err
+		}
+	}
+
 	output, err := s.s3client.ListObjects(&s3.ListObjectsInput{
 		Bucket:    aws.String(s.config.Bucket),
 		Prefix:    aws.String(s.config.Prefix),
@@ -84,19 +97,61 @@ func (s *s3Driver) loadMigrations() error {
 	if err != nil {
 		return err
 	}
+	cache := source.Cache{Migrations: s.migrations}
 	for _, object := range output.Contents {
-		_, fileName := path.Split(aws.StringValue(object.Key))
+		key := aws.StringValue(object.Key)
+		if modified := aws.TimeValue(object.LastModified); modified.After(cache.LastModified) {
+			cache.LastModified = modified
+		}
+		cache.ObjectCount++
+		_, fileName := path.Split(key)
 		m, err := source.DefaultParse(fileName)
 		if err != nil {
 			continue
 		}
 		if !s.migrations.Append(m) {
-			return fmt.Errorf("unable to parse file %v", aws.StringValue(object.Key))
+			return fmt.Errorf("unable to parse file %v", key)
 		}
 	}
+
+	if s.config.CacheFile != "" {
+		return source.WriteCacheFile(s.config.CacheFile, &cache)
+	}
 	return nil
 }
 
+// loadCache loads the migrations from the cache file, unless it doesn't
+// exist or objects were added, modified or deleted after it was written.
+// Listing the objects is still needed, but not parsing them.
+func (s *s3Driver) loadCache() (ok bool, err error) {
+	cache, err := source.ReadCacheFile(s.config.CacheFile)
+	if err != nil {
+		// missing or unreadable cache, scan the bucket instead
+		return false, nil
+	}
+
+	output, err := s.s3client.ListObjects(&s3.ListObjectsInput{
+		Bucket:    aws.String(s.config.Bucket),
+		Prefix:    aws.String(s.config.Prefix),
+		Delimiter: aws.String("/"),
+	})
+	if err != nil {
+		return false, err
+	}
+	var lastModified time.Time
+	for _, object := range output.Contents {
+		if modified := aws.TimeValue(object.LastModified); modified.After(lastModified) {
+			lastModified = modified
+		}
+	}
+	if !cache.Valid(lastModified, len(output.Contents)) {
+		return false, nil
+	}
+
+	s.migrations = cache.Migrations
+	return true, nil
+}
+
 func (s *s3Driver) Close() error {
 	return nil
 }
@@ -125,6 +180,10 @@ func (s *s3Driver) Next(version uint) (uint, error) {
 	return v, nil
 }
 
+func (s *s3Driver) List() ([]source.Migration, error) {
+	return s.migrations.List(), nil
+}
+
 func (s *s3Driver) ReadUp(version uint) (io.ReadCloser, string, error) {
 	if m, ok := s.migrations.Up(version); ok {
 		return s.open(m)
@@ -148,5 +207,9 @@ func (s *s3Driver) open(m *source.Migration) (io.ReadCloser, string, error) {
 	if err != nil {
 		return nil, "", err
 	}
-	return object.Body, m.Identifier, nil
+	body, err := compress.Decompress(key, object.Body)
+	if err != nil {
+		return nil, "", err
+	}
+	return body, m.Identifier, nil
 }
@@ -3,12 +3,15 @@ package awss3
 import (
 	"errors"
 	"io"
+	"path/filepath"
 	"strings"
 	"testing"
+	"time"
 
 	"github.com/aws/aws-sdk-go/aws"
 	"github.com/aws/aws-sdk-go/service/s3"
 	st "github.com/golang-migrate/migrate/v4/source/testing"
+	"github.com/klauspost/compress/zstd"
 	"github.com/stretchr/testify/assert"
 )
 
@@ -40,6 +43,50 @@ func Test(t *testing.T) {
 	st.Test(t, driver)
 }
 
+func TestCompressed(t *testing.T) {
+	enc, err := zstd.NewWriter(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s3Client := fakeS3{
+		bucket: "some-bucket",
+		objects: map[string]string{
+			"prod/migrations/1_foobar.up.sql.zst": string(enc.EncodeAll([]byte("1 up"), nil)),
+			"prod/migrations/1_foobar.down.sql":   "1 down",
+		},
+	}
+	driver, err := WithInstance(&s3Client, &Config{
+		Bucket: "some-bucket",
+		Prefix: "prod/migrations/",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	r, identifier, err := driver.ReadUp(1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+	assert.Equal(t, "foobar", identifier)
+	b, err := io.ReadAll(r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, "1 up", string(b))
+
+	r, _, err = driver.ReadDown(1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+	b, err = io.ReadAll(r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, "1 down", string(b))
+}
+
 func TestParseURI(t *testing.T) {
 	tests := []struct {
 		name   string
@@ -88,10 +135,84 @@ func TestParseURI(t *testing.T) {
 	}
 }
 
+func TestCacheFile(t *testing.T) {
+	s3Client := fakeS3{
+		bucket: "some-bucket",
+		objects: map[string]string{
+			"prod/migrations/1_foobar.up.sql": "1 up",
+			"prod/migrations/2_foobar.up.sql": "2 up",
+		},
+		modified: map[string]time.Time{
+			"prod/migrations/1_foobar.up.sql": time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC),
+			"prod/migrations/2_foobar.up.sql": time.Date(2024, 1, 2, 0, 0, 0, 0, time.UTC),
+		},
+	}
+	config := &Config{
+		Bucket:    "some-bucket",
+		Prefix:    "prod/migrations/",
+		CacheFile: filepath.Join(t.TempDir(), "cache"),
+	}
+
+	// first open scans the bucket and writes the cache
+	if _, err := WithInstance(&s3Client, config); err != nil {
+		t.Fatal(err)
+	}
+
+	// unchanged objects are served from the cache
+	driver, err := WithInstance(&s3Client, config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	v, err := driver.First()
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, uint(1), v)
+
+	// added migrations invalidate the cache, wherever they are listed
+	s3Client.objects["prod/migrations/0_foobar.up.sql"] = "0 up"
+	s3Client.modified["prod/migrations/0_foobar.up.sql"] = time.Date(2024, 1, 3, 0, 0, 0, 0, time.UTC)
+	driver, err = WithInstance(&s3Client, config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	v, err = driver.First()
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, uint(0), v)
+
+	// deleted migrations invalidate the cache too
+	delete(s3Client.objects, "prod/migrations/0_foobar.up.sql")
+	delete(s3Client.objects, "prod/migrations/1_foobar.up.sql")
+	driver, err = WithInstance(&s3Client, config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	v, err = driver.First()
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, uint(2), v)
+}
+
+func TestParseURIWithCacheFile(t *testing.T) {
+	actual, err := parseURI("s3://migration-bucket/production?x-cache-file=/tmp/migrations.cache")
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, &Config{
+		Bucket:    "migration-bucket",
+		Prefix:    "production/",
+		CacheFile: "/tmp/migrations.cache",
+	}, actual)
+}
+
 type fakeS3 struct {
 	s3.S3
-	bucket  string
-	objects map[string]string
+	bucket   string
+	objects  map[string]string
+	modified map[string]time.Time
 }
 
 func (s *fakeS3) ListObjects(input *s3.ListObjectsInput) (*s3.ListObjectsOutput, error) {
@@ -101,12 +222,17 @@ func (s *fakeS3) ListObjects(input *s3.ListObjectsInput) (*s3.ListObjectsOutput,
 	}
 	prefix := aws.StringValue(input.Prefix)
 	delimiter := aws.StringValue(input.Delimiter)
+	marker := aws.StringValue(input.Marker)
 	var output s3.ListObjectsOutput
 	for name := range s.objects {
+		if name <= marker {
+			continue
+		}
 		if strings.HasPrefix(name, prefix) {
 			if delimiter == "" || !strings.Contains(strings.Replace(name, prefix, "", 1), delimiter) {
 				output.Contents = append(output.Contents, &s3.Object{
-					Key: aws.String(name),
+					Key:          aws.String(name),
+					LastModified: aws.Time(s.modified[name]),
 				})
 			}
 		}
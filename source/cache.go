@@ -0,0 +1,104 @@
+package source
+
+import (
+	"bytes"
+	"encoding/gob"
+	"fmt"
+	"os"
+	"time"
+)
+
+// Serialize encodes the versions, directions, identifiers and raw locations
+// of all migrations, but not their bodies. Use Deserialize to decode them.
+func (i *Migrations) Serialize() ([]byte, error) {
+	var buf bytes.Buffer
+	if err := gob.NewEncoder(&buf).Encode(i.List()); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// Deserialize decodes migrations encoded with Serialize.
+func Deserialize(b []byte) (*Migrations, error) {
+	var ms []Migration
+	if err := gob.NewDecoder(bytes.NewReader(b)).Decode(&ms); err != nil {
+		return nil, err
+	}
+
+	i := NewMigrations()
+	for k := range ms {
+		if !i.Append(&ms[k]) {
+			return nil, fmt.Errorf("duplicate migration: %s", ms[k].Raw)
+		}
+	}
+	return i, nil
+}
+
+// Cache holds migrations scanned from a source, so that source drivers
+// listing remote objects don't have to scan them again on every start.
+type Cache struct {
+	// Migrations is the scanned migrations index.
+	Migrations *Migrations
+
+	// LastModified is the latest modification time of the scanned objects.
+	LastModified time.Time
+
+	// ObjectCount is the number of scanned objects. Along with LastModified,
+	// it tells drivers listing the objects again whether any were added,
+	// modified or deleted since.
+	ObjectCount int
+}
+
+// Valid reports whether the listed objects, with lastModified the latest
+// modification time among the count objects, are still the ones scanned
+// when the cache was written.
+func (c *Cache) Valid(lastModified time.Time, count int) bool {
+	return !lastModified.After(c.LastModified) && count == c.ObjectCount
+}
+
+type cacheFile struct {
+	LastModified time.Time
+	ObjectCount  int
+	Migrations   []byte
+}
+
+// ReadCacheFile reads a Cache written by WriteCacheFile.
+func ReadCacheFile(path string) (*Cache, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var cf cacheFile
+	if err := gob.NewDecoder(f).Decode(&cf); err != nil {
+		return nil, fmt.Errorf("invalid cache file %s: %w", path, err)
+	}
+	ms, err := Deserialize(cf.Migrations)
+	if err != nil {
+		return nil, fmt.Errorf("invalid cache file %s: %w", path, err)
+	}
+	return &Cache{
+		Migrations:   ms,
+		LastModified: cf.LastModified,
+		ObjectCount:  cf.ObjectCount,
+	}, nil
+}
+
+// WriteCacheFile writes c to path, replacing any existing file.
+func WriteCacheFile(path string, c *Cache) error {
+	b, err := c.Migrations.Serialize()
+	if err != nil {
+		return err
+	}
+
+	var buf bytes.Buffer
+	if err := gob.NewEncoder(&buf).Encode(cacheFile{
+		LastModified: c.LastModified,
+		ObjectCount:  c.ObjectCount,
+		Migrations:   b,
+	}); err != nil {
+		return err
+	}
+	return os.WriteFile(path, buf.Bytes(), 0644)
+}
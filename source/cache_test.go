@@ -0,0 +1,95 @@
+package source
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestSerialize(t *testing.T) {
+	ms := NewMigrations()
+	for _, raw := range []string{"1_a.up.sql", "1_a.down.sql", "3_b.up.sql", "0010_c.down.sql"} {
+		m, err := Parse(raw)
+		if err != nil {
+			t.Fatal(err)
+		}
+		ms.Append(m)
+	}
+
+	b, err := ms.Serialize()
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err := Deserialize(b)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(got.index) != 3 || got.index[0] != 1 || got.index[1] != 3 || got.index[2] != 10 {
+		t.Fatalf("expected versions [1 3 10], got %v", got.index)
+	}
+	for _, raw := range []string{"1_a.up.sql", "1_a.down.sql", "3_b.up.sql", "0010_c.down.sql"} {
+		expected, _ := Parse(raw)
+		m, ok := got.Get(expected.Version, expected.Direction)
+		if !ok {
+			t.Fatalf("expected %s to be deserialized", raw)
+		}
+		if *m != *expected {
+			t.Fatalf("expected %+v, got %+v", expected, m)
+		}
+	}
+	if _, ok := got.Down(3); ok {
+		t.Fatal("expected no down migration for version 3")
+	}
+}
+
+func TestDeserializeInvalid(t *testing.T) {
+	if _, err := Deserialize([]byte("not gob")); err == nil {
+		t.Fatal("expected err")
+	}
+}
+
+func TestCacheFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "cache")
+
+	if _, err := ReadCacheFile(path); !os.IsNotExist(err) {
+		t.Fatalf("expected not exist error, got %v", err)
+	}
+
+	ms := NewMigrations()
+	m, _ := Parse("1_a.up.sql")
+	ms.Append(m)
+	lastModified := time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)
+
+	if err := WriteCacheFile(path, &Cache{Migrations: ms, LastModified: lastModified, ObjectCount: 3}); err != nil {
+		t.Fatal(err)
+	}
+
+	c, err := ReadCacheFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !c.LastModified.Equal(lastModified) {
+		t.Fatalf("expected %v, got %v", lastModified, c.LastModified)
+	}
+	if c.ObjectCount != 3 {
+		t.Fatalf("expected 3 objects, got %v", c.ObjectCount)
+	}
+	if !c.Valid(lastModified, 3) {
+		t.Fatal("expected cache to be valid")
+	}
+	if c.Valid(lastModified.Add(time.Second), 3) || c.Valid(lastModified, 2) {
+		t.Fatal("expected cache to be invalid after objects changed")
+	}
+	if _, ok := c.Migrations.Up(1); !ok {
+		t.Fatal("expected up migration for version 1")
+	}
+
+	if err := os.WriteFile(path, []byte("corrupt"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := ReadCacheFile(path); err == nil {
+		t.Fatal("expected err")
+	}
+}
@@ -0,0 +1,191 @@
+package dbtable
+
+import (
+	"bytes"
+	"database/sql"
+	"fmt"
+	"io"
+	nurl "net/url"
+	"os"
+	"regexp"
+	"strings"
+
+	iurl "github.com/golang-migrate/migrate/v4/internal/url"
+	"github.com/golang-migrate/migrate/v4/source"
+)
+
+func init() {
+	source.Register("dbtable", &DBTable{})
+}
+
+var (
+	DefaultTable  = "migrations"
+	DefaultDriver = "sqlite"
+)
+
+var (
+	ErrNilConfig    = fmt.Errorf("no config")
+	ErrInvalidTable = fmt.Errorf("invalid table name")
+)
+
+var tableName = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*(\.[A-Za-z_][A-Za-z0-9_]*)?$`)
+
+// Config configures the table holding the migrations. The table has the
+// columns version, direction (up or down), identifier and body.
+type Config struct {
+	Table string
+}
+
+// DBTable reads migrations from rows of a table in a SQL database.
+type DBTable struct {
+	db         *sql.DB
+	config     *Config
+	migrations *source.Migrations
+}
+
+// Open opens the database at dbtable://dsn with the database/sql driver
+// named by x-driver, which defaults to sqlite. The driver has to be
+// registered by the program.
+func (d *DBTable) Open(url string) (source.Driver, error) {
+	purl, err := nurl.Parse(url)
+	if err != nil {
+		return nil, err
+	}
+	qv := purl.Query()
+
+	driverName := qv.Get("x-driver")
+	if driverName == "" {
+		driverName = DefaultDriver
+	}
+	dsn := strings.Replace(iurl.FilterCustomQuery(purl).String(), "dbtable://", "", 1)
+	db, err := sql.Open(driverName, dsn)
+	if err != nil {
+		return nil, err
+	}
+
+	dt, err := WithInstance(db, &Config{Table: qv.Get("x-table")})
+	if err != nil {
+		db.Close()
+		return nil, err
+	}
+	return dt, nil
+}
+
+// WithInstance reads the migrations index from config.Table in db.
+// Bodies are queried when a migration is read.
+func WithInstance(db *sql.DB, config *Config) (source.Driver, error) {
+	if config == nil {
+		return nil, ErrNilConfig
+	}
+	if config.Table == "" {
+		config.Table = DefaultTable
+	}
+	if !tableName.MatchString(config.Table) {
+		return nil, fmt.Errorf("%w: %q", ErrInvalidTable, config.Table)
+	}
+
+	d := &DBTable{
+		db:         db,
+		config:     config,
+		migrations: source.NewMigrations(),
+	}
+	if err := d.readIndex(); err != nil {
+		return nil, err
+	}
+	return d, nil
+}
+
+func (d *DBTable) readIndex() error {
+	query := `SELECT version, direction, identifier FROM ` + d.config.Table + ` ORDER BY version`
+	rows, err := d.db.Query(query)
+	if err != nil {
+		return fmt.Errorf("reading migrations from %v: %w", d.config.Table, err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var (
+			version    uint64
+			direction  string
+			identifier sql.NullString
+		)
+		if err := rows.Scan(&version, &direction, &identifier); err != nil {
+			return err
+		}
+		m := &source.Migration{
+			Version:    uint(version),
+			Identifier: identifier.String,
+			Direction:  source.Direction(strings.ToLower(direction)),
+		}
+		if m.Direction != source.Up && m.Direction != source.Down {
+			return fmt.Errorf("invalid direction %q for version %v", direction, version)
+		}
+		if !d.migrations.Append(m) {
+			return fmt.Errorf("duplicate %v migration for version %v", m.Direction, version)
+		}
+	}
+	return rows.Err()
+}
+
+// readBody queries the body of a migration. The version and direction are
+// inlined, as placeholders differ between database/sql drivers.
+func (d *DBTable) readBody(m *source.Migration) (io.ReadCloser, error) {
+	query := fmt.Sprintf(`SELECT body FROM %s WHERE version = %d AND LOWER(direction) = '%s'`,
+		d.config.Table, m.Version, m.Direction)
+	var body []byte
+	if err := d.db.QueryRow(query).Scan(&body); err != nil {
+		return nil, err
+	}
+	return io.NopCloser(bytes.NewReader(body)), nil
+}
+
+func (d *DBTable) Close() error {
+	return d.db.Close()
+}
+
+func (d *DBTable) First() (version uint, err error) {
+	if v, ok := d.migrations.First(); ok {
+		return v, nil
+	}
+	return 0, &os.PathError{Op: "first", Path: d.config.Table, Err: os.ErrNotExist}
+}
+
+func (d *DBTable) Prev(version uint) (prevVersion uint, err error) {
+	if v, ok := d.migrations.Prev(version); ok {
+		return v, nil
+	}
+	return 0, &os.PathError{Op: fmt.Sprintf("prev for version %v", version), Path: d.config.Table, Err: os.ErrNotExist}
+}
+
+func (d *DBTable) Next(version uint) (nextVersion uint, err error) {
+	if v, ok := d.migrations.Next(version); ok {
+		return v, nil
+	}
+	return 0, &os.PathError{Op: fmt.Sprintf("next for version %v", version), Path: d.config.Table, Err: os.ErrNotExist}
+}
+
+func (d *DBTable) ReadUp(version uint) (r io.ReadCloser, identifier string, err error) {
+	if m, ok := d.migrations.Up(version); ok {
+		r, err := d.readBody(m)
+		if err != nil {
+			return nil, "", err
+		}
+		return r, m.Identifier, nil
+	}
+	return nil, "", &os.PathError{Op: fmt.Sprintf("read version %v", version), Path: d.config.Table, Err: os.ErrNotExist}
+}
+
+func (d *DBTable) ReadDown(version uint) (r io.ReadCloser, identifier string, err error) {
+	if m, ok := d.migrations.Down(version); ok {
+		r, err := d.readBody(m)
+		if err != nil {
+			return nil, "", err
+		}
+		return r, m.Identifier, nil
+	}
+	return nil, "", &os.PathError{Op: fmt.Sprintf("read version %v", version), Path: d.config.Table, Err: os.ErrNotExist}
+}
+
+func (d *DBTable) List() ([]source.Migration, error) {
+	return d.migrations.List(), nil
+}
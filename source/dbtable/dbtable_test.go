@@ -0,0 +1,127 @@
+package dbtable
+
+import (
+	"database/sql"
+	"errors"
+	"io"
+	"path/filepath"
+	"testing"
+
+	st "github.com/golang-migrate/migrate/v4/source/testing"
+	_ "modernc.org/sqlite"
+)
+
+func fixture(t *testing.T, db *sql.DB, table string) {
+	t.Helper()
+	if _, err := db.Exec(`CREATE TABLE ` + table + ` (version INTEGER, direction TEXT, identifier TEXT, body BLOB)`); err != nil {
+		t.Fatal(err)
+	}
+	// inserted out of order, to check the index is sorted
+	rows := []struct {
+		version    uint
+		direction  string
+		identifier string
+	}{
+		{7, "down", "foobar"},
+		{1, "up", "foobar"},
+		{4, "up", "foobar"},
+		{1, "down", "foobar"},
+		{3, "up", "foobar"},
+		{4, "down", "foobar"},
+		{5, "down", "foobar"},
+		{7, "up", "foobar"},
+	}
+	for _, r := range rows {
+		body := r.direction + " " + r.identifier
+		if _, err := db.Exec(`INSERT INTO `+table+` VALUES (?, ?, ?, ?)`, r.version, r.direction, r.identifier, body); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func newInMemory(t *testing.T) *sql.DB {
+	t.Helper()
+	db, err := sql.Open("sqlite", ":memory:")
+	if err != nil {
+		t.Fatal(err)
+	}
+	// every connection gets its own in-memory database
+	db.SetMaxOpenConns(1)
+	return db
+}
+
+func Test(t *testing.T) {
+	db := newInMemory(t)
+	fixture(t, db, DefaultTable)
+
+	d, err := WithInstance(db, &Config{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer d.Close()
+	st.Test(t, d)
+
+	r, identifier, err := d.ReadDown(4)
+	if err != nil {
+		t.Fatal(err)
+	}
+	body, err := io.ReadAll(r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(body) != "down foobar" || identifier != "foobar" {
+		t.Errorf("expected down foobar, got %q %q", body, identifier)
+	}
+}
+
+func TestOpen(t *testing.T) {
+	dbfile := filepath.Join(t.TempDir(), "control.db")
+	db, err := sql.Open("sqlite", dbfile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	fixture(t, db, "schema_scripts")
+	if err := db.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	d, err := (&DBTable{}).Open("dbtable://" + dbfile + "?x-table=schema_scripts&x-driver=sqlite")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer d.Close()
+	st.Test(t, d)
+}
+
+func TestInvalidRows(t *testing.T) {
+	tt := []struct {
+		name  string
+		query string
+	}{
+		{name: "duplicate", query: `INSERT INTO migrations VALUES (1, 'up', 'again', '')`},
+		{name: "direction", query: `INSERT INTO migrations VALUES (2, 'sideways', 'foobar', '')`},
+	}
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			db := newInMemory(t)
+			defer db.Close()
+			fixture(t, db, DefaultTable)
+			if _, err := db.Exec(tc.query); err != nil {
+				t.Fatal(err)
+			}
+			if _, err := WithInstance(db, &Config{}); err == nil {
+				t.Error("expected an error")
+			}
+		})
+	}
+}
+
+func TestInvalidTable(t *testing.T) {
+	db := newInMemory(t)
+	defer db.Close()
+
+	_, err := WithInstance(db, &Config{Table: "migrations; DROP TABLE users"})
+	if !errors.Is(err, ErrInvalidTable) {
+		t.Errorf("expected %v, got %v", ErrInvalidTable, err)
+	}
+}
@@ -72,6 +72,34 @@ type Driver interface {
 	ReadDown(version uint) (r io.ReadCloser, identifier string, err error)
 }
 
+// Lister is an optional interface a driver can implement to return all
+// available migrations in a single call, e.g. from one directory listing
+// instead of a round-trip per First, Next or Prev call.
+type Lister interface {
+	// List returns all available migrations ordered by version.
+	List() ([]Migration, error)
+}
+
+// DriverInfo describes where a driver reads migrations from, for tooling
+// built on top of migrate.
+type DriverInfo struct {
+	// Name is the name the driver is registered with.
+	Name string
+
+	// Location is where the migrations are read from, without credentials.
+	Location string
+
+	// Checksum identifies the content of the migrations, like the SHA-256
+	// of an archive, for integrity logging. Empty if unknown.
+	Checksum string
+}
+
+// Describer is an optional interface a driver can implement to describe
+// where it reads migrations from.
+type Describer interface {
+	Describe() (DriverInfo, error)
+}
+
 // Open returns a new driver instance.
 func Open(url string) (Driver, error) {
 	u, err := nurl.Parse(url)
@@ -90,7 +118,20 @@ func Open(url string) (Driver, error) {
 		return nil, fmt.Errorf("source driver: unknown driver '%s' (forgotten import?)", u.Scheme)
 	}
 
-	return d.Open(url)
+	// x-label is handled here for all drivers, see LabelSource
+	q := u.Query()
+	label := q.Get("x-label")
+	if label == "" {
+		return d.Open(url)
+	}
+	q.Del("x-label")
+	u.RawQuery = q.Encode()
+
+	drv, err := d.Open(u.String())
+	if err != nil {
+		return nil, err
+	}
+	return NewLabelSource(drv, label), nil
 }
 
 // Register globally registers a driver.
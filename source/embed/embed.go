@@ -0,0 +1,45 @@
+// Package embed provides a helper to read migrations embedded with go:embed,
+// failing at program start if the embedded directory is misconfigured.
+package embed
+
+import (
+	"embed"
+	"errors"
+	"fmt"
+	"os"
+
+	"github.com/golang-migrate/migrate/v4/source"
+	"github.com/golang-migrate/migrate/v4/source/iofs"
+)
+
+// New returns a new iofs Driver reading the migrations in dir of fsys.
+// It returns an error if dir doesn't exist or contains no migrations.
+func New(fsys embed.FS, dir string) (source.Driver, error) {
+	d, err := iofs.New(fsys, dir)
+	if err != nil {
+		return nil, fmt.Errorf("embedded migrations: %w", err)
+	}
+	if _, err := d.First(); err != nil {
+		d.Close()
+		if errors.Is(err, os.ErrNotExist) {
+			return nil, fmt.Errorf("embedded migrations: no migrations found in %s", dir)
+		}
+		return nil, fmt.Errorf("embedded migrations: %w", err)
+	}
+	return d, nil
+}
+
+// MustEmbed is like New but panics if the migrations can't be read.
+// It is meant to be called when initializing package variables:
+//
+//	//go:embed migrations/*.sql
+//	var fs embed.FS
+//
+//	var migrations = embed.MustEmbed(fs, "migrations")
+func MustEmbed(fsys embed.FS, dir string) source.Driver {
+	d, err := New(fsys, dir)
+	if err != nil {
+		panic(err)
+	}
+	return d
+}
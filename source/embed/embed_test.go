@@ -0,0 +1,59 @@
+package embed
+
+import (
+	"embed"
+	"strings"
+	"testing"
+)
+
+//go:embed testdata
+var testdata embed.FS
+
+func TestMustEmbed(t *testing.T) {
+	d := MustEmbed(testdata, "testdata/migrations")
+	defer d.Close()
+
+	v, err := d.First()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if v != 1 {
+		t.Errorf("expected first version 1, got %v", v)
+	}
+	if v, err = d.Next(v); err != nil {
+		t.Fatal(err)
+	}
+	if v != 3 {
+		t.Errorf("expected next version 3, got %v", v)
+	}
+}
+
+func TestMustEmbedInvalid(t *testing.T) {
+	cases := []struct {
+		name string
+		dir  string
+		err  string
+	}{
+		{"missing directory", "testdata/missing", "testdata/missing"},
+		{"no migrations", "testdata/empty", "no migrations found in testdata/empty"},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			defer func() {
+				r := recover()
+				if r == nil {
+					t.Fatal("expected panic")
+				}
+				err, ok := r.(error)
+				if !ok {
+					t.Fatalf("expected error, got %v", r)
+				}
+				if !strings.Contains(err.Error(), c.err) {
+					t.Errorf("expected error containing %q, got %q", c.err, err)
+				}
+			}()
+			MustEmbed(testdata, c.dir)
+		})
+	}
+}
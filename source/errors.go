@@ -1,15 +1,26 @@
 package source
 
-import "os"
+import (
+	"fmt"
+	"os"
+)
 
 // ErrDuplicateMigration is an error type for reporting duplicate migration
 // files.
 type ErrDuplicateMigration struct {
 	Migration
 	os.FileInfo
+
+	// Existing is the migration previously found for the same version and
+	// direction, if known. Versions are compared numerically, so 9_a.up.sql
+	// and 0009_b.up.sql are duplicates.
+	Existing *Migration
 }
 
 // Error implements error interface.
 func (e ErrDuplicateMigration) Error() string {
+	if e.Existing != nil {
+		return fmt.Sprintf("duplicate migration file: %s (version %d is already defined by %s)", e.Name(), e.Version, e.Existing.Raw)
+	}
 	return "duplicate migration file: " + e.Name()
 }
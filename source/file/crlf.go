@@ -0,0 +1,44 @@
+package file
+
+import (
+	"bufio"
+	"io"
+)
+
+// crlfReader replaces the CRLF line endings of a migration with LF, so
+// that database drivers receive the same SQL regardless of the OS the
+// migration was written on. A lone CR is kept.
+type crlfReader struct {
+	r *bufio.Reader
+	c io.Closer
+}
+
+func newCRLFReader(rc io.ReadCloser) *crlfReader {
+	return &crlfReader{r: bufio.NewReader(rc), c: rc}
+}
+
+func (c *crlfReader) Read(p []byte) (int, error) {
+	n := 0
+	for n < len(p) {
+		b, err := c.r.ReadByte()
+		if err != nil {
+			if n > 0 && err == io.EOF {
+				return n, nil
+			}
+			return n, err
+		}
+		if b == '\r' {
+			// drop the CR of a CRLF, which may span two reads of the file
+			if next, err := c.r.Peek(1); err == nil && next[0] == '\n' {
+				continue
+			}
+		}
+		p[n] = b
+		n++
+	}
+	return n, nil
+}
+
+func (c *crlfReader) Close() error {
+	return c.c.Close()
+}
@@ -1,6 +1,7 @@
 package file
 
 import (
+	"io"
 	nurl "net/url"
 	"os"
 	"path/filepath"
@@ -19,25 +20,54 @@ type File struct {
 	path string
 }
 
+// Open reads the migrations in the directory of url. The x-pattern query
+// parameter replaces source.Regex to match the names of the migrations, see
+// source.PatternParse.
 func (f *File) Open(url string) (source.Driver, error) {
-	p, err := parseURL(url)
+	p, query, err := parseURL(url)
 	if err != nil {
 		return nil, err
 	}
+	parse := source.DefaultParse
+	if pattern := query.Get("x-pattern"); pattern != "" {
+		if parse, err = source.PatternParse(pattern); err != nil {
+			return nil, err
+		}
+	}
 	nf := &File{
 		url:  url,
 		path: p,
 	}
-	if err := nf.Init(os.DirFS(p), "."); err != nil {
+	if err := nf.InitWithParse(os.DirFS(p), ".", parse); err != nil {
 		return nil, err
 	}
 	return nf, nil
 }
 
-func parseURL(url string) (string, error) {
+// ReadUp is part of source.Driver interface implementation. CRLF line
+// endings are replaced with LF.
+func (f *File) ReadUp(version uint) (r io.ReadCloser, identifier string, err error) {
+	r, identifier, err = f.PartialDriver.ReadUp(version)
+	if err != nil {
+		return nil, "", err
+	}
+	return newCRLFReader(r), identifier, nil
+}
+
+// ReadDown is part of source.Driver interface implementation. CRLF line
+// endings are replaced with LF.
+func (f *File) ReadDown(version uint) (r io.ReadCloser, identifier string, err error) {
+	r, identifier, err = f.PartialDriver.ReadDown(version)
+	if err != nil {
+		return nil, "", err
+	}
+	return newCRLFReader(r), identifier, nil
+}
+
+func parseURL(url string) (string, nurl.Values, error) {
 	u, err := nurl.Parse(url)
 	if err != nil {
-		return "", err
+		return "", nil, err
 	}
 	// concat host and path to restore full path
 	// host might be `.`
@@ -50,7 +80,7 @@ func parseURL(url string) (string, error) {
 		// default to current directory if no path
 		wd, err := os.Getwd()
 		if err != nil {
-			return "", err
+			return "", nil, err
 		}
 		p = wd
 
@@ -58,9 +88,9 @@ func parseURL(url string) (string, error) {
 		// make path absolute if relative
 		abs, err := filepath.Abs(p)
 		if err != nil {
-			return "", err
+			return "", nil, err
 		}
 		p = abs
 	}
-	return p, nil
+	return p, u.Query(), nil
 }
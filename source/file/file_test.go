@@ -3,10 +3,14 @@ package file
 import (
 	"errors"
 	"fmt"
+	"io"
+	"net/url"
 	"os"
 	"path"
 	"path/filepath"
+	"strings"
 	"testing"
+	"testing/iotest"
 
 	st "github.com/golang-migrate/migrate/v4/source/testing"
 )
@@ -39,6 +43,53 @@ func Test(t *testing.T) {
 	st.Test(t, d)
 }
 
+func TestDirLayout(t *testing.T) {
+	tmpDir := t.TempDir()
+
+	// mix flat files and one directory per migration
+	mustWriteFile(t, tmpDir, "1_foobar.up.sql", "1 up")
+	mustWriteFile(t, tmpDir, "1_foobar.down.sql", "1 down")
+
+	mustCreateDir(t, tmpDir, "3_foobar")
+	mustWriteFile(t, tmpDir, "3_foobar/up.sql", "3 up")
+
+	mustCreateDir(t, tmpDir, "4_foobar")
+	mustWriteFile(t, tmpDir, "4_foobar/up.sql", "4 up")
+	mustWriteFile(t, tmpDir, "4_foobar/down.sql", "4 down")
+
+	mustWriteFile(t, tmpDir, "5_foobar.down.sql", "5 down")
+
+	mustCreateDir(t, tmpDir, "7_foobar")
+	mustWriteFile(t, tmpDir, "7_foobar/up.sql", "7 up")
+	mustWriteFile(t, tmpDir, "7_foobar/down.sql", "7 down")
+
+	// directories not following the layout are ignored
+	mustCreateDir(t, tmpDir, "foo")
+	mustWriteFile(t, tmpDir, "foo/up.sql", "")
+
+	f := &File{}
+	d, err := f.Open(scheme + tmpDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	st.Test(t, d)
+}
+
+func TestDirLayoutWithDuplicateVersion(t *testing.T) {
+	tmpDir := t.TempDir()
+
+	mustWriteFile(t, tmpDir, "1_foo.up.sql", "")
+	mustCreateDir(t, tmpDir, "1_bar")
+	mustWriteFile(t, tmpDir, "1_bar/up.sql", "")
+
+	f := &File{}
+	_, err := f.Open(scheme + tmpDir)
+	if err == nil {
+		t.Fatal("expected err not to be nil")
+	}
+}
+
 func TestOpen(t *testing.T) {
 	tmpDir := t.TempDir()
 
@@ -56,6 +107,45 @@ func TestOpen(t *testing.T) {
 	}
 }
 
+func TestOpenWithPattern(t *testing.T) {
+	tmpDir := t.TempDir()
+
+	// write files that meet driver test requirements, with dots as separator
+	mustWriteFile(t, tmpDir, "0001.foobar.up.sql", "1 up")
+	mustWriteFile(t, tmpDir, "0001.foobar.down.sql", "1 down")
+
+	mustWriteFile(t, tmpDir, "0003.foobar.up.sql", "3 up")
+
+	mustWriteFile(t, tmpDir, "0004.foobar.up.sql", "4 up")
+	mustWriteFile(t, tmpDir, "0004.foobar.down.sql", "4 down")
+
+	mustWriteFile(t, tmpDir, "0005.foobar.down.sql", "5 down")
+
+	mustWriteFile(t, tmpDir, "0007.foobar.up.sql", "7 up")
+	mustWriteFile(t, tmpDir, "0007.foobar.down.sql", "7 down")
+
+	// ignored by the pattern
+	mustWriteFile(t, tmpDir, "2_foobar.up.sql", "2 up")
+
+	pattern := url.QueryEscape(`^(?P<version>[0-9]+)\.(?P<name>[^.]+)\.(?P<direction>up|down)\.sql$`)
+	f := &File{}
+	d, err := f.Open(scheme + tmpDir + "?x-pattern=" + pattern)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	st.Test(t, d)
+}
+
+func TestOpenWithInvalidPattern(t *testing.T) {
+	tmpDir := t.TempDir()
+
+	f := &File{}
+	if _, err := f.Open(scheme + tmpDir + "?x-pattern=" + url.QueryEscape(`^([0-9]+)\.sql$`)); err == nil {
+		t.Error("expected an error for a pattern without named groups")
+	}
+}
+
 func TestOpenWithRelativePath(t *testing.T) {
 	tmpDir := t.TempDir()
 
@@ -133,6 +223,54 @@ func TestOpenWithDuplicateVersion(t *testing.T) {
 	}
 }
 
+func TestOpenWithMixedPadding(t *testing.T) {
+	tmpDir := t.TempDir()
+
+	// unpadded versions created before switching to zero-padded ones
+	for i := 1; i <= 9; i++ {
+		mustWriteFile(t, tmpDir, fmt.Sprintf("%d_foobar.up.sql", i), "")
+	}
+	mustWriteFile(t, tmpDir, "0010_foobar.up.sql", "")
+	mustWriteFile(t, tmpDir, "0011_foobar.up.sql", "")
+
+	f := &File{}
+	d, err := f.Open(scheme + tmpDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	v, err := d.First()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := uint(2); i <= 11; i++ {
+		if v, err = d.Next(v); err != nil {
+			t.Fatal(err)
+		}
+		if v != i {
+			t.Fatalf("expected version %d, got %d", i, v)
+		}
+	}
+}
+
+func TestOpenWithMixedPaddingDuplicateVersion(t *testing.T) {
+	tmpDir := t.TempDir()
+
+	mustWriteFile(t, tmpDir, "9_foo.up.sql", "")
+	mustWriteFile(t, tmpDir, "0009_bar.up.sql", "")
+
+	f := &File{}
+	_, err := f.Open(scheme + tmpDir)
+	if err == nil {
+		t.Fatal("expected err")
+	}
+	// directory entries are read in lexical order, so 0009_bar.up.sql comes first
+	expected := "duplicate migration file: 9_foo.up.sql (version 9 is already defined by 0009_bar.up.sql)"
+	if err.Error() != expected {
+		t.Fatalf("expected %q, got %q", expected, err.Error())
+	}
+}
+
 func TestClose(t *testing.T) {
 	tmpDir := t.TempDir()
 
@@ -147,12 +285,76 @@ func TestClose(t *testing.T) {
 	}
 }
 
+func TestReadCRLF(t *testing.T) {
+	tmpDir := t.TempDir()
+	mustWriteFile(t, tmpDir, "1_foobar.up.sql", "CREATE TABLE t (\r\n  id int\r\n);\r\n")
+	mustWriteFile(t, tmpDir, "1_foobar.down.sql", "DROP TABLE t;\rSELECT '\r';\n")
+
+	f := &File{}
+	d, err := f.Open(scheme + tmpDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, c := range []struct {
+		read     func(uint) (io.ReadCloser, string, error)
+		expected string
+	}{
+		{d.ReadUp, "CREATE TABLE t (\n  id int\n);\n"},
+		// lone CRs are kept
+		{d.ReadDown, "DROP TABLE t;\rSELECT '\r';\n"},
+	} {
+		r, _, err := c.read(1)
+		if err != nil {
+			t.Fatal(err)
+		}
+		body, err := io.ReadAll(r)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := r.Close(); err != nil {
+			t.Fatal(err)
+		}
+		if string(body) != c.expected {
+			t.Errorf("expected %q, got %q", c.expected, body)
+		}
+	}
+}
+
+func TestCRLFReader(t *testing.T) {
+	for _, c := range []struct {
+		in, expected string
+	}{
+		{"", ""},
+		{"a\r\nb", "a\nb"},
+		{"a\r\r\nb\r", "a\r\nb\r"},
+		{"\r\n\r\n", "\n\n"},
+		{"a\nb\n", "a\nb\n"},
+	} {
+		// one byte at a time, so CRLFs span reads
+		r := newCRLFReader(io.NopCloser(iotest.OneByteReader(strings.NewReader(c.in))))
+		body, err := io.ReadAll(iotest.OneByteReader(r))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(body) != c.expected {
+			t.Errorf("%q: expected %q, got %q", c.in, c.expected, body)
+		}
+	}
+}
+
 func mustWriteFile(t testing.TB, dir, file string, body string) {
 	if err := os.WriteFile(path.Join(dir, file), []byte(body), 06444); err != nil {
 		t.Fatal(err)
 	}
 }
 
+func mustCreateDir(t testing.TB, dir, name string) {
+	if err := os.Mkdir(path.Join(dir, name), os.ModePerm); err != nil {
+		t.Fatal(err)
+	}
+}
+
 func mustCreateBenchmarkDir(t *testing.B) (dir string) {
 	tmpDir := t.TempDir()
 
@@ -0,0 +1,191 @@
+package firestore
+
+import (
+	"context"
+	"fmt"
+	"io"
+	nurl "net/url"
+	"os"
+	"path"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/golang-migrate/migrate/v4/source"
+	firestorev1 "google.golang.org/api/firestore/v1"
+	"google.golang.org/api/option"
+)
+
+func init() {
+	source.Register("firestore", &Firestore{})
+}
+
+const (
+	DefaultDatabase = "(default)"
+	// FieldUp and FieldDown are the document fields holding the up and
+	// down migrations.
+	FieldUp   = "content_up"
+	FieldDown = "content_down"
+)
+
+var (
+	ErrNoProject         = fmt.Errorf("no project")
+	ErrInvalidCollection = fmt.Errorf("invalid collection path")
+)
+
+// documentID matches document IDs like 1_create_users.
+var documentID = regexp.MustCompile(`^([0-9]+)_(.*)$`)
+
+// Firestore reads migrations from the documents of a Firestore collection.
+// Each document named like VERSION_TITLE is a migration, with the up and
+// down migrations in its content_up and content_down string fields.
+type Firestore struct {
+	service    *firestorev1.Service
+	config     *Config
+	migrations *source.Migrations
+	bodies     map[string]string
+}
+
+type Config struct {
+	ProjectID string
+	// Database defaults to DefaultDatabase.
+	Database string
+	// Collection is the path of the collection, like migrations or
+	// services/billing/migrations.
+	Collection string
+}
+
+func (f *Firestore) Open(url string) (source.Driver, error) {
+	u, err := nurl.Parse(url)
+	if err != nil {
+		return nil, err
+	}
+
+	var opts []option.ClientOption
+	if file := u.Query().Get("credentials-file"); file != "" {
+		opts = append(opts, option.WithCredentialsFile(file))
+	}
+	service, err := firestorev1.NewService(context.Background(), opts...)
+	if err != nil {
+		return nil, err
+	}
+
+	return WithInstance(service, &Config{
+		ProjectID:  u.Host,
+		Database:   u.Query().Get("x-database"),
+		Collection: strings.Trim(u.Path, "/"),
+	})
+}
+
+// WithInstance lists the migrations of config.Collection with service.
+func WithInstance(service *firestorev1.Service, config *Config) (source.Driver, error) {
+	if config.ProjectID == "" {
+		return nil, ErrNoProject
+	}
+	if config.Database == "" {
+		config.Database = DefaultDatabase
+	}
+	if config.Collection == "" || strings.Count(config.Collection, "/")%2 != 0 {
+		return nil, fmt.Errorf("%w: %q", ErrInvalidCollection, config.Collection)
+	}
+
+	f := &Firestore{
+		service:    service,
+		config:     config,
+		migrations: source.NewMigrations(),
+		bodies:     make(map[string]string),
+	}
+	if err := f.loadMigrations(); err != nil {
+		return nil, err
+	}
+	return f, nil
+}
+
+func (f *Firestore) loadMigrations() error {
+	parent, collectionID := path.Split(f.config.Collection)
+	parent = path.Join("projects", f.config.ProjectID, "databases", f.config.Database, "documents", parent)
+
+	call := f.service.Projects.Databases.Documents.List(parent, collectionID).
+		MaskFieldPaths(FieldUp, FieldDown)
+	return call.Pages(context.Background(), func(page *firestorev1.ListDocumentsResponse) error {
+		for _, doc := range page.Documents {
+			if err := f.appendDocument(doc); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+func (f *Firestore) appendDocument(doc *firestorev1.Document) error {
+	_, id := path.Split(doc.Name)
+	matches := documentID.FindStringSubmatch(id)
+	if matches == nil {
+		return nil // ignore documents that we can't parse
+	}
+	version, err := strconv.ParseUint(matches[1], 10, 64)
+	if err != nil {
+		return nil
+	}
+
+	for field, direction := range map[string]source.Direction{FieldUp: source.Up, FieldDown: source.Down} {
+		value, ok := doc.Fields[field]
+		if !ok {
+			continue
+		}
+		m := &source.Migration{
+			Version:    uint(version),
+			Identifier: matches[2],
+			Direction:  direction,
+			Raw:        id + "/" + field,
+		}
+		if !f.migrations.Append(m) {
+			return fmt.Errorf("unable to parse document %v", doc.Name)
+		}
+		f.bodies[m.Raw] = value.StringValue
+	}
+	return nil
+}
+
+func (f *Firestore) Close() error {
+	return nil
+}
+
+func (f *Firestore) First() (version uint, err error) {
+	if v, ok := f.migrations.First(); ok {
+		return v, nil
+	}
+	return 0, &os.PathError{Op: "first", Path: f.config.Collection, Err: os.ErrNotExist}
+}
+
+func (f *Firestore) Prev(version uint) (prevVersion uint, err error) {
+	if v, ok := f.migrations.Prev(version); ok {
+		return v, nil
+	}
+	return 0, &os.PathError{Op: fmt.Sprintf("prev for version %v", version), Path: f.config.Collection, Err: os.ErrNotExist}
+}
+
+func (f *Firestore) Next(version uint) (nextVersion uint, err error) {
+	if v, ok := f.migrations.Next(version); ok {
+		return v, nil
+	}
+	return 0, &os.PathError{Op: fmt.Sprintf("next for version %v", version), Path: f.config.Collection, Err: os.ErrNotExist}
+}
+
+func (f *Firestore) ReadUp(version uint) (r io.ReadCloser, identifier string, err error) {
+	if m, ok := f.migrations.Up(version); ok {
+		return io.NopCloser(strings.NewReader(f.bodies[m.Raw])), m.Identifier, nil
+	}
+	return nil, "", &os.PathError{Op: fmt.Sprintf("read version %v", version), Path: f.config.Collection, Err: os.ErrNotExist}
+}
+
+func (f *Firestore) ReadDown(version uint) (r io.ReadCloser, identifier string, err error) {
+	if m, ok := f.migrations.Down(version); ok {
+		return io.NopCloser(strings.NewReader(f.bodies[m.Raw])), m.Identifier, nil
+	}
+	return nil, "", &os.PathError{Op: fmt.Sprintf("read version %v", version), Path: f.config.Collection, Err: os.ErrNotExist}
+}
+
+func (f *Firestore) List() ([]source.Migration, error) {
+	return f.migrations.List(), nil
+}
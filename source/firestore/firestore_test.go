@@ -0,0 +1,90 @@
+package firestore
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	st "github.com/golang-migrate/migrate/v4/source/testing"
+	firestorev1 "google.golang.org/api/firestore/v1"
+	"google.golang.org/api/option"
+)
+
+// newFakeFirestore serves the documents of the collection at parent,
+// two documents per page.
+func newFakeFirestore(t *testing.T, parent string, docs map[string]map[string]string) *firestorev1.Service {
+	t.Helper()
+
+	var documents []*firestorev1.Document
+	for id, fields := range docs {
+		doc := &firestorev1.Document{Name: parent + "/" + id, Fields: map[string]firestorev1.Value{}}
+		for field, value := range fields {
+			doc.Fields[field] = firestorev1.Value{StringValue: value}
+		}
+		documents = append(documents, doc)
+	}
+
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/v1/"+parent {
+			http.NotFound(w, r)
+			return
+		}
+		start := 0
+		if token := r.URL.Query().Get("pageToken"); token != "" {
+			start = len(token)
+		}
+		end := start + 2
+		resp := &firestorev1.ListDocumentsResponse{}
+		if end < len(documents) {
+			resp.NextPageToken = strings.Repeat(".", end)
+		} else {
+			end = len(documents)
+		}
+		resp.Documents = documents[start:end]
+		_ = json.NewEncoder(w).Encode(resp)
+	}))
+	t.Cleanup(ts.Close)
+
+	service, err := firestorev1.NewService(context.Background(),
+		option.WithEndpoint(ts.URL+"/"),
+		option.WithHTTPClient(ts.Client()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return service
+}
+
+func Test(t *testing.T) {
+	service := newFakeFirestore(t, "projects/some-project/databases/(default)/documents/prod/schema/migrations",
+		map[string]map[string]string{
+			"1_foobar":          {FieldUp: "1 up", FieldDown: "1 down"},
+			"3_foobar":          {FieldUp: "3 up"},
+			"4_foobar":          {FieldUp: "4 up", FieldDown: "4 down"},
+			"5_foobar":          {FieldDown: "5 down"},
+			"7_foobar":          {FieldUp: "7 up", FieldDown: "7 down"},
+			"not-a-migration":   {FieldUp: "ignored"},
+			"8_without_content": {"comment": "ignored"},
+		})
+
+	driver, err := WithInstance(service, &Config{
+		ProjectID:  "some-project",
+		Collection: "prod/schema/migrations",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	st.Test(t, driver)
+}
+
+func TestInvalidCollection(t *testing.T) {
+	for _, collection := range []string{"", "migrations/doc"} {
+		_, err := WithInstance(nil, &Config{ProjectID: "some-project", Collection: collection})
+		if !errors.Is(err, ErrInvalidCollection) {
+			t.Errorf("%q: expected %v, got %v", collection, ErrInvalidCollection, err)
+		}
+	}
+}
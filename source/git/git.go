@@ -0,0 +1,233 @@
+package git
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	nurl "net/url"
+	"os"
+	"path"
+	"strconv"
+	"strings"
+
+	billyfs "github.com/go-git/go-billy/v5/helper/iofs"
+	"github.com/go-git/go-billy/v5/memfs"
+	"github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/config"
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/plumbing/transport"
+	"github.com/go-git/go-git/v5/plumbing/transport/http"
+	"github.com/go-git/go-git/v5/plumbing/transport/ssh"
+	"github.com/go-git/go-git/v5/storage/memory"
+	"github.com/golang-migrate/migrate/v4/source"
+	"github.com/golang-migrate/migrate/v4/source/iofs"
+)
+
+func init() {
+	source.Register("git", &Git{})
+}
+
+// DefaultDepth is the depth of the clone, only the latest commit is needed.
+const DefaultDepth = 1
+
+var ErrNoRepository = errors.New("no repository, expected an URL like git://https://host/repo.git/path")
+
+// Git reads migrations from a clone of a git repository, in memory or in a
+// temporary directory removed on Close.
+type Git struct {
+	iofs.PartialDriver
+	config *Config
+	// dir is the clone, empty when in memory
+	dir string
+}
+
+type Config struct {
+	// Repository is the URL of the repository, like
+	// https://github.com/org/repo.git or ssh://git@github.com/org/repo.git.
+	Repository string
+	// Path is the directory of the migrations in the repository.
+	Path string
+	// Ref is the branch or tag to clone, defaults to the default branch.
+	Ref string
+	// Username and Token authenticate HTTP(S) repositories. Username
+	// defaults to x-access-token.
+	Username string
+	Token    string
+	// SSHKeyFile is the private key for SSH repositories.
+	SSHKeyFile string
+	// Depth defaults to DefaultDepth.
+	Depth int
+	// InMemory clones the repository in memory instead of a temporary
+	// directory.
+	InMemory bool
+}
+
+// Open clones git://https://host/org/repo.git/path?ref=main&auth-token=xxx.
+func (g *Git) Open(url string) (source.Driver, error) {
+	if !strings.HasPrefix(url, "git://") {
+		return nil, ErrNoRepository
+	}
+	u, err := nurl.Parse(strings.TrimPrefix(url, "git://"))
+	if err != nil {
+		return nil, err
+	}
+	qv := u.Query()
+
+	repoPath, migrationsPath, ok := splitRepository(u.Path)
+	if !ok {
+		return nil, ErrNoRepository
+	}
+
+	config := &Config{
+		Path:       migrationsPath,
+		Ref:        qv.Get("ref"),
+		Username:   qv.Get("x-username"),
+		Token:      qv.Get("auth-token"),
+		SSHKeyFile: qv.Get("x-ssh-key-file"),
+	}
+	if s := qv.Get("x-depth"); s != "" {
+		if config.Depth, err = strconv.Atoi(s); err != nil {
+			return nil, fmt.Errorf("invalid x-depth: %w", err)
+		}
+	}
+	if s := qv.Get("x-in-memory"); s != "" {
+		if config.InMemory, err = strconv.ParseBool(s); err != nil {
+			return nil, fmt.Errorf("invalid x-in-memory: %w", err)
+		}
+	}
+
+	u.Path = repoPath
+	u.RawQuery = ""
+	config.Repository = u.String()
+
+	return New(config)
+}
+
+// splitRepository splits a URL path at the .git suffix of the repository.
+func splitRepository(p string) (repo, migrations string, ok bool) {
+	if strings.HasSuffix(p, ".git") {
+		return p, "", true
+	}
+	i := strings.Index(p, ".git/")
+	if i < 0 {
+		return "", "", false
+	}
+	return p[:i+len(".git")], strings.Trim(p[i+len(".git"):], "/"), true
+}
+
+// New clones config.Repository and reads the migrations in config.Path.
+func New(config *Config) (source.Driver, error) {
+	if config.Repository == "" {
+		return nil, ErrNoRepository
+	}
+	if config.Depth == 0 {
+		config.Depth = DefaultDepth
+	}
+
+	g := &Git{
+		config: config,
+	}
+	fsys, err := g.clone()
+	if err != nil {
+		os.RemoveAll(g.dir)
+		return nil, err
+	}
+
+	migrationsPath := path.Clean("/" + config.Path)[1:]
+	if migrationsPath == "" {
+		migrationsPath = "."
+	}
+	if err := g.Init(fsys, migrationsPath); err != nil {
+		os.RemoveAll(g.dir)
+		return nil, err
+	}
+	return g, nil
+}
+
+func (g *Git) auth() (transport.AuthMethod, error) {
+	if g.config.SSHKeyFile != "" {
+		return ssh.NewPublicKeysFromFile("git", g.config.SSHKeyFile, "")
+	}
+	if g.config.Token != "" {
+		username := g.config.Username
+		if username == "" {
+			username = "x-access-token"
+		}
+		return &http.BasicAuth{Username: username, Password: g.config.Token}, nil
+	}
+	return nil, nil
+}
+
+// reference resolves config.Ref to a branch or a tag of the repository.
+func (g *Git) reference(auth transport.AuthMethod) (plumbing.ReferenceName, error) {
+	if g.config.Ref == "" {
+		return plumbing.HEAD, nil
+	}
+	remote := git.NewRemote(memory.NewStorage(), &config.RemoteConfig{
+		Name: git.DefaultRemoteName,
+		URLs: []string{g.config.Repository},
+	})
+	refs, err := remote.List(&git.ListOptions{Auth: auth})
+	if err != nil {
+		return "", err
+	}
+	for _, name := range []plumbing.ReferenceName{
+		plumbing.NewBranchReferenceName(g.config.Ref),
+		plumbing.NewTagReferenceName(g.config.Ref),
+	} {
+		for _, ref := range refs {
+			if ref.Name() == name {
+				return name, nil
+			}
+		}
+	}
+	return "", fmt.Errorf("no branch or tag %v", g.config.Ref)
+}
+
+// clone clones the repository in memory or in a temporary directory and
+// returns its worktree.
+func (g *Git) clone() (fs.FS, error) {
+	auth, err := g.auth()
+	if err != nil {
+		return nil, fmt.Errorf("cloning %v: %w", g.config.Repository, err)
+	}
+	ref, err := g.reference(auth)
+	if err != nil {
+		return nil, fmt.Errorf("cloning %v: %w", g.config.Repository, err)
+	}
+	options := &git.CloneOptions{
+		URL:           g.config.Repository,
+		Auth:          auth,
+		ReferenceName: ref,
+		SingleBranch:  true,
+		Depth:         g.config.Depth,
+		Tags:          git.NoTags,
+	}
+
+	if g.config.InMemory {
+		worktree := memfs.New()
+		if _, err := git.Clone(memory.NewStorage(), worktree, options); err != nil {
+			return nil, fmt.Errorf("cloning %v: %w", g.config.Repository, err)
+		}
+		return billyfs.New(worktree), nil
+	}
+
+	if g.dir, err = os.MkdirTemp("", "migrate-git-"); err != nil {
+		return nil, err
+	}
+	if _, err := git.PlainClone(g.dir, false, options); err != nil {
+		return nil, fmt.Errorf("cloning %v: %w", g.config.Repository, err)
+	}
+	return os.DirFS(g.dir), nil
+}
+
+// Close removes the clone.
+func (g *Git) Close() error {
+	err := g.PartialDriver.Close()
+	if g.dir != "" {
+		if rerr := os.RemoveAll(g.dir); err == nil {
+			err = rerr
+		}
+	}
+	return err
+}
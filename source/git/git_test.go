@@ -0,0 +1,133 @@
+package git
+
+import (
+	"errors"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"testing"
+
+	st "github.com/golang-migrate/migrate/v4/source/testing"
+)
+
+// newRepository commits the test migrations to migrations/ of a new
+// repository, tagged v1, and returns the repository URL.
+func newRepository(t *testing.T) string {
+	t.Helper()
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git not installed")
+	}
+
+	dir := filepath.Join(t.TempDir(), "repo.git")
+	files := []string{
+		"1_foobar.up.sql", "1_foobar.down.sql",
+		"3_foobar.up.sql",
+		"4_foobar.up.sql", "4_foobar.down.sql",
+		"5_foobar.down.sql",
+		"7_foobar.up.sql", "7_foobar.down.sql",
+	}
+	if err := os.MkdirAll(filepath.Join(dir, "migrations"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	for _, f := range files {
+		if err := os.WriteFile(filepath.Join(dir, "migrations", f), []byte(f), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	run := func(args ...string) {
+		cmd := exec.Command("git", append([]string{"-C", dir, "-c", "user.name=test", "-c", "user.email=test@example.com"}, args...)...)
+		if out, err := cmd.CombinedOutput(); err != nil {
+			t.Fatalf("git %v: %v: %s", args, err, out)
+		}
+	}
+	run("init", "--quiet")
+	run("add", ".")
+	run("commit", "--quiet", "-m", "migrations")
+	run("tag", "v1")
+	// a later commit, not in v1
+	if err := os.WriteFile(filepath.Join(dir, "migrations", "8_foobar.up.sql"), nil, 0644); err != nil {
+		t.Fatal(err)
+	}
+	run("add", ".")
+	run("commit", "--quiet", "-m", "more migrations")
+
+	return "file://" + dir
+}
+
+func Test(t *testing.T) {
+	repo := newRepository(t)
+
+	g := &Git{}
+	d, err := g.Open("git://" + repo + "/migrations?ref=v1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	st.Test(t, d)
+
+	dir := d.(*Git).dir
+	if err := d.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(dir); !os.IsNotExist(err) {
+		t.Errorf("expected %v to be removed, got %v", dir, err)
+	}
+}
+
+func TestInMemory(t *testing.T) {
+	repo := newRepository(t)
+
+	d, err := (&Git{}).Open("git://" + repo + "/migrations?ref=v1&x-in-memory=true")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if dir := d.(*Git).dir; dir != "" {
+		t.Errorf("expected no clone directory, got %v", dir)
+	}
+	st.Test(t, d)
+}
+
+func TestDefaultBranch(t *testing.T) {
+	repo := newRepository(t)
+
+	d, err := New(&Config{Repository: repo, Path: "migrations"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer d.Close()
+	if _, err := d.Next(7); err != nil {
+		t.Errorf("expected version 8 on the default branch, got %v", err)
+	}
+}
+
+func TestCloneError(t *testing.T) {
+	repo := newRepository(t)
+
+	g := &Git{}
+	if _, err := g.Open("git://" + repo + "/migrations?ref=no-such-branch"); err == nil {
+		t.Error("expected an error")
+	}
+	if _, err := g.Open("git://" + repo[:len(repo)-len(".git")] + "/migrations"); !errors.Is(err, ErrNoRepository) {
+		t.Errorf("expected %v, got %v", ErrNoRepository, err)
+	}
+}
+
+func TestSplitRepository(t *testing.T) {
+	tt := []struct {
+		path       string
+		repo       string
+		migrations string
+		ok         bool
+	}{
+		{path: "/org/repo.git", repo: "/org/repo.git", ok: true},
+		{path: "/org/repo.git/migrations", repo: "/org/repo.git", migrations: "migrations", ok: true},
+		{path: "/org/repo.git/db/migrations/", repo: "/org/repo.git", migrations: "db/migrations", ok: true},
+		{path: "/org/repo/migrations"},
+	}
+	for _, tc := range tt {
+		repo, migrations, ok := splitRepository(tc.path)
+		if repo != tc.repo || migrations != tc.migrations || ok != tc.ok {
+			t.Errorf("%v: expected %q %q %v, got %q %q %v", tc.path, tc.repo, tc.migrations, tc.ok, repo, migrations, ok)
+		}
+	}
+}
@@ -7,9 +7,11 @@ import (
 	"os"
 	"path"
 	"strings"
+	"time"
 
 	"cloud.google.com/go/storage"
 	"context"
+	"github.com/golang-migrate/migrate/v4/internal/compress"
 	"github.com/golang-migrate/migrate/v4/source"
 	"google.golang.org/api/iterator"
 )
@@ -21,6 +23,7 @@ func init() {
 type gcs struct {
 	bucket     *storage.BucketHandle
 	prefix     string
+	cacheFile  string
 	migrations *source.Migrations
 }
 
@@ -36,6 +39,7 @@ func (g *gcs) Open(folder string) (source.Driver, error) {
 	driver := gcs{
 		bucket:     client.Bucket(u.Host),
 		prefix:     strings.Trim(u.Path, "/") + "/",
+		cacheFile:  u.Query().Get("x-cache-file"),
 		migrations: source.NewMigrations(),
 	}
 	err = driver.loadMigrations()
@@ -46,12 +50,23 @@ func (g *gcs) Open(folder string) (source.Driver, error) {
 }
 
 func (g *gcs) loadMigrations() error {
+	if g.cacheFile != "" {
+		if ok, err := g.loadCache(); err != nil || ok {
+			return err
+		}
+	}
+
 	iter := g.bucket.Objects(context.Background(), &storage.Query{
 		Prefix:    g.prefix,
 		Delimiter: "/",
 	})
+	cache := source.Cache{Migrations: g.migrations}
 	object, err := iter.Next()
 	for ; err == nil; object, err = iter.Next() {
+		if object.Updated.After(cache.LastModified) {
+			cache.LastModified = object.Updated
+		}
+		cache.ObjectCount++
 		_, fileName := path.Split(object.Name)
 		m, parseErr := source.DefaultParse(fileName)
 		if parseErr != nil {
@@ -64,9 +79,49 @@ func (g *gcs) loadMigrations() error {
 	if err != iterator.Done {
 		return err
 	}
+
+	if g.cacheFile != "" {
+		return source.WriteCacheFile(g.cacheFile, &cache)
+	}
 	return nil
 }
 
+// loadCache loads the migrations from the cache file, unless it doesn't
+// exist or objects were added, modified or deleted after it was written.
+// Listing the objects is still needed, but not parsing them.
+func (g *gcs) loadCache() (ok bool, err error) {
+	cache, err := source.ReadCacheFile(g.cacheFile)
+	if err != nil {
+		// missing or unreadable cache, scan the bucket instead
+		return false, nil
+	}
+
+	iter := g.bucket.Objects(context.Background(), &storage.Query{
+		Prefix:    g.prefix,
+		Delimiter: "/",
+	})
+	var (
+		lastModified time.Time
+		count        int
+	)
+	object, err := iter.Next()
+	for ; err == nil; object, err = iter.Next() {
+		if object.Updated.After(lastModified) {
+			lastModified = object.Updated
+		}
+		count++
+	}
+	if err != iterator.Done {
+		return false, err
+	}
+	if !cache.Valid(lastModified, count) {
+		return false, nil
+	}
+
+	g.migrations = cache.Migrations
+	return true, nil
+}
+
 func (g *gcs) Close() error {
 	return nil
 }
@@ -95,6 +150,10 @@ func (g *gcs) Next(version uint) (uint, error) {
 	return v, nil
 }
 
+func (g *gcs) List() ([]source.Migration, error) {
+	return g.migrations.List(), nil
+}
+
 func (g *gcs) ReadUp(version uint) (io.ReadCloser, string, error) {
 	if m, ok := g.migrations.Up(version); ok {
 		return g.open(m)
@@ -115,5 +174,9 @@ func (g *gcs) open(m *source.Migration) (io.ReadCloser, string, error) {
 	if err != nil {
 		return nil, "", err
 	}
-	return reader, m.Identifier, nil
+	body, err := compress.Decompress(objectPath, reader)
+	if err != nil {
+		return nil, "", err
+	}
+	return body, m.Identifier, nil
 }
@@ -1,6 +1,8 @@
 package googlecloudstorage
 
 import (
+	"context"
+	"path/filepath"
 	"testing"
 
 	"github.com/fsouza/fake-gcs-server/fakestorage"
@@ -35,3 +37,83 @@ func Test(t *testing.T) {
 	}
 	st.Test(t, &driver)
 }
+
+func TestCacheFile(t *testing.T) {
+	server := fakestorage.NewServer([]fakestorage.Object{
+		{BucketName: "some-bucket", Name: "prod/migrations/1_foobar.up.sql", Content: []byte("1 up")},
+		{BucketName: "some-bucket", Name: "prod/migrations/1_foobar.down.sql", Content: []byte("1 down")},
+		{BucketName: "some-bucket", Name: "prod/migrations/3_foobar.up.sql", Content: []byte("3 up")},
+		{BucketName: "some-bucket", Name: "prod/migrations/4_foobar.up.sql", Content: []byte("4 up")},
+		{BucketName: "some-bucket", Name: "prod/migrations/4_foobar.down.sql", Content: []byte("4 down")},
+		{BucketName: "some-bucket", Name: "prod/migrations/5_foobar.down.sql", Content: []byte("5 down")},
+		{BucketName: "some-bucket", Name: "prod/migrations/7_foobar.up.sql", Content: []byte("7 up")},
+		{BucketName: "some-bucket", Name: "prod/migrations/7_foobar.down.sql", Content: []byte("7 down")},
+	})
+	defer server.Stop()
+	cacheFile := filepath.Join(t.TempDir(), "cache")
+
+	// first load scans the bucket and writes the cache
+	driver := gcs{
+		bucket:     server.Client().Bucket("some-bucket"),
+		prefix:     "prod/migrations/",
+		cacheFile:  cacheFile,
+		migrations: source.NewMigrations(),
+	}
+	if err := driver.loadMigrations(); err != nil {
+		t.Fatal(err)
+	}
+	cache, err := source.ReadCacheFile(cacheFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cache.ObjectCount != 8 {
+		t.Fatalf("expected 8 objects, got %v", cache.ObjectCount)
+	}
+
+	// second load uses the cache
+	driver = gcs{
+		bucket:     server.Client().Bucket("some-bucket"),
+		prefix:     "prod/migrations/",
+		cacheFile:  cacheFile,
+		migrations: source.NewMigrations(),
+	}
+	if err := driver.loadMigrations(); err != nil {
+		t.Fatal(err)
+	}
+	st.Test(t, &driver)
+}
+
+func TestCacheFileInvalidated(t *testing.T) {
+	server := fakestorage.NewServer([]fakestorage.Object{
+		{BucketName: "some-bucket", Name: "prod/migrations/1_foobar.up.sql", Content: []byte("1 up")},
+		{BucketName: "some-bucket", Name: "prod/migrations/3_foobar.up.sql", Content: []byte("3 up")},
+	})
+	defer server.Stop()
+	cacheFile := filepath.Join(t.TempDir(), "cache")
+	load := func() *gcs {
+		driver := &gcs{
+			bucket:     server.Client().Bucket("some-bucket"),
+			prefix:     "prod/migrations/",
+			cacheFile:  cacheFile,
+			migrations: source.NewMigrations(),
+		}
+		if err := driver.loadMigrations(); err != nil {
+			t.Fatal(err)
+		}
+		return driver
+	}
+	load()
+
+	// added before the last object seen when caching
+	server.CreateObject(fakestorage.Object{BucketName: "some-bucket", Name: "prod/migrations/2_foobar.up.sql", Content: []byte("2 up")})
+	if v, err := load().Next(1); err != nil || v != 2 {
+		t.Fatalf("expected version 2 after 1, got %v, %v", v, err)
+	}
+
+	if err := server.Client().Bucket("some-bucket").Object("prod/migrations/1_foobar.up.sql").Delete(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if v, err := load().First(); err != nil || v != 2 {
+		t.Fatalf("expected first version 2 after deleting 1, got %v, %v", v, err)
+	}
+}
@@ -52,9 +52,11 @@ func (p *PartialDriver) Init(fs http.FileSystem, path string) error {
 		}
 
 		if !ms.Append(m) {
+			existing, _ := ms.Get(m.Version, m.Direction)
 			return source.ErrDuplicateMigration{
 				Migration: *m,
 				FileInfo:  file,
+				Existing:  existing,
 			}
 		}
 	}
@@ -106,6 +108,11 @@ func (p *PartialDriver) Next(version uint) (nextVersion uint, err error) {
 	}
 }
 
+// List is part of source.Lister interface implementation.
+func (p *PartialDriver) List() ([]source.Migration, error) {
+	return p.migrations.List(), nil
+}
+
 // ReadUp is part of source.Driver interface implementation.
 func (p *PartialDriver) ReadUp(version uint) (r io.ReadCloser, identifier string, err error) {
 	if m, ok := p.migrations.Up(version); ok {
@@ -0,0 +1,270 @@
+package httpfs
+
+import (
+	"errors"
+	"fmt"
+	"html"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// RemoteFS is a http.FileSystem reading the files served by a HTTP server,
+// e.g. a directory served with http.FileServer. Directories are listed from
+// the links of their index page.
+//
+// Files are streamed lazily: nothing is requested until a file is read, and
+// its body is read from the response as it is consumed. Seeking uses range
+// requests if the server supports them with "Accept-Ranges: bytes", or else
+// a full GET skipping the bytes before the offset.
+//
+// Combined with Migrate.PrefetchMigrations set to 0, migrations are streamed
+// from the server to the database without being buffered in memory.
+type RemoteFS struct {
+	// URL is the base URL of the files.
+	URL string
+
+	// Client is used for the requests, http.DefaultClient if nil.
+	Client *http.Client
+}
+
+// Open implements http.FileSystem. It doesn't send any request.
+func (fs *RemoteFS) Open(name string) (http.File, error) {
+	u, err := url.Parse(fs.URL)
+	if err != nil {
+		return nil, err
+	}
+	client := fs.Client
+	if client == nil {
+		client = http.DefaultClient
+	}
+	return &remoteFile{
+		client: client,
+		url:    u.JoinPath(name).String(),
+		name:   path.Base(name),
+		size:   -1,
+	}, nil
+}
+
+// remoteFile is a file of a RemoteFS.
+type remoteFile struct {
+	client *http.Client
+	url    string
+	name   string
+
+	// offset is the position of the next Read.
+	offset int64
+	// body is the response body being read, nil until the next Read.
+	body io.ReadCloser
+
+	// set by head
+	headDone     bool
+	size         int64
+	modTime      time.Time
+	acceptRanges bool
+}
+
+func (f *remoteFile) Read(p []byte) (int, error) {
+	if f.body == nil {
+		if err := f.get(); err != nil {
+			return 0, err
+		}
+	}
+	n, err := f.body.Read(p)
+	f.offset += int64(n)
+	return n, err
+}
+
+// get requests the file from offset on.
+func (f *remoteFile) get() error {
+	if f.offset > 0 {
+		if err := f.head(); err != nil {
+			return err
+		}
+	}
+
+	req, err := http.NewRequest(http.MethodGet, f.url, nil)
+	if err != nil {
+		return err
+	}
+	if f.offset > 0 && f.acceptRanges {
+		req.Header.Set("Range", fmt.Sprintf("bytes=%d-", f.offset))
+	}
+
+	resp, err := f.client.Do(req)
+	if err != nil {
+		return err
+	}
+
+	switch resp.StatusCode {
+	case http.StatusPartialContent:
+		f.body = resp.Body
+	case http.StatusOK:
+		// the whole file, skip to the offset
+		if _, err := io.CopyN(io.Discard, resp.Body, f.offset); err != nil && err != io.EOF {
+			resp.Body.Close()
+			return err
+		}
+		f.body = resp.Body
+	case http.StatusRequestedRangeNotSatisfiable:
+		// the offset is past the end of the file
+		resp.Body.Close()
+		f.body = http.NoBody
+	default:
+		resp.Body.Close()
+		return f.statusError(http.MethodGet, resp)
+	}
+	return nil
+}
+
+// head requests the size and range support of the file, once.
+func (f *remoteFile) head() error {
+	if f.headDone {
+		return nil
+	}
+
+	resp, err := f.client.Head(f.url)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return f.statusError(http.MethodHead, resp)
+	}
+
+	f.headDone = true
+	f.size = resp.ContentLength
+	f.acceptRanges = resp.Header.Get("Accept-Ranges") == "bytes"
+	if t, err := http.ParseTime(resp.Header.Get("Last-Modified")); err == nil {
+		f.modTime = t
+	}
+	return nil
+}
+
+func (f *remoteFile) statusError(method string, resp *http.Response) error {
+	if resp.StatusCode == http.StatusNotFound {
+		return &os.PathError{Op: "open", Path: f.url, Err: os.ErrNotExist}
+	}
+	return fmt.Errorf("%s %s: %s", method, f.url, resp.Status)
+}
+
+func (f *remoteFile) Seek(offset int64, whence int) (int64, error) {
+	switch whence {
+	case io.SeekStart:
+	case io.SeekCurrent:
+		offset += f.offset
+	case io.SeekEnd:
+		if err := f.head(); err != nil {
+			return 0, err
+		}
+		if f.size < 0 {
+			return 0, errors.New("httpfs: seek relative to an unknown size")
+		}
+		offset += f.size
+	default:
+		return 0, errors.New("httpfs: invalid whence")
+	}
+	if offset < 0 {
+		return 0, errors.New("httpfs: negative position")
+	}
+
+	if offset != f.offset {
+		// the next Read requests the file from the new offset
+		if err := f.Close(); err != nil {
+			return 0, err
+		}
+		f.offset = offset
+	}
+	return offset, nil
+}
+
+func (f *remoteFile) Close() error {
+	if f.body == nil {
+		return nil
+	}
+	err := f.body.Close()
+	f.body = nil
+	return err
+}
+
+func (f *remoteFile) Stat() (os.FileInfo, error) {
+	if err := f.head(); err != nil {
+		return nil, err
+	}
+	return &remoteFileInfo{name: f.name, size: f.size, modTime: f.modTime}, nil
+}
+
+// hrefRegex matches the links of a directory index page.
+var hrefRegex = regexp.MustCompile(`(?i)href="([^"]*)"`)
+
+// Readdir lists the files linked from the index page of the directory.
+func (f *remoteFile) Readdir(count int) ([]os.FileInfo, error) {
+	dirURL := f.url
+	if !strings.HasSuffix(dirURL, "/") {
+		dirURL += "/"
+	}
+	resp, err := f.client.Get(dirURL)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, f.statusError(http.MethodGet, resp)
+	}
+	index, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+
+	var infos []os.FileInfo
+	seen := make(map[string]bool)
+	for _, match := range hrefRegex.FindAllSubmatch(index, -1) {
+		name, err := url.PathUnescape(html.UnescapeString(string(match[1])))
+		if err != nil {
+			continue
+		}
+		name = strings.TrimPrefix(name, "./")
+		// skip links outside the directory, like ../ or other sites
+		if name == "" || strings.HasPrefix(name, ".") || strings.HasPrefix(name, "/") || strings.ContainsAny(name, "?#:") {
+			continue
+		}
+		isDir := strings.HasSuffix(name, "/")
+		name = strings.TrimSuffix(name, "/")
+		if strings.Contains(name, "/") || seen[name] {
+			continue
+		}
+		seen[name] = true
+		infos = append(infos, &remoteFileInfo{name: name, size: -1, dir: isDir})
+	}
+
+	if count > 0 && len(infos) > count {
+		infos = infos[:count]
+	}
+	return infos, nil
+}
+
+// remoteFileInfo implements os.FileInfo for a RemoteFS file.
+type remoteFileInfo struct {
+	name    string
+	size    int64
+	modTime time.Time
+	dir     bool
+}
+
+func (fi *remoteFileInfo) Name() string       { return fi.name }
+func (fi *remoteFileInfo) Size() int64        { return fi.size }
+func (fi *remoteFileInfo) ModTime() time.Time { return fi.modTime }
+func (fi *remoteFileInfo) IsDir() bool        { return fi.dir }
+func (fi *remoteFileInfo) Sys() interface{}   { return nil }
+
+func (fi *remoteFileInfo) Mode() os.FileMode {
+	if fi.dir {
+		return os.ModeDir | 0555
+	}
+	return 0444
+}
@@ -0,0 +1,163 @@
+package httpfs_test
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strconv"
+	"sync"
+	"testing"
+
+	"github.com/golang-migrate/migrate/v4/source/httpfs"
+	st "github.com/golang-migrate/migrate/v4/source/testing"
+)
+
+// recorder records the requests to a handler.
+type recorder struct {
+	handler http.Handler
+
+	mu       sync.Mutex
+	requests []string
+	ranges   []string
+}
+
+func (r *recorder) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	r.mu.Lock()
+	r.requests = append(r.requests, req.Method+" "+req.URL.Path)
+	if rng := req.Header.Get("Range"); rng != "" {
+		r.ranges = append(r.ranges, rng)
+	}
+	r.mu.Unlock()
+	r.handler.ServeHTTP(w, req)
+}
+
+// noRanges serves the files of dir without support for range requests.
+func noRanges(dir string) http.Handler {
+	fileServer := http.FileServer(http.Dir(dir))
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		body, err := os.ReadFile(dir + req.URL.Path)
+		if err != nil {
+			// directories and missing files
+			fileServer.ServeHTTP(w, req)
+			return
+		}
+		w.Header().Set("Content-Length", strconv.Itoa(len(body)))
+		if req.Method == http.MethodGet {
+			_, _ = w.Write(body)
+		}
+	})
+}
+
+func TestRemoteFS(t *testing.T) {
+	server := httptest.NewServer(http.FileServer(http.Dir("testdata")))
+	defer server.Close()
+
+	d, err := httpfs.New(&httpfs.RemoteFS{URL: server.URL}, "sql")
+	if err != nil {
+		t.Fatal(err)
+	}
+	st.Test(t, d)
+}
+
+func TestRemoteFSLazy(t *testing.T) {
+	rec := &recorder{handler: http.FileServer(http.Dir("testdata"))}
+	server := httptest.NewServer(rec)
+	defer server.Close()
+
+	fs := &httpfs.RemoteFS{URL: server.URL}
+	f, err := fs.Open("sql/1_foobar.up.sql")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	if len(rec.requests) != 0 {
+		t.Fatalf("expected no requests before reading, got %v", rec.requests)
+	}
+
+	body, err := io.ReadAll(f)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(body) != "1 up\n" {
+		t.Errorf("expected %q, got %q", "1 up\n", body)
+	}
+	if len(rec.requests) != 1 || len(rec.ranges) != 0 {
+		t.Errorf("expected a single GET without range, got %v, %v", rec.requests, rec.ranges)
+	}
+}
+
+func TestRemoteFSSeek(t *testing.T) {
+	expected, err := os.ReadFile("testdata/sql/1_foobar.down.sql")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	testCases := []struct {
+		name          string
+		handler       http.Handler
+		expectedRange string
+	}{
+		{"ranges", http.FileServer(http.Dir("testdata")), "bytes=2-"},
+		{"no ranges", noRanges("testdata"), ""},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			rec := &recorder{handler: tc.handler}
+			server := httptest.NewServer(rec)
+			defer server.Close()
+
+			fs := &httpfs.RemoteFS{URL: server.URL}
+			f, err := fs.Open("sql/1_foobar.down.sql")
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer f.Close()
+
+			if _, err := f.Seek(2, io.SeekStart); err != nil {
+				t.Fatal(err)
+			}
+			body, err := io.ReadAll(f)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(body) != string(expected[2:]) {
+				t.Errorf("expected %q, got %q", expected[2:], body)
+			}
+
+			var rng string
+			if len(rec.ranges) > 0 {
+				rng = rec.ranges[0]
+			}
+			if rng != tc.expectedRange {
+				t.Errorf("expected range %q, got %q", tc.expectedRange, rng)
+			}
+
+			// seeking to the end reads nothing
+			if _, err := f.Seek(0, io.SeekEnd); err != nil {
+				t.Fatal(err)
+			}
+			if body, err := io.ReadAll(f); err != nil || len(body) != 0 {
+				t.Errorf("expected nothing at the end, got %q, %v", body, err)
+			}
+		})
+	}
+}
+
+func TestRemoteFSNotExist(t *testing.T) {
+	server := httptest.NewServer(http.FileServer(http.Dir("testdata")))
+	defer server.Close()
+
+	fs := &httpfs.RemoteFS{URL: server.URL}
+	f, err := fs.Open("sql/does-not-exist.up.sql")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := io.ReadAll(f); !os.IsNotExist(err) {
+		t.Errorf("expected a not exist error, got %v", err)
+	}
+
+	if _, err := httpfs.New(fs, "does-not-exist"); err == nil {
+		t.Error("expected an error for a missing directory")
+	}
+}
@@ -0,0 +1,47 @@
+package source
+
+import (
+	"errors"
+	"io"
+	"strings"
+)
+
+// IdempotentSource wraps a source driver and hides the up migration bodies
+// of versions that are already applied to the database. This is helpful when
+// the same set of migrations is applied to multiple database instances that
+// may be at different versions, e.g. in blue/green deployments.
+type IdempotentSource struct {
+	Driver
+
+	applied func(version uint) bool
+}
+
+// NewIdempotentSource returns a new IdempotentSource wrapping drv.
+// applied reports whether the given version is already applied. For those
+// versions ReadUp returns an empty body, so that running the migration only
+// advances the version.
+func NewIdempotentSource(drv Driver, applied func(version uint) bool) *IdempotentSource {
+	return &IdempotentSource{
+		Driver:  drv,
+		applied: applied,
+	}
+}
+
+// Open is part of source.Driver interface implementation.
+// Open cannot be called on the idempotent source wrapper.
+func (s *IdempotentSource) Open(url string) (Driver, error) {
+	return nil, errors.New("Open() cannot be called on the idempotent source wrapper")
+}
+
+// ReadUp is part of source.Driver interface implementation.
+// It returns an empty body if the version is already applied.
+func (s *IdempotentSource) ReadUp(version uint) (r io.ReadCloser, identifier string, err error) {
+	r, identifier, err = s.Driver.ReadUp(version)
+	if err != nil || s.applied == nil || !s.applied(version) {
+		return r, identifier, err
+	}
+	if err := r.Close(); err != nil {
+		return nil, "", err
+	}
+	return io.NopCloser(strings.NewReader("")), identifier, nil
+}
@@ -0,0 +1,76 @@
+package source_test
+
+import (
+	"io"
+	"testing"
+
+	"github.com/golang-migrate/migrate/v4/source"
+	"github.com/golang-migrate/migrate/v4/source/stub"
+	st "github.com/golang-migrate/migrate/v4/source/testing"
+)
+
+func newIdempotentStub(t *testing.T, applied func(version uint) bool) *source.IdempotentSource {
+	d, err := (&stub.Stub{}).Open("stub://")
+	if err != nil {
+		t.Fatal(err)
+	}
+	ms := source.NewMigrations()
+	ms.Append(&source.Migration{Version: 1, Direction: source.Up, Identifier: "CREATE 1"})
+	ms.Append(&source.Migration{Version: 1, Direction: source.Down, Identifier: "DROP 1"})
+	ms.Append(&source.Migration{Version: 3, Direction: source.Up, Identifier: "CREATE 3"})
+	ms.Append(&source.Migration{Version: 4, Direction: source.Up, Identifier: "CREATE 4"})
+	ms.Append(&source.Migration{Version: 4, Direction: source.Down, Identifier: "DROP 4"})
+	ms.Append(&source.Migration{Version: 5, Direction: source.Down, Identifier: "DROP 5"})
+	ms.Append(&source.Migration{Version: 7, Direction: source.Up, Identifier: "CREATE 7"})
+	ms.Append(&source.Migration{Version: 7, Direction: source.Down, Identifier: "DROP 7"})
+	d.(*stub.Stub).Migrations = ms
+	return source.NewIdempotentSource(d, applied)
+}
+
+func TestIdempotentSource(t *testing.T) {
+	st.Test(t, newIdempotentStub(t, func(uint) bool { return false }))
+}
+
+func TestIdempotentSourceReadUp(t *testing.T) {
+	d := newIdempotentStub(t, func(version uint) bool { return version <= 3 })
+
+	tt := []struct {
+		version    uint
+		expectBody string
+	}{
+		{version: 1, expectBody: ""},
+		{version: 3, expectBody: ""},
+		{version: 4, expectBody: "CREATE 4"},
+		{version: 7, expectBody: "CREATE 7"},
+	}
+
+	for i, v := range tt {
+		r, identifier, err := d.ReadUp(v.version)
+		if err != nil {
+			t.Fatalf("expected err to be nil, got %v, in %v", err, i)
+		}
+		if identifier == "" {
+			t.Errorf("expected identifier not to be empty, in %v", i)
+		}
+		body, err := io.ReadAll(r)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(body) != v.expectBody {
+			t.Errorf("expected body %q, got %q, in %v", v.expectBody, body, i)
+		}
+	}
+
+	// down migrations are not affected
+	r, _, err := d.ReadDown(1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	body, err := io.ReadAll(r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(body) != "DROP 1" {
+		t.Errorf("expected body %q, got %q", "DROP 1", body)
+	}
+}
@@ -48,6 +48,13 @@ type PartialDriver struct {
 // Init prepares not initialized IoFS instance to read migrations from a
 // io/fs#FS instance and a relative path.
 func (d *PartialDriver) Init(fsys fs.FS, path string) error {
+	return d.InitWithParse(fsys, path, source.DefaultParse)
+}
+
+// InitWithParse is like Init, but parses the names of the files in path
+// with parse instead of source.DefaultParse. Migrations in one directory
+// per migration are still parsed with source.ParseDir.
+func (d *PartialDriver) InitWithParse(fsys fs.FS, path string, parse func(raw string) (*source.Migration, error)) error {
 	entries, err := fs.ReadDir(fsys, path)
 	if err != nil {
 		return err
@@ -56,9 +63,12 @@ func (d *PartialDriver) Init(fsys fs.FS, path string) error {
 	ms := source.NewMigrations()
 	for _, e := range entries {
 		if e.IsDir() {
+			if err := appendDirMigrations(ms, fsys, path, e.Name()); err != nil {
+				return err
+			}
 			continue
 		}
-		m, err := source.DefaultParse(e.Name())
+		m, err := parse(e.Name())
 		if err != nil {
 			continue
 		}
@@ -67,9 +77,11 @@ func (d *PartialDriver) Init(fsys fs.FS, path string) error {
 			return err
 		}
 		if !ms.Append(m) {
+			existing, _ := ms.Get(m.Version, m.Direction)
 			return source.ErrDuplicateMigration{
 				Migration: *m,
 				FileInfo:  file,
+				Existing:  existing,
 			}
 		}
 	}
@@ -80,6 +92,41 @@ func (d *PartialDriver) Init(fsys fs.FS, path string) error {
 	return nil
 }
 
+// appendDirMigrations appends the migrations found in a migration directory
+// like 123_name/up.sql. Directories and files not following this layout are
+// ignored.
+func appendDirMigrations(ms *source.Migrations, fsys fs.FS, root, dir string) error {
+	if !source.DirRegex.MatchString(dir) {
+		return nil
+	}
+	entries, err := fs.ReadDir(fsys, path.Join(root, dir))
+	if err != nil {
+		return err
+	}
+	for _, e := range entries {
+		if e.IsDir() {
+			continue
+		}
+		m, err := source.ParseDir(dir, e.Name())
+		if err != nil {
+			continue
+		}
+		file, err := e.Info()
+		if err != nil {
+			return err
+		}
+		if !ms.Append(m) {
+			existing, _ := ms.Get(m.Version, m.Direction)
+			return source.ErrDuplicateMigration{
+				Migration: *m,
+				FileInfo:  file,
+				Existing:  existing,
+			}
+		}
+	}
+	return nil
+}
+
 // Close is part of source.Driver interface implementation.
 // Closes the file system if possible.
 func (d *PartialDriver) Close() error {
@@ -0,0 +1,70 @@
+package source
+
+import (
+	"errors"
+	"io"
+	"strings"
+)
+
+// LabelSource wraps a source driver and hides the migrations not carrying
+// a label, so that only the migrations of e.g. a single service in a
+// monorepo are applied. A label is a dot separated segment of the migration
+// identifier, like orders in 123_create_orders.orders.up.sql.
+//
+// Hidden migrations are still walked in order with an empty body, so the
+// database keeps recording the global version and gaps between labeled
+// migrations don't break the ordering.
+type LabelSource struct {
+	Driver
+
+	label string
+}
+
+// NewLabelSource returns a new LabelSource wrapping drv, only exposing
+// migrations carrying label.
+func NewLabelSource(drv Driver, label string) *LabelSource {
+	return &LabelSource{
+		Driver: drv,
+		label:  label,
+	}
+}
+
+// Open is part of source.Driver interface implementation.
+// Open cannot be called on the label source wrapper.
+func (s *LabelSource) Open(url string) (Driver, error) {
+	return nil, errors.New("Open() cannot be called on the label source wrapper")
+}
+
+// ReadUp is part of source.Driver interface implementation.
+// It returns an empty body for migrations not carrying the label.
+func (s *LabelSource) ReadUp(version uint) (r io.ReadCloser, identifier string, err error) {
+	return s.filter(s.Driver.ReadUp(version))
+}
+
+// ReadDown is part of source.Driver interface implementation.
+// It returns an empty body for migrations not carrying the label.
+func (s *LabelSource) ReadDown(version uint) (r io.ReadCloser, identifier string, err error) {
+	return s.filter(s.Driver.ReadDown(version))
+}
+
+func (s *LabelSource) filter(r io.ReadCloser, identifier string, err error) (io.ReadCloser, string, error) {
+	if err != nil || HasLabel(identifier, s.label) {
+		return r, identifier, err
+	}
+	if err := r.Close(); err != nil {
+		return nil, "", err
+	}
+	return io.NopCloser(strings.NewReader("")), identifier, nil
+}
+
+// HasLabel reports whether the migration identifier carries label,
+// i.e. label is one of its dot separated segments after the name.
+func HasLabel(identifier, label string) bool {
+	segments := strings.Split(identifier, ".")
+	for _, segment := range segments[1:] {
+		if segment == label {
+			return true
+		}
+	}
+	return false
+}
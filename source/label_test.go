@@ -0,0 +1,125 @@
+package source_test
+
+import (
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+	"testing/fstest"
+
+	"github.com/golang-migrate/migrate/v4/source"
+	_ "github.com/golang-migrate/migrate/v4/source/file"
+	"github.com/golang-migrate/migrate/v4/source/iofs"
+)
+
+var labeledMigrations = fstest.MapFS{
+	"1_create_users.users.up.sql":     {Data: []byte("CREATE users")},
+	"1_create_users.users.down.sql":   {Data: []byte("DROP users")},
+	"2_create_orders.orders.up.sql":   {Data: []byte("CREATE orders")},
+	"2_create_orders.orders.down.sql": {Data: []byte("DROP orders")},
+	"3_create_shared.up.sql":          {Data: []byte("CREATE shared")},
+	"4_add_index.orders.up.sql":       {Data: []byte("INDEX orders")},
+	"5_add_email.users.up.sql":        {Data: []byte("ALTER users")},
+}
+
+func TestLabelSource(t *testing.T) {
+	d, err := iofs.New(labeledMigrations, ".")
+	if err != nil {
+		t.Fatal(err)
+	}
+	ls := source.NewLabelSource(d, "orders")
+
+	// all versions are still walked in order
+	v, err := ls.First()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, expected := range []uint{2, 3, 4, 5} {
+		if v, err = ls.Next(v); err != nil {
+			t.Fatal(err)
+		}
+		if v != expected {
+			t.Fatalf("expected version %v, got %v", expected, v)
+		}
+	}
+
+	tt := []struct {
+		version    uint
+		expectBody string
+	}{
+		{version: 1, expectBody: ""},
+		{version: 2, expectBody: "CREATE orders"},
+		{version: 3, expectBody: ""},
+		{version: 4, expectBody: "INDEX orders"},
+		{version: 5, expectBody: ""},
+	}
+	for i, v := range tt {
+		r, _, err := ls.ReadUp(v.version)
+		if err != nil {
+			t.Fatalf("expected err to be nil, got %v, in %v", err, i)
+		}
+		body, err := io.ReadAll(r)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(body) != v.expectBody {
+			t.Errorf("expected body %q, got %q, in %v", v.expectBody, body, i)
+		}
+	}
+
+	// missing migrations stay missing
+	if _, _, err := ls.ReadDown(3); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("expected os.ErrNotExist, got %v", err)
+	}
+}
+
+func TestHasLabel(t *testing.T) {
+	tt := []struct {
+		identifier string
+		label      string
+		expected   bool
+	}{
+		{"create_orders.orders", "orders", true},
+		{"create_orders.orders.billing", "billing", true},
+		{"create_orders", "orders", false},
+		{"orders", "orders", false},
+		{"create_orders.order", "orders", false},
+		{"", "orders", false},
+	}
+	for _, tc := range tt {
+		if got := source.HasLabel(tc.identifier, tc.label); got != tc.expected {
+			t.Errorf("HasLabel(%q, %q): expected %v, got %v", tc.identifier, tc.label, tc.expected, got)
+		}
+	}
+}
+
+func TestOpenWithLabel(t *testing.T) {
+	dir := t.TempDir()
+	for name, f := range labeledMigrations {
+		if err := os.WriteFile(filepath.Join(dir, name), f.Data, 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	d, err := source.Open("file://" + dir + "?x-label=users")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := d.(*source.LabelSource); !ok {
+		t.Fatalf("expected *source.LabelSource, got %T", d)
+	}
+	for version, expectBody := range map[uint]string{2: "", 5: "ALTER users"} {
+		r, _, err := d.ReadUp(version)
+		if err != nil {
+			t.Fatal(err)
+		}
+		body, err := io.ReadAll(r)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(body) != expectBody {
+			t.Errorf("expected body %q, got %q", expectBody, body)
+		}
+	}
+}
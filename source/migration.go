@@ -116,6 +116,34 @@ func (i *Migrations) Down(version uint) (m *Migration, ok bool) {
 	return nil, false
 }
 
+// Get returns the migration for version and direction, if any.
+func (i *Migrations) Get(version uint, direction Direction) (m *Migration, ok bool) {
+	if _, ok := i.migrations[version]; ok {
+		if mx, ok := i.migrations[version][direction]; ok {
+			return mx, true
+		}
+	}
+	return nil, false
+}
+
+// List returns all migrations ordered by version, up before down.
+func (i *Migrations) List() []Migration {
+	ms := make([]Migration, 0, 2*len(i.index))
+	for _, version := range i.index {
+		for _, direction := range []Direction{Up, Down} {
+			if m, ok := i.migrations[version][direction]; ok {
+				ms = append(ms, *m)
+			}
+		}
+	}
+	return ms
+}
+
+// Versions returns the versions of all migrations in ascending order.
+func (i *Migrations) Versions() []uint {
+	return append([]uint{}, i.index...)
+}
+
 func (i *Migrations) findPos(version uint) int {
 	if len(i.index) > 0 {
 		ix := i.index.Search(version)
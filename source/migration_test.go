@@ -12,6 +12,39 @@ func TestAppend(t *testing.T) {
 	// TODO
 }
 
+func TestAppendMixedPadding(t *testing.T) {
+	ms := NewMigrations()
+	for _, raw := range []string{"1_a.up.sql", "02_b.up.sql", "0010_c.up.sql", "9_d.up.sql"} {
+		m, err := Parse(raw)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !ms.Append(m) {
+			t.Fatalf("expected %s to be appended", raw)
+		}
+	}
+
+	var versions []uint
+	for v, ok := ms.First(); ok; v, ok = ms.Next(v) {
+		versions = append(versions, v)
+	}
+	if len(versions) != 4 || versions[0] != 1 || versions[1] != 2 || versions[2] != 9 || versions[3] != 10 {
+		t.Fatalf("expected versions [1 2 9 10], got %v", versions)
+	}
+
+	// 0009 and 9 resolve to the same numeric version
+	m, err := Parse("0009_e.up.sql")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ms.Append(m) {
+		t.Fatal("expected 0009_e.up.sql to be rejected as duplicate of 9_d.up.sql")
+	}
+	if existing, ok := ms.Get(9, Up); !ok || existing.Raw != "9_d.up.sql" {
+		t.Fatalf("expected 9_d.up.sql to be kept, got %v", existing)
+	}
+}
+
 func TestBuildIndex(t *testing.T) {
 	// TODO
 }
@@ -32,6 +65,28 @@ func TestDown(t *testing.T) {
 	// TODO
 }
 
+func TestList(t *testing.T) {
+	ms := NewMigrations()
+	for _, raw := range []string{"3_c.up.sql", "1_a.down.sql", "1_a.up.sql", "2_b.down.sql"} {
+		m, err := Parse(raw)
+		if err != nil {
+			t.Fatal(err)
+		}
+		ms.Append(m)
+	}
+
+	list := ms.List()
+	expected := []string{"1_a.up.sql", "1_a.down.sql", "2_b.down.sql", "3_c.up.sql"}
+	if len(list) != len(expected) {
+		t.Fatalf("expected %v migrations, got %v", len(expected), len(list))
+	}
+	for i, m := range list {
+		if m.Raw != expected[i] {
+			t.Errorf("expected %v at %v, got %v", expected[i], i, m.Raw)
+		}
+	}
+}
+
 func TestFindPos(t *testing.T) {
 	m := Migrations{index: uintSlice{1, 2, 3}}
 	if p := m.findPos(0); p != -1 {
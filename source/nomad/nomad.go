@@ -0,0 +1,247 @@
+package nomad
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	nurl "net/url"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/golang-migrate/migrate/v4/source"
+)
+
+func init() {
+	source.Register("nomad", &Nomad{})
+}
+
+// DefaultItem is the variable item holding the migration body.
+const DefaultItem = "migration"
+
+// TokenEnv is the environment variable holding the ACL token if the URL
+// has none, like for the nomad CLI.
+const TokenEnv = "NOMAD_TOKEN"
+
+var (
+	ErrNoPath       = fmt.Errorf("no variable path")
+	ErrItemNotFound = fmt.Errorf("item not found in variable")
+)
+
+type Nomad struct {
+	config     *Config
+	client     *http.Client
+	migrations *source.Migrations
+}
+
+type Config struct {
+	// Address of the Nomad server, like https://nomad:4646.
+	Address string
+	// Path of the variables holding the migrations, like kv/migrations.
+	Path      string
+	Namespace string
+	// Item is the variable item holding the migration body.
+	// Defaults to DefaultItem.
+	Item string
+	// Token is the ACL token, if ACLs are enabled.
+	Token string
+}
+
+func (n *Nomad) Open(url string) (source.Driver, error) {
+	u, err := nurl.Parse(url)
+	if err != nil {
+		return nil, err
+	}
+
+	q := u.Query()
+	scheme := "https"
+	if s := q.Get("x-tls"); s != "" {
+		tls, err := strconv.ParseBool(s)
+		if err != nil {
+			return nil, fmt.Errorf("unable to parse option x-tls: %w", err)
+		}
+		if !tls {
+			scheme = "http"
+		}
+	}
+
+	token := q.Get("token")
+	if token == "" {
+		token = os.Getenv(TokenEnv)
+	}
+
+	return WithInstance(http.DefaultClient, &Config{
+		Address:   scheme + "://" + u.Host,
+		Path:      strings.Trim(u.Path, "/"),
+		Namespace: q.Get("namespace"),
+		Item:      q.Get("x-item"),
+		Token:     token,
+	})
+}
+
+// WithInstance lists the migrations stored in the Nomad variables under
+// config.Path.
+func WithInstance(client *http.Client, config *Config) (source.Driver, error) {
+	if config.Path == "" {
+		return nil, ErrNoPath
+	}
+	if config.Item == "" {
+		config.Item = DefaultItem
+	}
+
+	n := &Nomad{
+		config:     config,
+		client:     client,
+		migrations: source.NewMigrations(),
+	}
+
+	if err := n.readDirectory(); err != nil {
+		return nil, err
+	}
+	return n, nil
+}
+
+// variable is a Nomad variable, whose items are only set when it is read,
+// not when it is listed.
+type variable struct {
+	Path  string            `json:"Path"`
+	Items map[string]string `json:"Items"`
+}
+
+func (n *Nomad) readDirectory() error {
+	prefix := n.config.Path + "/"
+	q := nurl.Values{"prefix": {prefix}}
+	for {
+		var vars []variable
+		next, err := n.get("vars", q, &vars)
+		if err != nil {
+			return err
+		}
+
+		for _, v := range vars {
+			if !strings.HasPrefix(v.Path, prefix) {
+				// the prefix matches paths like kv/migrations2 too
+				continue
+			}
+			name := strings.TrimPrefix(v.Path, prefix)
+			m, err := source.DefaultParse(name)
+			if err != nil {
+				continue // ignore variables that we can't parse, like sub paths
+			}
+			if !n.migrations.Append(m) {
+				return fmt.Errorf("unable to parse file %v", v.Path)
+			}
+		}
+
+		if next == "" {
+			return nil
+		}
+		q.Set("next_token", next)
+	}
+}
+
+func (n *Nomad) readVariable(name string) (io.ReadCloser, error) {
+	var v variable
+	if _, err := n.get("var/"+n.config.Path+"/"+name, nil, &v); err != nil {
+		return nil, err
+	}
+	body, ok := v.Items[n.config.Item]
+	if !ok {
+		return nil, fmt.Errorf("%w: %v in %v", ErrItemNotFound, n.config.Item, v.Path)
+	}
+	return io.NopCloser(strings.NewReader(body)), nil
+}
+
+// get decodes the response of the Nomad API at endpoint, like vars, into v
+// and returns the token of the next page, if any.
+func (n *Nomad) get(endpoint string, q nurl.Values, v interface{}) (next string, err error) {
+	if q == nil {
+		q = nurl.Values{}
+	}
+	if n.config.Namespace != "" {
+		q.Set("namespace", n.config.Namespace)
+	}
+	u := strings.TrimRight(n.config.Address, "/") + "/v1/" + endpoint
+	if len(q) > 0 {
+		u += "?" + q.Encode()
+	}
+
+	req, err := http.NewRequest(http.MethodGet, u, nil)
+	if err != nil {
+		return "", err
+	}
+	if n.config.Token != "" {
+		req.Header.Set("X-Nomad-Token", n.config.Token)
+	}
+
+	resp, err := n.client.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode == http.StatusNotFound {
+		return "", &os.PathError{Op: "get", Path: endpoint, Err: os.ErrNotExist}
+	}
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		return "", fmt.Errorf("nomad: GET %v: %v %v", endpoint, resp.Status, strings.TrimSpace(string(msg)))
+	}
+
+	if err := json.NewDecoder(resp.Body).Decode(v); err != nil {
+		return "", err
+	}
+	return resp.Header.Get("X-Nomad-NextToken"), nil
+}
+
+func (n *Nomad) Close() error {
+	return nil
+}
+
+func (n *Nomad) First() (version uint, err error) {
+	if ver, ok := n.migrations.First(); ok {
+		return ver, nil
+	}
+	return 0, &os.PathError{Op: "first", Path: n.config.Path, Err: os.ErrNotExist}
+}
+
+func (n *Nomad) Prev(version uint) (prevVersion uint, err error) {
+	if ver, ok := n.migrations.Prev(version); ok {
+		return ver, nil
+	}
+	return 0, &os.PathError{Op: fmt.Sprintf("prev for version %v", version), Path: n.config.Path, Err: os.ErrNotExist}
+}
+
+func (n *Nomad) Next(version uint) (nextVersion uint, err error) {
+	if ver, ok := n.migrations.Next(version); ok {
+		return ver, nil
+	}
+	return 0, &os.PathError{Op: fmt.Sprintf("next for version %v", version), Path: n.config.Path, Err: os.ErrNotExist}
+}
+
+func (n *Nomad) ReadUp(version uint) (r io.ReadCloser, identifier string, err error) {
+	if m, ok := n.migrations.Up(version); ok {
+		r, err := n.readVariable(m.Raw)
+		if err != nil {
+			return nil, "", err
+		}
+		return r, m.Identifier, nil
+	}
+	return nil, "", &os.PathError{Op: fmt.Sprintf("read version %v", version), Path: n.config.Path, Err: os.ErrNotExist}
+}
+
+func (n *Nomad) ReadDown(version uint) (r io.ReadCloser, identifier string, err error) {
+	if m, ok := n.migrations.Down(version); ok {
+		r, err := n.readVariable(m.Raw)
+		if err != nil {
+			return nil, "", err
+		}
+		return r, m.Identifier, nil
+	}
+	return nil, "", &os.PathError{Op: fmt.Sprintf("read version %v", version), Path: n.config.Path, Err: os.ErrNotExist}
+}
+
+func (n *Nomad) List() ([]source.Migration, error) {
+	return n.migrations.List(), nil
+}
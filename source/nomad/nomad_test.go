@@ -0,0 +1,183 @@
+package nomad
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"testing"
+
+	st "github.com/golang-migrate/migrate/v4/source/testing"
+)
+
+// fakeNomad serves variables in the default namespace, with one ACL token.
+// Listings are paged by two variables.
+type fakeNomad struct {
+	token     string
+	variables map[string]string
+}
+
+func (f *fakeNomad) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	reply := func(v interface{}) { _ = json.NewEncoder(w).Encode(v) }
+
+	if r.Header.Get("X-Nomad-Token") != f.token {
+		w.WriteHeader(http.StatusForbidden)
+		_, _ = io.WriteString(w, "Permission denied")
+		return
+	}
+	if ns := r.URL.Query().Get("namespace"); ns != "" && ns != "default" {
+		reply([]interface{}{})
+		return
+	}
+
+	switch p := r.URL.Path; {
+	case p == "/v1/vars":
+		prefix := r.URL.Query().Get("prefix")
+		paths := []string{}
+		for k := range f.variables {
+			if strings.HasPrefix(k, prefix) {
+				paths = append(paths, k)
+			}
+		}
+		sort.Strings(paths)
+
+		start, _ := strconv.Atoi(r.URL.Query().Get("next_token"))
+		end := start + 2
+		if end < len(paths) {
+			w.Header().Set("X-Nomad-NextToken", strconv.Itoa(end))
+		} else {
+			end = len(paths)
+		}
+		vars := []map[string]string{}
+		for _, k := range paths[start:end] {
+			vars = append(vars, map[string]string{"Path": k, "Namespace": "default"})
+		}
+		reply(vars)
+	case strings.HasPrefix(p, "/v1/var/"):
+		k := strings.TrimPrefix(p, "/v1/var/")
+		body, ok := f.variables[k]
+		if !ok {
+			w.WriteHeader(http.StatusNotFound)
+			_, _ = io.WriteString(w, "variable not found")
+			return
+		}
+		reply(map[string]interface{}{"Path": k, "Items": map[string]string{"migration": body}})
+	default:
+		w.WriteHeader(http.StatusNotFound)
+	}
+}
+
+func newFakeNomad() *httptest.Server {
+	return httptest.NewServer(&fakeNomad{
+		token: "t0ken",
+		variables: map[string]string{
+			"kv/migrations/1_foobar.up.sql":     "1 up",
+			"kv/migrations/1_foobar.down.sql":   "1 down",
+			"kv/migrations/3_foobar.up.sql":     "3 up",
+			"kv/migrations/4_foobar.up.sql":     "4 up",
+			"kv/migrations/4_foobar.down.sql":   "4 down",
+			"kv/migrations/5_foobar.down.sql":   "5 down",
+			"kv/migrations/7_foobar.up.sql":     "7 up",
+			"kv/migrations/7_foobar.down.sql":   "7 down",
+			"kv/migrations/sub/8_foobar.up.sql": "8 up",
+			"kv/migrations2/9_foobar.up.sql":    "9 up",
+		},
+	})
+}
+
+func Test(t *testing.T) {
+	ts := newFakeNomad()
+	defer ts.Close()
+
+	n := &Nomad{}
+	d, err := n.Open("nomad://" + strings.TrimPrefix(ts.URL, "http://") + "/kv/migrations?token=t0ken&x-tls=false")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer d.Close()
+	st.Test(t, d)
+
+	r, identifier, err := d.ReadUp(3)
+	if err != nil {
+		t.Fatal(err)
+	}
+	body, _ := io.ReadAll(r)
+	if string(body) != "3 up" || identifier != "foobar" {
+		t.Errorf("expected 3 up foobar, got %q %q", body, identifier)
+	}
+
+	if _, err := d.Next(7); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("expected only the migrations under kv/migrations, got next version with %v", err)
+	}
+}
+
+func TestOpenTokenEnv(t *testing.T) {
+	ts := newFakeNomad()
+	defer ts.Close()
+
+	t.Setenv(TokenEnv, "t0ken")
+	d, err := (&Nomad{}).Open("nomad://" + strings.TrimPrefix(ts.URL, "http://") + "/kv/migrations?x-tls=false")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer d.Close()
+	if v, err := d.First(); err != nil || v != 1 {
+		t.Errorf("expected first version 1, got %v %v", v, err)
+	}
+}
+
+func TestWithInstance(t *testing.T) {
+	ts := newFakeNomad()
+	defer ts.Close()
+
+	tt := []struct {
+		name   string
+		config Config
+		err    error
+	}{
+		{name: "token", config: Config{Path: "kv/migrations", Token: "t0ken"}},
+		{name: "bad token", config: Config{Path: "kv/migrations", Token: "wrong"}, err: errors.New("403")},
+		{name: "no path", config: Config{Token: "t0ken"}, err: ErrNoPath},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			c := tc.config
+			c.Address = ts.URL
+			d, err := WithInstance(ts.Client(), &c)
+			if tc.err == nil {
+				if err != nil {
+					t.Fatal(err)
+				}
+				d.Close()
+				return
+			}
+			if err == nil {
+				d.Close()
+				t.Fatal("expected an error")
+			}
+			if !errors.Is(err, tc.err) && !strings.Contains(err.Error(), tc.err.Error()) {
+				t.Errorf("expected %v, got %v", tc.err, err)
+			}
+		})
+	}
+}
+
+func TestItemNotFound(t *testing.T) {
+	ts := newFakeNomad()
+	defer ts.Close()
+
+	d, err := WithInstance(ts.Client(), &Config{Address: ts.URL, Path: "kv/migrations", Item: "sql", Token: "t0ken"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer d.Close()
+	if _, _, err := d.ReadUp(1); !errors.Is(err, ErrItemNotFound) {
+		t.Errorf("expected %v, got %v", ErrItemNotFound, err)
+	}
+}
@@ -0,0 +1,108 @@
+// Package offset provides a source driver wrapper shifting the versions of
+// another source driver by a constant, for merging the migration histories
+// of several projects without renaming their migrations.
+package offset
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"os"
+
+	"github.com/golang-migrate/migrate/v4/source"
+)
+
+// ErrOverflow is returned by New if shifting a version exceeds the largest
+// version a database can record.
+var ErrOverflow = errors.New("version offset overflows")
+
+// Offset wraps a source driver and adds a constant offset to every version,
+// e.g. with an offset of 1000, migration 1 of the wrapped driver is
+// exposed as version 1001. The identifiers are left unchanged.
+type Offset struct {
+	source.Driver
+
+	offset uint
+}
+
+// New returns a new Offset wrapping drv, adding offset to its versions.
+// The versions of drv are walked once to check that none of them overflows
+// when shifted, which also keeps them unique. ErrOverflow is returned
+// otherwise.
+func New(drv source.Driver, offset uint) (*Offset, error) {
+	versions, err := source.SortedVersions(drv)
+	if err != nil {
+		return nil, err
+	}
+	if n := len(versions); n > 0 && versions[n-1] > math.MaxInt-offset {
+		return nil, fmt.Errorf("%w: version %d + %d", ErrOverflow, versions[n-1], offset)
+	}
+	return &Offset{
+		Driver: drv,
+		offset: offset,
+	}, nil
+}
+
+// Open is part of source.Driver interface implementation.
+// Open cannot be called on the offset source wrapper.
+func (o *Offset) Open(url string) (source.Driver, error) {
+	return nil, errors.New("Open() cannot be called on the offset source wrapper")
+}
+
+// First is part of source.Driver interface implementation.
+func (o *Offset) First() (version uint, err error) {
+	return o.shift(o.Driver.First())
+}
+
+// Prev is part of source.Driver interface implementation.
+func (o *Offset) Prev(version uint) (prevVersion uint, err error) {
+	v, err := o.unshift("prev", version)
+	if err != nil {
+		return 0, err
+	}
+	return o.shift(o.Driver.Prev(v))
+}
+
+// Next is part of source.Driver interface implementation.
+func (o *Offset) Next(version uint) (nextVersion uint, err error) {
+	v, err := o.unshift("next", version)
+	if err != nil {
+		return 0, err
+	}
+	return o.shift(o.Driver.Next(v))
+}
+
+// ReadUp is part of source.Driver interface implementation.
+func (o *Offset) ReadUp(version uint) (r io.ReadCloser, identifier string, err error) {
+	v, err := o.unshift("read up", version)
+	if err != nil {
+		return nil, "", err
+	}
+	return o.Driver.ReadUp(v)
+}
+
+// ReadDown is part of source.Driver interface implementation.
+func (o *Offset) ReadDown(version uint) (r io.ReadCloser, identifier string, err error) {
+	v, err := o.unshift("read down", version)
+	if err != nil {
+		return nil, "", err
+	}
+	return o.Driver.ReadDown(v)
+}
+
+func (o *Offset) shift(version uint, err error) (uint, error) {
+	if err != nil {
+		return 0, err
+	}
+	return version + o.offset, nil
+}
+
+// unshift returns the version of the wrapped driver for version, which
+// doesn't exist if it is below the offset.
+func (o *Offset) unshift(op string, version uint) (uint, error) {
+	if version < o.offset {
+		return 0, &os.PathError{Op: fmt.Sprintf("%s for version %d", op, version), Path: "offset", Err: os.ErrNotExist}
+	}
+	return version - o.offset, nil
+}
@@ -0,0 +1,112 @@
+package offset
+
+import (
+	"errors"
+	"io"
+	"math"
+	"os"
+	"testing"
+
+	"github.com/golang-migrate/migrate/v4/source"
+	"github.com/golang-migrate/migrate/v4/source/stub"
+	st "github.com/golang-migrate/migrate/v4/source/testing"
+)
+
+func newStub(t *testing.T) source.Driver {
+	t.Helper()
+	d, err := (&stub.Stub{}).Open("")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	m := source.NewMigrations()
+	m.Append(&source.Migration{Version: 1, Direction: source.Up, Identifier: "CREATE 1"})
+	m.Append(&source.Migration{Version: 1, Direction: source.Down, Identifier: "DROP 1"})
+	m.Append(&source.Migration{Version: 3, Direction: source.Up, Identifier: "CREATE 3"})
+	m.Append(&source.Migration{Version: 4, Direction: source.Up, Identifier: "CREATE 4"})
+	m.Append(&source.Migration{Version: 4, Direction: source.Down, Identifier: "DROP 4"})
+	m.Append(&source.Migration{Version: 5, Direction: source.Down, Identifier: "DROP 5"})
+	m.Append(&source.Migration{Version: 7, Direction: source.Up, Identifier: "CREATE 7"})
+	m.Append(&source.Migration{Version: 7, Direction: source.Down, Identifier: "DROP 7"})
+	d.(*stub.Stub).Migrations = m
+	return d
+}
+
+func Test(t *testing.T) {
+	// without an offset, the wrapper behaves like the wrapped driver
+	d, err := New(newStub(t), 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	st.Test(t, d)
+}
+
+func TestOffset(t *testing.T) {
+	d, err := New(newStub(t), 1000)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	v, err := d.First()
+	if err != nil || v != 1001 {
+		t.Fatalf("First: expected 1001, got %v, %v", v, err)
+	}
+	for _, expected := range []uint{1003, 1004, 1005, 1007} {
+		if v, err = d.Next(v); err != nil || v != expected {
+			t.Fatalf("Next: expected %v, got %v, %v", expected, v, err)
+		}
+	}
+	if _, err := d.Next(v); !errors.Is(err, os.ErrNotExist) {
+		t.Fatalf("Next: expected os.ErrNotExist after the last version, got %v", err)
+	}
+	if v, err := d.Prev(1004); err != nil || v != 1003 {
+		t.Fatalf("Prev: expected 1003, got %v, %v", v, err)
+	}
+	if _, err := d.Prev(1001); !errors.Is(err, os.ErrNotExist) {
+		t.Fatalf("Prev: expected os.ErrNotExist before the first version, got %v", err)
+	}
+
+	r, identifier, err := d.ReadUp(1004)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if body, _ := io.ReadAll(r); string(body) != "CREATE 4" || identifier != "4.up.stub" {
+		t.Fatalf("ReadUp: expected CREATE 4 with the unchanged identifier, got %q, %q", body, identifier)
+	}
+	r, identifier, err = d.ReadDown(1005)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if body, _ := io.ReadAll(r); string(body) != "DROP 5" || identifier != "5.down.stub" {
+		t.Fatalf("ReadDown: expected DROP 5 with the unchanged identifier, got %q, %q", body, identifier)
+	}
+
+	// the unshifted versions are hidden
+	for _, version := range []uint{1, 4, 999} {
+		if _, _, err := d.ReadUp(version); !errors.Is(err, os.ErrNotExist) {
+			t.Errorf("ReadUp(%v): expected os.ErrNotExist, got %v", version, err)
+		}
+		if _, err := d.Next(version); !errors.Is(err, os.ErrNotExist) {
+			t.Errorf("Next(%v): expected os.ErrNotExist, got %v", version, err)
+		}
+	}
+}
+
+func TestOverflow(t *testing.T) {
+	if _, err := New(newStub(t), math.MaxInt-7); err != nil {
+		t.Fatalf("expected the last version to fit, got %v", err)
+	}
+	if _, err := New(newStub(t), math.MaxInt-6); !errors.Is(err, ErrOverflow) {
+		t.Fatalf("expected ErrOverflow, got %v", err)
+	}
+}
+
+func TestOpen(t *testing.T) {
+	d, err := New(newStub(t), 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := d.Open("stub://"); err == nil {
+		t.Fatal("expected Open to fail")
+	}
+}
@@ -2,8 +2,10 @@ package source
 
 import (
 	"fmt"
+	"path"
 	"regexp"
 	"strconv"
+	"strings"
 )
 
 var (
@@ -38,3 +40,77 @@ func Parse(raw string) (*Migration, error) {
 	}
 	return nil, ErrParse
 }
+
+// PatternParse returns a function parsing migrations like Parse, but with
+// the regular expression pattern. It must have the named groups version and
+// direction, which has to match up or down in any case, and may have the
+// named group name for the identifier. For example:
+//
+//	^(?P<version>[0-9]+)\.(?P<name>.*)\.(?P<direction>up|down)\.sql$
+func PatternParse(pattern string) (func(raw string) (*Migration, error), error) {
+	re, err := regexp.Compile(pattern)
+	if err != nil {
+		return nil, err
+	}
+	version, direction, name := re.SubexpIndex("version"), re.SubexpIndex("direction"), re.SubexpIndex("name")
+	if version < 0 || direction < 0 {
+		return nil, fmt.Errorf("pattern %q must have the named groups version and direction", pattern)
+	}
+
+	return func(raw string) (*Migration, error) {
+		m := re.FindStringSubmatch(raw)
+		if m == nil {
+			return nil, ErrParse
+		}
+		versionUint64, err := strconv.ParseUint(m[version], 10, 64)
+		if err != nil {
+			return nil, err
+		}
+		d := Direction(strings.ToLower(m[direction]))
+		if d != Up && d != Down {
+			return nil, ErrParse
+		}
+		migr := &Migration{
+			Version:   uint(versionUint64),
+			Direction: d,
+			Raw:       raw,
+		}
+		if name >= 0 {
+			migr.Identifier = m[name]
+		}
+		return migr, nil
+	}, nil
+}
+
+// DirRegex matches the name of a directory holding the migrations
+// of a single version:
+//
+//	123_name/
+var DirRegex = regexp.MustCompile(`^([0-9]+)_(.*)$`)
+
+// DirFileRegex matches the following pattern of files inside a
+// directory matching DirRegex:
+//
+//	up.ext
+//	down.ext
+var DirFileRegex = regexp.MustCompile(`^(` + string(Down) + `|` + string(Up) + `)\.(.*)$`)
+
+// ParseDir returns Migration for a file inside a migration directory,
+// matching DirRegex for dir and DirFileRegex for file.
+func ParseDir(dir, file string) (*Migration, error) {
+	d := DirRegex.FindStringSubmatch(dir)
+	f := DirFileRegex.FindStringSubmatch(file)
+	if len(d) == 3 && len(f) == 3 {
+		versionUint64, err := strconv.ParseUint(d[1], 10, 64)
+		if err != nil {
+			return nil, err
+		}
+		return &Migration{
+			Version:    uint(versionUint64),
+			Identifier: d[2],
+			Direction:  Direction(f[1]),
+			Raw:        path.Join(dir, file),
+		}, nil
+	}
+	return nil, ErrParse
+}
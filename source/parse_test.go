@@ -104,3 +104,150 @@ func TestParse(t *testing.T) {
 		}
 	}
 }
+
+func TestParseDir(t *testing.T) {
+	tt := []struct {
+		dir             string
+		file            string
+		expectErr       error
+		expectMigration *Migration
+	}{
+		{
+			dir:       "000001_init",
+			file:      "up.sql",
+			expectErr: nil,
+			expectMigration: &Migration{
+				Version:    1,
+				Identifier: "init",
+				Direction:  Up,
+				Raw:        "000001_init/up.sql",
+			},
+		},
+		{
+			dir:       "20170412214116_date_foobar",
+			file:      "down.sql",
+			expectErr: nil,
+			expectMigration: &Migration{
+				Version:    20170412214116,
+				Identifier: "date_foobar",
+				Direction:  Down,
+				Raw:        "20170412214116_date_foobar/down.sql",
+			},
+		},
+		{
+			dir:             "init",
+			file:            "up.sql",
+			expectErr:       ErrParse,
+			expectMigration: nil,
+		},
+		{
+			dir:             "1_init",
+			file:            "1_init.up.sql",
+			expectErr:       ErrParse,
+			expectMigration: nil,
+		},
+		{
+			dir:             "1_init",
+			file:            "up",
+			expectErr:       ErrParse,
+			expectMigration: nil,
+		},
+	}
+
+	for i, v := range tt {
+		f, err := ParseDir(v.dir, v.file)
+
+		if err != v.expectErr {
+			t.Errorf("expected %v, got %v, in %v", v.expectErr, err, i)
+		}
+
+		if v.expectMigration != nil && *f != *v.expectMigration {
+			t.Errorf("expected %+v, got %+v, in %v", *v.expectMigration, *f, i)
+		}
+	}
+}
+
+func TestPatternParse(t *testing.T) {
+	parse, err := PatternParse(`^V(?P<version>[0-9]+)\.(?P<name>.*)\.(?P<direction>up|down|UP|DOWN)\.sql$`)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tt := []struct {
+		name            string
+		expectErr       error
+		expectMigration *Migration
+	}{
+		{
+			name: "V0001.create_users.up.sql",
+			expectMigration: &Migration{
+				Version:    1,
+				Identifier: "create_users",
+				Direction:  Up,
+				Raw:        "V0001.create_users.up.sql",
+			},
+		},
+		{
+			name: "V12.create.users.DOWN.sql",
+			expectMigration: &Migration{
+				Version:    12,
+				Identifier: "create.users",
+				Direction:  Down,
+				Raw:        "V12.create.users.DOWN.sql",
+			},
+		},
+		{
+			name:      "1_create_users.up.sql",
+			expectErr: ErrParse,
+		},
+		{
+			name:      "V1.create_users.up.txt",
+			expectErr: ErrParse,
+		},
+	}
+
+	for i, v := range tt {
+		f, err := parse(v.name)
+
+		if err != v.expectErr {
+			t.Errorf("expected %v, got %v, in %v", v.expectErr, err, i)
+		}
+
+		if v.expectMigration != nil && *f != *v.expectMigration {
+			t.Errorf("expected %+v, got %+v, in %v", *v.expectMigration, *f, i)
+		}
+	}
+}
+
+func TestPatternParseWithoutName(t *testing.T) {
+	parse, err := PatternParse(`^(?P<version>[0-9]+)-(?P<direction>[a-z]+)\.sql$`)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	m, err := parse("3-up.sql")
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := Migration{Version: 3, Direction: Up, Raw: "3-up.sql"}
+	if *m != expected {
+		t.Errorf("expected %+v, got %+v", expected, *m)
+	}
+
+	// the direction group has to match up or down
+	if _, err := parse("3-apply.sql"); err != ErrParse {
+		t.Errorf("expected %v, got %v", ErrParse, err)
+	}
+}
+
+func TestPatternParseInvalid(t *testing.T) {
+	for _, pattern := range []string{
+		`^(?P<version>[0-9]+`,
+		`^(?P<version>[0-9]+)_(?P<name>.*)\.sql$`,
+		`^([0-9]+)_(.*)\.(up|down)\.sql$`,
+	} {
+		if _, err := PatternParse(pattern); err == nil {
+			t.Errorf("%v: expected an error", pattern)
+		}
+	}
+}
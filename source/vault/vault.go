@@ -0,0 +1,387 @@
+package vault
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	nurl "net/url"
+	"os"
+	"path"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/golang-migrate/migrate/v4/source"
+)
+
+func init() {
+	source.Register("vault", &Vault{})
+}
+
+const DefaultField = "migration"
+
+var (
+	ErrNoPath        = fmt.Errorf("no secret path")
+	ErrNoAuth        = fmt.Errorf("no token, x-role-id and x-secret-id or x-k8s-sa-token-path provided")
+	ErrNoK8sRole     = fmt.Errorf("x-k8s-role is required with x-k8s-sa-token-path")
+	ErrFieldNotFound = fmt.Errorf("field not found in secret")
+)
+
+type Vault struct {
+	config     *Config
+	client     *http.Client
+	migrations *source.Migrations
+
+	token string
+
+	stop chan struct{}
+	done chan struct{}
+}
+
+type Config struct {
+	// Address of the Vault server, like https://vault:8200.
+	Address string
+	// Path of the secrets, like secret/data/migrations. Paths with data as
+	// their second element are read as KV version 2.
+	Path      string
+	Namespace string
+	// Field is the secret field holding the migration body.
+	// Defaults to DefaultField.
+	Field string
+
+	// Token authenticates directly. Otherwise RoleID and SecretID log in
+	// with AppRole, or K8sTokenPath and K8sRole log in with Kubernetes.
+	Token        string
+	RoleID       string
+	SecretID     string
+	K8sTokenPath string
+	K8sRole      string
+}
+
+func (v *Vault) Open(url string) (source.Driver, error) {
+	u, err := nurl.Parse(url)
+	if err != nil {
+		return nil, err
+	}
+
+	q := u.Query()
+	scheme := "https"
+	if s := q.Get("x-tls"); s != "" {
+		tls, err := strconv.ParseBool(s)
+		if err != nil {
+			return nil, fmt.Errorf("unable to parse option x-tls: %w", err)
+		}
+		if !tls {
+			scheme = "http"
+		}
+	}
+
+	return WithInstance(http.DefaultClient, &Config{
+		Address:      scheme + "://" + u.Host,
+		Path:         strings.Trim(u.Path, "/"),
+		Namespace:    q.Get("namespace"),
+		Field:        q.Get("x-field"),
+		Token:        q.Get("token"),
+		RoleID:       q.Get("x-role-id"),
+		SecretID:     q.Get("x-secret-id"),
+		K8sTokenPath: q.Get("x-k8s-sa-token-path"),
+		K8sRole:      q.Get("x-k8s-role"),
+	})
+}
+
+// WithInstance authenticates with Vault and lists the migrations under
+// config.Path. If the token is renewable, it is renewed in the background
+// until Close is called.
+func WithInstance(client *http.Client, config *Config) (source.Driver, error) {
+	if config.Path == "" {
+		return nil, ErrNoPath
+	}
+	if config.Field == "" {
+		config.Field = DefaultField
+	}
+
+	v := &Vault{
+		config:     config,
+		client:     client,
+		migrations: source.NewMigrations(),
+	}
+
+	a, err := v.login()
+	if err != nil {
+		return nil, err
+	}
+	v.token = a.ClientToken
+
+	if err := v.readDirectory(); err != nil {
+		return nil, err
+	}
+
+	v.stop = make(chan struct{})
+	v.done = make(chan struct{})
+	go v.renew(a)
+
+	return v, nil
+}
+
+type secret struct {
+	Data json.RawMessage `json:"data"`
+	Auth *auth           `json:"auth"`
+}
+
+type auth struct {
+	ClientToken   string `json:"client_token"`
+	LeaseDuration int    `json:"lease_duration"`
+	Renewable     bool   `json:"renewable"`
+}
+
+// login returns the token to use, with its lease if it has one.
+func (v *Vault) login() (*auth, error) {
+	c := v.config
+	switch {
+	case c.Token != "":
+		v.token = c.Token
+		s, err := v.do(http.MethodGet, "auth/token/lookup-self", nil)
+		if err != nil {
+			return nil, err
+		}
+		var data struct {
+			TTL       int  `json:"ttl"`
+			Renewable bool `json:"renewable"`
+		}
+		if err := json.Unmarshal(s.Data, &data); err != nil {
+			return nil, err
+		}
+		return &auth{ClientToken: c.Token, LeaseDuration: data.TTL, Renewable: data.Renewable}, nil
+
+	case c.RoleID != "" && c.SecretID != "":
+		return v.loginWith("auth/approle/login", map[string]string{
+			"role_id":   c.RoleID,
+			"secret_id": c.SecretID,
+		})
+
+	case c.K8sTokenPath != "":
+		if c.K8sRole == "" {
+			return nil, ErrNoK8sRole
+		}
+		jwt, err := os.ReadFile(c.K8sTokenPath)
+		if err != nil {
+			return nil, err
+		}
+		return v.loginWith("auth/kubernetes/login", map[string]string{
+			"role": c.K8sRole,
+			"jwt":  strings.TrimSpace(string(jwt)),
+		})
+	}
+	return nil, ErrNoAuth
+}
+
+func (v *Vault) loginWith(endpoint string, body map[string]string) (*auth, error) {
+	s, err := v.do(http.MethodPost, endpoint, body)
+	if err != nil {
+		return nil, err
+	}
+	if s.Auth == nil || s.Auth.ClientToken == "" {
+		return nil, fmt.Errorf("vault: no token returned by %v", endpoint)
+	}
+	return s.Auth, nil
+}
+
+// renew renews the token at two thirds of its lease until stopped, or
+// until Vault stops renewing it.
+func (v *Vault) renew(a *auth) {
+	defer close(v.done)
+
+	for a.Renewable && a.LeaseDuration > 0 {
+		select {
+		case <-v.stop:
+			return
+		case <-time.After(time.Duration(a.LeaseDuration) * time.Second * 2 / 3):
+		}
+
+		s, err := v.do(http.MethodPost, "auth/token/renew-self", nil)
+		if err != nil || s.Auth == nil {
+			return
+		}
+		a = s.Auth
+	}
+	<-v.stop
+}
+
+func (v *Vault) readDirectory() error {
+	s, err := v.do("LIST", v.listPath(), nil)
+	if err != nil {
+		return err
+	}
+	var data struct {
+		Keys []string `json:"keys"`
+	}
+	if err := json.Unmarshal(s.Data, &data); err != nil {
+		return err
+	}
+
+	for _, key := range data.Keys {
+		m, err := source.DefaultParse(key)
+		if err != nil {
+			continue // ignore keys that we can't parse, like sub paths
+		}
+		if !v.migrations.Append(m) {
+			return fmt.Errorf("unable to parse file %v", key)
+		}
+	}
+	return nil
+}
+
+// listPath returns the path listing the secrets, which is the metadata
+// path for KV version 2.
+func (v *Vault) listPath() string {
+	if mount, rest, ok := v.kv2(); ok {
+		return path.Join(mount, "metadata", rest)
+	}
+	return v.config.Path
+}
+
+func (v *Vault) kv2() (mount, rest string, ok bool) {
+	pe := strings.SplitN(v.config.Path, "/", 3)
+	if len(pe) < 2 || pe[1] != "data" {
+		return "", "", false
+	}
+	if len(pe) == 3 {
+		rest = pe[2]
+	}
+	return pe[0], rest, true
+}
+
+func (v *Vault) readSecret(key string) (io.ReadCloser, error) {
+	s, err := v.do(http.MethodGet, path.Join(v.config.Path, key), nil)
+	if err != nil {
+		return nil, err
+	}
+
+	raw := s.Data
+	if _, _, ok := v.kv2(); ok {
+		var data struct {
+			Data json.RawMessage `json:"data"`
+		}
+		if err := json.Unmarshal(raw, &data); err != nil {
+			return nil, err
+		}
+		raw = data.Data
+	}
+
+	var fields map[string]interface{}
+	if err := json.Unmarshal(raw, &fields); err != nil {
+		return nil, err
+	}
+	body, ok := fields[v.config.Field].(string)
+	if !ok {
+		return nil, fmt.Errorf("%w: %v in %v", ErrFieldNotFound, v.config.Field, key)
+	}
+	return io.NopCloser(strings.NewReader(body)), nil
+}
+
+// do sends a request to the Vault API at endpoint, like auth/approle/login.
+func (v *Vault) do(method, endpoint string, body interface{}) (*secret, error) {
+	var r io.Reader
+	if body != nil {
+		b, err := json.Marshal(body)
+		if err != nil {
+			return nil, err
+		}
+		r = bytes.NewReader(b)
+	}
+
+	req, err := http.NewRequest(method, strings.TrimRight(v.config.Address, "/")+"/v1/"+endpoint, r)
+	if err != nil {
+		return nil, err
+	}
+	if v.token != "" {
+		req.Header.Set("X-Vault-Token", v.token)
+	}
+	if v.config.Namespace != "" {
+		req.Header.Set("X-Vault-Namespace", v.config.Namespace)
+	}
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+
+	resp, err := v.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode == http.StatusNotFound {
+		return nil, &os.PathError{Op: strings.ToLower(method), Path: endpoint, Err: os.ErrNotExist}
+	}
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		var e struct {
+			Errors []string `json:"errors"`
+		}
+		_ = json.NewDecoder(resp.Body).Decode(&e)
+		return nil, fmt.Errorf("vault: %v %v: %v %v", method, endpoint, resp.Status, strings.Join(e.Errors, ", "))
+	}
+
+	var s secret
+	if err := json.NewDecoder(resp.Body).Decode(&s); err != nil {
+		return nil, err
+	}
+	return &s, nil
+}
+
+func (v *Vault) Close() error {
+	if v.stop != nil {
+		close(v.stop)
+		<-v.done
+		v.stop = nil
+	}
+	return nil
+}
+
+func (v *Vault) First() (version uint, err error) {
+	if ver, ok := v.migrations.First(); ok {
+		return ver, nil
+	}
+	return 0, &os.PathError{Op: "first", Path: v.config.Path, Err: os.ErrNotExist}
+}
+
+func (v *Vault) Prev(version uint) (prevVersion uint, err error) {
+	if ver, ok := v.migrations.Prev(version); ok {
+		return ver, nil
+	}
+	return 0, &os.PathError{Op: fmt.Sprintf("prev for version %v", version), Path: v.config.Path, Err: os.ErrNotExist}
+}
+
+func (v *Vault) Next(version uint) (nextVersion uint, err error) {
+	if ver, ok := v.migrations.Next(version); ok {
+		return ver, nil
+	}
+	return 0, &os.PathError{Op: fmt.Sprintf("next for version %v", version), Path: v.config.Path, Err: os.ErrNotExist}
+}
+
+func (v *Vault) ReadUp(version uint) (r io.ReadCloser, identifier string, err error) {
+	if m, ok := v.migrations.Up(version); ok {
+		r, err := v.readSecret(m.Raw)
+		if err != nil {
+			return nil, "", err
+		}
+		return r, m.Identifier, nil
+	}
+	return nil, "", &os.PathError{Op: fmt.Sprintf("read version %v", version), Path: v.config.Path, Err: os.ErrNotExist}
+}
+
+func (v *Vault) ReadDown(version uint) (r io.ReadCloser, identifier string, err error) {
+	if m, ok := v.migrations.Down(version); ok {
+		r, err := v.readSecret(m.Raw)
+		if err != nil {
+			return nil, "", err
+		}
+		return r, m.Identifier, nil
+	}
+	return nil, "", &os.PathError{Op: fmt.Sprintf("read version %v", version), Path: v.config.Path, Err: os.ErrNotExist}
+}
+
+func (v *Vault) List() ([]source.Migration, error) {
+	return v.migrations.List(), nil
+}
@@ -0,0 +1,211 @@
+package vault
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	st "github.com/golang-migrate/migrate/v4/source/testing"
+)
+
+// fakeVault serves KV version 2 secrets under secret/, with one token.
+type fakeVault struct {
+	token    string
+	ttl      int
+	secrets  map[string]string
+	renewals atomic.Int32
+}
+
+func (f *fakeVault) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	p := strings.TrimPrefix(r.URL.Path, "/v1/")
+	reply := func(v interface{}) { _ = json.NewEncoder(w).Encode(v) }
+
+	switch {
+	case p == "auth/approle/login" || p == "auth/kubernetes/login":
+		var body map[string]string
+		_ = json.NewDecoder(r.Body).Decode(&body)
+		if body["secret_id"] != "s3cret" && body["jwt"] != "sa-jwt" {
+			w.WriteHeader(http.StatusBadRequest)
+			reply(map[string][]string{"errors": {"invalid credentials"}})
+			return
+		}
+		reply(map[string]interface{}{"auth": map[string]interface{}{
+			"client_token": f.token, "lease_duration": f.ttl, "renewable": true,
+		}})
+		return
+	}
+
+	if r.Header.Get("X-Vault-Token") != f.token {
+		w.WriteHeader(http.StatusForbidden)
+		reply(map[string][]string{"errors": {"permission denied"}})
+		return
+	}
+
+	switch {
+	case p == "auth/token/lookup-self":
+		reply(map[string]interface{}{"data": map[string]interface{}{"ttl": f.ttl, "renewable": f.ttl > 0}})
+	case p == "auth/token/renew-self":
+		f.renewals.Add(1)
+		reply(map[string]interface{}{"auth": map[string]interface{}{
+			"client_token": f.token, "lease_duration": f.ttl, "renewable": true,
+		}})
+	case r.Method == "LIST" && p == "secret/metadata/migrations":
+		keys := []string{"sub/"}
+		for k := range f.secrets {
+			keys = append(keys, k)
+		}
+		reply(map[string]interface{}{"data": map[string]interface{}{"keys": keys}})
+	case r.Method == http.MethodGet && strings.HasPrefix(p, "secret/data/migrations/"):
+		body, ok := f.secrets[strings.TrimPrefix(p, "secret/data/migrations/")]
+		if !ok {
+			w.WriteHeader(http.StatusNotFound)
+			reply(map[string][]string{"errors": {}})
+			return
+		}
+		reply(map[string]interface{}{"data": map[string]interface{}{
+			"data": map[string]string{"migration": body},
+		}})
+	default:
+		w.WriteHeader(http.StatusNotFound)
+	}
+}
+
+func newFakeVault(ttl int) (*fakeVault, *httptest.Server) {
+	f := &fakeVault{
+		token: "t0ken",
+		ttl:   ttl,
+		secrets: map[string]string{
+			"1_foobar.up.sql":   "1 up",
+			"1_foobar.down.sql": "1 down",
+			"3_foobar.up.sql":   "3 up",
+			"4_foobar.up.sql":   "4 up",
+			"4_foobar.down.sql": "4 down",
+			"5_foobar.down.sql": "5 down",
+			"7_foobar.up.sql":   "7 up",
+			"7_foobar.down.sql": "7 down",
+		},
+	}
+	return f, httptest.NewServer(f)
+}
+
+func Test(t *testing.T) {
+	_, ts := newFakeVault(0)
+	defer ts.Close()
+
+	v := &Vault{}
+	d, err := v.Open("vault://" + strings.TrimPrefix(ts.URL, "http://") + "/secret/data/migrations?token=t0ken&x-tls=false")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer d.Close()
+	st.Test(t, d)
+
+	r, identifier, err := d.ReadUp(3)
+	if err != nil {
+		t.Fatal(err)
+	}
+	body, _ := io.ReadAll(r)
+	if string(body) != "3 up" || identifier != "foobar" {
+		t.Errorf("expected 3 up foobar, got %q %q", body, identifier)
+	}
+}
+
+func TestAuth(t *testing.T) {
+	_, ts := newFakeVault(0)
+	defer ts.Close()
+
+	saToken := filepath.Join(t.TempDir(), "token")
+	if err := os.WriteFile(saToken, []byte("sa-jwt\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	tt := []struct {
+		name   string
+		config Config
+		err    error
+	}{
+		{name: "token", config: Config{Token: "t0ken"}},
+		{name: "bad token", config: Config{Token: "wrong"}, err: errors.New("403")},
+		{name: "approle", config: Config{RoleID: "role", SecretID: "s3cret"}},
+		{name: "bad approle", config: Config{RoleID: "role", SecretID: "wrong"}, err: errors.New("invalid credentials")},
+		{name: "kubernetes", config: Config{K8sTokenPath: saToken, K8sRole: "migrate"}},
+		{name: "kubernetes without role", config: Config{K8sTokenPath: saToken}, err: ErrNoK8sRole},
+		{name: "none", config: Config{}, err: ErrNoAuth},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			c := tc.config
+			c.Address = ts.URL
+			c.Path = "secret/data/migrations"
+			d, err := WithInstance(ts.Client(), &c)
+			if tc.err == nil {
+				if err != nil {
+					t.Fatal(err)
+				}
+				d.Close()
+				return
+			}
+			if err == nil {
+				d.Close()
+				t.Fatal("expected an error")
+			}
+			if !errors.Is(err, tc.err) && !strings.Contains(err.Error(), tc.err.Error()) {
+				t.Errorf("expected %v, got %v", tc.err, err)
+			}
+		})
+	}
+}
+
+func TestRenew(t *testing.T) {
+	f, ts := newFakeVault(1)
+	defer ts.Close()
+
+	d, err := WithInstance(ts.Client(), &Config{
+		Address:  ts.URL,
+		Path:     "secret/data/migrations",
+		RoleID:   "role",
+		SecretID: "s3cret",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for i := 0; i < 100 && f.renewals.Load() < 2; i++ {
+		if _, err := d.First(); err != nil {
+			t.Fatal(err)
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+	if err := d.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if n := f.renewals.Load(); n < 2 {
+		t.Errorf("expected the token to be renewed at least twice, got %v", n)
+	}
+}
+
+func TestListPath(t *testing.T) {
+	tt := []struct {
+		path     string
+		expected string
+	}{
+		{path: "secret/data/migrations", expected: "secret/metadata/migrations"},
+		{path: "secret/data", expected: "secret/metadata"},
+		{path: "kv/migrations", expected: "kv/migrations"},
+	}
+	for _, tc := range tt {
+		v := &Vault{config: &Config{Path: tc.path}}
+		if p := v.listPath(); p != tc.expected {
+			t.Errorf("%v: expected %v, got %v", tc.path, tc.expected, p)
+		}
+	}
+}
@@ -0,0 +1,46 @@
+package source
+
+import (
+	"errors"
+	"os"
+)
+
+// SortedVersions returns the versions of all migrations of drv in ascending
+// order, walking them with First and Next. It returns an empty slice if drv
+// has no migrations.
+func SortedVersions(drv Driver) ([]uint, error) {
+	return walkVersions(drv, func(uint) (keep, more bool) { return true, true })
+}
+
+// SortedVersionRange is like SortedVersions, but only returns the versions
+// between from and to, both included. The walk stops at the first version
+// after to.
+func SortedVersionRange(drv Driver, from, to uint) ([]uint, error) {
+	if from > to {
+		return []uint{}, nil
+	}
+	return walkVersions(drv, func(v uint) (keep, more bool) {
+		return v >= from && v <= to, v < to
+	})
+}
+
+// walkVersions walks the versions of drv in order, collecting the ones
+// visit keeps until it returns more false.
+func walkVersions(drv Driver, visit func(version uint) (keep, more bool)) ([]uint, error) {
+	versions := []uint{}
+	v, err := drv.First()
+	for err == nil {
+		keep, more := visit(v)
+		if keep {
+			versions = append(versions, v)
+		}
+		if !more {
+			return versions, nil
+		}
+		v, err = drv.Next(v)
+	}
+	if errors.Is(err, os.ErrNotExist) {
+		return versions, nil
+	}
+	return nil, err
+}
@@ -0,0 +1,80 @@
+package source_test
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+
+	"github.com/golang-migrate/migrate/v4/source"
+	"github.com/golang-migrate/migrate/v4/source/stub"
+)
+
+func openStub(t *testing.T, versions ...uint) source.Driver {
+	t.Helper()
+	d, err := (&stub.Stub{}).Open("stub://")
+	if err != nil {
+		t.Fatal(err)
+	}
+	ms := source.NewMigrations()
+	for _, v := range versions {
+		ms.Append(&source.Migration{Version: v, Direction: source.Up})
+	}
+	d.(*stub.Stub).Migrations = ms
+	return d
+}
+
+func TestSortedVersions(t *testing.T) {
+	versions, err := source.SortedVersions(openStub(t))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(versions) != 0 {
+		t.Fatalf("expected no versions, got %v", versions)
+	}
+
+	versions, err = source.SortedVersions(openStub(t, 7, 1, 3, 4))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if expected := []uint{1, 3, 4, 7}; !reflect.DeepEqual(versions, expected) {
+		t.Fatalf("expected %v, got %v", expected, versions)
+	}
+}
+
+func TestSortedVersionRange(t *testing.T) {
+	d := openStub(t, 1, 3, 4, 5, 7)
+	testCases := []struct {
+		from, to uint
+		expected []uint
+	}{
+		{from: 0, to: 100, expected: []uint{1, 3, 4, 5, 7}},
+		{from: 3, to: 5, expected: []uint{3, 4, 5}},
+		{from: 2, to: 6, expected: []uint{3, 4, 5}},
+		{from: 7, to: 7, expected: []uint{7}},
+		{from: 8, to: 9, expected: []uint{}},
+		{from: 5, to: 3, expected: []uint{}},
+	}
+	for _, tc := range testCases {
+		versions, err := source.SortedVersionRange(d, tc.from, tc.to)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(versions, tc.expected) {
+			t.Fatalf("%d to %d: expected %v, got %v", tc.from, tc.to, tc.expected, versions)
+		}
+	}
+}
+
+var errNext = errors.New("next failed")
+
+type failingNext struct {
+	source.Driver
+}
+
+func (failingNext) Next(uint) (uint, error) { return 0, errNext }
+
+func TestSortedVersionsError(t *testing.T) {
+	if _, err := source.SortedVersions(failingNext{openStub(t, 1, 2)}); !errors.Is(err, errNext) {
+		t.Fatalf("expected %v, got %v", errNext, err)
+	}
+}
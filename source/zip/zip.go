@@ -0,0 +1,179 @@
+package zip
+
+import (
+	"archive/zip"
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	nurl "net/url"
+	"os"
+	"path"
+	"strings"
+
+	iurl "github.com/golang-migrate/migrate/v4/internal/url"
+	"github.com/golang-migrate/migrate/v4/source"
+	"github.com/golang-migrate/migrate/v4/source/iofs"
+)
+
+func init() {
+	source.Register("zip", &Zip{})
+	source.Register("zip+http", &Zip{})
+	source.Register("zip+https", &Zip{})
+}
+
+var ErrNoArchive = errors.New("no archive, expected an URL like zip:///path/to/migrations.zip or zip+https://host/migrations.zip")
+
+// Zip reads migrations from a zip archive, a local file or downloaded on
+// Open, without extracting it.
+type Zip struct {
+	iofs.PartialDriver
+	config *Config
+	// file is the local archive, nil when downloaded
+	file     *os.File
+	checksum string
+}
+
+type Config struct {
+	// Archive is the path of a local archive or the http(s) URL of a remote
+	// one.
+	Archive string
+	// Path is the directory of the migrations in the archive, defaults to
+	// its root.
+	Path string
+	// Client downloads remote archives, http.DefaultClient if nil.
+	Client *http.Client
+}
+
+// Open opens zip:///path/to/migrations.zip or downloads
+// zip+https://host/migrations.zip, with x-path=inner/directory.
+func (z *Zip) Open(url string) (source.Driver, error) {
+	u, err := nurl.Parse(url)
+	if err != nil {
+		return nil, err
+	}
+	qv := u.Query()
+	config := &Config{
+		Path: qv.Get("x-path"),
+	}
+
+	switch u.Scheme {
+	case "zip":
+		config.Archive = u.Host + u.Path
+	case "zip+http", "zip+https":
+		u = iurl.FilterCustomQuery(u)
+		u.Scheme = strings.TrimPrefix(u.Scheme, "zip+")
+		config.Archive = u.String()
+	default:
+		return nil, ErrNoArchive
+	}
+	return New(config)
+}
+
+// New opens or downloads config.Archive and reads the migrations in
+// config.Path.
+func New(config *Config) (source.Driver, error) {
+	if config.Archive == "" {
+		return nil, ErrNoArchive
+	}
+
+	z := &Zip{
+		config: config,
+	}
+	reader, size, err := z.open()
+	if err != nil {
+		return nil, err
+	}
+	zr, err := zip.NewReader(reader, size)
+	if err != nil {
+		z.closeFile()
+		return nil, fmt.Errorf("reading %v: %w", z.location(), err)
+	}
+
+	migrationsPath := path.Clean("/" + config.Path)[1:]
+	if migrationsPath == "" {
+		migrationsPath = "."
+	}
+	if err := z.Init(zr, migrationsPath); err != nil {
+		z.closeFile()
+		return nil, err
+	}
+	return z, nil
+}
+
+// open returns the archive and its size, and computes its checksum.
+func (z *Zip) open() (io.ReaderAt, int64, error) {
+	if !strings.HasPrefix(z.config.Archive, "http://") && !strings.HasPrefix(z.config.Archive, "https://") {
+		f, err := os.Open(z.config.Archive)
+		if err != nil {
+			return nil, 0, err
+		}
+		h := sha256.New()
+		size, err := io.Copy(h, f)
+		if err != nil {
+			f.Close()
+			return nil, 0, fmt.Errorf("reading %v: %w", z.config.Archive, err)
+		}
+		z.file = f
+		z.checksum = hex.EncodeToString(h.Sum(nil))
+		return f, size, nil
+	}
+
+	client := z.config.Client
+	if client == nil {
+		client = http.DefaultClient
+	}
+	resp, err := client.Get(z.config.Archive)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, 0, fmt.Errorf("downloading %v: %v", z.location(), resp.Status)
+	}
+	content, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, 0, fmt.Errorf("downloading %v: %w", z.location(), err)
+	}
+	sum := sha256.Sum256(content)
+	z.checksum = hex.EncodeToString(sum[:])
+	return bytes.NewReader(content), int64(len(content)), nil
+}
+
+// location is the archive without the credentials of its URL.
+func (z *Zip) location() string {
+	u, err := nurl.Parse(z.config.Archive)
+	if err != nil || u.Scheme == "" {
+		return z.config.Archive
+	}
+	return u.Redacted()
+}
+
+func (z *Zip) closeFile() error {
+	if z.file == nil {
+		return nil
+	}
+	return z.file.Close()
+}
+
+// Describe implements source.Describer. Checksum is the hex SHA-256 of the
+// archive.
+func (z *Zip) Describe() (source.DriverInfo, error) {
+	return source.DriverInfo{
+		Name:     "zip",
+		Location: z.location(),
+		Checksum: z.checksum,
+	}, nil
+}
+
+// Close closes the archive.
+func (z *Zip) Close() error {
+	err := z.PartialDriver.Close()
+	if cerr := z.closeFile(); err == nil {
+		err = cerr
+	}
+	return err
+}
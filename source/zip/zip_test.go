@@ -0,0 +1,150 @@
+package zip
+
+import (
+	"archive/zip"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/golang-migrate/migrate/v4/source"
+	st "github.com/golang-migrate/migrate/v4/source/testing"
+)
+
+// newArchive writes the test migrations to the root and to db/migrations/
+// of a new archive and returns its path.
+func newArchive(t *testing.T) string {
+	t.Helper()
+	archive := filepath.Join(t.TempDir(), "migrations.zip")
+	f, err := os.Create(archive)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	files := []string{
+		"1_foobar.up.sql", "1_foobar.down.sql",
+		"3_foobar.up.sql",
+		"4_foobar.up.sql", "4_foobar.down.sql",
+		"5_foobar.down.sql",
+		"7_foobar.up.sql", "7_foobar.down.sql",
+	}
+	w := zip.NewWriter(f)
+	for _, dir := range []string{"", "db/migrations/"} {
+		for _, name := range files {
+			fw, err := w.Create(dir + name)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if _, err := fw.Write([]byte(name)); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return archive
+}
+
+func checksum(t *testing.T, archive string) string {
+	t.Helper()
+	content, err := os.ReadFile(archive)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sum := sha256.Sum256(content)
+	return hex.EncodeToString(sum[:])
+}
+
+func Test(t *testing.T) {
+	archive := newArchive(t)
+
+	d, err := (&Zip{}).Open("zip://" + archive)
+	if err != nil {
+		t.Fatal(err)
+	}
+	st.Test(t, d)
+
+	info, err := d.(source.Describer).Describe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := source.DriverInfo{Name: "zip", Location: archive, Checksum: checksum(t, archive)}
+	if info != expected {
+		t.Errorf("expected %+v, got %+v", expected, info)
+	}
+	if err := d.Close(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestPath(t *testing.T) {
+	d, err := (&Zip{}).Open("zip://" + newArchive(t) + "?x-path=/db/migrations/")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer d.Close()
+	st.Test(t, d)
+}
+
+func TestHTTP(t *testing.T) {
+	archive := newArchive(t)
+	var query string
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/migrations.zip" {
+			http.NotFound(w, r)
+			return
+		}
+		query = r.URL.RawQuery
+		http.ServeFile(w, r, archive)
+	}))
+	defer ts.Close()
+
+	d, err := (&Zip{}).Open("zip+" + ts.URL + "/migrations.zip?token=secret&x-path=db/migrations")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer d.Close()
+	st.Test(t, d)
+	if query != "token=secret" {
+		t.Errorf("expected the x- options to be removed from the query, got %v", query)
+	}
+
+	info, err := d.(source.Describer).Describe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Checksum != checksum(t, archive) {
+		t.Errorf("expected checksum %v, got %v", checksum(t, archive), info.Checksum)
+	}
+
+	if _, err := (&Zip{}).Open("zip+" + ts.URL + "/missing.zip"); err == nil {
+		t.Error("expected an error for a missing archive")
+	}
+}
+
+func TestOpenErrors(t *testing.T) {
+	dir := t.TempDir()
+	notZip := filepath.Join(dir, "migrations.zip")
+	if err := os.WriteFile(notZip, []byte("not a zip"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := (&Zip{}).Open("zip://" + filepath.Join(dir, "missing.zip")); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("expected %v, got %v", os.ErrNotExist, err)
+	}
+	if _, err := (&Zip{}).Open("zip://" + notZip); err == nil {
+		t.Error("expected an error for an invalid archive")
+	}
+	if _, err := (&Zip{}).Open("zip://" + newArchive(t) + "?x-path=missing"); err == nil {
+		t.Error("expected an error for a missing x-path")
+	}
+	if _, err := New(&Config{}); !errors.Is(err, ErrNoArchive) {
+		t.Errorf("expected %v, got %v", ErrNoArchive, err)
+	}
+}
@@ -1,6 +1,8 @@
-// Package testing is used in driver tests and should only be used by migrate tests.
+// Package testing has helpers to test migrations, see RunMigrations.
 //
-// Deprecated: If you'd like to test using Docker images, use package github.com/dhui/dktest instead
+// Its Docker helpers are used in driver tests and should only be used by
+// migrate tests. If you'd like to test using Docker images, use package
+// github.com/dhui/dktest instead.
 package testing
 
 import (
@@ -23,6 +25,7 @@ import (
 	"github.com/hashicorp/go-multierror"
 )
 
+// Deprecated: If you'd like to test using Docker images, use package github.com/dhui/dktest instead
 func NewDockerContainer(t testing.TB, image string, env []string, cmd []string) (*DockerContainer, error) {
 	c, err := dockerclient.NewClientWithOpts(
 		dockerclient.FromEnv,
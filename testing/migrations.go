@@ -0,0 +1,171 @@
+package testing
+
+import (
+	"database/sql"
+	"errors"
+	"net/url"
+	"os"
+	"testing"
+
+	"github.com/golang-migrate/migrate/v4"
+	"github.com/golang-migrate/migrate/v4/database"
+	"github.com/golang-migrate/migrate/v4/source"
+)
+
+// MigrationTestHelper gives access to a database migrated by RunMigrations.
+type MigrationTestHelper struct {
+	t       *testing.T
+	m       *migrate.Migrate
+	dsn     string
+	options options
+
+	// base is the version the migrations are undone to, database.NilVersion
+	// to undo all of them.
+	base int
+	db   *sql.DB
+}
+
+// Option configures RunMigrations.
+type Option func(*options)
+
+type options struct {
+	from, to       uint
+	hasRange       bool
+	sqlDriver      string
+	dataSourceName string
+}
+
+// WithRange runs the migrations from version from to version to only,
+// assuming the database already has the schema of the versions before from.
+// The versions before from are marked as applied without running them.
+func WithRange(from, to uint) Option {
+	return func(o *options) {
+		o.from, o.to, o.hasRange = from, to, true
+	}
+}
+
+// WithSQLDriver sets the database/sql driver and data source name used to
+// open DB, by default the scheme of the database URL and the URL itself.
+func WithSQLDriver(driverName, dataSourceName string) Option {
+	return func(o *options) {
+		o.sqlDriver, o.dataSourceName = driverName, dataSourceName
+	}
+}
+
+// RunMigrations applies the migrations of sourceURL to the database of dsn,
+// the URL of a migrate database driver, and undoes them when the test and
+// its subtests complete. The source and database drivers have to be
+// imported by the test, like in the migrate CLI.
+//
+// Errors fail the test with t.Fatal.
+func RunMigrations(t *testing.T, dsn, sourceURL string, opts ...Option) *MigrationTestHelper {
+	t.Helper()
+
+	h := &MigrationTestHelper{t: t, dsn: dsn, base: database.NilVersion}
+	for _, opt := range opts {
+		opt(&h.options)
+	}
+	if h.options.hasRange && h.options.from > h.options.to {
+		t.Fatalf("invalid range %v to %v", h.options.from, h.options.to)
+	}
+
+	m, err := migrate.New(sourceURL, dsn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	h.m = m
+	t.Cleanup(h.cleanup)
+
+	if !h.options.hasRange {
+		if err := m.Up(); err != nil && !errors.Is(err, migrate.ErrNoChange) {
+			t.Fatal(err)
+		}
+		return h
+	}
+
+	base, err := prevVersion(sourceURL, h.options.from)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if base != database.NilVersion {
+		if err := m.Force(base); err != nil {
+			t.Fatal(err)
+		}
+	}
+	h.base = base
+	if err := m.Migrate(h.options.to); err != nil && !errors.Is(err, migrate.ErrNoChange) {
+		t.Fatal(err)
+	}
+	return h
+}
+
+// prevVersion returns the version before version in the source, or
+// database.NilVersion if version is the first one.
+func prevVersion(sourceURL string, version uint) (int, error) {
+	src, err := source.Open(sourceURL)
+	if err != nil {
+		return 0, err
+	}
+	defer src.Close()
+
+	prev, err := src.Prev(version)
+	if errors.Is(err, os.ErrNotExist) {
+		return database.NilVersion, nil
+	}
+	if err != nil {
+		return 0, err
+	}
+	return int(prev), nil
+}
+
+// cleanup undoes the migrations and closes the connections.
+func (h *MigrationTestHelper) cleanup() {
+	var err error
+	if h.base == database.NilVersion {
+		err = h.m.Down()
+	} else {
+		err = h.m.Migrate(uint(h.base))
+	}
+	if err != nil && !errors.Is(err, migrate.ErrNoChange) {
+		h.t.Errorf("undoing migrations: %v", err)
+	}
+
+	if h.db != nil {
+		if err := h.db.Close(); err != nil {
+			h.t.Error(err)
+		}
+	}
+	if srcErr, dbErr := h.m.Close(); srcErr != nil || dbErr != nil {
+		h.t.Errorf("closing migrate: %v, %v", srcErr, dbErr)
+	}
+}
+
+// Migrate returns the Migrate instance of the helper, e.g. to test down
+// migrations with Steps. It is closed when the test completes.
+func (h *MigrationTestHelper) Migrate() *migrate.Migrate {
+	return h.m
+}
+
+// DB returns a connection to the migrated database for assertions, opened
+// on the first call and closed when the test completes. See WithSQLDriver.
+func (h *MigrationTestHelper) DB() *sql.DB {
+	h.t.Helper()
+	if h.db != nil {
+		return h.db
+	}
+
+	driverName, dataSourceName := h.options.sqlDriver, h.options.dataSourceName
+	if driverName == "" {
+		u, err := url.Parse(h.dsn)
+		if err != nil {
+			h.t.Fatal(err)
+		}
+		driverName, dataSourceName = u.Scheme, h.dsn
+	}
+	db, err := sql.Open(driverName, dataSourceName)
+	if err != nil {
+		h.t.Fatal(err)
+	}
+	h.db = db
+	return db
+}
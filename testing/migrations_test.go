@@ -0,0 +1,142 @@
+package testing
+
+import (
+	"database/sql"
+	sqldriver "database/sql/driver"
+	"errors"
+	"reflect"
+	"testing"
+
+	"github.com/golang-migrate/migrate/v4/database"
+	dStub "github.com/golang-migrate/migrate/v4/database/stub"
+	_ "github.com/golang-migrate/migrate/v4/source/file"
+)
+
+const testSource = "file://testdata/migrations"
+
+// sharedStub opens the same stub database every time, so that tests can
+// inspect it after the helper closed it.
+type sharedStub struct {
+	*dStub.Stub
+}
+
+var shared *dStub.Stub
+
+func (sharedStub) Open(url string) (database.Driver, error) {
+	return shared, nil
+}
+
+// fakeSQLDriver is a database/sql driver refusing any connection.
+type fakeSQLDriver struct{}
+
+func (fakeSQLDriver) Open(string) (sqldriver.Conn, error) {
+	return nil, errors.New("not implemented")
+}
+
+func init() {
+	database.Register("sharedstub", sharedStub{})
+	sql.Register("sharedstub", fakeSQLDriver{})
+	sql.Register("othersql", fakeSQLDriver{})
+}
+
+// resetShared resets the shared stub database.
+func resetShared(t *testing.T) {
+	d, err := (&dStub.Stub{}).Open("sharedstub://")
+	if err != nil {
+		t.Fatal(err)
+	}
+	shared = d.(*dStub.Stub)
+}
+
+func TestRunMigrations(t *testing.T) {
+	resetShared(t)
+
+	t.Run("migrated", func(t *testing.T) {
+		h := RunMigrations(t, "sharedstub://", testSource)
+		if v, dirty, err := h.Migrate().Version(); err != nil || v != 3 || dirty {
+			t.Errorf("expected clean version 3, got %v, %v, %v", v, dirty, err)
+		}
+	})
+
+	expected := []string{
+		"CREATE TABLE users (id int);\n",
+		"ALTER TABLE users ADD COLUMN email text;\n",
+		"CREATE INDEX users_email ON users (email);\n",
+		"DROP INDEX users_email;\n",
+		"ALTER TABLE users DROP COLUMN email;\n",
+		"DROP TABLE users;\n",
+	}
+	if !reflect.DeepEqual(shared.MigrationSequence, expected) {
+		t.Errorf("expected %q, got %q", expected, shared.MigrationSequence)
+	}
+	if shared.CurrentVersion != database.NilVersion || shared.IsDirty {
+		t.Errorf("expected all migrations to be undone, got version %v (dirty: %v)", shared.CurrentVersion, shared.IsDirty)
+	}
+}
+
+func TestRunMigrationsWithRange(t *testing.T) {
+	testCases := []struct {
+		name     string
+		from, to uint
+		expected []string
+		// base is the version after the test
+		base int
+	}{
+		{
+			name:     "first",
+			from:     1,
+			to:       1,
+			expected: []string{"CREATE TABLE users (id int);\n", "DROP TABLE users;\n"},
+			base:     database.NilVersion,
+		},
+		{
+			name: "middle",
+			from: 2,
+			to:   3,
+			expected: []string{
+				"ALTER TABLE users ADD COLUMN email text;\n",
+				"CREATE INDEX users_email ON users (email);\n",
+				"DROP INDEX users_email;\n",
+				"ALTER TABLE users DROP COLUMN email;\n",
+			},
+			base: 1,
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			resetShared(t)
+
+			t.Run("migrated", func(t *testing.T) {
+				h := RunMigrations(t, "sharedstub://", testSource, WithRange(tc.from, tc.to))
+				if v, dirty, err := h.Migrate().Version(); err != nil || v != tc.to || dirty {
+					t.Errorf("expected clean version %v, got %v, %v, %v", tc.to, v, dirty, err)
+				}
+			})
+
+			if !reflect.DeepEqual(shared.MigrationSequence, tc.expected) {
+				t.Errorf("expected %q, got %q", tc.expected, shared.MigrationSequence)
+			}
+			if shared.CurrentVersion != tc.base || shared.IsDirty {
+				t.Errorf("expected clean version %v, got %v (dirty: %v)", tc.base, shared.CurrentVersion, shared.IsDirty)
+			}
+		})
+	}
+}
+
+func TestDB(t *testing.T) {
+	resetShared(t)
+
+	h := RunMigrations(t, "sharedstub://", testSource)
+	db := h.DB()
+	if _, ok := db.Driver().(fakeSQLDriver); !ok {
+		t.Errorf("expected the sharedstub sql driver, got %T", db.Driver())
+	}
+	if h.DB() != db {
+		t.Error("expected the same DB")
+	}
+
+	other := RunMigrations(t, "sharedstub://", testSource, WithSQLDriver("othersql", "dsn"))
+	if other.DB() == db {
+		t.Error("expected another DB")
+	}
+}
@@ -20,6 +20,7 @@ type Version struct {
 	Cmd   []string
 }
 
+// Deprecated: If you'd like to test using Docker images, use package github.com/dhui/dktest instead
 func ParallelTest(t *testing.T, versions []Version, readyFn IsReadyFunc, testFn TestFunc) {
 	timeout, err := strconv.Atoi(os.Getenv("MIGRATE_TEST_CONTAINER_BOOT_TIMEOUT"))
 	if err != nil {
@@ -4,6 +4,8 @@ import (
 	"fmt"
 	nurl "net/url"
 	"strings"
+
+	iurl "github.com/golang-migrate/migrate/v4/internal/url"
 )
 
 // MultiError holds multiple errors.
@@ -49,13 +51,5 @@ func suint(n int) uint {
 
 // FilterCustomQuery filters all query values starting with `x-`
 func FilterCustomQuery(u *nurl.URL) *nurl.URL {
-	ux := *u
-	vx := make(nurl.Values)
-	for k, v := range ux.Query() {
-		if len(k) <= 1 || k[0:2] != "x-" {
-			vx[k] = v
-		}
-	}
-	ux.RawQuery = vx.Encode()
-	return &ux
+	return iurl.FilterCustomQuery(u)
 }